@@ -9,7 +9,11 @@ import (
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Println("Usage: mygit <command> [args...]")
-		fmt.Println("Commands: init, add, commit, log, status, diff, branch, checkout, merge")
+		fmt.Println("Commands: init, add, commit, log, show, status, diff, branch, checkout, restore, reset, rm, mv,")
+		fmt.Println("          stash, rebase, cherry-pick, revert, tag, blame, grep, bisect, clean, archive,")
+		fmt.Println("          check-ignore, merge-base, commit-graph, config, push, verify-commit, verify-tag")
+		fmt.Println("Plumbing: cat-file, hash-object, ls-tree, ls-files, update-index, write-tree, commit-tree,")
+		fmt.Println("          update-ref, receive-pack")
 		os.Exit(1)
 	}
 
@@ -33,10 +37,68 @@ func main() {
 		commands.Branch(args)
 	case "checkout":
 		commands.Checkout(args)
+	case "restore":
+		commands.Restore(args)
+	case "reset":
+		commands.Reset(args)
+	case "rm":
+		commands.Rm(args)
+	case "mv":
+		commands.Mv(args)
+	case "stash":
+		commands.Stash(args)
+	case "rebase":
+		commands.Rebase(args)
+	case "cherry-pick":
+		commands.CherryPick(args)
+	case "revert":
+		commands.Revert(args)
+	case "tag":
+		commands.Tag(args)
+	case "blame":
+		commands.Blame(args)
+	case "grep":
+		commands.Grep(args)
+	case "bisect":
+		commands.Bisect(args)
+	case "diff":
+		commands.Diff(args)
+	case "clean":
+		commands.Clean(args)
+	case "archive":
+		commands.Archive(args)
+	case "verify-commit":
+		commands.VerifyCommit(args)
+	case "verify-tag":
+		commands.VerifyTag(args)
+	case "receive-pack":
+		commands.ReceivePack(args)
 	case "show":
 		commands.Show(args)
 	case "config":
 		commands.Config(args)
+	case "check-ignore":
+		commands.CheckIgnore(args)
+	case "cat-file":
+		commands.CatFile(args)
+	case "hash-object":
+		commands.HashObject(args)
+	case "ls-tree":
+		commands.LsTree(args)
+	case "ls-files":
+		commands.LsFiles(args)
+	case "update-index":
+		commands.UpdateIndex(args)
+	case "write-tree":
+		commands.WriteTree(args)
+	case "commit-tree":
+		commands.CommitTree(args)
+	case "update-ref":
+		commands.UpdateRef(args)
+	case "merge-base":
+		commands.MergeBase(args)
+	case "commit-graph":
+		commands.CommitGraph(args)
 	default:
 		fmt.Printf("Unknown command: %s\n", command)
 		os.Exit(1)
@@ -6,14 +6,52 @@ import (
 	"mygit/internal/index"
 	"mygit/internal/objects"
 	"mygit/internal/repository"
+	"mygit/internal/utils"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
+// addOptions holds the flags of the add command.
+type addOptions struct {
+	force  bool // add ignored files too
+	all    bool // -A: stage new, modified and deleted files
+	update bool // -u: only stage modified and deleted tracked files
+	patch  bool // -p: interactively pick hunks to stage
+	ignore *utils.Ignore
+}
+
 func Add(args []string) {
-	if len(args) == 0 {
-		fmt.Println("Usage: mygit add <file>...")
+	opts := &addOptions{}
+	var paths []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-f" || arg == "--force":
+			opts.force = true
+		case arg == "-A" || arg == "--all":
+			opts.all = true
+		case arg == "-u" || arg == "--update":
+			opts.update = true
+		case arg == "-p" || arg == "--patch":
+			opts.patch = true
+		case arg == "--":
+			paths = append(paths, args[i+1:]...)
+			i = len(args)
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			fmt.Printf("Error: unknown option '%s'\n", arg)
+			os.Exit(1)
+		default:
+			paths = append(paths, arg)
+		}
+	}
+
+	if opts.all && opts.update {
+		fmt.Println("fatal: -A and -u are mutually incompatible")
+		os.Exit(1)
+	}
+	if len(paths) == 0 && !opts.all && !opts.update && !opts.patch {
+		fmt.Println("Usage: mygit add [-f] [-A | -u | -p] <file>...")
 		os.Exit(1)
 	}
 
@@ -30,122 +68,270 @@ func Add(args []string) {
 		os.Exit(1)
 	}
 
-	fmt.Printf("DEBUG: Repository found at: %s\n", repo.GitDir)
-
 	//Init objects store and index
 	objStore := objects.NewObjectStore(repo.GitDir)
 	idx := index.NewIndex(repo.GitDir)
 
-	fmt.Printf("DEBUG: Loading existing index...\n")
 	if err := idx.Load(); err != nil {
 		fmt.Printf("Error loading index: %v\n", err)
 		os.Exit(1)
 	}
 
+	opts.ignore, err = utils.NewIgnore(repo.WorkDir)
+	if err != nil {
+		fmt.Printf("Error loading ignore rules: %v\n", err)
+		os.Exit(1)
+	}
+
+	// -A, -u and -p without paths operate on the whole tree
+	if len(paths) == 0 {
+		paths = []string{repo.WorkDir}
+	}
+
+	if opts.patch {
+		specs, err := normalizePathspecs(repo, paths)
+		if err != nil {
+			fmt.Printf("fatal: %v\n", err)
+			os.Exit(1)
+		}
+		if err := addPatch(repo, objStore, idx, specs); err != nil {
+			fmt.Printf("error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := idx.Save(); err != nil {
+			fmt.Printf("Error saving index: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Stage modifications and deletions of tracked files first, so that
+	// paths that no longer exist on disk are not an error.
+	specs, err := normalizePathspecs(repo, paths)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(1)
+	}
+	matchedTracked, err := updateTrackedFiles(repo, objStore, idx, specs, opts.update, true)
+	if err != nil {
+		fmt.Printf("Error updating tracked files: %v\n", err)
+		os.Exit(1)
+	}
+
 	//Process each argument
-	for _, arg := range args {
-		fmt.Printf("DEBUG: Processing argument: '%s'\n", arg)
-		if err := addPath(repo, objStore, idx, arg); err != nil {
+	for i, arg := range paths {
+		if opts.update {
+			if !matchedTracked[specs[i]] {
+				fmt.Printf("Error adding %s: pathspec did not match any tracked files\n", arg)
+				os.Exit(1)
+			}
+			continue
+		}
+
+		if err := addPath(repo, objStore, idx, opts, arg); err != nil {
+			if os.IsNotExist(err) && matchedTracked[specs[i]] {
+				continue // a deleted tracked file, already staged
+			}
 			fmt.Printf("Error adding %s: %v\n", arg, err)
 			os.Exit(1)
 		}
 	}
 
 	// Save the index
-	fmt.Printf("DEBUG: Saving index...\n")
 	if err := idx.Save(); err != nil {
 		fmt.Printf("Error saving index: %v\n", err)
 		os.Exit(1)
 	}
-
-	fmt.Printf("DEBUG: Add command completed successfully\n")
 }
 
-func addPath(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, path string) error {
-	fmt.Printf("DEBUG: addPath called with: '%s'\n", path)
+// updateTrackedFiles stages the current state of the tracked files matched
+// by specs: deleted files are removed from the index and, with
+// includeModified, modified files are re-added. With report, each change is
+// printed. It returns the pathspecs that matched at least one tracked file.
+func updateTrackedFiles(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, specs []string, includeModified, report bool) (map[string]bool, error) {
+	unstaged, err := utils.GetUnstagedChanges(repo, idx, objStore)
+	if err != nil {
+		return nil, err
+	}
+	changed := make(map[string]bool)
+	for _, path := range unstaged {
+		changed[path] = true
+	}
+
+	matched := make(map[string]bool)
+	var tracked []string
+	for path := range idx.GetAll() {
+		tracked = append(tracked, path)
+	}
+
+	for _, path := range tracked {
+		selected := false
+		for _, spec := range specs {
+			if matchPathspec(path, []string{spec}) {
+				matched[spec] = true
+				selected = true
+			}
+		}
+		if !selected || !changed[path] {
+			continue
+		}
+
+		fullPath := filepath.Join(repo.WorkDir, path)
+		info, err := os.Lstat(fullPath)
+		if os.IsNotExist(err) {
+			idx.Remove(path)
+			if report {
+				fmt.Printf("Removed '%s'\n", path)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			// A tracked file was replaced by a directory
+			idx.Remove(path)
+			continue
+		}
+		if !includeModified {
+			continue
+		}
+		hash, err := addFile(repo, objStore, idx, fullPath, info)
+		if err != nil {
+			return nil, err
+		}
+		if report {
+			fmt.Printf("Added '%s' (hash: %s)\n", path, hash[:8])
+		}
+	}
+
+	return matched, nil
+}
 
+func addPath(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, opts *addOptions, path string) error {
 	// convert to absolute path if needed
 	if !filepath.IsAbs(path) {
 		cwd, _ := os.Getwd()
 		path = filepath.Join(cwd, path)
 	}
 
-	fmt.Printf("DEBUG: Absolute path: '%s'\n", path)
-
-	//Get file info
-	info, err := os.Stat(path)
+	//Get file info (without following symlinks)
+	info, err := os.Lstat(path)
 	if err != nil {
 		return err
 	}
 	if info.IsDir() {
-		return addDirectory(repo, objStore, idx, path)
+		return addDirectory(repo, objStore, idx, opts, path)
 	}
 
-	return addFile(repo, objStore, idx, path, info)
-}
+	// Naming an ignored file explicitly needs -f, unless it is already tracked
+	relPath, err := filepath.Rel(repo.WorkDir, path)
+	if err != nil {
+		return fmt.Errorf("cannot get relative path: %w", err)
+	}
+	relPath = filepath.ToSlash(relPath)
+	if _, tracked := idx.Get(relPath); !tracked && !opts.force && opts.ignore.Matches(relPath, false) {
+		return fmt.Errorf("the following paths are ignored by one of your .gitignore files:\n%s\nUse -f if you really want to add them", relPath)
+	}
 
-func addFile(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, path string, info os.FileInfo) error {
-	fmt.Printf("DEBUG: addFile called for: '%s'\n", path)
+	return addAndReport(repo, objStore, idx, path, info)
+}
 
-	content, err := os.ReadFile(path)
+// addAndReport stages a file as addFile does and prints that it did.
+func addAndReport(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, path string, info os.FileInfo) error {
+	hash, err := addFile(repo, objStore, idx, path, info)
 	if err != nil {
-		return fmt.Errorf("cannot read file: %w", err)
+		return err
 	}
+	relPath, _ := filepath.Rel(repo.WorkDir, path)
+	fmt.Printf("Added '%s' (hash: %s)\n", filepath.ToSlash(relPath), hash[:8])
+	return nil
+}
 
-	fmt.Printf("DEBUG: File content read, length: %d bytes\n", len(content))
+// addFile writes a file's content to the object store and stages it,
+// returning the blob's hash.
+func addFile(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, path string, info os.FileInfo) (string, error) {
+	// Symlinks are stored as blobs holding the link target
+	content, _, err := utils.ReadWorktreeFile(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read file: %w", err)
+	}
 
 	//create blob object
 	hash, err := objStore.WriteObject(content, objects.BlobType)
 	if err != nil {
-		return fmt.Errorf("cannot write object: %w", err)
+		return "", fmt.Errorf("cannot write object: %w", err)
 	}
 
-	fmt.Printf("DEBUG: Object written, hash: '%s' (length: %d)\n", hash, len(hash))
-
 	// Validate hash format
 	if len(hash) != 40 {
-		return fmt.Errorf("WriteObject returned invalid hash length: expected 40, got %d (hash: '%s')", len(hash), hash)
+		return "", fmt.Errorf("WriteObject returned invalid hash length: expected 40, got %d (hash: '%s')", len(hash), hash)
 	}
 
 	//Get relative path from repository root
 	relPath, err := filepath.Rel(repo.WorkDir, path)
 	if err != nil {
-		return fmt.Errorf("cannot get relative path: %w", err)
+		return "", fmt.Errorf("cannot get relative path: %w", err)
 	}
 
 	relPath = filepath.ToSlash(relPath)
-	fmt.Printf("DEBUG: Relative path: '%s'\n", relPath)
-
-	idx.Add(relPath, hash, info)
 
-	fmt.Printf("Added '%s' (hash: %s)\n", relPath, hash[:8])
-	return nil
+	existing, _ := idx.Get(relPath)
+	perm := utils.WorktreePermissions(info, existing, utils.LoadWorktreeOptions(repo))
+	idx.AddWithMode(relPath, hash, info, perm)
+	return hash, nil
 }
 
-func addDirectory(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, dirPath string) error {
+func addDirectory(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, opts *addOptions, dirPath string) error {
 	return filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
+		relPath, err := filepath.Rel(repo.WorkDir, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
 		// Skip .mygit directory
-		if strings.Contains(path, ".mygit") {
+		if relPath == ".mygit" || strings.HasPrefix(relPath, ".mygit/") {
 			if d.IsDir() {
 				return filepath.SkipDir
 			}
 			return nil
 		}
 
-		// Skip directories themselves, only process files
+		// Ignored files are skipped unless they are already tracked
+		ignored := !opts.force && relPath != "." && opts.ignore.Matches(relPath, d.IsDir())
 		if d.IsDir() {
+			if ignored && !hasTrackedUnder(idx, relPath) {
+				return filepath.SkipDir
+			}
+			// Skip directories themselves, only process files
 			return nil
 		}
+		if ignored {
+			if _, tracked := idx.Get(relPath); !tracked {
+				return nil
+			}
+		}
 
 		info, err := d.Info()
 		if err != nil {
 			return err
 		}
 
-		return addFile(repo, objStore, idx, path, info)
+		return addAndReport(repo, objStore, idx, path, info)
 	})
 }
+
+// hasTrackedUnder reports whether the index has entries inside directory dir.
+func hasTrackedUnder(idx *index.Index, dir string) bool {
+	for path := range idx.GetAll() {
+		if strings.HasPrefix(path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
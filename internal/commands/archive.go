@@ -0,0 +1,557 @@
+package commands
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"mygit/internal/config"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"mygit/internal/utils"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// archiveFormats are the formats archive writes, as --list shows them.
+var archiveFormats = []string{"tar", "tgz", "tar.gz", "zip"}
+
+// archiveOptions holds the options of archive.
+type archiveOptions struct {
+	format             string
+	prefix             string
+	output             string
+	level              int // compression level, -1 for the default
+	verbose            bool
+	worktreeAttributes bool
+}
+
+// Archive handles the `archive` command, which writes the files of a tree
+// as a tar or zip archive:
+//
+//	mygit archive [--format=<fmt>] [--prefix=<prefix>/] [-o <file>] [-v] [-<n>] [--worktree-attributes] <tree-ish> [<path>...]
+//	mygit archive --list
+//
+// The files are read straight from the object store. Given a commit (or a
+// tag of one), its ID is stored in a pax global header or the zip comment,
+// and its commit time is used for every entry. Paths with the
+// export-ignore attribute are left out.
+//
+// As the archive may be going to standard output, errors go to standard
+// error.
+func Archive(args []string) {
+	opts := archiveOptions{level: -1}
+	var positional []string
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "usage: mygit archive [<options>] <tree-ish> [<path>...]")
+		fmt.Fprintln(os.Stderr, "   or: mygit archive --list")
+		os.Exit(129)
+	}
+	value := func(i *int, arg, name string) string {
+		if v, ok := strings.CutPrefix(arg, name+"="); ok {
+			return v
+		}
+		if *i+1 >= len(args) {
+			fmt.Fprintf(os.Stderr, "error: option `%s' requires a value\n", strings.TrimLeft(name, "-"))
+			usage()
+		}
+		*i++
+		return args[*i]
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			positional = append(positional, args[i+1:]...)
+			i = len(args)
+		case arg == "-l" || arg == "--list":
+			for _, format := range archiveFormats {
+				fmt.Println(format)
+			}
+			return
+		case arg == "--format" || strings.HasPrefix(arg, "--format="):
+			opts.format = value(&i, arg, "--format")
+		case arg == "--prefix" || strings.HasPrefix(arg, "--prefix="):
+			opts.prefix = value(&i, arg, "--prefix")
+		case arg == "-o" || arg == "--output" || strings.HasPrefix(arg, "--output="):
+			opts.output = value(&i, arg, strings.SplitN(arg, "=", 2)[0])
+		case arg == "-v" || arg == "--verbose":
+			opts.verbose = true
+		case arg == "--worktree-attributes":
+			opts.worktreeAttributes = true
+		case len(arg) == 2 && arg[0] == '-' && arg[1] >= '0' && arg[1] <= '9':
+			opts.level = int(arg[1] - '0')
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			fmt.Fprintf(os.Stderr, "error: unknown option `%s'\n", strings.TrimLeft(arg, "-"))
+			usage()
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) == 0 {
+		usage()
+	}
+
+	// Without --format, the name of the output file decides
+	if opts.format == "" {
+		opts.format = "tar"
+		for _, format := range archiveFormats {
+			if strings.HasSuffix(opts.output, "."+format) {
+				opts.format = format
+			}
+		}
+	}
+	switch opts.format {
+	case "tar":
+		if opts.level >= 0 {
+			fmt.Fprintf(os.Stderr, "fatal: Argument not supported for format '%s': -%d\n", opts.format, opts.level)
+			os.Exit(128)
+		}
+	case "tgz", "tar.gz", "zip":
+	default:
+		fmt.Fprintf(os.Stderr, "fatal: Unknown archive format '%s'\n", opts.format)
+		os.Exit(128)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting current directory: %v\n", err)
+		os.Exit(128)
+	}
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+
+	rev := positional[0]
+	tree, commitID, mtime, err := archiveTree(objStore, refManager, rev)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	// Run from a subdirectory, only that part of the tree is archived
+	base := ""
+	if rel, err := filepath.Rel(repo.WorkDir, cwd); err == nil && rel != "." {
+		base = filepath.ToSlash(rel)
+	}
+	specs, err := normalizePathspecs(repo, positional[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+	for i, spec := range specs {
+		specs[i] = relativeTo(spec, base)
+	}
+
+	// Every path has to match something, even if it is export-ignored
+	if len(specs) > 0 {
+		files, err := utils.GetTreeEntriesRecursive(objStore, tree, "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+			os.Exit(128)
+		}
+		for i, spec := range specs {
+			found := false
+			for p := range files {
+				if (base == "" || strings.HasPrefix(p, base+"/")) && matchPathspec(relativeTo(p, base), []string{spec}) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				fmt.Fprintf(os.Stderr, "fatal: pathspec '%s' did not match any files\n", positional[i+1])
+				os.Exit(128)
+			}
+		}
+	}
+
+	attrs, err := utils.NewAttributes(repo.GitDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	var out io.Writer = os.Stdout
+	if opts.output != "" {
+		f, err := os.Create(opts.output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: could not create archive file '%s': %v\n", opts.output, err)
+			os.Exit(128)
+		}
+		defer f.Close()
+		out = f
+	}
+	buffered := bufio.NewWriter(out)
+
+	var w archiveWriter
+	switch opts.format {
+	case "tar":
+		w, err = newTarArchive(buffered, nil, repo, commitID, mtime)
+	case "tgz", "tar.gz":
+		var gz *gzip.Writer
+		if gz, err = gzip.NewWriterLevel(buffered, opts.level); err == nil {
+			w, err = newTarArchive(gz, gz, repo, commitID, mtime)
+		}
+	case "zip":
+		w = newZipArchive(buffered, commitID, mtime, opts.level)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	a := &archiver{repo: repo, objStore: objStore, attrs: attrs, opts: opts, w: w, base: base, specs: specs}
+	err = a.run(tree)
+	if err == nil {
+		err = w.close()
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+}
+
+// archiveTree resolves the tree-ish to archive. For a commit, or a tag of
+// one, it also returns the commit ID and the commit time; otherwise the
+// time is now.
+func archiveTree(objStore *objects.ObjectStore, refManager *refs.RefManager, rev string) (string, string, time.Time, error) {
+	hash, err := resolveRevision(objStore, refManager, rev)
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("not a valid object name: %s", rev)
+	}
+	hash, err = peelRevision(objStore, hash, "", rev)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	obj, err := objStore.ReadObject(hash)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	switch obj.Type {
+	case objects.CommitType:
+		commit, err := objects.ParseCommit(obj.Content)
+		if err != nil {
+			return "", "", time.Time{}, err
+		}
+		return commit.Tree, hash, commit.Committer.When, nil
+	case objects.TreeType:
+		return hash, "", time.Now(), nil
+	}
+	return "", "", time.Time{}, fmt.Errorf("not a tree object: %s", hash)
+}
+
+// archiver walks a tree and writes what it selects to an archive.
+type archiver struct {
+	repo     *repository.GitRepository
+	objStore *objects.ObjectStore
+	attrs    *utils.Attributes
+	opts     archiveOptions
+	w        archiveWriter
+	base     string   // the directory archived, "" for the whole tree
+	specs    []string // pathspecs relative to base
+}
+
+func (a *archiver) run(tree string) error {
+	// A prefix naming a directory gets an entry of its own
+	if strings.HasSuffix(a.opts.prefix, "/") {
+		if err := a.write(a.opts.prefix, objects.ModeTree, nil); err != nil {
+			return err
+		}
+	}
+	return a.walk(tree, "")
+}
+
+// walk writes the entries of the tree at dir, a path from the top of the
+// repository, loading its .gitattributes first.
+func (a *archiver) walk(treeHash, dir string) error {
+	obj, err := a.objStore.ReadObject(treeHash)
+	if err != nil {
+		return err
+	}
+	tree, err := objects.ParseTree(obj.Content)
+	if err != nil {
+		return err
+	}
+	if err := a.loadAttributes(tree, dir); err != nil {
+		return err
+	}
+
+	for _, entry := range tree.Entries {
+		p := entry.Name
+		if dir != "" {
+			p = dir + "/" + entry.Name
+		}
+		isDir := entry.Mode == objects.ModeTree
+
+		// Outside the directory archived, only its parents are entered
+		if a.base != "" && p != a.base && !strings.HasPrefix(p, a.base+"/") {
+			if isDir && strings.HasPrefix(a.base, p+"/") {
+				if err := a.walk(entry.Hash, p); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if p == a.base {
+			if isDir {
+				if err := a.walk(entry.Hash, p); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		name := relativeTo(p, a.base)
+		selected := len(a.specs) == 0 || matchPathspec(name, a.specs)
+		if !selected && !(isDir && leadsToPathspec(name, a.specs)) {
+			continue
+		}
+		if a.attrs.IsSet(p, isDir || entry.Mode == objects.ModeGitlink, "export-ignore") {
+			continue
+		}
+
+		switch entry.Mode {
+		case objects.ModeTree:
+			if err := a.write(a.opts.prefix+name+"/", entry.Mode, nil); err != nil {
+				return err
+			}
+			if err := a.walk(entry.Hash, p); err != nil {
+				return err
+			}
+		case objects.ModeGitlink:
+			// A submodule is not in this repository; it shows as empty
+			if err := a.write(a.opts.prefix+name+"/", objects.ModeTree, nil); err != nil {
+				return err
+			}
+		default:
+			blob, err := a.objStore.ReadObject(entry.Hash)
+			if err != nil {
+				return err
+			}
+			if err := a.write(a.opts.prefix+name, entry.Mode, blob.Content); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadAttributes adds the .gitattributes file of a directory, from the tree
+// or with --worktree-attributes from the working directory.
+func (a *archiver) loadAttributes(tree *objects.Tree, dir string) error {
+	if a.opts.worktreeAttributes {
+		content, err := os.ReadFile(filepath.Join(a.repo.WorkDir, filepath.FromSlash(dir), ".gitattributes"))
+		if err == nil {
+			a.attrs.AddFile(dir, content)
+		}
+		return nil
+	}
+	for _, entry := range tree.Entries {
+		if entry.Name == ".gitattributes" && entry.Mode != objects.ModeTree && entry.Mode != objects.ModeGitlink {
+			blob, err := a.objStore.ReadObject(entry.Hash)
+			if err != nil {
+				return err
+			}
+			a.attrs.AddFile(dir, blob.Content)
+		}
+	}
+	return nil
+}
+
+func (a *archiver) write(name, mode string, content []byte) error {
+	if a.opts.verbose {
+		fmt.Fprintln(os.Stderr, name)
+	}
+	return a.w.writeEntry(name, mode, content)
+}
+
+// archiveWriter writes entries in one archive format. Directory names end
+// in "/", and the content of a symbolic link is its target.
+type archiveWriter interface {
+	writeEntry(name, mode string, content []byte) error
+	close() error
+}
+
+// tarArchive writes a tar archive the way Git does: owned by root, with
+// tar.umask (0002 by default) applied to the modes.
+type tarArchive struct {
+	tw    *tar.Writer
+	gz    *gzip.Writer // compressing the output, or nil
+	mtime time.Time
+	umask int64
+}
+
+func newTarArchive(w io.Writer, gz *gzip.Writer, repo *repository.GitRepository, commitID string, mtime time.Time) (*tarArchive, error) {
+	t := &tarArchive{tw: tar.NewWriter(w), gz: gz, mtime: time.Unix(mtime.Unix(), 0), umask: 0002}
+	cfg := config.NewConfig(filepath.Join(repo.GitDir, "config"))
+	if err := cfg.Load(); err != nil {
+		return nil, err
+	}
+	if value, ok := cfg.Get("tar.umask"); ok {
+		umask, err := strconv.ParseInt(value, 8, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad tar.umask value '%s'", value)
+		}
+		t.umask = umask
+	}
+
+	if commitID != "" {
+		err := t.tw.WriteHeader(&tar.Header{
+			Typeflag:   tar.TypeXGlobalHeader,
+			Name:       "pax_global_header",
+			PAXRecords: map[string]string{"comment": commitID},
+			Format:     tar.FormatPAX,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *tarArchive) writeEntry(name, mode string, content []byte) error {
+	hdr := &tar.Header{Name: name, ModTime: t.mtime, Uname: "root", Gname: "root"}
+	switch mode {
+	case objects.ModeTree:
+		hdr.Typeflag, hdr.Mode = tar.TypeDir, 0777
+	case objects.ModeSymlink:
+		hdr.Typeflag, hdr.Mode, hdr.Linkname = tar.TypeSymlink, 0777, string(content)
+		content = nil
+	case objects.ModeExecutable:
+		hdr.Typeflag, hdr.Mode = tar.TypeReg, 0777
+	default:
+		hdr.Typeflag, hdr.Mode = tar.TypeReg, 0666
+	}
+	if mode != objects.ModeSymlink {
+		hdr.Mode &^= t.umask
+	}
+	hdr.Size = int64(len(content))
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := t.tw.Write(content)
+	return err
+}
+
+func (t *tarArchive) close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	if t.gz != nil {
+		return t.gz.Close()
+	}
+	return nil
+}
+
+// zipArchive writes a zip archive. Each file is deflated, or stored when
+// that does not make it smaller; only executables and symbolic links get
+// Unix modes, as with Git.
+type zipArchive struct {
+	zw    *zip.Writer
+	mtime time.Time
+	level int
+}
+
+func newZipArchive(w io.Writer, commitID string, mtime time.Time, level int) *zipArchive {
+	z := &zipArchive{zw: zip.NewWriter(w), mtime: mtime, level: level}
+	if commitID != "" {
+		z.zw.SetComment(commitID)
+	}
+	return z
+}
+
+// writeEntry deflates the content once and writes whichever of the
+// deflated or stored forms is smaller with CreateRaw.
+func (z *zipArchive) writeEntry(name, mode string, content []byte) error {
+	hdr := &zip.FileHeader{
+		Name:               name,
+		Modified:           z.mtime,
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(content),
+		UncompressedSize64: uint64(len(content)),
+	}
+	switch mode {
+	case objects.ModeSymlink:
+		hdr.SetMode(os.ModeSymlink | 0777)
+	case objects.ModeExecutable:
+		hdr.SetMode(0755)
+	}
+	data := content
+	if len(content) > 0 && z.level != 0 {
+		var buf bytes.Buffer
+		fw, err := flate.NewWriter(&buf, z.level)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(content); err != nil {
+			return err
+		}
+		if err := fw.Close(); err != nil {
+			return err
+		}
+		if buf.Len() < len(content) {
+			hdr.Method = zip.Deflate
+			data = buf.Bytes()
+		}
+	}
+	hdr.CompressedSize64 = uint64(len(data))
+	fillRawZipHeader(hdr)
+
+	w, err := z.zw.CreateRaw(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// fillRawZipHeader sets the header fields that CreateHeader derives from
+// the name and modification time but CreateRaw writes as given: the
+// versions, the UTF-8 flag, the MS-DOS time and an extended timestamp.
+func fillRawZipHeader(hdr *zip.FileHeader) {
+	hdr.CreatorVersion = hdr.CreatorVersion&0xff00 | 20
+	hdr.ReaderVersion = 20
+	nonASCII := strings.IndexFunc(hdr.Name, func(r rune) bool { return r >= utf8.RuneSelf }) >= 0
+	if nonASCII && utf8.ValidString(hdr.Name) {
+		hdr.Flags |= 0x800
+	}
+
+	// MS-DOS dates cover 1980 to 2107; the extended timestamp keeps the
+	// real time
+	t := hdr.Modified
+	if dosEpoch := time.Date(1980, 1, 1, 0, 0, 0, 0, t.Location()); t.Before(dosEpoch) {
+		t = dosEpoch
+	} else if dosEnd := time.Date(2107, 12, 31, 23, 59, 58, 0, t.Location()); t.After(dosEnd) {
+		t = dosEnd
+	}
+	hdr.ModifiedDate = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	hdr.ModifiedTime = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	extra := make([]byte, 9)
+	binary.LittleEndian.PutUint16(extra[0:], 0x5455) // extended timestamp
+	binary.LittleEndian.PutUint16(extra[2:], 5)
+	extra[4] = 1 // modification time only
+	binary.LittleEndian.PutUint32(extra[5:], uint32(hdr.Modified.Unix()))
+	hdr.Extra = append(hdr.Extra, extra...)
+}
+
+func (z *zipArchive) close() error {
+	return z.zw.Close()
+}
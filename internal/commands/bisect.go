@@ -0,0 +1,954 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"mygit/internal/index"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"mygit/internal/utils"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Bisect state files in the git directory. The commits marked so far are
+// refs/bisect/bad, refs/bisect/good-<hash> and refs/bisect/skip-<hash>.
+const (
+	bisectStartFile    = "BISECT_START"        // the branch or commit bisect started from
+	bisectLogFile      = "BISECT_LOG"          // the commands so far, for bisect log and replay
+	bisectNamesFile    = "BISECT_NAMES"        // the paths bisect is limited to
+	bisectExpectedFile = "BISECT_EXPECTED_REV" // the commit last checked out for testing
+	bisectAncestorsOK  = "BISECT_ANCESTORS_OK" // the merge bases of good and bad were checked
+	bisectRefs         = "refs/bisect/"
+)
+
+// Outcomes of choosing the next commit to test.
+const (
+	bisectWaiting = iota // good and bad commits are still needed
+	bisectNext           // a commit has been checked out for testing
+	bisectFound          // the first bad commit is known
+)
+
+// errOnlySkipped is returned when the first bad commit is among commits
+// that were skipped.
+var errOnlySkipped = errors.New("only skipped commits left to test")
+
+// Bisect handles the `bisect` command, which finds the commit that
+// introduced a bug by binary search over the history:
+//
+//	mygit bisect start [<bad> [<good>...]] [--] [<path>...]
+//	mygit bisect (bad | new) [<rev>]
+//	mygit bisect (good | old) [<rev>...]
+//	mygit bisect skip [<rev>...]
+//	mygit bisect reset [<commit>]
+//	mygit bisect log
+//	mygit bisect replay <logfile>
+//	mygit bisect run <cmd> [<arg>...]
+//
+// Each step checks out, with HEAD detached, the commit that best splits
+// the commits still suspected, counting every parent of merges.
+func Bisect(args []string) {
+	usage := func() {
+		fmt.Println("usage: mygit bisect (start | bad | good | skip | reset | log | replay | run) [<args>...]")
+		os.Exit(129)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(128)
+	}
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	b := newBisector(repo)
+
+	subcommand, rest := args[0], args[1:]
+	switch subcommand {
+	case "start":
+		err = b.start(rest)
+		if err == nil {
+			_, err = b.next()
+		}
+	case "bad", "new", "good", "old", "skip":
+		if !b.bisecting() {
+			fmt.Println("You need to start by \"mygit bisect start\"")
+			os.Exit(1)
+		}
+		err = b.mark(subcommand, rest)
+		if err == nil {
+			_, err = b.next()
+		}
+	case "reset":
+		if len(rest) > 1 {
+			usage()
+		}
+		target := ""
+		if len(rest) == 1 {
+			target = rest[0]
+		}
+		err = b.reset(target)
+	case "log":
+		if !b.bisecting() {
+			fmt.Println("error: We are not bisecting.")
+			os.Exit(1)
+		}
+		fmt.Print(b.readState(bisectLogFile))
+	case "replay":
+		if len(rest) != 1 {
+			fmt.Println("error: no logfile given")
+			os.Exit(129)
+		}
+		err = b.replay(rest[0])
+	case "run":
+		if len(rest) == 0 {
+			fmt.Println("error: bisect run failed: no command provided.")
+			os.Exit(1)
+		}
+		err = b.run(rest)
+	default:
+		usage()
+	}
+
+	if errors.Is(err, errOnlySkipped) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// bisector keeps the bisect state of a repository.
+type bisector struct {
+	repo       *repository.GitRepository
+	objStore   *objects.ObjectStore
+	refManager *refs.RefManager
+	walk       *revWalk
+}
+
+func newBisector(repo *repository.GitRepository) *bisector {
+	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+	return &bisector{
+		repo:       repo,
+		objStore:   objStore,
+		refManager: refManager,
+		walk:       newRevWalk(objStore, refManager),
+	}
+}
+
+func (b *bisector) readState(name string) string {
+	data, _ := os.ReadFile(filepath.Join(b.repo.GitDir, name))
+	return string(data)
+}
+
+func (b *bisector) writeState(name, content string) error {
+	return os.WriteFile(filepath.Join(b.repo.GitDir, name), []byte(content), 0644)
+}
+
+func (b *bisector) hasState(name string) bool {
+	return utils.PathExists(filepath.Join(b.repo.GitDir, name))
+}
+
+// bisecting reports whether a bisect is in progress.
+func (b *bisector) bisecting() bool {
+	return b.hasState(bisectStartFile)
+}
+
+// appendLog adds lines to BISECT_LOG.
+func (b *bisector) appendLog(lines ...string) error {
+	f, err := os.OpenFile(filepath.Join(b.repo.GitDir, bisectLogFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(f, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// describe returns "[<hash>] <subject>" for a commit.
+func (b *bisector) describe(hash string) string {
+	c, err := b.walk.commit(hash)
+	if err != nil {
+		return "[" + hash + "]"
+	}
+	return fmt.Sprintf("[%s] %s", hash, subject(c.Message))
+}
+
+// start begins a bisect, forgetting any earlier one. The first revision
+// given is bad and the others are good; arguments after them, or after
+// "--", are the paths to limit the search to.
+func (b *bisector) start(args []string) error {
+	var revs, paths []string
+	for i, arg := range args {
+		if arg == "--" {
+			paths = append(paths, args[i+1:]...)
+			break
+		}
+		if len(paths) == 0 {
+			if _, err := b.walk.peelCommit(arg); err == nil {
+				revs = append(revs, arg)
+				continue
+			}
+			if _, err := os.Lstat(arg); err != nil {
+				return fmt.Errorf("'%s' does not appear to be a valid revision", arg)
+			}
+		}
+		paths = append(paths, arg)
+	}
+	hashes := make([]string, len(revs))
+	for i, rev := range revs {
+		hash, err := b.walk.peelCommit(rev)
+		if err != nil {
+			return fmt.Errorf("'%s' does not appear to be a valid revision", rev)
+		}
+		hashes[i] = hash
+	}
+	specs, err := normalizePathspecs(b.repo, paths)
+	if err != nil {
+		return err
+	}
+
+	// Restarting keeps the branch the first bisect started from
+	origin := strings.TrimSpace(b.readState(bisectStartFile))
+	if origin == "" {
+		if branch, err := b.refManager.GetCurrentBranch(); err == nil {
+			origin = branch
+		} else if origin, err = b.refManager.GetHEAD(); err != nil || origin == "" {
+			return fmt.Errorf("bad HEAD - I need a HEAD")
+		}
+	}
+	if err := b.clear(); err != nil {
+		return err
+	}
+	if err := b.writeState(bisectStartFile, origin+"\n"); err != nil {
+		return err
+	}
+	if err := b.writeState(bisectNamesFile, shellQuoteArgs(specs)+"\n"); err != nil {
+		return err
+	}
+
+	for i, hash := range hashes {
+		term := "good"
+		if i == 0 {
+			term = "bad"
+		}
+		if err := b.markCommit(term, hash, false); err != nil {
+			return err
+		}
+	}
+	// The log names the commits by hash, so that replaying it does not
+	// depend on where HEAD is
+	words := hashes
+	if len(paths) > 0 {
+		words = append(append(words, "--"), paths...)
+	}
+	line := "mygit bisect start"
+	if len(words) > 0 {
+		line += " " + shellQuoteArgs(words)
+	}
+	return b.appendLog(line)
+}
+
+// mark records revisions as bad, good or skipped; HEAD by default.
+func (b *bisector) mark(term string, revs []string) error {
+	switch term {
+	case "new":
+		term = "bad"
+	case "old":
+		term = "good"
+	}
+	if len(revs) == 0 {
+		revs = []string{"HEAD"}
+	}
+	if term == "bad" && len(revs) > 1 {
+		return fmt.Errorf("'mygit bisect bad' can take only one argument.")
+	}
+	for _, rev := range revs {
+		hash, err := b.walk.peelCommit(rev)
+		if err != nil {
+			return fmt.Errorf("bad rev input: %s", rev)
+		}
+		if err := b.markCommit(term, hash, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markCommit records one commit and logs it, with the command that
+// replays it when command is set.
+func (b *bisector) markCommit(term, hash string, command bool) error {
+	ref := bisectRefs + term + "-" + hash
+	if term == "bad" {
+		ref = bisectRefs + "bad"
+	}
+	if err := b.refManager.SetRef(ref, hash); err != nil {
+		return err
+	}
+	lines := []string{fmt.Sprintf("# %s: %s", term, b.describe(hash))}
+	if command {
+		lines = append(lines, fmt.Sprintf("mygit bisect %s %s", term, hash))
+	}
+	return b.appendLog(lines...)
+}
+
+// marked returns the commits marked with a term.
+func (b *bisector) marked(term string) ([]string, error) {
+	list, err := b.refManager.ListRefs(bisectRefs + term + "-")
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(list))
+	for i, ref := range list {
+		hashes[i] = ref.Hash
+	}
+	return hashes, nil
+}
+
+// next checks out the next commit to test, or reports the first bad
+// commit once it is known.
+func (b *bisector) next() (int, error) {
+	bad, err := b.refManager.GetRef(bisectRefs + "bad")
+	if err != nil {
+		return 0, err
+	}
+	goods, err := b.marked("good")
+	if err != nil {
+		return 0, err
+	}
+	skips, err := b.marked("skip")
+	if err != nil {
+		return 0, err
+	}
+	status := ""
+	switch {
+	case bad == "" && len(goods) == 0:
+		status = "waiting for both good and bad commits"
+	case bad == "":
+		status = fmt.Sprintf("waiting for bad commit, %d good %s known", len(goods), plural(len(goods), "commit", "commits"))
+	case len(goods) == 0:
+		status = "waiting for good commit(s), bad commit known"
+	}
+	if status != "" {
+		fmt.Println("status: " + status)
+		return bisectWaiting, b.appendLog("# status: " + status)
+	}
+
+	if tested, err := b.checkMergeBases(bad, goods, skips); tested || err != nil {
+		return bisectNext, err
+	}
+
+	candidates, err := b.candidates(bad, goods)
+	if err != nil {
+		return 0, err
+	}
+	skipped := make(map[string]bool)
+	for _, hash := range skips {
+		skipped[hash] = true
+	}
+
+	best, weight := b.best(candidates, skipped)
+	if best == bad || best == "" {
+		for _, hash := range candidates.order {
+			if skipped[hash] && candidates.touches[hash] {
+				return 0, b.onlySkipped(candidates, skipped, bad)
+			}
+		}
+		return bisectFound, b.found(bad)
+	}
+
+	left := candidates.interesting - weight - 1
+	steps := estimateBisectSteps(candidates.interesting)
+	fmt.Printf("Bisecting: %d %s left to test after this (roughly %d %s)\n",
+		left, plural(left, "revision", "revisions"), steps, plural(steps, "step", "steps"))
+	return bisectNext, b.checkout(best)
+}
+
+// checkMergeBases makes sure the good commits that are not ancestors of
+// the bad one are checked through their merge bases with it: a merge base
+// not known to be good is checked out for testing first. It reports
+// whether one was. Once they all pass, this is not checked again.
+func (b *bisector) checkMergeBases(bad string, goods, skips []string) (bool, error) {
+	if b.hasState(bisectAncestorsOK) {
+		return false, nil
+	}
+	var unrelated []string
+	for _, good := range goods {
+		ok, err := b.walk.isAncestor(good, bad)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			unrelated = append(unrelated, good)
+		}
+	}
+	if len(unrelated) == 0 {
+		return false, b.writeState(bisectAncestorsOK, "")
+	}
+
+	bases, err := b.walk.mergeBases(bad, unrelated, true)
+	if err != nil {
+		return false, err
+	}
+	known := make(map[string]bool)
+	for _, hash := range append(goods, skips...) {
+		known[hash] = true
+	}
+	for _, base := range bases {
+		if base == bad {
+			return false, fmt.Errorf("The merge base %s is bad.\nThis means the bug has been fixed between %s and [%s].",
+				base, base, strings.Join(unrelated, " "))
+		}
+		if !known[base] {
+			fmt.Println("Bisecting: a merge base must be tested")
+			return true, b.checkout(base)
+		}
+	}
+	return false, b.writeState(bisectAncestorsOK, "")
+}
+
+// bisectCandidates are the commits that may be the first bad one: those
+// the bad commit reaches but no good commit does. order lists them oldest
+// first, the reverse of the order log walks them in.
+type bisectCandidates struct {
+	order       []string
+	parents     map[string][]string // parents that are candidates too
+	interesting int                 // how many touch the bisect paths
+	touches     map[string]bool
+}
+
+func (b *bisector) candidates(bad string, goods []string) (*bisectCandidates, error) {
+	args := []string{bad}
+	for _, good := range goods {
+		args = append(args, "^"+good)
+	}
+	tips, err := b.walk.selectRange(args)
+	if err != nil {
+		return nil, err
+	}
+	newestFirst, err := b.walk.sort(tips, orderWalk)
+	if err != nil {
+		return nil, err
+	}
+	specs := splitShellWords(strings.TrimSpace(b.readState(bisectNamesFile)))
+
+	c := &bisectCandidates{parents: make(map[string][]string), touches: make(map[string]bool)}
+	for i := len(newestFirst) - 1; i >= 0; i-- {
+		hash := newestFirst[i]
+		c.order = append(c.order, hash)
+		parents, err := b.walk.allParents(hash)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range parents {
+			if b.walk.included[p] {
+				c.parents[hash] = append(c.parents[hash], p)
+			}
+		}
+		touches := true
+		if len(specs) > 0 && hash != bad {
+			if touches, err = b.touchesPaths(hash, specs); err != nil {
+				return nil, err
+			}
+		}
+		if touches {
+			c.touches[hash] = true
+			c.interesting++
+		}
+	}
+	return c, nil
+}
+
+// touchesPaths reports whether a commit changes any of the paths compared
+// with its first parent.
+func (b *bisector) touchesPaths(hash string, specs []string) (bool, error) {
+	parents, err := b.walk.allParents(hash)
+	if err != nil {
+		return false, err
+	}
+	parent := ""
+	if len(parents) > 0 {
+		parent = parents[0]
+	}
+	oldTree, err := b.walk.tree(parent)
+	if err != nil {
+		return false, err
+	}
+	newTree, err := b.walk.tree(hash)
+	if err != nil {
+		return false, err
+	}
+	for _, change := range diffEntries(oldTree, newTree) {
+		if matchPathspec(change.Path, specs) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// best returns the commit to test next and the number of candidates it
+// reaches. That is the commit for which the smaller of the candidates it
+// reaches and the candidates it does not is largest, chosen the way Git
+// does: weights are worked out oldest first, merges by walking their
+// history and other commits from their parent, and without skipped
+// commits the first commit found to be about halfway is taken. Skipped
+// commits are counted but never chosen.
+func (b *bisector) best(c *bisectCandidates, skipped map[string]bool) (string, int) {
+	weights := make(map[string]int, len(c.order))
+	anySkipped := false
+	for _, hash := range c.order {
+		anySkipped = anySkipped || skipped[hash]
+	}
+	halfway := func(hash string) bool {
+		diff := 2*weights[hash] - c.interesting
+		return !anySkipped && c.touches[hash] && diff >= -1 && diff <= 1
+	}
+
+	const unknown, unknownMerge = -1, -2
+	for _, hash := range c.order {
+		switch len(c.parents[hash]) {
+		case 0:
+			weights[hash] = 0
+			if c.touches[hash] {
+				weights[hash] = 1
+			}
+		case 1:
+			weights[hash] = unknown
+		default:
+			weights[hash] = unknownMerge
+		}
+	}
+	for _, hash := range c.order {
+		if weights[hash] == unknownMerge {
+			weights[hash] = c.reachCount(hash)
+			if halfway(hash) {
+				return hash, weights[hash]
+			}
+		}
+	}
+	for progress := true; progress; {
+		progress = false
+		for _, hash := range c.order {
+			parent := c.parents[hash]
+			if weights[hash] >= 0 || weights[parent[0]] < 0 {
+				continue
+			}
+			weights[hash] = weights[parent[0]]
+			if c.touches[hash] {
+				weights[hash]++
+			}
+			progress = true
+			if halfway(hash) {
+				return hash, weights[hash]
+			}
+		}
+	}
+
+	best, bestDistance := "", -1
+	for _, hash := range c.order {
+		if skipped[hash] || !c.touches[hash] {
+			continue
+		}
+		distance := min(weights[hash], c.interesting-weights[hash])
+		if distance > bestDistance {
+			best, bestDistance = hash, distance
+		}
+	}
+	return best, weights[best]
+}
+
+// reachCount counts the interesting candidates a commit reaches,
+// including itself.
+func (c *bisectCandidates) reachCount(hash string) int {
+	count := 0
+	seen := map[string]bool{hash: true}
+	stack := []string{hash}
+	for len(stack) > 0 {
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if c.touches[h] {
+			count++
+		}
+		for _, p := range c.parents[h] {
+			if !seen[p] {
+				seen[p] = true
+				stack = append(stack, p)
+			}
+		}
+	}
+	return count
+}
+
+// estimateBisectSteps estimates how many more steps a bisect of n
+// commits takes, as Git does.
+func estimateBisectSteps(n int) int {
+	if n < 3 {
+		return 0
+	}
+	steps := 0
+	for 1<<(steps+1) <= n {
+		steps++
+	}
+	e := 1 << steps
+	if e < 3*(n-e) {
+		return steps
+	}
+	return steps - 1
+}
+
+// found reports the first bad commit with its message and diffstat.
+func (b *bisector) found(hash string) error {
+	c, err := b.walk.commit(hash)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is the first bad commit\n", hash)
+	format := prettyFormat{name: "medium", repo: b.repo}
+	for _, line := range format.lines(hash, c, nil) {
+		fmt.Println(line)
+	}
+	parent := ""
+	if len(c.Parents) > 0 {
+		parent = c.Parents[0]
+	}
+	oldTree, err := b.walk.tree(parent)
+	if err != nil {
+		return err
+	}
+	newTree, err := b.walk.tree(hash)
+	if err != nil {
+		return err
+	}
+	if changes := diffEntries(oldTree, newTree); len(changes) > 0 {
+		stat, err := formatStat(b.objStore, changes)
+		if err != nil {
+			return err
+		}
+		fmt.Println()
+		fmt.Print(stat)
+	}
+	return b.appendLog("# first bad commit: " + b.describe(hash))
+}
+
+// onlySkipped reports the commits the first bad one is among when all
+// of them were skipped.
+func (b *bisector) onlySkipped(c *bisectCandidates, skipped map[string]bool, bad string) error {
+	fmt.Println("There are only 'skip'ped commits left to test.")
+	fmt.Println("The first bad commit could be any of:")
+	lines := []string{"# only skipped commits left to test"}
+	for i := len(c.order) - 1; i >= 0; i-- {
+		hash := c.order[i]
+		if hash == bad || skipped[hash] {
+			fmt.Println(hash)
+			lines = append(lines, "# possible first bad commit: "+b.describe(hash))
+		}
+	}
+	fmt.Println("We cannot bisect more!")
+	if err := b.appendLog(lines...); err != nil {
+		return err
+	}
+	return errOnlySkipped
+}
+
+// checkout detaches HEAD at a commit, updating the index and working
+// directory.
+func (b *bisector) checkout(hash string) error {
+	head, err := b.refManager.GetHEAD()
+	if err != nil {
+		return err
+	}
+	if err := b.switchTo(head, hash); err != nil {
+		return err
+	}
+	from := head
+	if branch, err := b.refManager.GetCurrentBranch(); err == nil {
+		from = branch
+	}
+	if err := b.refManager.SetRef("HEAD", hash); err != nil {
+		return err
+	}
+	b.refManager.AppendReflog("HEAD", head, hash, getAuthor(b.repo),
+		fmt.Sprintf("checkout: moving from %s to %s", from, hash))
+	fmt.Println(b.describe(hash))
+	return b.writeState(bisectExpectedFile, hash+"\n")
+}
+
+// switchTo updates the index and working directory from one commit's tree
+// to another's, refusing to overwrite local changes.
+func (b *bisector) switchTo(from, to string) error {
+	if from == to {
+		return nil
+	}
+	idx := index.NewIndex(b.repo.GitDir)
+	if err := idx.Load(); err != nil {
+		return err
+	}
+	fromTree, err := b.walk.tree(from)
+	if err != nil {
+		return err
+	}
+	toTree, err := b.walk.tree(to)
+	if err != nil {
+		return err
+	}
+	if _, err := switchTrees(b.repo, b.objStore, idx, fromTree, toTree, false, ""); err != nil {
+		return err
+	}
+	return idx.Save()
+}
+
+// reset ends the bisect and goes back to the branch it started from, or
+// to target.
+func (b *bisector) reset(target string) error {
+	if !b.bisecting() {
+		fmt.Println("We are not bisecting.")
+		return nil
+	}
+	if target == "" {
+		target = strings.TrimSpace(b.readState(bisectStartFile))
+	}
+
+	head, err := b.refManager.GetHEAD()
+	if err != nil {
+		return err
+	}
+	branchHash, _ := b.refManager.GetRef("refs/heads/" + target)
+	if branchHash != "" {
+		if err := b.switchTo(head, branchHash); err != nil {
+			return err
+		}
+		if current, err := b.refManager.GetCurrentBranch(); err != nil || current != target {
+			if err != nil {
+				c, cerr := b.walk.commit(head)
+				if cerr == nil {
+					fmt.Printf("Previous HEAD position was %s %s\n", head[:abbrevLength], subject(c.Message))
+				}
+			}
+			if err := b.refManager.SetHEAD("refs/heads/" + target); err != nil {
+				return err
+			}
+			b.refManager.AppendReflog("HEAD", head, branchHash, getAuthor(b.repo),
+				fmt.Sprintf("checkout: moving from %s to %s", head, target))
+			fmt.Printf("Switched to branch '%s'\n", target)
+		}
+	} else {
+		hash, err := b.walk.peelCommit(target)
+		if err != nil {
+			return fmt.Errorf("could not check out original HEAD '%s'. Try 'mygit bisect reset <commit>'.", target)
+		}
+		if err := b.switchTo(head, hash); err != nil {
+			return err
+		}
+		if err := b.refManager.SetRef("HEAD", hash); err != nil {
+			return err
+		}
+		b.refManager.AppendReflog("HEAD", head, hash, getAuthor(b.repo),
+			fmt.Sprintf("checkout: moving from %s to %s", head, hash))
+		c, err := b.walk.commit(hash)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("HEAD is now at %s %s\n", hash[:abbrevLength], subject(c.Message))
+	}
+	return b.clear()
+}
+
+// clear removes the bisect refs and state files.
+func (b *bisector) clear() error {
+	list, err := b.refManager.ListRefs(bisectRefs)
+	if err != nil {
+		return err
+	}
+	for _, ref := range list {
+		if err := b.refManager.DeleteRef(ref.Name); err != nil {
+			return err
+		}
+	}
+	for _, name := range []string{bisectStartFile, bisectLogFile, bisectNamesFile, bisectExpectedFile, bisectAncestorsOK} {
+		if err := os.Remove(filepath.Join(b.repo.GitDir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// replay restarts the bisect from a log written by `bisect log`, possibly
+// edited, and checks out the next commit to test.
+func (b *bisector) replay(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("cannot read file '%s' for replaying", file)
+	}
+	started := false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words := splitShellWords(line)
+		if len(words) < 3 || (words[0] != "mygit" && words[0] != "git") || words[1] != "bisect" {
+			return fmt.Errorf("?? what are you talking about?")
+		}
+		switch words[2] {
+		case "start":
+			err = b.start(words[3:])
+			started = true
+		case "bad", "new", "good", "old", "skip":
+			if !started {
+				return fmt.Errorf("?? what are you talking about?")
+			}
+			err = b.mark(words[2], words[3:])
+		default:
+			return fmt.Errorf("?? what are you talking about?")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !started {
+		return fmt.Errorf("no bisect start in '%s'", file)
+	}
+	_, err = b.next()
+	return err
+}
+
+// run tests commits with a command until the first bad one is found. The
+// command's exit status marks the commit checked out: 0 is good, 125
+// skips it and any other status below 128 is bad.
+func (b *bisector) run(command []string) error {
+	if !b.bisecting() {
+		fmt.Println("You need to start by \"mygit bisect start\"")
+		os.Exit(1)
+	}
+	bad, err := b.refManager.GetRef(bisectRefs + "bad")
+	if err != nil {
+		return err
+	}
+	goods, err := b.marked("good")
+	if err != nil {
+		return err
+	}
+	if bad == "" || len(goods) == 0 {
+		return fmt.Errorf("You need to give me at least one good and one bad revision.\n(You can use \"mygit bisect bad\" and \"mygit bisect good\" for that.)")
+	}
+
+	quoted := shellQuoteArgs(command)
+	script := strings.Join(command, " ")
+	if len(command) > 1 {
+		script = quoted
+	}
+	for {
+		fmt.Printf("running  %s\n", quoted)
+		cmd := exec.Command("sh", "-c", script)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		status := 0
+		if err := cmd.Run(); err != nil {
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				return fmt.Errorf("bisect run failed: %v", err)
+			}
+			status = exitErr.ExitCode()
+		}
+		term := "good"
+		switch {
+		case status < 0 || status >= 128:
+			return fmt.Errorf("bisect run failed: exit code %d from '%s' is < 0 or >= 128", status, quoted)
+		case status == 125:
+			term = "skip"
+		case status != 0:
+			term = "bad"
+		}
+
+		if err := b.mark(term, nil); err != nil {
+			return err
+		}
+		outcome, err := b.next()
+		if errors.Is(err, errOnlySkipped) {
+			fmt.Println("bisect run cannot continue any more")
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if outcome == bisectFound {
+			fmt.Println("bisect found first bad commit")
+			return nil
+		}
+	}
+}
+
+// bisectStatusLines describes a bisect in progress for status, or returns
+// nil if there is none.
+func bisectStatusLines(repo *repository.GitRepository) []string {
+	data, err := os.ReadFile(filepath.Join(repo.GitDir, bisectStartFile))
+	if err != nil {
+		return nil
+	}
+	origin := strings.TrimSpace(string(data))
+	refManager := refs.NewRefManager(repo.GitDir)
+	if hash, _ := refManager.GetRef("refs/heads/" + origin); hash != "" {
+		return []string{fmt.Sprintf("You are currently bisecting, started from branch '%s'.", origin),
+			"  (use \"mygit bisect reset\" to get back to the original branch)"}
+	}
+	return []string{"You are currently bisecting.",
+		"  (use \"mygit bisect reset\" to get back to the original branch)"}
+}
+
+// shellQuoteArgs quotes each argument for sh and joins them with spaces.
+func shellQuoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// splitShellWords splits a line written with shellQuoteArgs back into
+// words. Only single quotes and backslashes are understood.
+func splitShellWords(line string) []string {
+	var words []string
+	var word strings.Builder
+	inWord, quoted := false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quoted && c == '\'':
+			quoted = false
+		case quoted:
+			word.WriteByte(c)
+		case c == '\'':
+			quoted, inWord = true, true
+		case c == '\\' && i+1 < len(line):
+			i++
+			word.WriteByte(line[i])
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
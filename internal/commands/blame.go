@@ -0,0 +1,983 @@
+package commands
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"io"
+	"mygit/internal/config"
+	"mygit/internal/diff"
+	"mygit/internal/index"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// zeroHash names the working tree copy of a file in blame output.
+const zeroHash = "0000000000000000000000000000000000000000"
+
+// blameOptions holds the options of blame.
+type blameOptions struct {
+	rev         string
+	path        string
+	ranges      []string // -L arguments, in order
+	porcelain   bool
+	linePorcel  bool
+	longHash    bool
+	noAuthor    bool
+	showEmail   bool
+	showName    bool
+	showNumber  bool
+	showRoot    bool
+	dateMode    string
+	ignoreRevs  []string
+	ignoreFiles []string
+	noPager     bool
+}
+
+// Blame handles the `blame` command, which shows the commit that last
+// changed each line of a file:
+//
+//	mygit blame [<options>] <file> [<rev>]
+//	mygit blame [<options>] [<rev>] [--] <file>
+//
+// Without a revision the working tree copy is blamed, and lines changed
+// since HEAD belong to "Not Committed Yet".
+func Blame(args []string) {
+	opts := blameOptions{dateMode: "iso"}
+	var positional []string
+	dashdash := -1
+
+	usage := func() {
+		fmt.Println("usage: mygit blame [<options>] [<rev>] [--] <file>")
+		os.Exit(129)
+	}
+	value := func(i *int, name string) string {
+		if *i+1 >= len(args) {
+			fmt.Printf("error: switch `%s' requires a value\n", name)
+			os.Exit(129)
+		}
+		*i++
+		return args[*i]
+	}
+	explicitDate := false
+	resetIgnores := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case dashdash >= 0:
+			positional = append(positional, arg)
+		case arg == "--":
+			dashdash = len(positional)
+		case arg == "-L":
+			opts.ranges = append(opts.ranges, value(&i, "L"))
+		case strings.HasPrefix(arg, "-L"):
+			opts.ranges = append(opts.ranges, arg[2:])
+		case arg == "--porcelain" || arg == "-p":
+			opts.porcelain = true
+		case arg == "--line-porcelain":
+			opts.porcelain, opts.linePorcel = true, true
+		case arg == "-l":
+			opts.longHash = true
+		case arg == "-s":
+			opts.noAuthor = true
+		case arg == "-e" || arg == "--show-email":
+			opts.showEmail = true
+		case arg == "-f" || arg == "--show-name":
+			opts.showName = true
+		case arg == "-n" || arg == "--show-number":
+			opts.showNumber = true
+		case arg == "--root":
+			opts.showRoot = true
+		case strings.HasPrefix(arg, "--date="):
+			mode := strings.TrimPrefix(arg, "--date=")
+			if !validDateModes[mode] {
+				fmt.Printf("fatal: unknown date format %s\n", mode)
+				os.Exit(128)
+			}
+			opts.dateMode, explicitDate = mode, true
+		case arg == "--ignore-rev":
+			opts.ignoreRevs = append(opts.ignoreRevs, value(&i, "ignore-rev"))
+		case strings.HasPrefix(arg, "--ignore-rev="):
+			opts.ignoreRevs = append(opts.ignoreRevs, strings.TrimPrefix(arg, "--ignore-rev="))
+		case arg == "--ignore-revs-file" || strings.HasPrefix(arg, "--ignore-revs-file="):
+			file, ok := strings.CutPrefix(arg, "--ignore-revs-file=")
+			if !ok {
+				file = value(&i, "ignore-revs-file")
+			}
+			// An empty name drops the files given so far and the configured one
+			if file == "" {
+				opts.ignoreFiles, resetIgnores = nil, true
+			} else {
+				opts.ignoreFiles = append(opts.ignoreFiles, file)
+			}
+		case arg == "--no-pager":
+			opts.noPager = true
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			fmt.Printf("error: unknown option `%s'\n", strings.TrimLeft(arg, "-"))
+			usage()
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(128)
+	}
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+
+	// <rev> -- <file>, <rev> <file> or <file> <rev>
+	var file string
+	switch {
+	case dashdash >= 0 && dashdash <= 1 && len(positional) == dashdash+1:
+		file = positional[dashdash]
+		if dashdash == 1 {
+			opts.rev = positional[0]
+		}
+	case dashdash < 0 && len(positional) == 1:
+		file = positional[0]
+	case dashdash < 0 && len(positional) == 2:
+		file, opts.rev = positional[1], positional[0]
+		if _, err := os.Lstat(positional[0]); err == nil {
+			if _, err := os.Lstat(positional[1]); err != nil {
+				file, opts.rev = positional[0], positional[1]
+			}
+		}
+	default:
+		usage()
+	}
+	paths, err := normalizePathspecs(repo, []string{file})
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	opts.path = paths[0]
+
+	cfg := config.NewConfig(filepath.Join(repo.GitDir, "config"))
+	if cfg.Load() == nil {
+		if mode, ok := cfg.Get("blame.date"); ok && !explicitDate && validDateModes[mode] {
+			opts.dateMode = mode
+		}
+		if cfg.GetBool("blame.showEmail", false) {
+			opts.showEmail = true
+		}
+		if cfg.GetBool("blame.showRoot", false) {
+			opts.showRoot = true
+		}
+		if file, ok := cfg.Get("blame.ignoreRevsFile"); ok && file != "" && !resetIgnores {
+			// A missing configured file is not an error, as in Git
+			if _, err := os.Stat(filepath.Join(repo.WorkDir, file)); err == nil {
+				opts.ignoreFiles = append([]string{filepath.Join(repo.WorkDir, file)}, opts.ignoreFiles...)
+			}
+		}
+	}
+
+	b := &blamer{
+		walk:     newRevWalk(objStore, refManager),
+		repo:     repo,
+		path:     opts.path,
+		ignore:   make(map[string]bool),
+		contents: make(map[string][]string),
+		previous: make(map[string]blameSource),
+		pending:  make(map[string]*blameOrigin),
+	}
+	b.queue.blamer = b
+	if err := b.loadIgnores(opts.ignoreRevs, opts.ignoreFiles); err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	if err := b.start(opts.rev); err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	lines, err := b.lines(b.final, b.path)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	selected, err := blameRanges(opts.ranges, lines, b.path)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	if err := b.run(selected); err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	var w io.Writer = os.Stdout
+	done := func() {}
+	if !opts.noPager {
+		w, done = startPager(repo)
+	}
+	out := bufio.NewWriter(w)
+	if opts.porcelain {
+		err = b.printPorcelain(out, lines, selected, opts)
+	} else {
+		err = b.print(out, lines, selected, opts)
+	}
+	out.Flush()
+	done()
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+}
+
+// blameLine is a line of the final file that is still to be blamed: its
+// line number there and in the suspect's copy of the file, both 0-based.
+type blameLine struct {
+	final   int
+	orig    int
+	ignored bool // passed on through an ignored commit
+}
+
+// blameOrigin is a suspect: a version of the file in some commit, with the
+// lines it may be to blame for. The commit is "" for the working tree.
+type blameOrigin struct {
+	commit string
+	path   string
+	lines  []blameLine
+}
+
+// blameSource is a commit and the path the file had there.
+type blameSource struct {
+	commit string
+	path   string
+}
+
+// blameResult records who is to blame for a line of the final file.
+type blameResult struct {
+	commit     string
+	path       string
+	orig       int
+	ignored    bool // the line went past an ignored commit
+	unblamable bool // the line was left on an ignored commit
+	done       bool
+}
+
+// blamer hands lines from each suspect down to its parents until every
+// line has a commit that introduced it.
+type blamer struct {
+	walk     *revWalk
+	repo     *repository.GitRepository
+	path     string
+	final    string // the commit being blamed, "" for the working tree
+	head     string // HEAD, the parent of the working tree
+	ignore   map[string]bool
+	contents map[string][]string // file lines by commit and path
+	previous map[string]blameSource
+	pending  map[string]*blameOrigin
+	queue    blameQueue
+	results  []blameResult
+}
+
+// blameQueue orders suspects newest first, so that every suspect is done
+// before the commits it descends from.
+type blameQueue struct {
+	blamer *blamer
+	items  []*blameOrigin
+}
+
+func (q *blameQueue) Len() int { return len(q.items) }
+
+func (q *blameQueue) Less(i, j int) bool {
+	return q.blamer.walk.commitTime(q.items[i].commit) > q.blamer.walk.commitTime(q.items[j].commit)
+}
+
+func (q *blameQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+func (q *blameQueue) Push(x any) { q.items = append(q.items, x.(*blameOrigin)) }
+
+func (q *blameQueue) Pop() any {
+	last := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return last
+}
+
+func blameKey(commit, path string) string {
+	return commit + "\x00" + path
+}
+
+// loadIgnores reads the commits to see past from --ignore-rev and the
+// ignore-revs files, which hold one revision per line and # comments.
+func (b *blamer) loadIgnores(revs, files []string) error {
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("could not open object name list: %s", file)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if i := strings.IndexByte(line, '#'); i >= 0 {
+				line = line[:i]
+			}
+			if line = strings.TrimSpace(line); line != "" {
+				revs = append(revs, line)
+			}
+		}
+	}
+	for _, rev := range revs {
+		hash, err := b.walk.peelCommit(rev)
+		if err != nil {
+			return fmt.Errorf("cannot find revision %s to ignore", rev)
+		}
+		b.ignore[hash] = true
+	}
+	return nil
+}
+
+// start settles what is blamed: the file at rev, or the working tree
+// copy, whose parent is HEAD, when there is no rev.
+func (b *blamer) start(rev string) error {
+	if rev != "" {
+		hash, err := b.walk.peelCommit(rev)
+		if err != nil {
+			return fmt.Errorf("bad revision '%s'", rev)
+		}
+		tree, err := b.walk.tree(hash)
+		if err != nil {
+			return err
+		}
+		if _, ok := tree[b.path]; !ok {
+			return fmt.Errorf("no such path %s in %s", b.path, rev)
+		}
+		b.final = hash
+		return nil
+	}
+
+	b.head, _ = b.walk.refManager.GetHEAD()
+	tree, err := b.walk.tree(b.head)
+	if err != nil {
+		return err
+	}
+	if _, ok := tree[b.path]; !ok {
+		idx := index.NewIndex(b.repo.GitDir)
+		if err := idx.Load(); err != nil {
+			return err
+		}
+		if _, ok := idx.Get(b.path); !ok {
+			return fmt.Errorf("no such path '%s' in HEAD", b.path)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(b.repo.WorkDir, b.path)); err != nil {
+		return fmt.Errorf("cannot stat path '%s': %v", b.path, err)
+	}
+	return nil
+}
+
+// lines returns the lines of a file in a commit, or in the working tree
+// for commit "".
+func (b *blamer) lines(commit, path string) ([]string, error) {
+	key := blameKey(commit, path)
+	if lines, ok := b.contents[key]; ok {
+		return lines, nil
+	}
+	var data []byte
+	var err error
+	if commit == "" {
+		data, err = os.ReadFile(filepath.Join(b.repo.WorkDir, path))
+	} else {
+		var tree map[string]*index.IndexEntry
+		if tree, err = b.walk.tree(commit); err == nil {
+			data, err = blobContent(b.walk.objStore, tree[path])
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	lines := diff.SplitLines(data)
+	b.contents[key] = lines
+	return lines, nil
+}
+
+// entry returns a file's tree entry in a commit, nil for the working tree.
+func (b *blamer) entry(commit, path string) (*index.IndexEntry, error) {
+	if commit == "" {
+		return nil, nil
+	}
+	tree, err := b.walk.tree(commit)
+	if err != nil {
+		return nil, err
+	}
+	return tree[path], nil
+}
+
+// parents returns the commits a suspect's lines can be passed to.
+func (b *blamer) parents(commit string) ([]string, error) {
+	if commit == "" {
+		if b.head == "" {
+			return nil, nil
+		}
+		return []string{b.head}, nil
+	}
+	return b.walk.allParents(commit)
+}
+
+// suspect queues lines to be blamed on a version of the file, adding them
+// to the lines already queued for it.
+func (b *blamer) suspect(commit, path string, lines []blameLine) {
+	if len(lines) == 0 {
+		return
+	}
+	key := blameKey(commit, path)
+	if o, ok := b.pending[key]; ok {
+		o.lines = append(o.lines, lines...)
+		return
+	}
+	o := &blameOrigin{commit: commit, path: path, lines: lines}
+	b.pending[key] = o
+	heap.Push(&b.queue, o)
+}
+
+// run blames the selected lines of the final file.
+func (b *blamer) run(selected []int) error {
+	lines, err := b.lines(b.final, b.path)
+	if err != nil {
+		return err
+	}
+	b.results = make([]blameResult, len(lines))
+	start := make([]blameLine, len(selected))
+	for i, n := range selected {
+		start[i] = blameLine{final: n, orig: n}
+	}
+	if b.final == "" {
+		// The working tree is not a commit, so it goes first whatever
+		// the commit times say
+		if err := b.process(&blameOrigin{path: b.path, lines: start}); err != nil {
+			return err
+		}
+	} else {
+		b.suspect(b.final, b.path, start)
+	}
+	for b.queue.Len() > 0 {
+		o := heap.Pop(&b.queue).(*blameOrigin)
+		delete(b.pending, blameKey(o.commit, o.path))
+		if err := b.process(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// process passes on the lines of a suspect that its parents already had
+// and takes the blame for the rest.
+func (b *blamer) process(o *blameOrigin) error {
+	parents, err := b.parents(o.commit)
+	if err != nil {
+		return err
+	}
+	own, err := b.entry(o.commit, o.path)
+	if err != nil {
+		return err
+	}
+
+	var sources []blameSource
+	for _, p := range parents {
+		path, entry, err := b.findPath(o, p)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			continue
+		}
+		// The same blob: the parent is to blame for everything
+		if own != nil && entry.Hash == own.Hash {
+			b.previous[blameKey(o.commit, o.path)] = blameSource{p, path}
+			b.suspect(p, path, o.lines)
+			return nil
+		}
+		sources = append(sources, blameSource{p, path})
+	}
+	if len(sources) > 0 {
+		b.previous[blameKey(o.commit, o.path)] = sources[0]
+	}
+
+	lines, err := b.lines(o.commit, o.path)
+	if err != nil {
+		return err
+	}
+	remaining := o.lines
+	var firstEdits []diff.Edit
+	for i, src := range sources {
+		parentLines, err := b.lines(src.commit, src.path)
+		if err != nil {
+			return err
+		}
+		edits := diff.Lines(parentLines, lines)
+		if i == 0 {
+			firstEdits = edits
+		}
+		oldOf := make([]int, len(lines))
+		for j := range oldOf {
+			oldOf[j] = -1
+		}
+		for _, e := range edits {
+			if e.Kind == diff.Equal {
+				oldOf[e.NewIndex] = e.OldIndex
+			}
+		}
+		var passed, kept []blameLine
+		for _, l := range remaining {
+			if old := oldOf[l.orig]; old >= 0 {
+				passed = append(passed, blameLine{final: l.final, orig: old, ignored: l.ignored})
+			} else {
+				kept = append(kept, l)
+			}
+		}
+		b.suspect(src.commit, src.path, passed)
+		remaining = kept
+	}
+
+	// An ignored commit hands its changed lines to the lines they
+	// replaced, matched up by position within each change
+	if b.ignore[o.commit] && len(sources) > 0 && len(remaining) > 0 {
+		oldOf := replacedLines(firstEdits, len(lines))
+		var passed, kept []blameLine
+		for _, l := range remaining {
+			if old := oldOf[l.orig]; old >= 0 {
+				passed = append(passed, blameLine{final: l.final, orig: old, ignored: true})
+			} else {
+				kept = append(kept, l)
+			}
+		}
+		b.suspect(sources[0].commit, sources[0].path, passed)
+		for _, l := range kept {
+			b.results[l.final] = blameResult{commit: o.commit, path: o.path, orig: l.orig, ignored: l.ignored, unblamable: true, done: true}
+		}
+		return nil
+	}
+
+	for _, l := range remaining {
+		b.results[l.final] = blameResult{commit: o.commit, path: o.path, orig: l.orig, ignored: l.ignored, done: true}
+	}
+	return nil
+}
+
+// replacedLines maps each inserted line of an edit script to the deleted
+// line at the same position in the same change, or -1.
+func replacedLines(edits []diff.Edit, n int) []int {
+	oldOf := make([]int, n)
+	for i := range oldOf {
+		oldOf[i] = -1
+	}
+	var deleted, inserted []int
+	flush := func() {
+		for i := 0; i < len(inserted) && i < len(deleted); i++ {
+			oldOf[inserted[i]] = deleted[i]
+		}
+		deleted, inserted = deleted[:0], inserted[:0]
+	}
+	for _, e := range edits {
+		switch e.Kind {
+		case diff.Delete:
+			deleted = append(deleted, e.OldIndex)
+		case diff.Insert:
+			inserted = append(inserted, e.NewIndex)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return oldOf
+}
+
+// findPath finds a suspect's file in a parent. A file missing there may
+// have been renamed by the suspect's commit: a file of the parent that the
+// commit removed is taken if it has the same content or, failing that, at
+// least half of its lines in common.
+func (b *blamer) findPath(o *blameOrigin, parent string) (string, *index.IndexEntry, error) {
+	parentTree, err := b.walk.tree(parent)
+	if err != nil {
+		return "", nil, err
+	}
+	if entry, ok := parentTree[o.path]; ok {
+		return o.path, entry, nil
+	}
+
+	var ownTree map[string]*index.IndexEntry
+	own, err := b.entry(o.commit, o.path)
+	if err != nil {
+		return "", nil, err
+	}
+	if o.commit == "" {
+		idx := index.NewIndex(b.repo.GitDir)
+		if err := idx.Load(); err != nil {
+			return "", nil, err
+		}
+		ownTree = idx.GetAll()
+	} else if ownTree, err = b.walk.tree(o.commit); err != nil {
+		return "", nil, err
+	}
+
+	var candidates []string
+	for path, entry := range parentTree {
+		if _, ok := ownTree[path]; ok {
+			continue
+		}
+		if own != nil && entry.Hash == own.Hash {
+			return path, entry, nil
+		}
+		candidates = append(candidates, path)
+	}
+	sort.Strings(candidates)
+
+	lines, err := b.lines(o.commit, o.path)
+	if err != nil {
+		return "", nil, err
+	}
+	best, bestScore := "", 50
+	for _, path := range candidates {
+		other, err := b.lines(parent, path)
+		if err != nil {
+			return "", nil, err
+		}
+		if score := lineSimilarity(other, lines); score >= bestScore && (best == "" || score > bestScore) {
+			best, bestScore = path, score
+		}
+	}
+	if best == "" {
+		return "", nil, nil
+	}
+	return best, parentTree[best], nil
+}
+
+// lineSimilarity returns how much of two files is common, as a percentage
+// of their combined line count.
+func lineSimilarity(a, b []string) int {
+	if len(a)+len(b) == 0 {
+		return 100
+	}
+	common := 0
+	for _, e := range diff.Lines(a, b) {
+		if e.Kind == diff.Equal {
+			common++
+		}
+	}
+	return 200 * common / (len(a) + len(b))
+}
+
+// blameRanges returns the 0-based line numbers -L selects, in order, or
+// every line without -L. Each range is <start>,<end>, where <start> is a
+// line number or /regex/ and <end> is a line number, +<count>, -<count>
+// or /regex/; either may be left out.
+func blameRanges(specs []string, lines []string, path string) ([]int, error) {
+	if len(specs) == 0 {
+		all := make([]int, len(lines))
+		for i := range all {
+			all[i] = i
+		}
+		return all, nil
+	}
+
+	selected := make(map[int]bool)
+	for _, spec := range specs {
+		startSpec, endSpec, hasEnd := strings.Cut(spec, ",")
+		start, err := blameRangePoint(startSpec, lines, 0, 1)
+		if err != nil {
+			return nil, err
+		}
+		if start > len(lines) && len(lines) > 0 {
+			return nil, fmt.Errorf("file %s has only %d %s", path, len(lines), plural(len(lines), "line", "lines"))
+		}
+		end := start
+		switch {
+		case !hasEnd:
+			end = start
+		case endSpec == "":
+			end = len(lines)
+		case strings.HasPrefix(endSpec, "+"):
+			n, err := strconv.Atoi(endSpec[1:])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("-L parameter '%s': invalid range", spec)
+			}
+			end = start + n - 1
+		case strings.HasPrefix(endSpec, "-"):
+			n, err := strconv.Atoi(endSpec[1:])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("-L parameter '%s': invalid range", spec)
+			}
+			start, end = start-n+1, start
+		default:
+			if end, err = blameRangePoint(endSpec, lines, start, start); err != nil {
+				return nil, err
+			}
+		}
+		if startSpec == "" && hasEnd {
+			start = 1
+		}
+		if !hasEnd && strings.HasPrefix(startSpec, "/") {
+			end = len(lines)
+		}
+		if end < start {
+			start, end = end, start
+		}
+		if start < 1 {
+			start = 1
+		}
+		if end > len(lines) {
+			end = len(lines)
+		}
+		for n := start; n <= end; n++ {
+			selected[n-1] = true
+		}
+	}
+
+	result := make([]int, 0, len(selected))
+	for n := range selected {
+		result = append(result, n)
+	}
+	sort.Ints(result)
+	return result, nil
+}
+
+// blameRangePoint parses one end of an -L range: a 1-based line number or
+// a /regex/ searched for from the line after from. An empty spec is dflt.
+func blameRangePoint(spec string, lines []string, from, dflt int) (int, error) {
+	if spec == "" {
+		return dflt, nil
+	}
+	if strings.HasPrefix(spec, "/") {
+		pattern := strings.TrimSuffix(spec[1:], "/")
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return 0, fmt.Errorf("-L parameter '%s': %v", pattern, err)
+		}
+		for i := from; i < len(lines); i++ {
+			if re.MatchString(lines[i]) {
+				return i + 1, nil
+			}
+		}
+		return 0, fmt.Errorf("-L parameter '%s': no match", pattern)
+	}
+	n, err := strconv.Atoi(spec)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("-L invalid line number: %s", spec)
+	}
+	return n, nil
+}
+
+// blameCommitInfo is what the output says about a commit.
+type blameCommitInfo struct {
+	author    objects.Signature
+	committer objects.Signature
+	summary   string
+	boundary  bool
+}
+
+func (b *blamer) commitInfo(commit string, showRoot bool) (blameCommitInfo, error) {
+	if commit == "" {
+		now := time.Now()
+		sig := objects.Signature{Name: "Not Committed Yet", Email: "not.committed.yet", When: now}
+		return blameCommitInfo{
+			author:    sig,
+			committer: sig,
+			summary:   fmt.Sprintf("Version of %s from %s", b.path, b.path),
+		}, nil
+	}
+	c, err := b.walk.commit(commit)
+	if err != nil {
+		return blameCommitInfo{}, err
+	}
+	return blameCommitInfo{
+		author:    c.Author,
+		committer: c.Committer,
+		summary:   subject(c.Message),
+		boundary:  len(c.Parents) == 0 && !showRoot,
+	}, nil
+}
+
+func blameHash(commit string) string {
+	if commit == "" {
+		return zeroHash
+	}
+	return commit
+}
+
+// print writes blame's default output: for each line, the commit, the
+// file name if it changed, the author and date, the line number and the
+// line itself.
+func (b *blamer) print(out *bufio.Writer, lines []string, selected []int, opts blameOptions) error {
+	infos := make(map[string]blameCommitInfo)
+	showName := opts.showName
+	longestAuthor, longestPath, maxOrig := 0, 0, 0
+	for _, n := range selected {
+		r := b.results[n]
+		info, ok := infos[r.commit]
+		if !ok {
+			var err error
+			if info, err = b.commitInfo(r.commit, opts.showRoot); err != nil {
+				return err
+			}
+			infos[r.commit] = info
+		}
+		if r.path != b.path {
+			showName = true
+		}
+		name := info.author.Name
+		if opts.showEmail {
+			name = "<" + info.author.Email + ">"
+		}
+		longestAuthor = max(longestAuthor, len([]rune(name)))
+		longestPath = max(longestPath, len(r.path))
+		maxOrig = max(maxOrig, r.orig+1)
+	}
+	numberWidth := len(strconv.Itoa(len(lines)))
+	origWidth := len(strconv.Itoa(maxOrig))
+	ignoredMarks, unblamableMarks := b.markConfig()
+
+	for _, n := range selected {
+		r := b.results[n]
+		info := infos[r.commit]
+		hash := blameHash(r.commit)
+		length := 8
+		if opts.longHash {
+			length = len(hash)
+		}
+		if info.boundary {
+			out.WriteByte('^')
+			length--
+		}
+		if unblamableMarks && r.unblamable {
+			out.WriteByte('*')
+			length--
+		}
+		if ignoredMarks && r.ignored {
+			out.WriteByte('?')
+			length--
+		}
+		out.WriteString(hash[:length])
+		if showName {
+			fmt.Fprintf(out, " %-*s", longestPath, r.path)
+		}
+		if opts.showNumber {
+			fmt.Fprintf(out, " %*d", origWidth, r.orig+1)
+		}
+		if !opts.noAuthor {
+			name := info.author.Name
+			if opts.showEmail {
+				name = "<" + info.author.Email + ">"
+			}
+			pad := longestAuthor - len([]rune(name))
+			fmt.Fprintf(out, " (%s%*s %10s", name, pad, "", formatDate(info.author.When, opts.dateMode))
+		}
+		fmt.Fprintf(out, " %*d) ", numberWidth, n+1)
+		writeBlameLine(out, lines[n])
+	}
+	return nil
+}
+
+// printPorcelain writes the machine-readable output of --porcelain and
+// --line-porcelain. Each run of lines from the same commit starts with
+// "<hash> <orig line> <final line> <count>"; the commit's details follow
+// the first time it appears, or with every line for --line-porcelain.
+func (b *blamer) printPorcelain(out *bufio.Writer, lines []string, selected []int, opts blameOptions) error {
+	infos := make(map[string]blameCommitInfo)
+	shown := make(map[string]bool)
+	paths := make(map[string]map[string]bool)
+	for _, n := range selected {
+		r := b.results[n]
+		if paths[r.commit] == nil {
+			paths[r.commit] = make(map[string]bool)
+		}
+		paths[r.commit][r.path] = true
+	}
+
+	for i := 0; i < len(selected); {
+		n := selected[i]
+		r := b.results[n]
+		info, ok := infos[r.commit]
+		if !ok {
+			var err error
+			if info, err = b.commitInfo(r.commit, opts.showRoot); err != nil {
+				return err
+			}
+			infos[r.commit] = info
+		}
+		count := 1
+		for i+count < len(selected) {
+			next := selected[i+count]
+			nr := b.results[next]
+			if next != n+count || nr.commit != r.commit || nr.path != r.path || nr.orig != r.orig+count ||
+				nr.ignored != r.ignored || nr.unblamable != r.unblamable {
+				break
+			}
+			count++
+		}
+
+		for j := 0; j < count; j++ {
+			line := n + j
+			hash := blameHash(r.commit)
+			if j == 0 {
+				fmt.Fprintf(out, "%s %d %d %d\n", hash, r.orig+1, line+1, count)
+			} else {
+				fmt.Fprintf(out, "%s %d %d\n", hash, r.orig+j+1, line+1)
+			}
+			if j == 0 || opts.linePorcel {
+				details := opts.linePorcel || !shown[r.commit]
+				if details {
+					shown[r.commit] = true
+					b.writeCommitDetails(out, info)
+				}
+				if details || len(paths[r.commit]) > 1 {
+					if prev, ok := b.previous[blameKey(r.commit, r.path)]; ok {
+						fmt.Fprintf(out, "previous %s %s\n", prev.commit, prev.path)
+					}
+					fmt.Fprintf(out, "filename %s\n", r.path)
+				}
+			}
+			out.WriteByte('\t')
+			writeBlameLine(out, lines[line])
+		}
+		i += count
+	}
+	return nil
+}
+
+func (b *blamer) writeCommitDetails(out *bufio.Writer, info blameCommitInfo) {
+	for _, p := range []struct {
+		role string
+		sig  objects.Signature
+	}{{"author", info.author}, {"committer", info.committer}} {
+		fmt.Fprintf(out, "%s %s\n", p.role, p.sig.Name)
+		fmt.Fprintf(out, "%s-mail <%s>\n", p.role, p.sig.Email)
+		fmt.Fprintf(out, "%s-time %d\n", p.role, p.sig.When.Unix())
+		fmt.Fprintf(out, "%s-tz %s\n", p.role, p.sig.When.Format("-0700"))
+	}
+	fmt.Fprintf(out, "summary %s\n", info.summary)
+	if info.boundary {
+		out.WriteString("boundary\n")
+	}
+}
+
+// markConfig returns blame.markIgnoredLines and blame.markUnblamableLines.
+func (b *blamer) markConfig() (bool, bool) {
+	cfg := config.NewConfig(filepath.Join(b.repo.GitDir, "config"))
+	if cfg.Load() != nil {
+		return false, false
+	}
+	return cfg.GetBool("blame.markIgnoredLines", false), cfg.GetBool("blame.markUnblamableLines", false)
+}
+
+// writeBlameLine writes a line of the file, adding the newline the last
+// line may lack.
+func writeBlameLine(out *bufio.Writer, line string) {
+	out.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		out.WriteByte('\n')
+	}
+}
@@ -87,6 +87,10 @@ func listBranches(refManager *refs.RefManager) error {
 
 // createBranch creates a new branch pointing at the current HEAD commit.
 func createBranch(refManager *refs.RefManager, branchName string) error {
+	if refs.CheckRefName(branchName) != nil {
+		return fmt.Errorf("'%s' is not a valid branch name", branchName)
+	}
+
 	// Check if branch already exists
 	newRefPath := filepath.Join("refs", "heads", branchName)
 	if _, err := os.Stat(filepath.Join(refManager.GitDir, newRefPath)); err == nil {
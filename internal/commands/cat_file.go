@@ -0,0 +1,194 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"os"
+	"strings"
+)
+
+// defaultBatchFormat is what --batch and --batch-check print for each
+// object when no format is given.
+const defaultBatchFormat = "%(objectname) %(objecttype) %(objectsize)"
+
+// CatFile handles the `cat-file` command, which prints the type, size or
+// content of objects:
+//
+//	mygit cat-file (-t | -s | -e | -p) <object>
+//	mygit cat-file <type> <object>
+//	mygit cat-file (--batch | --batch-check)[=<format>] [--buffer]
+//
+// The batch modes read one object name per line from standard input and
+// answer each as soon as it is read, so that a script can keep a single
+// process open and ask for objects one at a time.
+func CatFile(args []string) {
+	mode := ""
+	batch, batchFormat := "", defaultBatchFormat
+	buffer := false
+	var names []string
+
+	for _, arg := range args {
+		switch {
+		case arg == "-t" || arg == "-s" || arg == "-e" || arg == "-p":
+			mode = arg
+		case arg == "--batch" || arg == "--batch-check":
+			batch = arg
+		case strings.HasPrefix(arg, "--batch=") || strings.HasPrefix(arg, "--batch-check="):
+			batch, batchFormat, _ = strings.Cut(arg, "=")
+		case arg == "--buffer":
+			buffer = true
+		case strings.HasPrefix(arg, "-"):
+			fmt.Printf("fatal: unknown option '%s'\n", arg)
+			os.Exit(128)
+		default:
+			names = append(names, arg)
+		}
+	}
+
+	usage := "usage: mygit cat-file (-t | -s | -e | -p | <type>) <object>\n   or: mygit cat-file (--batch | --batch-check)[=<format>]"
+	switch {
+	case batch != "" && (mode != "" || len(names) > 0):
+		fmt.Println(usage)
+		os.Exit(129)
+	case batch == "" && mode != "" && len(names) != 1:
+		fmt.Println(usage)
+		os.Exit(129)
+	case batch == "" && mode == "" && len(names) != 2:
+		fmt.Println(usage)
+		os.Exit(129)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(128)
+	}
+
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+
+	if batch != "" {
+		if err := catFileBatch(objStore, refManager, batch == "--batch", batchFormat, buffer); err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+			os.Exit(128)
+		}
+		return
+	}
+
+	name := names[len(names)-1]
+	hash, err := resolveRevision(objStore, refManager, name)
+	if err != nil {
+		if mode == "-e" {
+			os.Exit(1)
+		}
+		fmt.Printf("fatal: Not a valid object name %s\n", name)
+		os.Exit(128)
+	}
+	obj, err := objStore.ReadObject(hash)
+	if err != nil {
+		if mode == "-e" {
+			os.Exit(1)
+		}
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	switch mode {
+	case "-e":
+	case "-t":
+		fmt.Println(obj.Type)
+	case "-s":
+		fmt.Println(len(obj.Content))
+	case "-p":
+		if obj.Type == objects.TreeType {
+			tree, err := objects.ParseTree(obj.Content)
+			if err != nil {
+				fmt.Printf("fatal: %v\n", err)
+				os.Exit(128)
+			}
+			for _, e := range tree.Entries {
+				fmt.Printf("%06s %s %s\t%s\n", e.Mode, e.Type, e.Hash, e.Name)
+			}
+			return
+		}
+		os.Stdout.Write(obj.Content)
+	default:
+		// <type> <object> peels the object to the type asked for
+		hash, err := peelRevision(objStore, hash, names[0], name)
+		if err != nil {
+			fmt.Printf("fatal: %s: bad file\n", name)
+			os.Exit(128)
+		}
+		if obj, err = objStore.ReadObject(hash); err != nil {
+			fmt.Printf("fatal: %v\n", err)
+			os.Exit(128)
+		}
+		os.Stdout.Write(obj.Content)
+	}
+}
+
+// catFileBatch answers object names read from standard input, one per
+// line. Unless buffering, the output is flushed after every answer.
+func catFileBatch(objStore *objects.ObjectStore, refManager *refs.RefManager, contents bool, format string, buffer bool) error {
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	// With %(rest) in the format, the name ends at the first whitespace
+	// and the rest of the line is echoed back
+	splitRest := strings.Contains(format, "%(rest)")
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		name, rest := line, ""
+		if splitRest {
+			if i := strings.IndexAny(line, " \t"); i >= 0 {
+				name, rest = line[:i], strings.TrimLeft(line[i:], " \t")
+			}
+		}
+
+		var obj *objects.Object
+		hash, err := resolveRevision(objStore, refManager, name)
+		if err == nil {
+			obj, err = objStore.ReadObject(hash)
+		}
+		if err != nil {
+			fmt.Fprintf(out, "%s missing\n", name)
+		} else {
+			out.WriteString(expandBatchFormat(format, obj, rest))
+			out.WriteByte('\n')
+			if contents {
+				out.Write(obj.Content)
+				out.WriteByte('\n')
+			}
+		}
+
+		if !buffer {
+			if err := out.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// expandBatchFormat fills in the %(atom)s of a batch format for an object.
+// Unknown atoms are left as they are.
+func expandBatchFormat(format string, obj *objects.Object, rest string) string {
+	return strings.NewReplacer(
+		"%(objectname)", obj.Hash,
+		"%(objecttype)", string(obj.Type),
+		"%(objectsize)", fmt.Sprint(len(obj.Content)),
+		"%(rest)", rest,
+	).Replace(format)
+}
@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"mygit/internal/index"
+	"mygit/internal/repository"
+	"mygit/internal/utils"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CheckIgnore handles the `check-ignore` command.
+// It prints the given paths that are ignored, or with -v the pattern that
+// decided each one, to help debug ignore rules.
+//
+// Exit status is 0 if at least one path is ignored and 1 otherwise.
+func CheckIgnore(args []string) {
+	verbose := false
+	nonMatching := false
+	noIndex := false
+	fromStdin := false
+	var paths []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-v" || arg == "--verbose":
+			verbose = true
+		case arg == "-n" || arg == "--non-matching":
+			nonMatching = true
+		case arg == "--no-index":
+			noIndex = true
+		case arg == "--stdin":
+			fromStdin = true
+		case arg == "--":
+			paths = append(paths, args[i+1:]...)
+			i = len(args)
+		case strings.HasPrefix(arg, "-"):
+			fmt.Printf("Error: unknown option '%s'\n", arg)
+			os.Exit(128)
+		default:
+			paths = append(paths, arg)
+		}
+	}
+
+	if nonMatching && !verbose {
+		fmt.Println("fatal: --non-matching is only valid with --verbose")
+		os.Exit(128)
+	}
+
+	if fromStdin {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				paths = append(paths, line)
+			}
+		}
+	}
+
+	if len(paths) == 0 {
+		fmt.Println("Usage: mygit check-ignore [-v] [-n] [--no-index] [--stdin] <pathname>...")
+		os.Exit(128)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(128)
+	}
+
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(128)
+	}
+
+	ignore, err := utils.NewIgnore(repo.WorkDir)
+	if err != nil {
+		fmt.Printf("Error loading ignore rules: %v\n", err)
+		os.Exit(128)
+	}
+
+	// Tracked files are never ignored, unless --no-index asks to check the rules alone
+	idx := index.NewIndex(repo.GitDir)
+	if !noIndex {
+		if err := idx.Load(); err != nil {
+			fmt.Printf("Error loading index: %v\n", err)
+			os.Exit(128)
+		}
+	}
+
+	specs, err := normalizePathspecs(repo, paths)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	anyIgnored := false
+	for i, relPath := range specs {
+		var match *utils.IgnoreMatch
+		if _, tracked := idx.Get(relPath); !tracked {
+			isDir := strings.HasSuffix(paths[i], "/")
+			if info, err := os.Lstat(filepath.Join(repo.WorkDir, relPath)); err == nil {
+				isDir = info.IsDir()
+			}
+			match = ignore.Match(relPath, isDir)
+		}
+
+		if match != nil && !match.Negated {
+			anyIgnored = true
+		}
+
+		switch {
+		case verbose && match != nil:
+			fmt.Printf("%s:%d:%s\t%s\n", match.Source, match.Line, match.Pattern, paths[i])
+		case verbose && nonMatching:
+			fmt.Printf("::\t%s\n", paths[i])
+		case match != nil && !match.Negated:
+			fmt.Println(paths[i])
+		}
+	}
+
+	if !anyIgnored {
+		os.Exit(1)
+	}
+}
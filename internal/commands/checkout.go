@@ -2,6 +2,8 @@ package commands
 
 import (
 	"fmt"
+	"mygit/internal/diff"
+	"mygit/internal/hooks"
 	"mygit/internal/index"
 	"mygit/internal/objects"
 	"mygit/internal/refs"
@@ -10,18 +12,14 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
 // Checkout handles the `checkout` command.
-// It can switch the current HEAD to a specified branch.
+// It can switch the current HEAD to a specified branch, or restore
+// files with `checkout [<rev>] -- <paths>`.
 func Checkout(args []string) {
-	if len(args) != 1 {
-		fmt.Println("Usage: mygit checkout <branch-name>")
-		os.Exit(1)
-	}
-	branchName := args[0]
-
 	// Find the repository
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -34,130 +32,380 @@ func Checkout(args []string) {
 		os.Exit(1)
 	}
 
+	// `checkout -- <paths>` and `checkout <rev> -- <paths>` restore files
+	for i, arg := range args {
+		if arg != "--" {
+			continue
+		}
+		if i > 1 || len(args) == i+1 {
+			fmt.Println("Usage: mygit checkout [<rev>] -- <paths>...")
+			os.Exit(1)
+		}
+
+		opts := RestoreOptions{Worktree: true}
+		if i == 1 {
+			// Like Git, checking out paths from a commit updates the index too
+			opts.Source = args[0]
+			opts.Staged = true
+		}
+		if err := restorePaths(repo, opts, args[i+1:]); err != nil {
+			fmt.Printf("error: %v\n", err)
+			os.Exit(1)
+		}
+
+		head, _ := refs.NewRefManager(repo.GitDir).GetHEAD()
+		runPostCheckout(repo, head, head, false)
+		return
+	}
+
+	merge := false
+	var positional []string
+	for _, arg := range args {
+		if arg == "-m" || arg == "--merge" {
+			merge = true
+		} else {
+			positional = append(positional, arg)
+		}
+	}
+
+	if len(positional) != 1 {
+		fmt.Println("Usage: mygit checkout [-m | --merge] <branch-name>")
+		fmt.Println("       mygit checkout [<rev>] -- <paths>...")
+		os.Exit(1)
+	}
+	branchName := positional[0]
+
 	refManager := refs.NewRefManager(repo.GitDir)
 	objStore := objects.NewObjectStore(repo.GitDir)
 	idx := index.NewIndex(repo.GitDir)
 
-	// --- Full Safety Check ---
 	if err := idx.Load(); err != nil {
 		fmt.Printf("Error loading index: %v\n", err)
 		os.Exit(1)
 	}
 
-	// 1. Check for unstaged changes (working directory vs. index)
-	unstagedChanges, err := utils.GetUnstagedChanges(repo, idx, objStore)
-	if err != nil {
-		fmt.Printf("Error checking for unstaged changes: %v\n", err)
+	// Get the commit hash for the target branch
+	targetRef := path.Join("refs", "heads", branchName)
+	targetCommitHash, err := refManager.GetRef(targetRef)
+	if err != nil || targetCommitHash == "" {
+		fmt.Printf("Error: branch '%s' not found.\n", branchName)
 		os.Exit(1)
 	}
-	if len(unstagedChanges) > 0 {
-		fmt.Println("error: Your local changes to the following files would be overwritten by checkout:")
-		for _, file := range unstagedChanges {
-			fmt.Printf("\t%s\n", file)
-		}
-		fmt.Println("Please commit your changes or stash them before you switch branches.")
-		os.Exit(1)
+
+	previousBranch, _ := refManager.GetCurrentBranch()
+	if previousBranch == branchName {
+		fmt.Printf("Already on '%s'\n", branchName)
+		return
 	}
 
-	// 2. Check for staged changes (index vs. HEAD)
+	// Read the trees we are switching between
 	headCommitHash, _ := refManager.GetHEAD()
-	var headTree map[string]*index.IndexEntry
+	headTree := make(map[string]*index.IndexEntry) // Empty repo, empty tree
 	if headCommitHash != "" {
-		headTree, _ = utils.GetTreeEntriesFromCommit(objStore, headCommitHash)
-	} else {
-		headTree = make(map[string]*index.IndexEntry) // Empty repo, empty tree
+		headTree, err = utils.GetTreeEntriesFromCommit(objStore, headCommitHash)
+		if err != nil {
+			fmt.Printf("Error reading HEAD commit tree: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	targetTree, err := utils.GetTreeEntriesFromCommit(objStore, targetCommitHash)
+	if err != nil {
+		fmt.Printf("Error reading target commit tree: %v\n", err)
+		os.Exit(1)
 	}
 
-	if isDirty(idx, headTree) {
-		fmt.Println("error: Your local changes would be overwritten by checkout.")
-		fmt.Println("Please commit your changes or stash them before you switch branches.")
+	// Only files that differ between the two trees are touched; local
+	// changes to anything else are carried over to the new branch.
+	conflicts, err := switchTrees(repo, objStore, idx, headTree, targetTree, merge, branchName)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
 		os.Exit(1)
 	}
-	// --- End of Safety Check ---
 
-	// Get the commit hash for the target branch
-	targetRef := path.Join("refs", "heads", branchName)
-	targetCommitHash, err := refManager.GetRef(targetRef)
-	if err != nil || targetCommitHash == "" {
-		fmt.Printf("Error: branch '%s' not found.\n", branchName)
+	if err := idx.Save(); err != nil {
+		fmt.Printf("Error saving new index: %v\n", err)
 		os.Exit(1)
 	}
 
 	// Update HEAD to point to the new branch
+	if previousBranch == "" {
+		previousBranch = headCommitHash
+	}
 	if err := refManager.SetHEAD(targetRef); err != nil {
 		fmt.Printf("Error updating HEAD: %v\n", err)
 		os.Exit(1)
 	}
+	refManager.AppendReflog("HEAD", headCommitHash, targetCommitHash, getAuthor(repo),
+		fmt.Sprintf("checkout: moving from %s to %s", previousBranch, branchName))
 
-	// Get the tree from the target commit
-	commit, err := objStore.ReadObject(targetCommitHash)
-	if err != nil || commit.Type != objects.CommitType {
-		fmt.Printf("Error reading target commit object: %v\n", err)
-		os.Exit(1)
+	// Report the local changes that were carried over
+	if changed, err := utils.GetUnstagedChanges(repo, idx, objStore); err == nil {
+		sort.Strings(changed)
+		for _, file := range changed {
+			fmt.Printf("M\t%s\n", file)
+		}
+	}
+	for _, file := range sortedKeys(conflicts) {
+		switch conflicts[file] {
+		case index.DeletedByUs:
+			printModifyDelete(file, "local", branchName)
+		case index.DeletedByThem:
+			printModifyDelete(file, branchName, "local")
+		default:
+			fmt.Printf("CONFLICT (content): Merge conflict in %s\n", file)
+		}
 	}
-	parsedCommit, _ := objects.ParseCommit(commit.Content)
-	treeHash := parsedCommit.Tree
 
-	// Clear the current working directory (of tracked files)
-	if err := clearWorkingDirectory(repo, idx); err != nil {
-		fmt.Printf("Error clearing working directory: %v\n", err)
-		os.Exit(1)
+	fmt.Printf("Switched to branch '%s'\n", branchName)
+	runPostCheckout(repo, headCommitHash, targetCommitHash, true)
+}
+
+// runPostCheckout runs the post-checkout hook with the previous and new
+// HEAD and whether a branch (rather than files) was checked out. Like Git,
+// the checkout is not undone if the hook fails, but its exit status
+// becomes the command's.
+func runPostCheckout(repo *repository.GitRepository, oldHead, newHead string, branch bool) {
+	if oldHead == "" {
+		oldHead = refs.ZeroHash
+	}
+	if newHead == "" {
+		newHead = refs.ZeroHash
 	}
+	flag := "0"
+	if branch {
+		flag = "1"
+	}
+	if err := hooks.Run(repo, "post-checkout", nil, oldHead, newHead, flag); err != nil {
+		if _, ok := err.(*hooks.Error); !ok {
+			fmt.Printf("error: %v\n", err)
+		}
+		os.Exit(hooks.ExitCode(err))
+	}
+}
 
-	// Update the index and working directory from the target tree
-	newIndex := index.NewIndex(repo.GitDir) // Create a fresh index
-	if err := updateWorkspaceFromTree(repo, objStore, newIndex, treeHash, ""); err != nil {
-		fmt.Printf("Error updating workspace from tree: %v\n", err)
-		os.Exit(1)
+// checkoutConflictError lists the files a checkout refused to overwrite.
+type checkoutConflictError struct {
+	modified  []string
+	untracked []string
+}
+
+func (e *checkoutConflictError) Error() string {
+	var b strings.Builder
+	if len(e.modified) > 0 {
+		b.WriteString("Your local changes to the following files would be overwritten by checkout:\n")
+		for _, file := range e.modified {
+			fmt.Fprintf(&b, "\t%s\n", file)
+		}
+		b.WriteString("Please commit your changes or stash them before you switch branches.")
+	}
+	if len(e.untracked) > 0 {
+		if b.Len() > 0 {
+			b.WriteString("\nerror: ")
+		}
+		b.WriteString("The following untracked working tree files would be overwritten by checkout:\n")
+		for _, file := range e.untracked {
+			fmt.Fprintf(&b, "\t%s\n", file)
+		}
+		b.WriteString("Please move or remove them before you switch branches.")
 	}
+	return b.String()
+}
 
-	// Save the new index
-	if err := newIndex.Save(); err != nil {
-		fmt.Printf("Error saving new index: %v\n", err)
-		os.Exit(1)
+// switchTrees performs a two-tree checkout, moving the index and working
+// directory from oldTree to newTree. Paths that are the same in both trees
+// are left alone, so local changes to them survive. A path that differs
+// between the trees is updated only if it has no local changes; otherwise
+// the checkout is refused, or with merge the local changes are merged
+// three-way into the new version. It returns the paths that were merged
+// with conflicts and the kind of each conflict. Nothing is modified if the
+// checkout is refused.
+func switchTrees(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, oldTree, newTree map[string]*index.IndexEntry, merge bool, targetLabel string) (map[string]string, error) {
+	unstagedList, err := utils.GetUnstagedChanges(repo, idx, objStore)
+	if err != nil {
+		return nil, err
+	}
+	unstaged := make(map[string]bool)
+	for _, path := range unstagedList {
+		unstaged[path] = true
 	}
 
-	fmt.Printf("Switched to branch '%s'\n", branchName)
+	paths := make(map[string]bool)
+	for path := range oldTree {
+		paths[path] = true
+	}
+	for path := range newTree {
+		paths[path] = true
+	}
+	sortedPaths := make([]string, 0, len(paths))
+	for path := range paths {
+		sortedPaths = append(sortedPaths, path)
+	}
+	sort.Strings(sortedPaths)
+
+	var updates, merges []string
+	refused := &checkoutConflictError{}
+	for _, path := range sortedPaths {
+		oldEntry, newEntry := oldTree[path], newTree[path]
+		if sameEntry(oldEntry, newEntry) {
+			continue
+		}
+
+		indexEntry, tracked := idx.Get(path)
+		if tracked && sameEntry(indexEntry, newEntry) {
+			// Already staged exactly as the target has it
+			continue
+		}
+
+		if !tracked && oldEntry == nil {
+			// Not tracked anywhere: an untracked file may be in the way
+			content, exists, err := readWorkdirFile(repo, path)
+			if err != nil {
+				return nil, err
+			}
+			if exists && (newEntry == nil || objStore.HashObject(content, objects.BlobType) != newEntry.Hash) {
+				refused.untracked = append(refused.untracked, path)
+				continue
+			}
+			updates = append(updates, path)
+			continue
+		}
+
+		indexClean := tracked && sameEntry(indexEntry, oldEntry)
+		worktreeClean := tracked && !unstaged[path]
+		if !tracked {
+			// Staged deletion: clean only if the file is really gone
+			_, exists, err := readWorkdirFile(repo, path)
+			if err != nil {
+				return nil, err
+			}
+			worktreeClean = !exists
+		}
+
+		switch {
+		case indexClean && worktreeClean:
+			updates = append(updates, path)
+		case merge:
+			merges = append(merges, path)
+		default:
+			refused.modified = append(refused.modified, path)
+		}
+	}
+
+	if len(refused.modified) > 0 || len(refused.untracked) > 0 {
+		return nil, refused
+	}
+
+	for _, path := range updates {
+		newEntry := newTree[path]
+		if newEntry == nil {
+			idx.Remove(path)
+			if err := removeWorkdirFile(repo, path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		info, err := checkoutBlob(repo, objStore, path, newEntry.Hash, newEntry.Permissions)
+		if err != nil {
+			return nil, err
+		}
+		idx.AddWithMode(path, newEntry.Hash, info, newEntry.Permissions)
+	}
+
+	conflicts := make(map[string]string)
+	for _, path := range merges {
+		kind, err := mergeLocalChanges(repo, objStore, idx, path, oldTree[path], newTree[path], targetLabel)
+		if err != nil {
+			return nil, err
+		}
+		if kind != "" {
+			conflicts[path] = kind
+		}
+	}
+
+	return conflicts, nil
 }
 
-// isDirty checks if there are any differences between the index and HEAD tree.
-func isDirty(idx *index.Index, headTree map[string]*index.IndexEntry) bool {
-	indexEntries := idx.GetAll()
+// mergeLocalChanges merges the working directory version of a file with the
+// change between its old and new tree versions, as `checkout --merge` does.
+// The index is set to the new version, so the merged local edits show up as
+// unstaged changes. A path left with conflicts is marked unmerged, and the
+// kind of conflict is returned ("" for a clean merge).
+func mergeLocalChanges(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, path string, oldEntry, newEntry *index.IndexEntry, targetLabel string) (string, error) {
+	ours, exists, err := readWorkdirFile(repo, path)
+	if err != nil {
+		return "", err
+	}
 
-	// Check for additions or modifications
-	for path, indexEntry := range indexEntries {
-		if headEntry, exists := headTree[path]; !exists || headEntry.Hash != indexEntry.Hash {
-			return true
+	if newEntry == nil {
+		// Deleted in the target but modified locally: keep the local file
+		idx.Remove(path)
+		if !exists {
+			return "", nil
+		}
+		idx.SetConflict(path, index.DeletedByThem)
+		return index.DeletedByThem, nil
+	}
+	if !exists {
+		// Deleted locally but changed in the target: take the target version
+		info, err := checkoutBlob(repo, objStore, path, newEntry.Hash, newEntry.Permissions)
+		if err != nil {
+			return "", err
 		}
+		idx.AddWithMode(path, newEntry.Hash, info, newEntry.Permissions)
+		idx.SetConflict(path, index.DeletedByUs)
+		return index.DeletedByUs, nil
 	}
 
-	// Check for deletions
-	for path := range headTree {
-		if _, exists := indexEntries[path]; !exists {
-			return true
+	var base []byte
+	if oldEntry != nil {
+		baseObj, err := objStore.ReadObject(oldEntry.Hash)
+		if err != nil {
+			return "", err
 		}
+		base = baseObj.Content
+	}
+	theirsObj, err := objStore.ReadObject(newEntry.Hash)
+	if err != nil {
+		return "", err
 	}
 
-	return false
+	merged, conflicted := diff.MergeBytes(base, ours, theirsObj.Content, "local", targetLabel)
+	if _, err := writeWorkdirFile(repo, path, merged, newEntry.Permissions); err != nil {
+		return "", err
+	}
+	idx.Set(&index.IndexEntry{Path: path, Hash: newEntry.Hash, Permissions: newEntry.Permissions})
+	if conflicted {
+		idx.SetConflict(path, index.BothModified)
+		return index.BothModified, nil
+	}
+	return "", nil
 }
 
-// clearWorkingDirectory removes all files and directories tracked in the index.
-func clearWorkingDirectory(repo *repository.GitRepository, idx *index.Index) error {
-	// It's safer to load the index again to ensure we have the right file list.
-	idx.Load()
-	for path := range idx.GetAll() {
-		fullPath := filepath.Join(repo.WorkDir, path)
-		if err := os.Remove(fullPath); err != nil {
-			if !os.IsNotExist(err) {
-				return err
-			}
+// sameEntry reports whether two (possibly missing) entries have the same content.
+func sameEntry(a, b *index.IndexEntry) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Hash == b.Hash
+}
+
+// readWorkdirFile reads a file (or the target of a symbolic link) from the
+// working directory, reporting whether it exists.
+func readWorkdirFile(repo *repository.GitRepository, relPath string) ([]byte, bool, error) {
+	content, _, err := utils.ReadWorktreeFile(filepath.Join(repo.WorkDir, relPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
 		}
+		return nil, false, err
 	}
-	return nil
+	return content, true, nil
 }
 
 // updateWorkspaceFromTree recursively populates the index and working dir from a tree.
-func updateWorkspaceFromTree(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, treeHash, currentPath string) error {
+// If filter is non-nil, only paths it accepts are written. If idx is nil,
+// only the working directory is updated.
+func updateWorkspaceFromTree(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, treeHash, currentPath string, filter func(string) bool) error {
 	treeObj, err := objStore.ReadObject(treeHash)
 	if err != nil || treeObj.Type != objects.TreeType {
 		return fmt.Errorf("could not read tree object %s", treeHash)
@@ -173,30 +421,72 @@ func updateWorkspaceFromTree(repo *repository.GitRepository, objStore *objects.O
 
 		if entry.Type == objects.TreeType {
 			// It's a directory, recurse
-			if err := updateWorkspaceFromTree(repo, objStore, idx, entry.Hash, pathInRepo); err != nil {
+			if err := updateWorkspaceFromTree(repo, objStore, idx, entry.Hash, pathInRepo, filter); err != nil {
 				return err
 			}
 		} else {
 			// It's a file (blob)
-			blobObj, err := objStore.ReadObject(entry.Hash)
-			if err != nil {
-				return fmt.Errorf("could not read blob object %s", entry.Hash)
+			relPath := strings.ReplaceAll(pathInRepo, "\\", "/")
+			if filter != nil && !filter(relPath) {
+				continue
 			}
 
-			// Write the file to the working directory
-			filePath := filepath.Join(repo.WorkDir, pathInRepo)
-			if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
-				return err
-			}
-			if err := os.WriteFile(filePath, blobObj.Content, 0644); err != nil {
+			perm := objects.PermissionsFromMode(entry.Mode)
+			info, err := checkoutBlob(repo, objStore, relPath, entry.Hash, perm)
+			if err != nil {
 				return err
 			}
 
 			// Add the file to the new index
-			info, _ := os.Stat(filePath)
-			idx.Add(strings.ReplaceAll(pathInRepo, "\\", "/"), entry.Hash, info)
+			if idx != nil {
+				idx.AddWithMode(relPath, entry.Hash, info, perm)
+			}
 		}
 	}
 
 	return nil
 }
+
+// checkoutBlob writes the content of a blob to the given path in the working
+// directory, creating a symbolic link or an executable file as perm says.
+func checkoutBlob(repo *repository.GitRepository, objStore *objects.ObjectStore, relPath, hash string, perm os.FileMode) (os.FileInfo, error) {
+	blobObj, err := objStore.ReadObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("could not read blob object %s", hash)
+	}
+	return writeWorkdirFile(repo, relPath, blobObj.Content, perm)
+}
+
+// writeWorkdirFile writes content to the given path in the working
+// directory, as a symbolic link to it or as a file that is executable or
+// not, as perm says.
+func writeWorkdirFile(repo *repository.GitRepository, relPath string, content []byte, perm os.FileMode) (os.FileInfo, error) {
+	filePath := filepath.Join(repo.WorkDir, relPath)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return nil, err
+	}
+
+	// Remove whatever is there first, so that a file can become a link (or
+	// the other way around) and the new permissions take effect.
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	opts := utils.LoadWorktreeOptions(repo)
+	if perm&os.ModeSymlink != 0 && opts.Symlinks {
+		if err := os.Symlink(string(content), filePath); err != nil {
+			return nil, err
+		}
+		return os.Lstat(filePath)
+	}
+
+	fileMode := os.FileMode(0644)
+	if perm&0111 != 0 && perm&os.ModeSymlink == 0 && opts.FileMode {
+		fileMode = 0755
+	}
+	if err := os.WriteFile(filePath, content, fileMode); err != nil {
+		return nil, err
+	}
+
+	return os.Lstat(filePath)
+}
@@ -0,0 +1,680 @@
+package commands
+
+import (
+	"fmt"
+	"mygit/internal/index"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"mygit/internal/utils"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sequencerDir is the directory under .mygit where a cherry-pick or revert
+// of several commits keeps the commits still to apply, named as in Git.
+const sequencerDir = "sequencer"
+
+// pickOptions holds the options of a cherry-pick or revert.
+type pickOptions struct {
+	revert       bool
+	noCommit     bool
+	mainline     int  // the parent to diff a merge against, counting from 1
+	recordOrigin bool // -x
+	edit         bool
+}
+
+// action is the name of the command, for messages.
+func (o pickOptions) action() string {
+	if o.revert {
+		return "revert"
+	}
+	return "cherry-pick"
+}
+
+// CherryPick handles the `cherry-pick` command, which applies the changes
+// made by existing commits on top of HEAD:
+//
+//	mygit cherry-pick [-n] [-m <parent>] [-x] [-e] <commit>...
+//	mygit cherry-pick (--continue | --skip | --abort | --quit)
+func CherryPick(args []string) {
+	runPicks(args, false)
+}
+
+// Revert handles the `revert` command, which records new commits undoing
+// the changes made by existing ones:
+//
+//	mygit revert [-n] [-m <parent>] [--no-edit] <commit>...
+//	mygit revert (--continue | --skip | --abort | --quit)
+func Revert(args []string) {
+	runPicks(args, true)
+}
+
+// runPicks parses the arguments shared by cherry-pick and revert. Each
+// commit is applied with a three-way merge against its parent, in the
+// order given (oldest first for a range); a conflict stops the sequence
+// until it is continued, skipped or aborted.
+func runPicks(args []string, revert bool) {
+	opts := pickOptions{revert: revert, edit: revert}
+	action := ""
+	var revs []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-n" || arg == "--no-commit":
+			opts.noCommit = true
+		case arg == "-x":
+			opts.recordOrigin = true
+		case arg == "-e" || arg == "--edit":
+			opts.edit = true
+		case arg == "--no-edit":
+			opts.edit = false
+		case arg == "-m" || arg == "--mainline" || strings.HasPrefix(arg, "--mainline="):
+			value, ok := strings.CutPrefix(arg, "--mainline=")
+			if !ok {
+				if i+1 >= len(args) {
+					fmt.Println("error: switch `m' requires a value")
+					os.Exit(129)
+				}
+				i++
+				value = args[i]
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				fmt.Println("error: option `mainline' expects a number greater than zero")
+				os.Exit(129)
+			}
+			opts.mainline = n
+		case arg == "--continue" || arg == "--skip" || arg == "--abort" || arg == "--quit":
+			action = arg
+		case strings.HasPrefix(arg, "-"):
+			fmt.Printf("error: unknown option '%s'\n", strings.TrimLeft(arg, "-"))
+			os.Exit(129)
+		default:
+			revs = append(revs, arg)
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(1)
+	}
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	p := newPicker(repo, opts)
+	if action != "" {
+		if len(revs) > 0 {
+			fmt.Printf("fatal: %s does not take arguments\n", action)
+			os.Exit(128)
+		}
+		if !p.inProgress() {
+			fmt.Println("error: no cherry-pick or revert in progress")
+			fmt.Printf("fatal: %s failed\n", opts.action())
+			os.Exit(128)
+		}
+		p.loadOptions()
+
+		switch action {
+		case "--continue":
+			err = p.resume()
+		case "--skip":
+			err = p.skip()
+		case "--abort":
+			err = p.abort()
+		case "--quit":
+			p.cleanup()
+		}
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+			fmt.Printf("fatal: %s failed\n", p.opts.action())
+			os.Exit(128)
+		}
+		return
+	}
+
+	if len(revs) == 0 {
+		fmt.Printf("usage: mygit %s [<options>] <commit-ish>...\n", opts.action())
+		os.Exit(129)
+	}
+	if p.inProgress() {
+		fmt.Printf("error: %s is already in progress\n", p.currentAction())
+		fmt.Printf("hint: try \"mygit %s (--continue | --skip | --abort | --quit)\"\n", p.currentAction())
+		fmt.Printf("fatal: %s failed\n", opts.action())
+		os.Exit(128)
+	}
+	if err := p.start(revs); err != nil {
+		fmt.Printf("error: %v\n", err)
+		fmt.Printf("fatal: %s failed\n", opts.action())
+		os.Exit(128)
+	}
+}
+
+// picker applies commits for cherry-pick and revert.
+type picker struct {
+	repo       *repository.GitRepository
+	objStore   *objects.ObjectStore
+	refManager *refs.RefManager
+	walk       *revWalk
+	dir        string
+	opts       pickOptions
+}
+
+func newPicker(repo *repository.GitRepository, opts pickOptions) *picker {
+	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+	return &picker{
+		repo:       repo,
+		objStore:   objStore,
+		refManager: refManager,
+		walk:       newRevWalk(objStore, refManager),
+		dir:        filepath.Join(repo.GitDir, sequencerDir),
+		opts:       opts,
+	}
+}
+
+// pickHead returns the name of the file recording the commit a stopped
+// cherry-pick or revert was applying.
+func pickHead(revert bool) string {
+	if revert {
+		return "REVERT_HEAD"
+	}
+	return "CHERRY_PICK_HEAD"
+}
+
+// stoppedAt returns the commit a stopped cherry-pick or revert was
+// applying, and whether it was a revert, or "" if none was stopped.
+func stoppedAt(repo *repository.GitRepository) (string, bool) {
+	for _, revert := range []bool{false, true} {
+		content, err := os.ReadFile(filepath.Join(repo.GitDir, pickHead(revert)))
+		if err == nil {
+			return strings.TrimSpace(string(content)), revert
+		}
+	}
+	return "", false
+}
+
+// clearPickState removes the files that record a stopped cherry-pick or
+// revert, once its commit has been made.
+func clearPickState(repo *repository.GitRepository) {
+	for _, name := range []string{"CHERRY_PICK_HEAD", "REVERT_HEAD", "MERGE_MSG"} {
+		os.Remove(filepath.Join(repo.GitDir, name))
+	}
+}
+
+func (p *picker) inProgress() bool {
+	hash, _ := stoppedAt(p.repo)
+	return hash != "" || utils.PathExists(p.dir)
+}
+
+// currentAction names the command that is in progress.
+func (p *picker) currentAction() string {
+	if hash, revert := stoppedAt(p.repo); hash != "" {
+		return pickOptions{revert: revert}.action()
+	}
+	if todo, err := os.ReadFile(filepath.Join(p.dir, "todo")); err == nil && strings.HasPrefix(string(todo), "revert ") {
+		return "revert"
+	}
+	return "cherry-pick"
+}
+
+// loadOptions takes the options of the cherry-pick or revert in progress,
+// whichever command continues it.
+func (p *picker) loadOptions() {
+	p.opts.revert = p.currentAction() == "revert"
+	content, err := os.ReadFile(filepath.Join(p.dir, "opts"))
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		switch key {
+		case "mainline":
+			p.opts.mainline, _ = strconv.Atoi(value)
+		case "record-origin":
+			p.opts.recordOrigin = true
+		case "edit":
+			p.opts.edit = value == "true"
+		}
+	}
+}
+
+// start resolves the commits to apply and applies them.
+func (p *picker) start(revs []string) error {
+	commits, err := p.commitsToApply(revs)
+	if err != nil {
+		return err
+	}
+
+	head, err := p.refManager.GetHEAD()
+	if err != nil || head == "" {
+		return fmt.Errorf("your current branch does not have any commits yet")
+	}
+	if err := p.requireClean(head); err != nil {
+		return err
+	}
+
+	if len(commits) > 1 && !p.opts.noCommit {
+		if err := os.MkdirAll(p.dir, 0755); err != nil {
+			return err
+		}
+		opts := fmt.Sprintf("edit=%t\n", p.opts.edit)
+		if p.opts.mainline > 0 {
+			opts += fmt.Sprintf("mainline=%d\n", p.opts.mainline)
+		}
+		if p.opts.recordOrigin {
+			opts += "record-origin\n"
+		}
+		if err := os.WriteFile(filepath.Join(p.dir, "opts"), []byte(opts), 0644); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(p.dir, "head"), []byte(head+"\n"), 0644); err != nil {
+			return err
+		}
+	}
+	return p.run(commits)
+}
+
+// commitsToApply resolves the commits named on the command line. A range
+// such as A..B gives its commits oldest first; single commits are taken
+// in the order given.
+func (p *picker) commitsToApply(revs []string) ([]string, error) {
+	isRange := false
+	for _, rev := range revs {
+		if strings.Contains(rev, "..") || strings.HasPrefix(rev, "^") {
+			isRange = true
+		}
+	}
+	if !isRange {
+		commits := make([]string, 0, len(revs))
+		for _, rev := range revs {
+			hash, err := p.walk.peelCommit(rev)
+			if err != nil {
+				return nil, fmt.Errorf("bad revision '%s'", rev)
+			}
+			commits = append(commits, hash)
+		}
+		return commits, nil
+	}
+
+	tips, err := p.walk.selectRange(revs)
+	if err != nil {
+		return nil, err
+	}
+	sorted, err := p.walk.sort(tips, orderTopo)
+	if err != nil {
+		return nil, err
+	}
+	if len(sorted) == 0 {
+		return nil, fmt.Errorf("empty commit set passed")
+	}
+	commits := make([]string, len(sorted))
+	for i, hash := range sorted {
+		commits[len(sorted)-1-i] = hash
+	}
+	return commits, nil
+}
+
+// requireClean refuses to apply commits over local changes. With -n,
+// changes already staged are fine, since the result is only staged.
+func (p *picker) requireClean(head string) error {
+	idx := index.NewIndex(p.repo.GitDir)
+	if err := idx.Load(); err != nil {
+		return err
+	}
+	unstaged, err := utils.GetUnstagedChanges(p.repo, idx, p.objStore)
+	if err != nil {
+		return err
+	}
+	dirty := len(unstaged) > 0 || len(idx.Conflicts()) > 0
+	if !dirty && !p.opts.noCommit {
+		headTree, err := utils.GetTreeEntriesFromCommit(p.objStore, head)
+		if err != nil {
+			return err
+		}
+		dirty = len(diffEntries(headTree, idx.GetAll())) > 0
+	}
+	if dirty {
+		return fmt.Errorf("your local changes would be overwritten by %s.\nhint: commit your changes or stash them to proceed.", p.opts.action())
+	}
+	return nil
+}
+
+// run applies the commits one by one. The ones after a commit that stops
+// are saved in the sequencer's todo list.
+func (p *picker) run(commits []string) error {
+	for i, hash := range commits {
+		if utils.PathExists(p.dir) {
+			if err := p.writeTodo(commits[i+1:]); err != nil {
+				return err
+			}
+		}
+		if err := p.pick(hash); err != nil {
+			return err
+		}
+	}
+	p.cleanup()
+	return nil
+}
+
+// writeTodo saves the commits still to apply.
+func (p *picker) writeTodo(commits []string) error {
+	var b strings.Builder
+	for _, hash := range commits {
+		c, err := p.walk.commit(hash)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s %s %s\n", p.opts.action(), hash, firstLine(c.Message))
+	}
+	return os.WriteFile(filepath.Join(p.dir, "todo"), []byte(b.String()), 0644)
+}
+
+// readTodo returns the commits still to apply.
+func (p *picker) readTodo() []string {
+	content, err := os.ReadFile(filepath.Join(p.dir, "todo"))
+	if err != nil {
+		return nil
+	}
+	var commits []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 {
+			commits = append(commits, fields[1])
+		}
+	}
+	return commits
+}
+
+// pick applies one commit, or its inverse, and commits the result unless
+// -n was given. A conflict, or a commit that turns out empty, stops the
+// command with the state recorded for --continue.
+func (p *picker) pick(hash string) error {
+	commit, err := p.walk.commit(hash)
+	if err != nil {
+		return err
+	}
+	abbrev := hash[:abbrevLength]
+
+	parent := ""
+	switch {
+	case len(commit.Parents) > 1 && p.opts.mainline == 0:
+		return fmt.Errorf("commit %s is a merge but no -m option was given.", hash)
+	case len(commit.Parents) > 1:
+		if p.opts.mainline > len(commit.Parents) {
+			return fmt.Errorf("commit %s does not have parent %d", hash, p.opts.mainline)
+		}
+		parent = commit.Parents[p.opts.mainline-1]
+	case p.opts.mainline > 0:
+		return fmt.Errorf("mainline was specified but commit %s is not a merge.", hash)
+	case len(commit.Parents) == 1:
+		parent = commit.Parents[0]
+	}
+
+	commitTree, err := p.walk.tree(hash)
+	if err != nil {
+		return err
+	}
+	parentTree := make(map[string]*index.IndexEntry)
+	if parent != "" {
+		if parentTree, err = p.walk.tree(parent); err != nil {
+			return err
+		}
+	}
+
+	subject := firstLine(commit.Message)
+	base, theirs := parentTree, commitTree
+	theirsLabel := fmt.Sprintf("%s (%s)", abbrev, subject)
+	message := commit.Message
+	if p.opts.revert {
+		base, theirs = commitTree, parentTree
+		theirsLabel = "parent of " + theirsLabel
+		message = fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s", subject, hash)
+		if len(commit.Parents) > 1 {
+			message += fmt.Sprintf(", reversing\nchanges made to %s", parent)
+		}
+		message += ".\n"
+	} else if p.opts.recordOrigin {
+		message = strings.TrimRight(message, "\n") + fmt.Sprintf("\n\n(cherry picked from commit %s)\n", hash)
+	}
+
+	idx := index.NewIndex(p.repo.GitDir)
+	if err := idx.Load(); err != nil {
+		return err
+	}
+	ours := make(map[string]*index.IndexEntry)
+	for path, entry := range idx.GetAll() {
+		ours[path] = entry
+	}
+	conflicts, err := mergeTrees(p.repo, p.objStore, idx, base, ours, theirs, "HEAD", theirsLabel)
+	if err != nil {
+		return err
+	}
+	if err := idx.Save(); err != nil {
+		return err
+	}
+
+	if len(conflicts) > 0 {
+		message = strings.TrimRight(message, "\n") + "\n\n# Conflicts:\n"
+		for _, path := range conflicts {
+			message += "#\t" + path + "\n"
+		}
+		p.stop(hash, message)
+		verb := "apply"
+		if p.opts.revert {
+			verb = "revert"
+		}
+		fmt.Printf("error: could not %s %s... %s\n", verb, abbrev, subject)
+		if p.opts.noCommit {
+			fmt.Println("hint: after resolving the conflicts, mark the corrected paths")
+			fmt.Println("hint: with 'mygit add <paths>' or 'mygit rm <paths>'")
+		} else {
+			fmt.Println("hint: After resolving the conflicts, mark them with")
+			fmt.Println("hint: \"mygit add/rm <pathspec>\", then run")
+			fmt.Printf("hint: \"mygit %s --continue\".\n", p.opts.action())
+			fmt.Printf("hint: You can instead skip this commit with \"mygit %s --skip\".\n", p.opts.action())
+			fmt.Printf("hint: To abort and get back to the state before \"mygit %s\",\n", p.opts.action())
+			fmt.Printf("hint: run \"mygit %s --abort\".\n", p.opts.action())
+		}
+		os.Exit(1)
+	}
+	if p.opts.noCommit {
+		return nil
+	}
+
+	if p.opts.edit {
+		if message, err = editMessage(p.repo, message); err != nil {
+			return err
+		}
+	}
+	return p.commit(hash, commit, message)
+}
+
+// stop records a commit that could not be applied, with the message to
+// commit its resolution with.
+func (p *picker) stop(hash, message string) {
+	if !p.opts.noCommit {
+		os.WriteFile(filepath.Join(p.repo.GitDir, pickHead(p.opts.revert)), []byte(hash+"\n"), 0644)
+	}
+	os.WriteFile(filepath.Join(p.repo.GitDir, "MERGE_MSG"), []byte(message), 0644)
+}
+
+// commit commits the index as the result of applying a commit. A
+// cherry-pick keeps the original author; a revert is authored by the
+// user. An empty result stops the command.
+func (p *picker) commit(hash string, commit *objects.Commit, message string) error {
+	head, err := p.refManager.GetHEAD()
+	if err != nil {
+		return err
+	}
+	headTree, err := utils.GetTreeEntriesFromCommit(p.objStore, head)
+	if err != nil {
+		return err
+	}
+	idx := index.NewIndex(p.repo.GitDir)
+	if err := idx.Load(); err != nil {
+		return err
+	}
+	changes := diffEntries(headTree, idx.GetAll())
+	if len(changes) == 0 {
+		p.stop(hash, message)
+		if p.opts.revert {
+			fmt.Println("nothing to commit, working tree clean")
+		} else {
+			fmt.Println("The previous cherry-pick is now empty, possibly due to conflict resolution.")
+			fmt.Println("If you wish to skip this commit, use:")
+			fmt.Println()
+			fmt.Println("    mygit cherry-pick --skip")
+		}
+		os.Exit(1)
+	}
+
+	tree, err := p.objStore.BuildTreeFromIndex(idx.GetAll())
+	if err != nil {
+		return err
+	}
+	author := commit.Author
+	if p.opts.revert {
+		author = objects.NewSignature(getAuthor(p.repo), time.Now())
+	}
+	newHash, err := writeCommit(p.repo, p.objStore, tree, []string{head}, author, message)
+	if err != nil {
+		return err
+	}
+	if err := p.refManager.UpdateHEAD(newHash, getAuthor(p.repo), p.opts.action()+": "+firstLine(message)); err != nil {
+		return err
+	}
+	clearPickState(p.repo)
+	printCommitSummary(p.objStore, p.refManager, newHash, message, false, changes)
+	return nil
+}
+
+// resume commits the resolution of the commit the command stopped at, if
+// the user has not committed it already, and applies the rest.
+func (p *picker) resume() error {
+	idx := index.NewIndex(p.repo.GitDir)
+	if err := idx.Load(); err != nil {
+		return err
+	}
+	if len(idx.Conflicts()) > 0 {
+		return fmt.Errorf("Committing is not possible because you have unmerged files.\nhint: Fix them up in the work tree, and then use 'mygit add/rm <file>'\nhint: as appropriate to mark resolution and make a commit.")
+	}
+
+	if hash, _ := stoppedAt(p.repo); hash != "" {
+		commit, err := p.walk.commit(hash)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(filepath.Join(p.repo.GitDir, "MERGE_MSG"))
+		if err != nil {
+			return err
+		}
+		message, err := editMessage(p.repo, string(content))
+		if err != nil {
+			return err
+		}
+		if err := p.commit(hash, commit, message); err != nil {
+			return err
+		}
+	}
+
+	head, err := p.refManager.GetHEAD()
+	if err != nil {
+		return err
+	}
+	if err := p.requireClean(head); err != nil {
+		return err
+	}
+	return p.run(p.readTodo())
+}
+
+// skip drops the commit the command stopped at, with any changes made to
+// the working directory, and applies the rest.
+func (p *picker) skip() error {
+	if hash, _ := stoppedAt(p.repo); hash == "" {
+		return fmt.Errorf("no %s to skip", p.opts.action())
+	}
+	if err := p.resetTo(""); err != nil {
+		return err
+	}
+	clearPickState(p.repo)
+	return p.run(p.readTodo())
+}
+
+// abort returns to the commit the command started from.
+func (p *picker) abort() error {
+	start := ""
+	if content, err := os.ReadFile(filepath.Join(p.dir, "head")); err == nil {
+		start = strings.TrimSpace(string(content))
+	}
+	if err := p.resetTo(start); err != nil {
+		return err
+	}
+	p.cleanup()
+	return nil
+}
+
+// resetTo resets the index and working directory to a commit, moving the
+// current branch there too, or to HEAD if commit is "".
+func (p *picker) resetTo(commit string) error {
+	head, err := p.refManager.GetHEAD()
+	if err != nil {
+		return err
+	}
+	if commit == "" {
+		commit = head
+	}
+	c, err := readCommit(p.objStore, commit)
+	if err != nil {
+		return err
+	}
+	if _, err := resetToTree(p.repo, p.objStore, c.Tree, true); err != nil {
+		return err
+	}
+	if commit != head {
+		return p.refManager.UpdateHEAD(commit, getAuthor(p.repo), p.opts.action()+": abort")
+	}
+	return nil
+}
+
+// cleanup forgets the cherry-pick or revert in progress.
+func (p *picker) cleanup() {
+	clearPickState(p.repo)
+	os.RemoveAll(p.dir)
+}
+
+// pickStatusLines describes a cherry-pick or revert in progress for
+// status, or returns nil if there is none.
+func pickStatusLines(repo *repository.GitRepository, unmerged bool) []string {
+	hash, revert := stoppedAt(repo)
+	if hash == "" {
+		if utils.PathExists(filepath.Join(repo.GitDir, sequencerDir)) {
+			return []string{"Cherry-pick currently in progress.",
+				"  (run \"mygit cherry-pick --continue\" to continue)",
+				"  (use \"mygit cherry-pick --skip\" to skip this patch)",
+				"  (use \"mygit cherry-pick --abort\" to cancel the cherry-pick operation)"}
+		}
+		return nil
+	}
+
+	action, verb := "cherry-pick", "cherry-picking"
+	if revert {
+		action, verb = "revert", "reverting"
+	}
+	lines := []string{fmt.Sprintf("You are currently %s commit %s.", verb, hash[:abbrevLength])}
+	if unmerged {
+		lines = append(lines, fmt.Sprintf("  (fix conflicts and run \"mygit %s --continue\")", action))
+	} else {
+		lines = append(lines, fmt.Sprintf("  (all conflicts fixed: run \"mygit %s --continue\")", action))
+	}
+	return append(lines,
+		fmt.Sprintf("  (use \"mygit %s --skip\" to skip this patch)", action),
+		fmt.Sprintf("  (use \"mygit %s --abort\" to cancel the %s operation)", action, action))
+}
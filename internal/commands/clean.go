@@ -0,0 +1,529 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mygit/internal/config"
+	"mygit/internal/index"
+	"mygit/internal/repository"
+	"mygit/internal/utils"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Which files clean removes, besides untracked ones that are not ignored
+const (
+	cleanUntracked   = iota
+	cleanWithIgnored // -x
+	cleanOnlyIgnored // -X
+)
+
+// cleanOptions holds the options of clean.
+type cleanOptions struct {
+	dryRun      bool
+	force       int // -ff also removes nested repositories
+	interactive bool
+	quiet       bool
+	dirs        bool
+	mode        int
+	excludes    []string
+}
+
+// Clean handles the `clean` command, which removes untracked files from
+// the working tree:
+//
+//	mygit clean [-d] [-f] [-i] [-n] [-q] [-e <pattern>] [-x | -X] [--] [<path>...]
+//
+// Only the current directory is cleaned unless paths are given. Unless
+// clean.requireForce is false, one of -f, -n or -i is required.
+func Clean(args []string) {
+	var opts cleanOptions
+	var paths []string
+	withIgnored, onlyIgnored := false, false
+	usage := func() {
+		fmt.Println("usage: mygit clean [-d] [-f] [-i] [-n] [-q] [-e <pattern>] [-x | -X] [--] [<pathspec>...]")
+		os.Exit(129)
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			paths = append(paths, args[i+1:]...)
+			i = len(args)
+		case arg == "-e" || arg == "--exclude":
+			if i+1 >= len(args) {
+				fmt.Println("error: switch `e' requires a value")
+				usage()
+			}
+			i++
+			opts.excludes = append(opts.excludes, args[i])
+		case strings.HasPrefix(arg, "--exclude="):
+			opts.excludes = append(opts.excludes, strings.TrimPrefix(arg, "--exclude="))
+		case arg == "--dry-run":
+			opts.dryRun = true
+		case arg == "--force":
+			opts.force++
+		case arg == "--interactive":
+			opts.interactive = true
+		case arg == "--quiet":
+			opts.quiet = true
+		case len(arg) > 1 && arg[0] == '-' && arg[1] != '-':
+			// Bundled short options, with -e taking the rest as its value
+			for j := 1; j < len(arg); j++ {
+				switch arg[j] {
+				case 'n':
+					opts.dryRun = true
+				case 'f':
+					opts.force++
+				case 'i':
+					opts.interactive = true
+				case 'q':
+					opts.quiet = true
+				case 'd':
+					opts.dirs = true
+				case 'x':
+					opts.mode, withIgnored = cleanWithIgnored, true
+				case 'X':
+					opts.mode, onlyIgnored = cleanOnlyIgnored, true
+				case 'e':
+					if j+1 < len(arg) {
+						opts.excludes = append(opts.excludes, arg[j+1:])
+					} else if i+1 < len(args) {
+						i++
+						opts.excludes = append(opts.excludes, args[i])
+					} else {
+						fmt.Println("error: switch `e' requires a value")
+						usage()
+					}
+					j = len(arg)
+				default:
+					fmt.Printf("error: unknown switch `%c'\n", arg[j])
+					usage()
+				}
+			}
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			fmt.Printf("error: unknown option `%s'\n", strings.TrimPrefix(arg, "--"))
+			usage()
+		default:
+			paths = append(paths, arg)
+		}
+	}
+	if withIgnored && onlyIgnored {
+		fmt.Println("fatal: -x and -X cannot be used together")
+		os.Exit(128)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(128)
+	}
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	cfg := config.NewConfig(filepath.Join(repo.GitDir, "config"))
+	if err := cfg.Load(); err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	if cfg.GetBool("clean.requireForce", true) && opts.force == 0 && !opts.dryRun && !opts.interactive {
+		fmt.Println("fatal: clean.requireForce defaults to true and neither -i, -n, nor -f given; refusing to clean")
+		os.Exit(128)
+	}
+
+	prefix := ""
+	if rel, err := filepath.Rel(repo.WorkDir, cwd); err == nil && rel != "." {
+		prefix = filepath.ToSlash(rel)
+	}
+	specs, err := normalizePathspecs(repo, paths)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	// Paths make -d irrelevant: directories they name are removed
+	if len(specs) > 0 {
+		opts.dirs = true
+	} else if prefix != "" {
+		specs = []string{prefix}
+	}
+
+	c, err := newCleaner(repo, opts, specs)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	if _, err := c.scan(""); err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	sort.Strings(c.found)
+
+	items := c.found
+	if opts.interactive && !opts.dryRun && len(items) > 0 {
+		if items = cleanInteractive(bufio.NewReader(os.Stdin), os.Stdout, c.found, prefix); items == nil {
+			return
+		}
+	}
+	failed := false
+	for _, item := range items {
+		name := relativeTo(strings.TrimSuffix(item, "/"), prefix)
+		if strings.HasSuffix(item, "/") {
+			name += "/"
+		}
+		if opts.dryRun {
+			fmt.Printf("Would remove %s\n", name)
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(repo.WorkDir, filepath.FromSlash(item))); err != nil {
+			fmt.Printf("warning: failed to remove %s: %v\n", name, err)
+			failed = true
+			continue
+		}
+		if !opts.quiet {
+			fmt.Printf("Removing %s\n", name)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// cleaner finds the files and directories clean removes.
+type cleaner struct {
+	repo       *repository.GitRepository
+	opts       cleanOptions
+	specs      []string
+	tracked    map[string]bool // tracked and unmerged files
+	trackedDir map[string]bool // directories holding tracked files
+	ignore     *utils.Ignore   // what is kept, or with -X what is removed
+	found      []string        // paths to remove; directories end in "/"
+}
+
+func newCleaner(repo *repository.GitRepository, opts cleanOptions, specs []string) (*cleaner, error) {
+	idx := index.NewIndex(repo.GitDir)
+	if err := idx.Load(); err != nil {
+		return nil, err
+	}
+	c := &cleaner{repo: repo, opts: opts, specs: specs, tracked: make(map[string]bool), trackedDir: make(map[string]bool)}
+	addTracked := func(p string) {
+		c.tracked[p] = true
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			c.trackedDir[dir] = true
+		}
+	}
+	for p := range idx.GetAll() {
+		addTracked(p)
+	}
+	for p := range idx.Conflicts() {
+		addTracked(p)
+	}
+
+	// -x still keeps what -e excludes
+	if opts.mode == cleanWithIgnored {
+		c.ignore = utils.NewCommandLineIgnore(repo.WorkDir, opts.excludes)
+		return c, nil
+	}
+	ignore, err := utils.NewIgnore(repo.WorkDir)
+	if err != nil {
+		return nil, err
+	}
+	ignore.AddPatterns(opts.excludes)
+	c.ignore = ignore
+	return c, nil
+}
+
+// scan adds what is to be removed in a directory ("" for the top) to
+// c.found, and reports whether everything in it is, so that the directory
+// can go as a whole.
+func (c *cleaner) scan(dir string) (bool, error) {
+	entries, err := os.ReadDir(filepath.Join(c.repo.WorkDir, filepath.FromSlash(dir)))
+	if err != nil {
+		return false, err
+	}
+	all := true
+	for _, e := range entries {
+		p := e.Name()
+		if dir != "" {
+			p = dir + "/" + p
+		}
+		if dir == "" && p == repository.GitDir || !c.mayMatch(p) {
+			all = false
+			continue
+		}
+
+		if !e.IsDir() {
+			if c.tracked[p] || !c.selected(p) || !c.removable(p) {
+				all = false
+				continue
+			}
+			c.found = append(c.found, p)
+			continue
+		}
+
+		if c.trackedDir[p] {
+			if _, err := c.scan(p); err != nil {
+				return false, err
+			}
+			all = false
+			continue
+		}
+		ok, err := c.untrackedDir(p)
+		if err != nil {
+			return false, err
+		}
+		all = all && ok
+	}
+	return all, nil
+}
+
+// untrackedDir handles a directory without tracked files, and reports
+// whether it is removed as a whole.
+func (c *cleaner) untrackedDir(dir string) (bool, error) {
+	// Another repository is only removed with -ff
+	if c.opts.force < 2 && (utils.PathExists(filepath.Join(c.repo.WorkDir, dir, repository.GitDir)) ||
+		utils.PathExists(filepath.Join(c.repo.WorkDir, dir, ".git"))) {
+		return false, nil
+	}
+	whole := c.opts.dirs && c.selected(dir)
+	ignored := c.ignore.Matches(dir, true)
+
+	if c.opts.mode == cleanOnlyIgnored {
+		if ignored {
+			if whole {
+				c.found = append(c.found, dir+"/")
+			}
+			return whole, nil
+		}
+		// Ignored files are found inside untracked directories even
+		// without -d, unless there is nothing else, which makes the
+		// directory count as ignored
+		mark := len(c.found)
+		all, err := c.scan(dir)
+		if err != nil {
+			return false, err
+		}
+		if all && len(c.found) > mark {
+			c.found = c.found[:mark]
+			if whole {
+				c.found = append(c.found, dir+"/")
+			}
+			return whole, nil
+		}
+		return false, nil
+	}
+
+	if ignored || !c.opts.dirs {
+		return false, nil
+	}
+	mark := len(c.found)
+	all, err := c.scan(dir)
+	if err != nil {
+		return false, err
+	}
+	if all && whole {
+		c.found = append(c.found[:mark], dir+"/")
+		return true, nil
+	}
+	return false, nil
+}
+
+// removable reports whether an untracked file is removed, going by the
+// ignore rules.
+func (c *cleaner) removable(p string) bool {
+	ignored := c.ignore.Matches(p, false)
+	if c.opts.mode == cleanOnlyIgnored {
+		return ignored
+	}
+	return !ignored
+}
+
+// selected reports whether a path is one of the pathspecs or under one.
+func (c *cleaner) selected(p string) bool {
+	return len(c.specs) == 0 || matchPathspec(p, c.specs)
+}
+
+// mayMatch reports whether a path or something under it can match the
+// pathspecs.
+func (c *cleaner) mayMatch(p string) bool {
+	return c.selected(p) || leadsToPathspec(p, c.specs)
+}
+
+// cleanInteractive lets the user pick what to remove, as clean -i does,
+// reading commands from in. It returns the chosen items, or nil to quit.
+func cleanInteractive(in *bufio.Reader, out io.Writer, items []string, prefix string) []string {
+	display := func(item string) string {
+		name := relativeTo(strings.TrimSuffix(item, "/"), prefix)
+		if strings.HasSuffix(item, "/") {
+			name += "/"
+		}
+		return name
+	}
+	prompt := func(text string) (string, bool) {
+		fmt.Fprint(out, text)
+		line, err := in.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(out)
+			return "", false
+		}
+		return strings.TrimSpace(line), true
+	}
+	list := func() {
+		for _, item := range items {
+			fmt.Fprintf(out, "  %s\n", display(item))
+		}
+	}
+
+	// The items are listed again unless the last command was not understood
+	show := true
+	for {
+		if len(items) == 0 {
+			fmt.Fprintln(out, "No more files to clean, exiting.")
+			return nil
+		}
+		if show {
+			fmt.Fprintf(out, "Would remove the following %s:\n", plural(len(items), "item", "items"))
+			list()
+		}
+		show = true
+		fmt.Fprintln(out, "*** Commands ***")
+		fmt.Fprintln(out, "    1: clean                2: filter by pattern    3: select by numbers")
+		fmt.Fprintln(out, "    4: ask each             5: quit                 6: help")
+		choice, ok := prompt("What now> ")
+		if !ok {
+			fmt.Fprintln(out, "Bye.")
+			return nil
+		}
+
+		switch choice {
+		case "1", "c", "clean":
+			return items
+		case "2", "f", "filter", "filter by pattern":
+			for len(items) > 0 {
+				list()
+				line, ok := prompt("Input ignore patterns>> ")
+				if !ok || line == "" {
+					break
+				}
+				var kept []string
+				for _, item := range items {
+					name := strings.TrimSuffix(display(item), "/")
+					excluded := false
+					for _, pattern := range strings.Fields(line) {
+						if m, _ := path.Match(pattern, name); m {
+							excluded = true
+						} else if m, _ := path.Match(pattern, path.Base(name)); m {
+							excluded = true
+						}
+					}
+					if !excluded {
+						kept = append(kept, item)
+					}
+				}
+				if len(kept) == len(items) {
+					fmt.Fprintf(out, "WARNING: Cannot find items matched by: %s\n", line)
+				}
+				items = kept
+			}
+		case "3", "s", "select", "select by numbers":
+			selected := make([]bool, len(items))
+			for {
+				for i, item := range items {
+					mark := " "
+					if selected[i] {
+						mark = "*"
+					}
+					fmt.Fprintf(out, "  %s %d: %s\n", mark, i+1, display(item))
+				}
+				line, ok := prompt("Select items to delete>> ")
+				if !ok || line == "" {
+					break
+				}
+				for _, token := range strings.Fields(strings.ReplaceAll(line, ",", " ")) {
+					if !selectItems(selected, token) {
+						fmt.Fprintf(out, "Huh (%s)?\n", token)
+					}
+				}
+			}
+			var kept []string
+			for i, item := range items {
+				if selected[i] {
+					kept = append(kept, item)
+				}
+			}
+			items = kept
+		case "4", "a", "ask each":
+			var chosen []string
+			for _, item := range items {
+				answer, ok := prompt(fmt.Sprintf("Remove %s [y/N]? ", display(item)))
+				if !ok {
+					break
+				}
+				if answer = strings.ToLower(answer); answer == "y" || answer == "yes" {
+					chosen = append(chosen, item)
+				}
+			}
+			if chosen == nil {
+				return nil
+			}
+			return chosen
+		case "5", "q", "quit":
+			fmt.Fprintln(out, "Bye.")
+			return nil
+		case "6", "h", "help", "?":
+			fmt.Fprintln(out, `clean               - start cleaning
+filter by pattern   - exclude items from deletion
+select by numbers   - select items to be deleted by numbers
+ask each            - confirm each deletion (like "rm -i")
+quit                - stop cleaning
+help                - this screen
+?                   - help for prompt selection`)
+		default:
+			fmt.Fprintf(out, "Huh (%s)?\n", choice)
+			show = false
+		}
+	}
+}
+
+// selectItems applies one token of a selection: "<n>", "<n>-<m>" or "*"
+// select items, and a leading "-" unselects them. It reports whether the
+// token was valid.
+func selectItems(selected []bool, token string) bool {
+	value := true
+	if rest, ok := strings.CutPrefix(token, "-"); ok {
+		value, token = false, rest
+	}
+	if token == "*" {
+		for i := range selected {
+			selected[i] = value
+		}
+		return true
+	}
+	from, to, isRange := strings.Cut(token, "-")
+	first, err := strconv.Atoi(from)
+	if err != nil {
+		return false
+	}
+	last := first
+	if isRange {
+		if to == "" {
+			last = len(selected)
+		} else if last, err = strconv.Atoi(to); err != nil {
+			return false
+		}
+	}
+	if first < 1 || last > len(selected) || first > last {
+		return false
+	}
+	for i := first; i <= last; i++ {
+		selected[i-1] = value
+	}
+	return true
+}
@@ -1,46 +1,114 @@
 package commands
 
 import (
-	"bufio"
 	"fmt"
+	"io"
 	"mygit/internal/config"
+	"mygit/internal/diff"
+	"mygit/internal/hooks"
 	"mygit/internal/index"
 	"mygit/internal/objects"
 	"mygit/internal/refs"
 	"mygit/internal/repository"
+	"mygit/internal/utils"
 	"os"
 	"os/user"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
+// commitOptions holds the flags of the commit command.
+type commitOptions struct {
+	messages   []string // -m, each one a paragraph
+	file       string   // -F, "-" for standard input
+	amend      bool     // replace the tip of the current branch
+	allowEmpty bool     // allow a commit that changes nothing
+	all        bool     // -a: stage modified and deleted tracked files first
+	author     string   // "Name <email>" overriding the configured author
+	date       string   // author date override
+	sign       bool     // -S: sign the commit
+	noSign     bool     // --no-gpg-sign: override commit.gpgSign
+	signingKey string   // key given with -S<key>, overriding user.signingKey
+	noVerify   bool     // -n: skip the pre-commit and commit-msg hooks
+}
+
 func Commit(args []string) {
-	var message string
+	opts := commitOptions{}
 
 	// Parse arguments
-	for i, arg := range args {
-		if arg == "-m" && i+1 < len(args) {
-			message = args[i+1]
-			break
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() string {
+			if i+1 >= len(args) {
+				fmt.Printf("error: switch '%s' requires a value\n", arg)
+				os.Exit(1)
+			}
+			i++
+			return args[i]
 		}
-	}
 
-	if message == "" {
-		// Get message from user input
-		fmt.Print("Enter commit message: ")
-		reader := bufio.NewReader(os.Stdin)
-		msg, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Printf("Error reading message: %v\n", err)
+		switch {
+		case arg == "-m" || arg == "--message":
+			opts.messages = append(opts.messages, value())
+		case strings.HasPrefix(arg, "--message="):
+			opts.messages = append(opts.messages, strings.TrimPrefix(arg, "--message="))
+		case arg == "-am":
+			opts.all = true
+			opts.messages = append(opts.messages, value())
+		case arg == "-F" || arg == "--file":
+			opts.file = value()
+		case strings.HasPrefix(arg, "--file="):
+			opts.file = strings.TrimPrefix(arg, "--file=")
+		case arg == "-a" || arg == "--all":
+			opts.all = true
+		case arg == "--amend":
+			opts.amend = true
+		case arg == "-n" || arg == "--no-verify":
+			opts.noVerify = true
+		case arg == "--allow-empty":
+			opts.allowEmpty = true
+		case arg == "--author":
+			opts.author = value()
+		case strings.HasPrefix(arg, "--author="):
+			opts.author = strings.TrimPrefix(arg, "--author=")
+		case arg == "--date":
+			opts.date = value()
+		case strings.HasPrefix(arg, "--date="):
+			opts.date = strings.TrimPrefix(arg, "--date=")
+		case arg == "-S" || arg == "--gpg-sign":
+			opts.sign, opts.noSign = true, false
+		case strings.HasPrefix(arg, "-S"):
+			opts.sign, opts.noSign, opts.signingKey = true, false, arg[2:]
+		case strings.HasPrefix(arg, "--gpg-sign="):
+			opts.sign, opts.noSign, opts.signingKey = true, false, strings.TrimPrefix(arg, "--gpg-sign=")
+		case arg == "--no-gpg-sign":
+			opts.sign, opts.noSign = false, true
+		default:
+			fmt.Printf("Error: unknown option '%s'\n", arg)
 			os.Exit(1)
 		}
-		message = strings.TrimSpace(msg)
 	}
 
-	if message == "" {
-		fmt.Println("Commit message cannot be empty")
+	if len(opts.messages) > 0 && opts.file != "" {
+		fmt.Println("fatal: options '-m' and '-F' cannot be used together")
+		os.Exit(1)
+	}
+	// Bad --author and --date values are caught before anything is staged
+	// or a message is asked for
+	if opts.author != "" && !validIdentity(opts.author) {
+		fmt.Printf("fatal: --author '%s' is not 'Name <email>'\n", opts.author)
 		os.Exit(1)
 	}
+	var authorDate time.Time
+	if opts.date != "" {
+		var err error
+		if authorDate, err = parseDate(opts.date); err != nil {
+			fmt.Printf("fatal: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
 	// Find repository
 	cwd, err := os.Getwd()
@@ -62,16 +130,98 @@ func Commit(args []string) {
 		os.Exit(1)
 	}
 
-	indexEntries := idx.GetAll()
-	if len(indexEntries) == 0 {
-		fmt.Println("nothing to commit, working tree clean")
-		return
-	}
-
 	// Initialize object store and ref manager
 	objStore := objects.NewObjectStore(repo.GitDir)
 	refManager := refs.NewRefManager(repo.GitDir)
 
+	if opts.all {
+		if _, err := updateTrackedFiles(repo, objStore, idx, []string{"."}, true, false); err != nil {
+			fmt.Printf("Error updating tracked files: %v\n", err)
+			os.Exit(1)
+		}
+		if err := idx.Save(); err != nil {
+			fmt.Printf("Error saving index: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// The pre-commit hook may stage more changes, so the index is read
+	// again after it has run
+	if !opts.noVerify {
+		if err := hooks.Run(repo, "pre-commit", nil); err != nil {
+			if _, ok := err.(*hooks.Error); !ok {
+				fmt.Printf("error: %v\n", err)
+			}
+			os.Exit(1)
+		}
+		if err := idx.Load(); err != nil {
+			fmt.Printf("Error loading index: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(idx.Conflicts()) > 0 {
+		fmt.Println("error: Committing is not possible because you have unmerged files.")
+		fmt.Println("hint: Fix them up in the work tree, and then use 'mygit add/rm <file>'")
+		fmt.Println("hint: as appropriate to mark resolution and make a commit.")
+		fmt.Println("fatal: Exiting because of an unresolved conflict.")
+		os.Exit(128)
+	}
+
+	// The parents of the new commit: HEAD, or HEAD's parents when amending
+	var parents []string
+	var amended *objects.Commit
+	currentCommit, err := refManager.GetHEAD()
+	if opts.amend {
+		if err != nil || currentCommit == "" {
+			fmt.Println("fatal: You have nothing to amend.")
+			os.Exit(1)
+		}
+		amended, err = readCommit(objStore, currentCommit)
+		if err != nil {
+			fmt.Printf("fatal: %v\n", err)
+			os.Exit(1)
+		}
+		parents = amended.Parents
+	} else if err == nil && currentCommit != "" {
+		parents = append(parents, currentCommit)
+	}
+
+	parentEntries := make(map[string]*index.IndexEntry)
+	if len(parents) > 0 {
+		parentEntries, err = utils.GetTreeEntriesFromCommit(objStore, parents[0])
+		if err != nil {
+			fmt.Printf("Error reading parent commit: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	indexEntries := idx.GetAll()
+	changes := diffEntries(parentEntries, indexEntries)
+	if len(changes) == 0 && !opts.allowEmpty {
+		if opts.amend {
+			fmt.Println("You asked to amend the most recent commit, but doing so would make")
+			fmt.Println("it empty. You can repeat your command with --allow-empty.")
+		} else if unstaged, _ := utils.GetUnstagedChanges(repo, idx, objStore); len(unstaged) > 0 {
+			fmt.Println("no changes added to commit (use \"mygit add\" and/or \"mygit commit -a\")")
+		} else {
+			fmt.Println("nothing to commit, working tree clean")
+		}
+		os.Exit(1)
+	}
+
+	message, err := commitMessage(repo, objStore, idx, opts, currentCommit, amended, changes)
+	if err != nil {
+		if _, ok := err.(*hooks.Error); !ok {
+			fmt.Printf("error: %v\n", err)
+		}
+		os.Exit(1)
+	}
+	if message == "" {
+		fmt.Println("Aborting commit due to empty commit message.")
+		os.Exit(1)
+	}
+
 	// Build tree from index
 	treeHash, err := objStore.BuildTreeFromIndex(indexEntries)
 	if err != nil {
@@ -79,18 +229,33 @@ func Commit(args []string) {
 		os.Exit(1)
 	}
 
-	// Get current commit (parent)
-	var parents []string
-	currentCommit, err := refManager.GetHEAD()
-	if err == nil && currentCommit != "" {
-		parents = append(parents, currentCommit)
+	// Get author info: amending keeps the original author and date
+	committer := objects.NewSignature(getAuthor(repo), time.Now())
+	author := committer
+	if amended != nil {
+		author = amended.Author
+	} else if picked, revert := stoppedAt(repo); picked != "" && !revert {
+		// A cherry-picked commit keeps its author
+		if original, err := readCommit(objStore, picked); err == nil {
+			author = original.Author
+		}
+	}
+	if opts.author != "" {
+		author = objects.NewSignature(opts.author, author.When)
+	}
+	if opts.date != "" {
+		author.When = authorDate
 	}
-
-	// Get author info
-	author := getAuthor(repo)
 
 	// Create commit object
 	commit := objects.NewCommit(treeHash, message, author, parents)
+	commit.Committer = committer
+	if opts.sign || (!opts.noSign && signByDefault(repo, "commit.gpgSign")) {
+		if err := signCommit(repo, commit, opts.signingKey); err != nil {
+			fmt.Printf("error: %v\nfatal: failed to write commit object\n", err)
+			os.Exit(1)
+		}
+	}
 	commitContent := commit.Serialize()
 
 	commitHash, err := objStore.WriteObject(commitContent, objects.CommitType)
@@ -100,13 +265,229 @@ func Commit(args []string) {
 	}
 
 	// Update current branch
-	if err := refManager.UpdateCurrentBranch(commitHash); err != nil {
+	reflogMessage := "commit: " + firstLine(message)
+	if opts.amend {
+		reflogMessage = "commit (amend): " + firstLine(message)
+	} else if len(parents) == 0 {
+		reflogMessage = "commit (initial): " + firstLine(message)
+	}
+	if err := refManager.UpdateHEAD(commitHash, committer.Identity(), reflogMessage); err != nil {
 		fmt.Printf("Error updating branch: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("[main %s] %s\n", commitHash[:7], message)
-	fmt.Printf(" %d files changed\n", len(indexEntries))
+	clearPickState(repo)
+	hooks.Run(repo, "post-commit", nil)
+
+	printCommitSummary(objStore, refManager, commitHash, message, len(parents) == 0, changes)
+}
+
+// commitMessage returns the cleaned-up message for a new commit, taken
+// from -m, -F or the user's editor. The message goes through
+// .mygit/COMMIT_EDITMSG so that the prepare-commit-msg and commit-msg
+// hooks can inspect and edit it.
+func commitMessage(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, opts commitOptions, headHash string, amended *objects.Commit, changes []fileDiff) (string, error) {
+	var initial string
+	var hookArgs []string
+	useEditor := false
+
+	switch {
+	case len(opts.messages) > 0:
+		initial = strings.Join(opts.messages, "\n\n") + "\n"
+		hookArgs = []string{"message"}
+	case opts.file != "":
+		var content []byte
+		var err error
+		if opts.file == "-" {
+			content, err = io.ReadAll(os.Stdin)
+		} else {
+			content, err = os.ReadFile(opts.file)
+		}
+		if err != nil {
+			return "", fmt.Errorf("could not read log file '%s': %w", opts.file, err)
+		}
+		initial = string(content)
+		hookArgs = []string{"message"}
+	default:
+		previous := ""
+		if amended != nil {
+			previous = amended.Message
+			hookArgs = []string{"commit", headHash}
+		} else if content, err := os.ReadFile(filepath.Join(repo.GitDir, "MERGE_MSG")); err == nil {
+			// Committing the resolution of a stopped cherry-pick or revert
+			previous = string(content)
+			hookArgs = []string{"merge"}
+		}
+		template, err := commitTemplate(repo, objStore, idx, previous, changes)
+		if err != nil {
+			return "", err
+		}
+		initial = template
+		useEditor = true
+	}
+
+	editPath := filepath.Join(repo.GitDir, "COMMIT_EDITMSG")
+	if err := os.WriteFile(editPath, []byte(initial), 0644); err != nil {
+		return "", err
+	}
+	if err := hooks.Run(repo, "prepare-commit-msg", nil, append([]string{editPath}, hookArgs...)...); err != nil {
+		return "", err
+	}
+	if useEditor {
+		if err := launchEditor(repo, editPath); err != nil {
+			return "", err
+		}
+	}
+	if !opts.noVerify {
+		if err := hooks.Run(repo, "commit-msg", nil, editPath); err != nil {
+			return "", err
+		}
+	}
+
+	content, err := os.ReadFile(editPath)
+	if err != nil {
+		return "", err
+	}
+	return cleanupMessage(string(content), useEditor), nil
+}
+
+// commitTemplate builds the text the editor starts with: the initial
+// message followed by a commented-out summary of what is being committed.
+func commitTemplate(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, initial string, changes []fileDiff) (string, error) {
+	var b strings.Builder
+	if initial != "" {
+		b.WriteString(strings.TrimRight(initial, "\n"))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	b.WriteString("# Please enter the commit message for your changes. Lines starting\n")
+	b.WriteString("# with '#' will be ignored, and an empty message aborts the commit.\n")
+	b.WriteString("#\n")
+
+	refManager := refs.NewRefManager(repo.GitDir)
+	if branch, err := refManager.GetCurrentBranch(); err == nil {
+		fmt.Fprintf(&b, "# On branch %s\n", branch)
+	} else {
+		b.WriteString("# HEAD detached\n")
+	}
+
+	if len(changes) > 0 {
+		b.WriteString("# Changes to be committed:\n")
+		for _, c := range changes {
+			switch {
+			case c.Old == nil:
+				fmt.Fprintf(&b, "#\tnew file:   %s\n", c.Path)
+			case c.New == nil:
+				fmt.Fprintf(&b, "#\tdeleted:    %s\n", c.Path)
+			default:
+				fmt.Fprintf(&b, "#\tmodified:   %s\n", c.Path)
+			}
+		}
+		b.WriteString("#\n")
+	}
+
+	unstaged, err := utils.GetUnstagedChanges(repo, idx, objStore)
+	if err != nil {
+		return "", err
+	}
+	if len(unstaged) > 0 {
+		sort.Strings(unstaged)
+		b.WriteString("# Changes not staged for commit:\n")
+		for _, path := range unstaged {
+			if utils.PathExists(filepath.Join(repo.WorkDir, path)) {
+				fmt.Fprintf(&b, "#\tmodified:   %s\n", path)
+			} else {
+				fmt.Fprintf(&b, "#\tdeleted:    %s\n", path)
+			}
+		}
+		b.WriteString("#\n")
+	}
+
+	untracked, err := untrackedFiles(repo, idx)
+	if err != nil {
+		return "", err
+	}
+	if len(untracked) > 0 {
+		b.WriteString("# Untracked files:\n")
+		for _, path := range untracked {
+			fmt.Fprintf(&b, "#\t%s\n", path)
+		}
+		b.WriteString("#\n")
+	}
+	return b.String(), nil
+}
+
+// cleanupMessage tidies a commit message the way Git does: trailing
+// whitespace is stripped from every line, runs of blank lines are
+// collapsed and leading and trailing blank lines removed. With
+// stripComments, lines starting with '#' are dropped first. The result
+// ends in a newline, or is empty.
+func cleanupMessage(message string, stripComments bool) string {
+	var lines []string
+	for _, line := range strings.Split(message, "\n") {
+		if stripComments && strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// validIdentity reports whether s looks like "Name <email>".
+func validIdentity(s string) bool {
+	open := strings.Index(s, "<")
+	return open > 0 && strings.HasSuffix(s, ">") && strings.TrimSpace(s[:open]) != ""
+}
+
+// printCommitSummary prints the line Git prints after a commit, such as
+// "[main 1a2b3c4] Subject", followed by a summary of the changes.
+func printCommitSummary(objStore *objects.ObjectStore, refManager *refs.RefManager, hash, message string, root bool, changes []fileDiff) {
+	branch, err := refManager.GetCurrentBranch()
+	if err != nil {
+		branch = "detached HEAD"
+	}
+	if root {
+		branch += " (root-commit)"
+	}
+	fmt.Printf("[%s %s] %s\n", branch, hash[:7], firstLine(message))
+	if len(changes) == 0 {
+		return
+	}
+
+	added, removed := 0, 0
+	for _, c := range changes {
+		oldContent, err := blobContent(objStore, c.Old)
+		if err != nil {
+			return
+		}
+		newContent, err := blobContent(objStore, c.New)
+		if err != nil {
+			return
+		}
+		a, r := diff.Stat(oldContent, newContent)
+		added += a
+		removed += r
+	}
+	fmt.Println(statSummary(len(changes), added, removed))
+
+	for _, c := range changes {
+		switch {
+		case c.Old == nil:
+			fmt.Printf(" create mode %s %s\n", objects.ModeFromPermissions(c.New.Permissions), c.Path)
+		case c.New == nil:
+			fmt.Printf(" delete mode %s %s\n", objects.ModeFromPermissions(c.Old.Permissions), c.Path)
+		}
+	}
 }
 
 func getAuthor(repo *repository.GitRepository) string {
@@ -135,3 +516,9 @@ func getAuthor(repo *repository.GitRepository) string {
 	}
 	return fmt.Sprintf("%s <%s@localhost>", currentUser.Username, currentUser.Username)
 }
+
+// firstLine returns the first line of a (commit) message.
+func firstLine(message string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	return line
+}
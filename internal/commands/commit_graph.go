@@ -0,0 +1,137 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"os"
+	"strings"
+)
+
+// CommitGraph handles the `commit-graph` command, which writes and checks
+// the commit-graph file, objects/info/commit-graph:
+//
+//	mygit commit-graph write [--reachable | --stdin-commits]
+//	mygit commit-graph verify
+//
+// write records every commit reachable from the refs (or from the commits
+// read from standard input) with its parents and generation number, so
+// that log, merge-base, rebase and other history walks can skip parsing
+// them. A commit made later is simply not in the graph until the next
+// write.
+func CommitGraph(args []string) {
+	usage := func() {
+		fmt.Println("usage: mygit commit-graph write [--reachable | --stdin-commits]")
+		fmt.Println("   or: mygit commit-graph verify")
+		os.Exit(129)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+	subcommand := args[0]
+	fromStdin := false
+	for _, arg := range args[1:] {
+		switch {
+		case subcommand == "write" && arg == "--reachable":
+			fromStdin = false
+		case subcommand == "write" && arg == "--stdin-commits":
+			fromStdin = true
+		default:
+			usage()
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(128)
+	}
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+
+	switch subcommand {
+	case "write":
+		var tips []string
+		if fromStdin {
+			tips, err = commitsFromStdin(objStore, refManager)
+		} else {
+			tips, err = refCommits(objStore, refManager)
+		}
+		if err != nil {
+			fmt.Printf("fatal: %v\n", err)
+			os.Exit(128)
+		}
+		if len(tips) == 0 {
+			return
+		}
+		count, err := objStore.WriteCommitGraph(tips)
+		if err != nil {
+			fmt.Printf("fatal: %v\n", err)
+			os.Exit(128)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote commit-graph with %d commits\n", count)
+	case "verify":
+		if _, err := os.Stat(objStore.CommitGraphPath()); os.IsNotExist(err) {
+			return
+		}
+		if err := objStore.VerifyCommitGraph(); err != nil {
+			fmt.Printf("error: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		usage()
+	}
+}
+
+// refCommits returns the commits that HEAD and the refs point at, peeling
+// tags. Refs to other objects are left out.
+func refCommits(objStore *objects.ObjectStore, refManager *refs.RefManager) ([]string, error) {
+	list, err := refManager.ListRefs("refs/")
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, 0, len(list)+1)
+	if head, err := refManager.GetHEAD(); err == nil && head != "" {
+		hashes = append(hashes, head)
+	}
+	for _, ref := range list {
+		hashes = append(hashes, ref.Hash)
+	}
+
+	var commits []string
+	for _, hash := range hashes {
+		obj, err := peelTag(objStore, hash)
+		if err == nil && obj.Type == objects.CommitType {
+			commits = append(commits, obj.Hash)
+		}
+	}
+	return commits, nil
+}
+
+// commitsFromStdin reads one commit per line from standard input.
+func commitsFromStdin(objStore *objects.ObjectStore, refManager *refs.RefManager) ([]string, error) {
+	var commits []string
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		hash, err := resolveRevision(objStore, refManager, line)
+		if err == nil {
+			hash, err = peelRevision(objStore, hash, "commit", line)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid commit object id: %s", line)
+		}
+		commits = append(commits, hash)
+	}
+	return commits, scanner.Err()
+}
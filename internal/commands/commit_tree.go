@@ -0,0 +1,182 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"os"
+	"strings"
+	"time"
+)
+
+// CommitTree handles the `commit-tree` command, which creates a commit
+// object for a tree and prints its hash:
+//
+//	mygit commit-tree <tree> [-p <parent>]... [-S[<keyid>] | --no-gpg-sign] [-m <message>]... [-F <file>]
+//
+// Without -m or -F the message is read from standard input. It is stored
+// as given, without the cleanup commit does. The author and committer can
+// be set with the GIT_AUTHOR_* and GIT_COMMITTER_* environment variables.
+func CommitTree(args []string) {
+	var treeName string
+	var parentNames, messages, files []string
+	sign, noSign, signingKey := false, false, ""
+
+	usage := func() {
+		fmt.Println("usage: mygit commit-tree <tree> [(-p <parent>)...] [-S[<keyid>]] [(-m <message>)...] [(-F <file>)...]")
+		os.Exit(129)
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-p" || arg == "-m" || arg == "-F":
+			if i+1 >= len(args) {
+				usage()
+			}
+			i++
+			switch arg {
+			case "-p":
+				parentNames = append(parentNames, args[i])
+			case "-m":
+				messages = append(messages, args[i])
+			default:
+				files = append(files, args[i])
+			}
+		case strings.HasPrefix(arg, "-S"):
+			sign, signingKey = true, strings.TrimPrefix(arg, "-S")
+		case arg == "--no-gpg-sign":
+			noSign = true
+		case strings.HasPrefix(arg, "-"):
+			usage()
+		case treeName == "":
+			treeName = arg
+		default:
+			usage()
+		}
+	}
+	if treeName == "" {
+		usage()
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(128)
+	}
+
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+
+	treeHash, err := resolveTreeHash(objStore, refManager, treeName)
+	if err != nil {
+		fmt.Printf("fatal: not a valid object name %s\n", treeName)
+		os.Exit(128)
+	}
+	var parents []string
+	for _, name := range parentNames {
+		hash, err := resolveRevision(objStore, refManager, name)
+		if err == nil {
+			hash, err = peelRevision(objStore, hash, "commit", name)
+		}
+		if err != nil {
+			fmt.Printf("fatal: not a valid object name %s\n", name)
+			os.Exit(128)
+		}
+		parents = append(parents, hash)
+	}
+
+	// Each -m is a paragraph; -F files are taken as they are
+	var message strings.Builder
+	for _, m := range messages {
+		if message.Len() > 0 {
+			message.WriteString("\n")
+		}
+		message.WriteString(m + "\n")
+	}
+	for _, file := range files {
+		if message.Len() > 0 {
+			message.WriteString("\n")
+		}
+		var content []byte
+		if file == "-" {
+			content, err = io.ReadAll(os.Stdin)
+		} else {
+			content, err = os.ReadFile(file)
+		}
+		if err != nil {
+			fmt.Printf("fatal: could not read log file '%s': %v\n", file, err)
+			os.Exit(128)
+		}
+		message.Write(content)
+	}
+	if len(messages) == 0 && len(files) == 0 {
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Printf("fatal: %v\n", err)
+			os.Exit(128)
+		}
+		message.Write(content)
+	}
+
+	author, err := envSignature(repo, "AUTHOR")
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	committer, err := envSignature(repo, "COMMITTER")
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	commit := &objects.Commit{
+		Tree:      treeHash,
+		Parents:   parents,
+		Author:    author,
+		Committer: committer,
+		Message:   message.String(),
+	}
+	if sign || (!noSign && signByDefault(repo, "commit.gpgSign")) {
+		if err := signCommit(repo, commit, signingKey); err != nil {
+			fmt.Printf("error: %v\nfatal: failed to write commit object\n", err)
+			os.Exit(128)
+		}
+	}
+
+	hash, err := objStore.WriteObject(commit.Serialize(), objects.CommitType)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	fmt.Println(hash)
+}
+
+// envSignature returns the author or committer identity (role being
+// "AUTHOR" or "COMMITTER") from the GIT_<role>_NAME, GIT_<role>_EMAIL and
+// GIT_<role>_DATE environment variables, falling back to the configured
+// user and the current time.
+func envSignature(repo *repository.GitRepository, role string) (objects.Signature, error) {
+	sig := objects.NewSignature(getAuthor(repo), time.Now())
+	if name, ok := os.LookupEnv("GIT_" + role + "_NAME"); ok {
+		sig.Name = name
+	}
+	if email, ok := os.LookupEnv("GIT_" + role + "_EMAIL"); ok {
+		sig.Email = email
+	}
+	if date, ok := os.LookupEnv("GIT_" + role + "_DATE"); ok {
+		when, err := parseDate(date)
+		if err != nil {
+			return sig, err
+		}
+		sig.When = when
+	}
+	return sig, nil
+}
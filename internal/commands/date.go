@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gitDateFormat is the default format Git uses to display dates.
+const gitDateFormat = "Mon Jan 2 15:04:05 2006 -0700"
+
+// dateLayouts are the date formats accepted on the command line, besides
+// Git's internal "<unix> <tz>" and "@<unix>" forms.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon Jan 2 15:04:05 2006 -0700",
+	"Mon Jan 2 15:04:05 2006",
+}
+
+// parseDate parses a date given as an option such as --date or --since.
+// Dates without a time zone are taken to be local time.
+func parseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	// "@<unix>" and "<unix> <tz>"
+	if unix, err := strconv.ParseInt(strings.TrimPrefix(s, "@"), 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	if fields := strings.Fields(s); len(fields) == 2 {
+		unix, err := strconv.ParseInt(strings.TrimPrefix(fields[0], "@"), 10, 64)
+		if err == nil {
+			if zone, err := time.Parse("-0700", fields[1]); err == nil {
+				return time.Unix(unix, 0).In(zone.Location()), nil
+			}
+		}
+	}
+
+	if t, ok := parseRelativeDate(s, time.Now()); ok {
+		return t, nil
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date format: %s", s)
+}
+
+// dateUnits are the units relative dates can be given in.
+var dateUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+}
+
+// parseRelativeDate parses the relative dates Git accepts for options such
+// as --since: "now", "yesterday" and "<n> <unit>s ago", where the words may
+// also be separated by dots ("2.weeks.ago").
+func parseRelativeDate(s string, now time.Time) (time.Time, bool) {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return r == ' ' || r == '.' })
+	switch {
+	case len(fields) == 1 && fields[0] == "now":
+		return now, true
+	case len(fields) == 1 && fields[0] == "yesterday":
+		return now.AddDate(0, 0, -1), true
+	case len(fields) == 2 || len(fields) == 3 && fields[2] == "ago":
+	default:
+		return time.Time{}, false
+	}
+
+	n, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return time.Time{}, false
+	}
+	unit := strings.TrimSuffix(fields[1], "s")
+	switch unit {
+	case "month":
+		return now.AddDate(0, -n, 0), true
+	case "year":
+		return now.AddDate(-n, 0, 0), true
+	}
+	d, ok := dateUnits[unit]
+	if !ok {
+		return time.Time{}, false
+	}
+	return now.Add(-time.Duration(n) * d), true
+}
@@ -0,0 +1,317 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mygit/internal/index"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"mygit/internal/utils"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// diffOptions holds the options of diff.
+type diffOptions struct {
+	cached     bool
+	stat       bool
+	patch      bool
+	nameOnly   bool
+	nameStatus bool
+	quiet      bool
+	exitCode   bool
+	renames    renameOptions
+	noPager    bool
+}
+
+// Diff handles the `diff` command, which shows changes between the
+// working tree, the index and commits:
+//
+//	mygit diff [<options>] [--] [<path>...]
+//	mygit diff [<options>] --cached [<commit>] [--] [<path>...]
+//	mygit diff [<options>] <commit> [<commit>] [--] [<path>...]
+//
+// Without a commit the index is compared with the working tree, with
+// --cached a commit (HEAD by default) with the index, with one commit that
+// commit with the working tree, and with two (or <commit>..<commit>) one
+// commit with the other. Renames are found as diff.renames says.
+func Diff(args []string) {
+	var opts diffOptions
+	var rest []string
+	dashdash := -1
+	for _, arg := range args {
+		switch {
+		case dashdash >= 0:
+			rest = append(rest, arg)
+		case arg == "--":
+			dashdash = len(rest)
+		case arg == "--cached" || arg == "--staged":
+			opts.cached = true
+		case arg == "--stat":
+			opts.stat = true
+		case arg == "-p" || arg == "-u" || arg == "--patch":
+			opts.patch = true
+		case arg == "--name-only":
+			opts.nameOnly, opts.nameStatus = true, false
+		case arg == "--name-status":
+			opts.nameStatus, opts.nameOnly = true, false
+		case arg == "-q" || arg == "--quiet":
+			opts.quiet = true
+		case arg == "--exit-code":
+			opts.exitCode = true
+		case arg == "--no-pager":
+			opts.noPager = true
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			if ok, err := parseRenameOption(arg, &opts.renames); ok {
+				if err != nil {
+					fmt.Printf("error: %v\n", err)
+					os.Exit(129)
+				}
+				continue
+			}
+			fmt.Printf("error: unknown option `%s'\n", strings.TrimLeft(arg, "-"))
+			fmt.Println("usage: mygit diff [<options>] [--cached] [<commit> [<commit>]] [--] [<path>...]")
+			os.Exit(129)
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	// A patch is shown unless another kind of output was asked for
+	if !opts.stat && !opts.nameOnly && !opts.nameStatus {
+		opts.patch = true
+	}
+	if opts.nameOnly || opts.nameStatus {
+		opts.patch = false
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(128)
+	}
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+	opts.renames.resolve(repo, "diff.renames")
+
+	// Commits come first; the first argument that is not one starts the
+	// paths, and must then exist
+	var revs, paths []string
+	for i, arg := range rest {
+		if dashdash >= 0 && i >= dashdash {
+			paths = append(paths, arg)
+			continue
+		}
+		if len(paths) == 0 {
+			if from, to, ok := strings.Cut(arg, ".."); ok && len(revs) == 0 {
+				revs = append(revs, orHEAD(from), orHEAD(to))
+				continue
+			}
+			if _, err := resolveRevision(objStore, refManager, arg); err == nil {
+				revs = append(revs, arg)
+				continue
+			}
+		}
+		if dashdash < 0 {
+			if _, err := os.Lstat(arg); err != nil {
+				fmt.Printf("fatal: ambiguous argument '%s': unknown revision or path not in the working tree.\n", arg)
+				fmt.Println("Use '--' to separate paths from revisions, like this:")
+				fmt.Println("'mygit <command> [<revision>...] -- [<file>...]'")
+				os.Exit(128)
+			}
+		}
+		paths = append(paths, arg)
+	}
+	if len(revs) > 2 || opts.cached && len(revs) > 1 {
+		fmt.Println("usage: mygit diff [<options>] [--cached] [<commit> [<commit>]] [--] [<path>...]")
+		os.Exit(129)
+	}
+	specs, err := normalizePathspecs(repo, paths)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	old, new, err := diffSides(repo, objStore, refManager, revs, opts.cached)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	if len(specs) > 0 {
+		old, new = filterEntries(old, specs), filterEntries(new, specs)
+	}
+	changes, err := diffWithRenames(objStore, old, new, opts.renames)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	if opts.quiet {
+		if len(changes) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	var w io.Writer = os.Stdout
+	done := func() {}
+	if !opts.noPager {
+		w, done = startPager(repo)
+	}
+	out := bufio.NewWriter(w)
+	err = printDiff(out, objStore, changes, opts)
+	out.Flush()
+	done()
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	if opts.exitCode && len(changes) > 0 {
+		os.Exit(1)
+	}
+}
+
+// diffSides returns the entries diff compares, as chosen by the commits
+// given and --cached.
+func diffSides(repo *repository.GitRepository, objStore *objects.ObjectStore, refManager *refs.RefManager, revs []string, cached bool) (map[string]*index.IndexEntry, map[string]*index.IndexEntry, error) {
+	treeOf := func(rev string) (map[string]*index.IndexEntry, error) {
+		hash, err := resolveRevision(objStore, refManager, rev)
+		if err != nil {
+			return nil, err
+		}
+		tree, err := peelRevision(objStore, hash, string(objects.TreeType), rev)
+		if err != nil {
+			return nil, err
+		}
+		return utils.GetTreeEntriesRecursive(objStore, tree, "")
+	}
+	if len(revs) == 2 {
+		old, err := treeOf(revs[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		new, err := treeOf(revs[1])
+		return old, new, err
+	}
+
+	idx := index.NewIndex(repo.GitDir)
+	if err := idx.Load(); err != nil {
+		return nil, nil, err
+	}
+	// Unmerged paths are left out; their stages are not kept
+	staged := make(map[string]*index.IndexEntry)
+	for path, entry := range idx.GetAll() {
+		if _, unmerged := idx.Conflicts()[path]; !unmerged {
+			staged[path] = entry
+		}
+	}
+
+	switch {
+	case cached:
+		old := map[string]*index.IndexEntry{}
+		if len(revs) == 1 {
+			var err error
+			if old, err = treeOf(revs[0]); err != nil {
+				return nil, nil, err
+			}
+		} else if head, _ := refManager.GetHEAD(); head != "" {
+			var err error
+			if old, err = treeOf("HEAD"); err != nil {
+				return nil, nil, err
+			}
+		}
+		return old, staged, nil
+	case len(revs) == 1:
+		old, err := treeOf(revs[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		new, err := worktreeEntries(repo, objStore, staged)
+		return old, new, err
+	default:
+		new, err := worktreeEntries(repo, objStore, staged)
+		return staged, new, err
+	}
+}
+
+// worktreeEntries returns entries for the working tree copies of the
+// files in the index, leaving out those that are missing. The content of
+// a changed file is written to the object store so it can be diffed.
+func worktreeEntries(repo *repository.GitRepository, objStore *objects.ObjectStore, staged map[string]*index.IndexEntry) (map[string]*index.IndexEntry, error) {
+	opts := utils.LoadWorktreeOptions(repo)
+	entries := make(map[string]*index.IndexEntry, len(staged))
+	for path, entry := range staged {
+		content, info, err := utils.ReadWorktreeFile(filepath.Join(repo.WorkDir, path))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		perm := utils.WorktreePermissions(info, entry, opts)
+		hash := objStore.HashObject(content, objects.BlobType)
+		if hash == entry.Hash && objects.ModeFromPermissions(perm) == objects.ModeFromPermissions(entry.Permissions) {
+			entries[path] = entry
+			continue
+		}
+		if !objStore.HasObject(hash) {
+			if _, err := objStore.WriteObject(content, objects.BlobType); err != nil {
+				return nil, err
+			}
+		}
+		entries[path] = &index.IndexEntry{Path: path, Hash: hash, Size: info.Size(), ModTime: info.ModTime(), Permissions: perm}
+	}
+	return entries, nil
+}
+
+// filterEntries returns the entries at the pathspecs.
+func filterEntries(entries map[string]*index.IndexEntry, specs []string) map[string]*index.IndexEntry {
+	filtered := make(map[string]*index.IndexEntry)
+	for path, entry := range entries {
+		if matchPathspec(path, specs) {
+			filtered[path] = entry
+		}
+	}
+	return filtered
+}
+
+// printDiff writes the changes in the formats the options ask for.
+func printDiff(out *bufio.Writer, objStore *objects.ObjectStore, changes []fileDiff, opts diffOptions) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	switch {
+	case opts.nameOnly:
+		for _, c := range changes {
+			fmt.Fprintln(out, c.Path)
+		}
+	case opts.nameStatus:
+		for _, line := range nameStatusLines(changes) {
+			fmt.Fprintln(out, line)
+		}
+	}
+	if opts.stat {
+		text, err := formatStat(objStore, changes)
+		if err != nil {
+			return err
+		}
+		out.WriteString(text)
+		if opts.patch {
+			out.WriteByte('\n')
+		}
+	}
+	if opts.patch {
+		text, err := formatPatch(objStore, changes)
+		if err != nil {
+			return err
+		}
+		out.WriteString(text)
+	}
+	return nil
+}
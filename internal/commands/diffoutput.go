@@ -0,0 +1,270 @@
+package commands
+
+import (
+	"fmt"
+	"mygit/internal/diff"
+	"mygit/internal/index"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"os"
+	"sort"
+	"strings"
+)
+
+// fileDiff is a change to one path between two sets of entries. Old is nil
+// for an added file and New is nil for a deleted one. For a rename or copy,
+// OldPath is where Old came from and Score how alike the two are.
+type fileDiff struct {
+	Path    string
+	Old     *index.IndexEntry
+	New     *index.IndexEntry
+	OldPath string
+	Score   int
+	Copy    bool
+}
+
+// sourcePath returns the path the change is from: OldPath for a rename or
+// copy, Path otherwise.
+func (c fileDiff) sourcePath() string {
+	if c.OldPath != "" {
+		return c.OldPath
+	}
+	return c.Path
+}
+
+// statusLetter returns the change's letter in --name-status output, with
+// the score for a rename or copy.
+func (c fileDiff) statusLetter() string {
+	switch {
+	case c.OldPath != "" && c.Copy:
+		return fmt.Sprintf("C%03d", c.Score)
+	case c.OldPath != "":
+		return fmt.Sprintf("R%03d", c.Score)
+	case c.Old == nil:
+		return "A"
+	case c.New == nil:
+		return "D"
+	case objects.ModeFromPermissions(c.Old.Permissions) != objects.ModeFromPermissions(c.New.Permissions) &&
+		(c.Old.Permissions|c.New.Permissions)&os.ModeSymlink != 0:
+		return "T"
+	default:
+		return "M"
+	}
+}
+
+// diffEntries compares two sets of entries (as read from trees or the
+// index) and returns the changed paths in order.
+func diffEntries(old, new map[string]*index.IndexEntry) []fileDiff {
+	var changes []fileDiff
+	for path, oldEntry := range old {
+		newEntry := new[path]
+		if newEntry != nil && newEntry.Hash == oldEntry.Hash &&
+			objects.ModeFromPermissions(newEntry.Permissions) == objects.ModeFromPermissions(oldEntry.Permissions) {
+			continue
+		}
+		changes = append(changes, fileDiff{Path: path, Old: oldEntry, New: newEntry})
+	}
+	for path, newEntry := range new {
+		if _, exists := old[path]; !exists {
+			changes = append(changes, fileDiff{Path: path, New: newEntry})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// blobContent returns the content of an entry's blob, or nil for a missing entry.
+func blobContent(objStore *objects.ObjectStore, entry *index.IndexEntry) ([]byte, error) {
+	if entry == nil {
+		return nil, nil
+	}
+	obj, err := objStore.ReadObject(entry.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return obj.Content, nil
+}
+
+// formatPatch renders changes as a Git-style unified diff.
+func formatPatch(objStore *objects.ObjectStore, changes []fileDiff) (string, error) {
+	var b strings.Builder
+	for _, c := range changes {
+		oldContent, err := blobContent(objStore, c.Old)
+		if err != nil {
+			return "", err
+		}
+		newContent, err := blobContent(objStore, c.New)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&b, "diff --git a/%s b/%s\n", c.sourcePath(), c.Path)
+		oldHash, newHash := refs.ZeroHash, refs.ZeroHash
+		oldName, newName := "a/"+c.sourcePath(), "b/"+c.Path
+		switch {
+		case c.Old == nil:
+			fmt.Fprintf(&b, "new file mode %s\n", objects.ModeFromPermissions(c.New.Permissions))
+			newHash = c.New.Hash
+			oldName = "/dev/null"
+		case c.New == nil:
+			fmt.Fprintf(&b, "deleted file mode %s\n", objects.ModeFromPermissions(c.Old.Permissions))
+			oldHash = c.Old.Hash
+			newName = "/dev/null"
+		default:
+			oldHash, newHash = c.Old.Hash, c.New.Hash
+			oldMode := objects.ModeFromPermissions(c.Old.Permissions)
+			newMode := objects.ModeFromPermissions(c.New.Permissions)
+			if oldMode != newMode {
+				fmt.Fprintf(&b, "old mode %s\nnew mode %s\n", oldMode, newMode)
+			}
+			if c.OldPath != "" {
+				verb := "rename"
+				if c.Copy {
+					verb = "copy"
+				}
+				fmt.Fprintf(&b, "similarity index %d%%\n%s from %s\n%s to %s\n", c.Score, verb, c.OldPath, verb, c.Path)
+			}
+		}
+
+		if oldHash == newHash {
+			// Only the mode changed
+			continue
+		}
+		fmt.Fprintf(&b, "index %s..%s", oldHash[:7], newHash[:7])
+		if c.Old != nil && c.New != nil && c.Old.Permissions == c.New.Permissions {
+			fmt.Fprintf(&b, " %s", objects.ModeFromPermissions(c.New.Permissions))
+		}
+		b.WriteByte('\n')
+
+		if diff.IsBinary(oldContent) || diff.IsBinary(newContent) {
+			fmt.Fprintf(&b, "Binary files %s and %s differ\n", oldName, newName)
+			continue
+		}
+		fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+		b.WriteString(diff.Unified(oldContent, newContent, diff.DefaultContext))
+	}
+	return b.String(), nil
+}
+
+// nameStatusLines returns the --name-status line of each change: its
+// letter, then the old path of a rename or copy and the path, separated by
+// tabs.
+func nameStatusLines(changes []fileDiff) []string {
+	lines := make([]string, len(changes))
+	for i, c := range changes {
+		if c.OldPath != "" {
+			lines[i] = c.statusLetter() + "\t" + c.OldPath + "\t" + c.Path
+		} else {
+			lines[i] = c.statusLetter() + "\t" + c.Path
+		}
+	}
+	return lines
+}
+
+// statBarWidth is the widest +/- bar formatStat draws before scaling.
+const statBarWidth = 50
+
+// formatStat renders changes as a Git-style diffstat.
+func formatStat(objStore *objects.ObjectStore, changes []fileDiff) (string, error) {
+	type statLine struct {
+		path             string
+		added, removed   int
+		binary           bool
+		oldSize, newSize int
+	}
+
+	var lines []statLine
+	nameWidth, maxChanges := 0, 0
+	totalAdded, totalRemoved := 0, 0
+	for _, c := range changes {
+		oldContent, err := blobContent(objStore, c.Old)
+		if err != nil {
+			return "", err
+		}
+		newContent, err := blobContent(objStore, c.New)
+		if err != nil {
+			return "", err
+		}
+
+		line := statLine{path: c.Path}
+		if c.OldPath != "" {
+			line.path = renameName(c.OldPath, c.Path)
+		}
+		if diff.IsBinary(oldContent) || diff.IsBinary(newContent) {
+			line.binary = true
+			line.oldSize, line.newSize = len(oldContent), len(newContent)
+		} else {
+			line.added, line.removed = diff.Stat(oldContent, newContent)
+		}
+		lines = append(lines, line)
+
+		if len(line.path) > nameWidth {
+			nameWidth = len(line.path)
+		}
+		if line.added+line.removed > maxChanges {
+			maxChanges = line.added + line.removed
+		}
+		totalAdded += line.added
+		totalRemoved += line.removed
+	}
+	countWidth := len(fmt.Sprint(maxChanges))
+	for _, line := range lines {
+		if line.binary && countWidth < len("Bin") {
+			countWidth = len("Bin")
+		}
+	}
+
+	var b strings.Builder
+	for _, line := range lines {
+		if line.binary {
+			fmt.Fprintf(&b, " %-*s | %*s %d -> %d bytes\n", nameWidth, line.path, countWidth, "Bin", line.oldSize, line.newSize)
+			continue
+		}
+		plus, minus := line.added, line.removed
+		if maxChanges > statBarWidth {
+			plus = scaleStat(plus, maxChanges)
+			minus = scaleStat(minus, maxChanges)
+		}
+		bar := strings.Repeat("+", plus) + strings.Repeat("-", minus)
+		if bar != "" {
+			bar = " " + bar
+		}
+		fmt.Fprintf(&b, " %-*s | %*d%s\n", nameWidth, line.path, countWidth, line.added+line.removed, bar)
+	}
+
+	b.WriteString(statSummary(len(lines), totalAdded, totalRemoved))
+	b.WriteByte('\n')
+	return b.String(), nil
+}
+
+// scaleStat scales a change count to the bar width, keeping non-zero
+// counts visible.
+func scaleStat(n, max int) int {
+	if n == 0 {
+		return 0
+	}
+	scaled := n * statBarWidth / max
+	if scaled == 0 {
+		scaled = 1
+	}
+	return scaled
+}
+
+// statSummary returns the "N files changed, ..." line of a diffstat.
+func statSummary(files, added, removed int) string {
+	summary := fmt.Sprintf(" %d %s changed", files, plural(files, "file", "files"))
+	if added > 0 || removed == 0 {
+		summary += fmt.Sprintf(", %d %s(+)", added, plural(added, "insertion", "insertions"))
+	}
+	if removed > 0 || added == 0 {
+		summary += fmt.Sprintf(", %d %s(-)", removed, plural(removed, "deletion", "deletions"))
+	}
+	return summary
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
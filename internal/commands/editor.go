@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"fmt"
+	"mygit/internal/config"
+	"mygit/internal/repository"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// getEditor returns the editor command to use, looked up the way Git does:
+// $GIT_EDITOR, core.editor, $VISUAL, $EDITOR and finally vi.
+func getEditor(repo *repository.GitRepository) string {
+	if editor := os.Getenv("GIT_EDITOR"); editor != "" {
+		return editor
+	}
+
+	cfg := config.NewConfig(filepath.Join(repo.GitDir, "config"))
+	if err := cfg.Load(); err == nil {
+		if editor, ok := cfg.Get("core.editor"); ok && editor != "" {
+			return editor
+		}
+	}
+
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if editor := os.Getenv(env); editor != "" {
+			return editor
+		}
+	}
+	return "vi"
+}
+
+// launchEditor opens a file in the user's editor and waits for it to exit.
+// The editor command is run through the shell, so it may carry arguments.
+func launchEditor(repo *repository.GitRepository, path string) error {
+	editor := getEditor(repo)
+	if editor == ":" {
+		return nil
+	}
+
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("there was a problem with the editor '%s': %w", editor, err)
+	}
+	return nil
+}
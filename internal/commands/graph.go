@@ -0,0 +1,472 @@
+package commands
+
+import "strings"
+
+// States of the graph between the lines it draws for a commit.
+const (
+	graphPadding = iota
+	graphPreCommit
+	graphCommit
+	graphPostMerge
+	graphCollapsing
+)
+
+// mergeChars are the characters leading to the parents of a merge.
+const mergeChars = "/|\\"
+
+// graph draws the history graph of log --graph, line for line the way Git
+// draws it. Each column is a line of history waiting for the commit it
+// leads to. Below a commit, its parents take its place; the mapping tells
+// for each screen position which of the new columns the edge there leads
+// to, and collapsing lines move edges left until each is in its column.
+type graph struct {
+	commit  string
+	parents []string
+
+	columns    []string // columns above the commit
+	newColumns []string // columns below it
+	mapping    []int
+	oldMapping []int
+	width      int
+
+	commitIndex     int
+	prevCommitIndex int
+	edgesAdded      int
+	prevEdgesAdded  int
+	mergeLayout     int
+	expansionRow    int
+	state           int
+	prevState       int
+}
+
+// graphRow is what the graph draws for one commit.
+type graphRow struct {
+	separator string   // drawn beside the blank line before the commit, if asked for
+	before    []string // drawn on their own before the commit line
+	lines     []string // the commit line, then lines joining its edges into the columns
+	padding   string   // drawn beside any further lines of output about the commit
+}
+
+// next advances the graph past a commit with the given parents, those of
+// its (rewritten) parents that are shown, and returns the lines to draw
+// for it. With separator set, the commit is preceded by a blank line.
+// All lines of a row have the same width, so text beside them lines up.
+func (g *graph) next(hash string, parents []string, separator bool) graphRow {
+	g.update(hash, parents)
+
+	var row graphRow
+	if separator {
+		if g.state == graphCommit {
+			row.separator = g.separatorLine()
+		} else {
+			row.separator = g.nextLine()
+		}
+	}
+	for g.state == graphPreCommit {
+		row.before = append(row.before, g.nextLine())
+	}
+	for {
+		row.lines = append(row.lines, g.nextLine())
+		if g.state == graphPadding {
+			break
+		}
+	}
+	row.padding = g.nextLine()
+	return row
+}
+
+func (g *graph) setState(state int) {
+	g.prevState = g.state
+	g.state = state
+}
+
+func (g *graph) update(hash string, parents []string) {
+	g.commit = hash
+	g.parents = parents
+	g.prevCommitIndex = g.commitIndex
+	g.updateColumns()
+	g.expansionRow = 0
+	if g.needsPreCommitLine() {
+		g.state = graphPreCommit
+	} else {
+		g.state = graphCommit
+	}
+}
+
+// updateColumns lays out the columns below the commit and maps the edges
+// leaving the commit row onto them.
+func (g *graph) updateColumns() {
+	g.columns, g.newColumns = g.newColumns, nil
+
+	g.mapping = make([]int, 2*(len(g.columns)+len(g.parents)))
+	for i := range g.mapping {
+		g.mapping[i] = -1
+	}
+	g.width = 0
+	g.prevEdgesAdded = g.edgesAdded
+	g.edgesAdded = 0
+
+	// The commit is in a column of its own if no child drawn so far
+	// leads to it
+	seen := false
+	for i := 0; i <= len(g.columns); i++ {
+		var c string
+		if i == len(g.columns) {
+			if seen {
+				break
+			}
+			c = g.commit
+		} else {
+			c = g.columns[i]
+		}
+
+		if c != g.commit {
+			g.insertColumn(c, -1)
+			continue
+		}
+		seen = true
+		g.commitIndex = i
+		g.mergeLayout = -1
+		for _, p := range g.parents {
+			g.insertColumn(p, i)
+		}
+		// The commit always takes up a column
+		if len(g.parents) == 0 {
+			g.width += 2
+		}
+	}
+
+	for len(g.mapping) > 1 && g.mapping[len(g.mapping)-1] < 0 {
+		g.mapping = g.mapping[:len(g.mapping)-1]
+	}
+}
+
+// insertColumn maps the next edge onto the column for c, adding one if
+// needed. idx is the commit's column when c is one of its parents.
+func (g *graph) insertColumn(c string, idx int) {
+	i := -1
+	for k, existing := range g.newColumns {
+		if existing == c {
+			i = k
+			break
+		}
+	}
+	if i < 0 {
+		g.newColumns = append(g.newColumns, c)
+		i = len(g.newColumns) - 1
+	}
+
+	var pos int
+	switch {
+	case len(g.parents) > 1 && idx > -1 && g.mergeLayout == -1:
+		// The first parent of a merge: the merge leans left when that
+		// parent is in a column to the left of it
+		dist := idx - i
+		shift := 1
+		if dist > 1 {
+			shift = 2*dist - 3
+		}
+		g.mergeLayout = 1
+		if dist > 0 {
+			g.mergeLayout = 0
+		}
+		g.edgesAdded = len(g.parents) + g.mergeLayout - 2
+		pos = g.width + (g.mergeLayout-1)*shift
+		g.width += 2 * g.mergeLayout
+	case g.edgesAdded > 0 && i == g.mapping[g.width-2]:
+		// The last parent of the merge joins the column right next to
+		// it rather than getting a column of its own
+		pos = g.width - 2
+		g.edgesAdded = -1
+	default:
+		pos = g.width
+		g.width += 2
+	}
+	g.mapping[pos] = i
+}
+
+func (g *graph) numDashedParents() int {
+	return len(g.parents) + g.mergeLayout - 3
+}
+
+func (g *graph) needsPreCommitLine() bool {
+	return len(g.parents) >= 3 && g.commitIndex < len(g.columns)-1 &&
+		g.expansionRow < 2*g.numDashedParents()
+}
+
+// mappingCorrect reports whether every edge is in its column, or just to
+// the right of it, where it joins the column without another line.
+func (g *graph) mappingCorrect() bool {
+	for i, target := range g.mapping {
+		if target >= 0 && target != i/2 {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *graph) nextLine() string {
+	var line []byte
+	switch g.state {
+	case graphPadding:
+		line = []byte(strings.Repeat("| ", len(g.newColumns)))
+	case graphPreCommit:
+		line = g.preCommitLine()
+	case graphCommit:
+		line = g.commitLine()
+	case graphPostMerge:
+		line = g.postMergeLine()
+	case graphCollapsing:
+		line = g.collapsingLine()
+	}
+	return pad(string(line), g.width)
+}
+
+// separatorLine draws the columns above the commit, for the blank line
+// that separates it from the previous commit.
+func (g *graph) separatorLine() string {
+	var line []byte
+	for _, c := range g.columns {
+		line = append(line, '|')
+		if c == g.commit && len(g.parents) > 2 {
+			line = append(line, strings.Repeat(" ", 2*(len(g.parents)-2))...)
+		} else {
+			line = append(line, ' ')
+		}
+	}
+	g.prevState = graphPadding
+	return pad(string(line), g.width)
+}
+
+// preCommitLine widens the space beside an octopus merge to make room
+// for the edges to its parents.
+func (g *graph) preCommitLine() []byte {
+	var line []byte
+	seen := false
+	for i, c := range g.columns {
+		switch {
+		case c == g.commit:
+			seen = true
+			line = append(line, '|')
+			line = append(line, strings.Repeat(" ", g.expansionRow)...)
+		case seen && g.expansionRow == 0:
+			if g.prevState == graphPostMerge && g.prevCommitIndex < i {
+				line = append(line, '\\')
+			} else {
+				line = append(line, '|')
+			}
+		case seen:
+			line = append(line, '\\')
+		default:
+			line = append(line, '|')
+		}
+		line = append(line, ' ')
+	}
+
+	g.expansionRow++
+	if !g.needsPreCommitLine() {
+		g.setState(graphCommit)
+	}
+	return line
+}
+
+func (g *graph) commitLine() []byte {
+	var line []byte
+	seen := false
+	for i := 0; i <= len(g.columns); i++ {
+		var c string
+		if i == len(g.columns) {
+			if seen {
+				break
+			}
+			c = g.commit
+		} else {
+			c = g.columns[i]
+		}
+
+		switch {
+		case c == g.commit:
+			seen = true
+			line = append(line, '*')
+			if len(g.parents) > 2 {
+				dashed := g.numDashedParents()
+				for k := 0; k < dashed; k++ {
+					line = append(line, '-')
+					if k == dashed-1 {
+						line = append(line, '.')
+					} else {
+						line = append(line, '-')
+					}
+				}
+			}
+		case seen && g.edgesAdded > 1:
+			line = append(line, '\\')
+		case seen && g.edgesAdded == 1:
+			// Keep leaning the way the previous merge left the edge
+			if g.prevState == graphPostMerge && g.prevEdgesAdded > 0 && g.prevCommitIndex < i {
+				line = append(line, '\\')
+			} else {
+				line = append(line, '|')
+			}
+		case g.prevState == graphCollapsing && 2*i+1 < len(g.oldMapping) &&
+			g.oldMapping[2*i+1] == i && 2*i < len(g.mapping) && g.mapping[2*i] < i:
+			line = append(line, '/')
+		default:
+			line = append(line, '|')
+		}
+		line = append(line, ' ')
+	}
+
+	switch {
+	case len(g.parents) > 1:
+		g.setState(graphPostMerge)
+	case g.mappingCorrect():
+		g.setState(graphPadding)
+	default:
+		g.setState(graphCollapsing)
+	}
+	return line
+}
+
+// postMergeLine draws the edges from a merge to its parents.
+func (g *graph) postMergeLine() []byte {
+	var line []byte
+	seen := false
+	parentSeen := false
+	for i := 0; i <= len(g.columns); i++ {
+		var c string
+		if i == len(g.columns) {
+			if seen {
+				break
+			}
+			c = g.commit
+		} else {
+			c = g.columns[i]
+		}
+
+		switch {
+		case c == g.commit:
+			seen = true
+			idx := g.mergeLayout
+			for j := range g.parents {
+				line = append(line, mergeChars[idx])
+				if idx == 2 {
+					if g.edgesAdded > 0 || j < len(g.parents)-1 {
+						line = append(line, ' ')
+					}
+				} else {
+					idx++
+				}
+			}
+			if g.edgesAdded == 0 {
+				line = append(line, ' ')
+			}
+		case seen:
+			if g.edgesAdded > 0 {
+				line = append(line, '\\')
+			} else {
+				line = append(line, '|')
+			}
+			line = append(line, ' ')
+		default:
+			line = append(line, '|')
+			if g.mergeLayout != 0 || i != g.commitIndex-1 {
+				if parentSeen {
+					line = append(line, '_')
+				} else {
+					line = append(line, ' ')
+				}
+			}
+		}
+		if c == g.parents[0] {
+			parentSeen = true
+		}
+	}
+
+	if g.mappingCorrect() {
+		g.setState(graphPadding)
+	} else {
+		g.setState(graphCollapsing)
+	}
+	return line
+}
+
+// collapsingLine moves every edge that is not yet in its column one place
+// left. An edge crossing another passes to its left, and one edge per line
+// may run horizontally to close a wide gap.
+func (g *graph) collapsingLine() []byte {
+	size := len(g.mapping)
+	g.oldMapping = g.mapping
+	g.mapping = make([]int, size)
+	for i := range g.mapping {
+		g.mapping[i] = -1
+	}
+
+	horizontalEdge, horizontalTarget := -1, -1
+	for i, target := range g.oldMapping {
+		switch {
+		case target < 0:
+		case 2*target == i:
+			g.mapping[i] = target
+		case g.mapping[i-1] < 0:
+			g.mapping[i-1] = target
+			if horizontalEdge == -1 {
+				horizontalEdge, horizontalTarget = i, target
+				for j := 2*target + 3; j < i-2; j += 2 {
+					g.mapping[j] = target
+				}
+			}
+		case g.mapping[i-1] == target:
+			// Joins the edge to its left, which leads to the same commit
+		default:
+			g.mapping[i-2] = target
+			if horizontalEdge == -1 {
+				horizontalEdge, horizontalTarget = i-1, target
+				for j := 2*target + 3; j < i-2; j += 2 {
+					g.mapping[j] = target
+				}
+			}
+		}
+	}
+	g.oldMapping = append([]int(nil), g.mapping...)
+	if g.mapping[size-1] < 0 {
+		g.mapping = g.mapping[:size-1]
+	}
+
+	line := make([]byte, 0, size)
+	usedHorizontal := false
+	for i, target := range g.mapping {
+		switch {
+		case target < 0:
+			line = append(line, ' ')
+		case 2*target == i:
+			line = append(line, '|')
+		case target == horizontalTarget && i != horizontalEdge-1:
+			// Only the first segment of a horizontal edge carries on
+			// into the next line
+			if i != 2*target+3 {
+				g.mapping[i] = -1
+			}
+			usedHorizontal = true
+			line = append(line, '_')
+		default:
+			if usedHorizontal && i < horizontalEdge {
+				g.mapping[i] = -1
+			}
+			line = append(line, '/')
+		}
+	}
+
+	if g.mappingCorrect() {
+		g.setState(graphPadding)
+	}
+	return line
+}
+
+// pad pads a graph line with spaces to the given width.
+func pad(s string, width int) string {
+	if len(s) >= width {
+		return s
+	}
+	return s + strings.Repeat(" ", width-len(s))
+}
@@ -0,0 +1,526 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mygit/internal/diff"
+	"mygit/internal/index"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"mygit/internal/utils"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// grepOptions holds the options of grep.
+type grepOptions struct {
+	patterns     []string
+	ignoreCase   bool
+	wordRegexp   bool
+	invert       bool
+	fixed        bool
+	lineNumber   bool
+	filesWith    bool
+	filesWithout bool
+	count        bool
+	quiet        bool
+	noFilename   bool
+	fullName     bool
+	binaryFiles  string // "", "text" (-a) or "without-match" (-I)
+	before       int
+	after        int
+	cached       bool
+	noPager      bool
+}
+
+// Grep handles the `grep` command, which searches tracked files for lines
+// matching a regular expression:
+//
+//	mygit grep [<options>] [-e] <pattern> [--cached | <rev>...] [[--] <path>...]
+//
+// Patterns use RE2 syntax. Without --cached or a revision the working
+// tree copies of the files in the index are searched; a revision's tree is
+// read straight from the object store. Files are searched in parallel, and
+// the results printed in path order.
+func Grep(args []string) {
+	var opts grepOptions
+	var rest []string
+	dashdash := -1
+
+	usage := func() {
+		fmt.Println("usage: mygit grep [<options>] [-e] <pattern> [<rev>...] [[--] <path>...]")
+		os.Exit(129)
+	}
+	number := func(i *int, name, value string) int {
+		if value == "" {
+			if *i+1 >= len(args) {
+				fmt.Printf("error: switch `%s' requires a value\n", name)
+				os.Exit(129)
+			}
+			*i++
+			value = args[*i]
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			fmt.Printf("error: switch `%s' expects a numerical value\n", name)
+			os.Exit(129)
+		}
+		return n
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case dashdash >= 0:
+			rest = append(rest, arg)
+		case arg == "--":
+			dashdash = len(rest)
+		case arg == "-e":
+			if i+1 >= len(args) {
+				fmt.Println("error: switch `e' requires a value")
+				os.Exit(129)
+			}
+			i++
+			opts.patterns = append(opts.patterns, args[i])
+		case arg == "-i" || arg == "--ignore-case":
+			opts.ignoreCase = true
+		case arg == "-w" || arg == "--word-regexp":
+			opts.wordRegexp = true
+		case arg == "-v" || arg == "--invert-match":
+			opts.invert = true
+		case arg == "-F" || arg == "--fixed-strings":
+			opts.fixed = true
+		case arg == "-E" || arg == "--extended-regexp" || arg == "-G" || arg == "--basic-regexp":
+			opts.fixed = false
+		case arg == "-n" || arg == "--line-number":
+			opts.lineNumber = true
+		case arg == "-l" || arg == "--files-with-matches" || arg == "--name-only":
+			opts.filesWith, opts.filesWithout = true, false
+		case arg == "-L" || arg == "--files-without-match":
+			opts.filesWithout, opts.filesWith = true, false
+		case arg == "-c" || arg == "--count":
+			opts.count = true
+		case arg == "-q" || arg == "--quiet":
+			opts.quiet = true
+		case arg == "-h":
+			opts.noFilename = true
+		case arg == "-H":
+			opts.noFilename = false
+		case arg == "--full-name":
+			opts.fullName = true
+		case arg == "-a" || arg == "--text":
+			opts.binaryFiles = "text"
+		case arg == "-I":
+			opts.binaryFiles = "without-match"
+		case arg == "--cached":
+			opts.cached = true
+		case arg == "--no-pager":
+			opts.noPager = true
+		case arg == "-A" || strings.HasPrefix(arg, "--after-context"):
+			opts.after = number(&i, "A", strings.TrimPrefix(strings.TrimPrefix(arg, "--after-context"), "="))
+		case arg == "-B" || strings.HasPrefix(arg, "--before-context"):
+			opts.before = number(&i, "B", strings.TrimPrefix(strings.TrimPrefix(arg, "--before-context"), "="))
+		case arg == "-C" || strings.HasPrefix(arg, "--context"):
+			n := number(&i, "C", strings.TrimPrefix(strings.TrimPrefix(arg, "--context"), "="))
+			opts.before, opts.after = n, n
+		case len(arg) > 2 && (arg[1] == 'A' || arg[1] == 'B' || arg[1] == 'C') && arg[0] == '-':
+			n := number(&i, arg[1:2], arg[2:])
+			if arg[1] != 'A' {
+				opts.before = n
+			}
+			if arg[1] != 'B' {
+				opts.after = n
+			}
+		case len(arg) > 1 && arg[0] == '-' && arg[1] >= '0' && arg[1] <= '9':
+			n := number(&i, "NUM", arg[1:])
+			opts.before, opts.after = n, n
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			fmt.Printf("error: unknown option `%s'\n", strings.TrimLeft(arg, "-"))
+			usage()
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	if len(opts.patterns) == 0 {
+		if len(rest) == 0 || dashdash == 0 {
+			fmt.Println("fatal: no pattern given")
+			os.Exit(128)
+		}
+		opts.patterns = rest[:1]
+		rest = rest[1:]
+		dashdash--
+	}
+
+	re, err := compileGrepPattern(opts)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(128)
+	}
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+
+	// Revisions come first; the first argument that is not one starts
+	// the paths, and must then exist
+	var revs, paths []string
+	for i, arg := range rest {
+		if dashdash >= 0 && i >= dashdash {
+			paths = append(paths, arg)
+			continue
+		}
+		if len(paths) == 0 {
+			if _, err := resolveRevision(objStore, refManager, arg); err == nil {
+				revs = append(revs, arg)
+				continue
+			}
+		}
+		if dashdash < 0 {
+			if _, err := os.Lstat(arg); err != nil {
+				fmt.Printf("fatal: ambiguous argument '%s': unknown revision or path not in the working tree.\n", arg)
+				fmt.Println("Use '--' to separate paths from revisions, like this:")
+				fmt.Println("'mygit <command> [<revision>...] -- [<file>...]'")
+				os.Exit(128)
+			}
+		}
+		paths = append(paths, arg)
+	}
+	if opts.cached && len(revs) > 0 {
+		fmt.Println("fatal: --cached cannot be used with revisions")
+		os.Exit(128)
+	}
+
+	prefix := ""
+	if rel, err := filepath.Rel(repo.WorkDir, cwd); err == nil && rel != "." {
+		prefix = filepath.ToSlash(rel)
+	}
+	specs, err := normalizePathspecs(repo, paths)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	if len(specs) == 0 && prefix != "" {
+		specs = []string{prefix}
+	}
+
+	var files []grepFile
+	if len(revs) > 0 {
+		for _, rev := range revs {
+			found, err := grepTreeFiles(objStore, refManager, rev, specs)
+			if err != nil {
+				fmt.Printf("fatal: %v\n", err)
+				os.Exit(128)
+			}
+			files = append(files, found...)
+		}
+	} else {
+		idx := index.NewIndex(repo.GitDir)
+		if err := idx.Load(); err != nil {
+			fmt.Printf("fatal: %v\n", err)
+			os.Exit(128)
+		}
+		files = grepIndexFiles(repo, idx, opts.cached, specs)
+	}
+	for i := range files {
+		files[i].name = files[i].path
+		if !opts.fullName && prefix != "" {
+			files[i].name = relativeTo(files[i].path, prefix)
+		}
+		files[i].name = files[i].label + files[i].name
+	}
+
+	g := &grepper{objStore: objStore, workDir: repo.WorkDir, re: re, opts: opts}
+	results := g.searchAll(files)
+
+	var w io.Writer = os.Stdout
+	done := func() {}
+	if !opts.noPager && !opts.quiet {
+		w, done = startPager(repo)
+	}
+	out := bufio.NewWriter(w)
+	found := false
+	separate := false
+	for i, r := range results {
+		if r.err != nil {
+			out.Flush()
+			done()
+			fmt.Printf("fatal: %s: %v\n", files[i].name, r.err)
+			os.Exit(128)
+		}
+		if !r.matched {
+			continue
+		}
+		found = true
+		if opts.quiet {
+			break
+		}
+		// Runs of lines with context are set off by "--", across files too
+		if separate && r.context {
+			out.WriteString("--\n")
+		}
+		out.Write(r.output)
+		separate = separate || r.context
+	}
+	out.Flush()
+	done()
+	if !found {
+		os.Exit(1)
+	}
+}
+
+// compileGrepPattern builds one RE2 expression out of the -e patterns.
+func compileGrepPattern(opts grepOptions) (*regexp.Regexp, error) {
+	alternatives := make([]string, len(opts.patterns))
+	for i, p := range opts.patterns {
+		if opts.fixed {
+			p = regexp.QuoteMeta(p)
+		}
+		alternatives[i] = "(?:" + p + ")"
+	}
+	expr := strings.Join(alternatives, "|")
+	if opts.ignoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %v", err)
+	}
+	return re, nil
+}
+
+// grepFile is a file to search: a blob, or a working tree file when hash
+// is empty. name is how the file is shown, with the revision in front.
+type grepFile struct {
+	path  string
+	hash  string
+	label string
+	name  string
+}
+
+// grepIndexFiles lists the tracked regular files selected by specs, with their
+// staged blobs when cached is set.
+func grepIndexFiles(repo *repository.GitRepository, idx *index.Index, cached bool, specs []string) []grepFile {
+	var files []grepFile
+	for p, entry := range idx.GetAll() {
+		if len(specs) > 0 && !matchPathspec(p, specs) {
+			continue
+		}
+		if mode := objects.ModeFromPermissions(entry.Permissions); mode == objects.ModeGitlink || mode == objects.ModeSymlink {
+			continue
+		}
+		f := grepFile{path: p}
+		if cached {
+			f.hash = entry.Hash
+		} else if _, err := os.Lstat(filepath.Join(repo.WorkDir, filepath.FromSlash(p))); err != nil {
+			// Deleted from the working tree, so there is nothing to search
+			continue
+		}
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files
+}
+
+// grepTreeFiles lists the regular files of a tree-ish selected by specs, labelled
+// with "<rev>:".
+func grepTreeFiles(objStore *objects.ObjectStore, refManager *refs.RefManager, rev string, specs []string) ([]grepFile, error) {
+	hash, err := resolveRevision(objStore, refManager, rev)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := peelRevision(objStore, hash, "tree", rev)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := utils.GetTreeEntriesRecursive(objStore, tree, "")
+	if err != nil {
+		return nil, err
+	}
+	label := rev + ":"
+
+	var files []grepFile
+	for p, entry := range entries {
+		if len(specs) > 0 && !matchPathspec(p, specs) {
+			continue
+		}
+		if mode := objects.ModeFromPermissions(entry.Permissions); mode == objects.ModeGitlink || mode == objects.ModeSymlink {
+			continue
+		}
+		files = append(files, grepFile{path: p, hash: entry.Hash, label: label})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files, nil
+}
+
+// grepResult is what searching one file printed.
+type grepResult struct {
+	matched bool
+	context bool // the output has context lines, so it is set off by "--"
+	output  []byte
+	err     error
+}
+
+// grepper searches files with a fixed set of options.
+type grepper struct {
+	objStore *objects.ObjectStore
+	workDir  string
+	re       *regexp.Regexp
+	opts     grepOptions
+}
+
+// searchAll searches the files on as many goroutines as there are CPUs
+// and returns the results in the order of files.
+func (g *grepper) searchAll(files []grepFile) []grepResult {
+	results := make([]grepResult, len(files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < runtime.NumCPU(); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = g.search(files[i])
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// search reads and searches one file.
+func (g *grepper) search(f grepFile) grepResult {
+	var data []byte
+	var err error
+	if f.hash != "" {
+		var obj *objects.Object
+		if obj, err = g.objStore.ReadObject(f.hash); err == nil {
+			data = obj.Content
+		}
+	} else {
+		data, err = os.ReadFile(filepath.Join(g.workDir, filepath.FromSlash(f.path)))
+	}
+	if err != nil {
+		return grepResult{err: err}
+	}
+
+	binary := g.opts.binaryFiles != "text" && diff.IsBinary(data)
+	if binary && g.opts.binaryFiles == "without-match" {
+		return grepResult{matched: g.opts.filesWithout, output: g.nameLine(f)}
+	}
+
+	lines := diff.SplitLines(data)
+	matches := make([]bool, len(lines))
+	count := 0
+	for i, line := range lines {
+		if g.matchLine(strings.TrimSuffix(line, "\n")) != g.opts.invert {
+			matches[i] = true
+			count++
+		}
+	}
+
+	switch {
+	case g.opts.filesWithout:
+		return grepResult{matched: count == 0, output: g.nameLine(f)}
+	case count == 0:
+		return grepResult{}
+	case g.opts.filesWith:
+		return grepResult{matched: true, output: g.nameLine(f)}
+	case g.opts.count:
+		if g.opts.noFilename {
+			return grepResult{matched: true, output: []byte(fmt.Sprintf("%d\n", count))}
+		}
+		return grepResult{matched: true, output: []byte(fmt.Sprintf("%s:%d\n", f.name, count))}
+	case binary:
+		return grepResult{matched: true, output: []byte(fmt.Sprintf("Binary file %s matches\n", f.name))}
+	}
+
+	var buf bytes.Buffer
+	context := g.opts.before > 0 || g.opts.after > 0
+	last := -1 // the last line printed
+	for i := range lines {
+		if !matches[i] {
+			continue
+		}
+		from := max(i-g.opts.before, last+1)
+		if context && last >= 0 && from > last+1 {
+			buf.WriteString("--\n")
+		}
+		for j := from; j < i; j++ {
+			g.writeLine(&buf, f, j, lines[j], '-')
+		}
+		g.writeLine(&buf, f, i, lines[i], ':')
+		last = i
+		// Trailing context stops at the next match, which prints its own
+		for j := i + 1; j <= i+g.opts.after && j < len(lines) && !matches[j]; j++ {
+			g.writeLine(&buf, f, j, lines[j], '-')
+			last = j
+		}
+	}
+	return grepResult{matched: true, context: context, output: buf.Bytes()}
+}
+
+// matchLine reports whether a line matches. With -w the match must not
+// have word characters on either side; if the leftmost one does, later
+// matches are tried.
+func (g *grepper) matchLine(line string) bool {
+	if !g.opts.wordRegexp {
+		return g.re.MatchString(line)
+	}
+	for start := 0; start <= len(line); {
+		loc := g.re.FindStringIndex(line[start:])
+		if loc == nil {
+			return false
+		}
+		begin, end := start+loc[0], start+loc[1]
+		if (begin == 0 || !isWordByte(line[begin-1])) && (end == len(line) || !isWordByte(line[end])) && end > begin {
+			return true
+		}
+		start = begin + 1
+	}
+	return false
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// writeLine writes a matching (sep ':') or context (sep '-') line.
+func (g *grepper) writeLine(buf *bytes.Buffer, f grepFile, i int, line string, sep byte) {
+	if !g.opts.noFilename {
+		buf.WriteString(f.name)
+		buf.WriteByte(sep)
+	}
+	if g.opts.lineNumber {
+		buf.WriteString(strconv.Itoa(i + 1))
+		buf.WriteByte(sep)
+	}
+	buf.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		buf.WriteByte('\n')
+	}
+}
+
+func (g *grepper) nameLine(f grepFile) []byte {
+	return []byte(f.name + "\n")
+}
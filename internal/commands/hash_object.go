@@ -0,0 +1,154 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mygit/internal/objects"
+	"mygit/internal/repository"
+	"mygit/internal/utils"
+	"os"
+	"strings"
+)
+
+// HashObject handles the `hash-object` command. It prints the hash of an
+// object with the given content, and with -w also writes it:
+//
+//	mygit hash-object [-w] [-t <type>] [--literally] (--stdin | --stdin-paths | <file>...)
+//
+// Commits, trees and tags are checked to parse unless --literally is given.
+func HashObject(args []string) {
+	write := false
+	objType := objects.BlobType
+	literally := false
+	fromStdin, stdinPaths := false, false
+	var files []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-w":
+			write = true
+		case arg == "-t":
+			if i+1 >= len(args) {
+				fmt.Println("fatal: option '-t' requires a value")
+				os.Exit(128)
+			}
+			i++
+			objType = objects.ObjectType(args[i])
+		case arg == "--literally":
+			literally = true
+		case arg == "--stdin":
+			fromStdin = true
+		case arg == "--stdin-paths":
+			stdinPaths = true
+		case arg == "--":
+			files = append(files, args[i+1:]...)
+			i = len(args)
+		case strings.HasPrefix(arg, "-"):
+			fmt.Printf("fatal: unknown option '%s'\n", arg)
+			os.Exit(128)
+		default:
+			files = append(files, arg)
+		}
+	}
+
+	switch objType {
+	case objects.BlobType, objects.TreeType, objects.CommitType, objects.TagType:
+	default:
+		if !literally {
+			fmt.Printf("fatal: invalid object type \"%s\"\n", objType)
+			os.Exit(128)
+		}
+	}
+	if stdinPaths && (fromStdin || len(files) > 0) {
+		fmt.Println("fatal: --stdin-paths cannot be combined with --stdin or file names")
+		os.Exit(128)
+	}
+	if !fromStdin && !stdinPaths && len(files) == 0 {
+		fmt.Println("usage: mygit hash-object [-w] [-t <type>] [--literally] (--stdin | --stdin-paths | <file>...)")
+		os.Exit(129)
+	}
+
+	// Writing needs a repository; only hashing does not
+	var objStore *objects.ObjectStore
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(128)
+	}
+	if repo, err := repository.FindRepository(cwd); err == nil {
+		objStore = objects.NewObjectStore(repo.GitDir)
+	} else if write {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	} else {
+		objStore = objects.NewObjectStore("")
+	}
+
+	hash := func(content []byte) {
+		if !literally {
+			if err := checkObject(content, objType); err != nil {
+				fmt.Printf("fatal: corrupt %s: %v\n", objType, err)
+				os.Exit(128)
+			}
+		}
+		h := objStore.HashObject(content, objType)
+		if write {
+			if h, err = objStore.WriteObject(content, objType); err != nil {
+				fmt.Printf("fatal: %v\n", err)
+				os.Exit(128)
+			}
+		}
+		fmt.Println(h)
+	}
+
+	if fromStdin {
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Printf("fatal: %v\n", err)
+			os.Exit(128)
+		}
+		hash(content)
+	}
+	if stdinPaths {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			files = append(files, scanner.Text())
+		}
+	}
+	for _, file := range files {
+		content, _, err := utils.ReadWorktreeFile(file)
+		if err != nil {
+			fmt.Printf("fatal: could not open '%s' for reading: %v\n", file, err)
+			os.Exit(128)
+		}
+		hash(content)
+	}
+}
+
+// checkObject checks that content parses as an object of the given type.
+func checkObject(content []byte, objType objects.ObjectType) error {
+	switch objType {
+	case objects.TreeType:
+		tree, err := objects.ParseTree(content)
+		if err != nil {
+			return err
+		}
+		// Parsing stops at the first malformed entry
+		size := 0
+		for _, e := range tree.Entries {
+			size += len(e.Mode) + len(e.Name) + 22
+		}
+		if size != len(content) {
+			return fmt.Errorf("malformed tree entry")
+		}
+	case objects.CommitType:
+		_, err := objects.ParseCommit(content)
+		return err
+	case objects.TagType:
+		_, err := objects.ParseTag(content)
+		return err
+	}
+	return nil
+}
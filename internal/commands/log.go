@@ -1,15 +1,243 @@
 package commands
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"mygit/internal/index"
 	"mygit/internal/objects"
 	"mygit/internal/refs"
 	"mygit/internal/repository"
+	"mygit/internal/utils"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// logOptions holds the options of log.
+type logOptions struct {
+	revs  []string
+	paths []string
+	all   bool
+
+	maxCount    int // -1 for no limit
+	skip        int
+	order       int
+	reverse     bool
+	firstParent bool
+	noMerges    bool
+	mergesOnly  bool
+	since       time.Time
+	until       time.Time
+
+	authors    []string
+	committers []string
+	greps      []string
+	ignoreCase bool
+	allMatch   bool
+	invertGrep bool
+
+	graph         bool
+	stat          bool
+	patch         bool
+	nameOnly      bool
+	nameStatus    bool
+	combined      string // "c" or "cc" (dense) to show merges as a combined diff
+	renames       renameOptions
+	follow        bool
+	follower      *follower // with --follow, tracks the file's name
+	showSignature bool
+	decorate      string // "short", "full", "no" or "auto"
+	noPager       bool
+	format        prettyFormat
+}
+
+// logFilter holds the compiled --author, --committer and --grep patterns.
+type logFilter struct {
+	authors    []*regexp.Regexp
+	committers []*regexp.Regexp
+	greps      []*regexp.Regexp
+}
+
 func Log(args []string) {
+	opts := logOptions{maxCount: -1, decorate: "auto"}
+	opts.format.name = "medium"
+
+	// Options that take a value accept it either as "--opt=value" or as
+	// the next argument
+	value := func(i *int, arg, name string) string {
+		if v, ok := strings.CutPrefix(arg, name+"="); ok {
+			return v
+		}
+		if *i+1 >= len(args) {
+			fmt.Printf("Error: option '%s' requires a value\n", name)
+			os.Exit(1)
+		}
+		*i++
+		return args[*i]
+	}
+	count := func(s string) int {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			fmt.Printf("Error: '%s' is not a valid count\n", s)
+			os.Exit(1)
+		}
+		return n
+	}
+	date := func(s string) time.Time {
+		t, err := parseDate(s)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return t
+	}
+	hasName := func(arg, name string) bool {
+		return arg == name || strings.HasPrefix(arg, name+"=")
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			opts.paths = append(opts.paths, args[i+1:]...)
+			i = len(args)
+		case arg == "--all":
+			opts.all = true
+		case arg == "--graph":
+			opts.graph = true
+		case arg == "--oneline":
+			opts.format.name = "oneline"
+			opts.format.abbrev = true
+		case hasName(arg, "--pretty") || hasName(arg, "--format"):
+			spec := "medium"
+			if v, ok := strings.CutPrefix(arg, "--pretty="); ok {
+				spec = v
+			} else if strings.HasPrefix(arg, "--format") {
+				spec = value(&i, arg, "--format")
+			}
+			format, err := parsePrettyFormat(spec)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			format.abbrev = opts.format.abbrev
+			opts.format = format
+		case arg == "--abbrev-commit":
+			opts.format.abbrev = true
+		case arg == "--no-abbrev-commit":
+			opts.format.abbrev = false
+		case hasName(arg, "--date"):
+			mode := value(&i, arg, "--date")
+			if !validDateModes[mode] {
+				fmt.Printf("Error: unknown date format %s\n", mode)
+				os.Exit(1)
+			}
+			opts.format.dateMode = mode
+		case arg == "--relative-date":
+			opts.format.dateMode = "relative"
+		case arg == "--decorate":
+			opts.decorate = "short"
+		case strings.HasPrefix(arg, "--decorate="):
+			opts.decorate = strings.TrimPrefix(arg, "--decorate=")
+			if opts.decorate != "short" && opts.decorate != "full" && opts.decorate != "no" && opts.decorate != "auto" {
+				fmt.Printf("Error: invalid --decorate option: %s\n", opts.decorate)
+				os.Exit(1)
+			}
+		case arg == "--no-decorate":
+			opts.decorate = "no"
+		case arg == "-n" || hasName(arg, "--max-count"):
+			name := "--max-count"
+			if arg == "-n" {
+				name = "-n"
+			}
+			opts.maxCount = count(value(&i, arg, name))
+		case strings.HasPrefix(arg, "-n"):
+			opts.maxCount = count(arg[2:])
+		case len(arg) > 1 && arg[0] == '-' && arg[1] >= '0' && arg[1] <= '9':
+			opts.maxCount = count(arg[1:])
+		case hasName(arg, "--skip"):
+			opts.skip = count(value(&i, arg, "--skip"))
+		case hasName(arg, "--since") || hasName(arg, "--after"):
+			name, _, _ := strings.Cut(arg, "=")
+			opts.since = date(value(&i, arg, name))
+		case hasName(arg, "--until") || hasName(arg, "--before"):
+			name, _, _ := strings.Cut(arg, "=")
+			opts.until = date(value(&i, arg, name))
+		case hasName(arg, "--author"):
+			opts.authors = append(opts.authors, value(&i, arg, "--author"))
+		case hasName(arg, "--committer"):
+			opts.committers = append(opts.committers, value(&i, arg, "--committer"))
+		case hasName(arg, "--grep"):
+			opts.greps = append(opts.greps, value(&i, arg, "--grep"))
+		case arg == "-i" || arg == "--regexp-ignore-case":
+			opts.ignoreCase = true
+		case arg == "--all-match":
+			opts.allMatch = true
+		case arg == "--invert-grep":
+			opts.invertGrep = true
+		case arg == "--topo-order":
+			opts.order = orderTopo
+		case arg == "--date-order":
+			opts.order = orderDate
+		case arg == "--reverse":
+			opts.reverse = true
+		case arg == "--first-parent":
+			opts.firstParent = true
+		case arg == "--no-merges":
+			opts.noMerges = true
+		case arg == "--merges":
+			opts.mergesOnly = true
+		case arg == "--stat":
+			opts.stat = true
+		case arg == "-p" || arg == "-u" || arg == "--patch":
+			opts.patch = true
+		case arg == "-c" || arg == "--cc":
+			opts.combined = strings.TrimLeft(arg, "-")
+		case arg == "--name-only":
+			opts.nameOnly, opts.nameStatus = true, false
+		case arg == "--name-status":
+			opts.nameStatus, opts.nameOnly = true, false
+		case arg == "--follow":
+			opts.follow = true
+		case arg == "-s" || arg == "--no-patch":
+			opts.patch, opts.stat, opts.nameOnly, opts.nameStatus = false, false, false, false
+			opts.combined = ""
+		case arg == "--show-signature":
+			opts.showSignature = true
+		case arg == "--no-pager":
+			opts.noPager = true
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			if ok, err := parseRenameOption(arg, &opts.renames); ok {
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				continue
+			}
+			fmt.Printf("Error: unknown option '%s'\n", arg)
+			os.Exit(1)
+		default:
+			opts.revs = append(opts.revs, arg)
+		}
+	}
+	if opts.graph && opts.reverse {
+		fmt.Println("Error: options '--reverse' and '--graph' cannot be used together")
+		os.Exit(1)
+	}
+	if opts.graph && opts.order == orderWalk {
+		opts.order = orderTopo
+	}
+	if opts.nameOnly || opts.nameStatus {
+		opts.patch = false
+	}
+	// -c and --cc show patches unless another kind of output is asked for
+	if opts.combined != "" && !opts.stat && !opts.nameOnly && !opts.nameStatus {
+		opts.patch = true
+	}
+
 	// Find repository
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -26,47 +254,522 @@ func Log(args []string) {
 	// Initialize object store and ref manager
 	objStore := objects.NewObjectStore(repo.GitDir)
 	refManager := refs.NewRefManager(repo.GitDir)
+	opts.renames.resolve(repo, "diff.renames")
 
-	// Get current commit
-	currentCommit, err := refManager.GetHEAD()
-	if err != nil || currentCommit == "" {
-		fmt.Println("No commits yet")
-		return
+	filter, err := compileLogFilter(opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	// Walk commit history
-	commitHash := currentCommit
-	for commitHash != "" {
-		// Read commit object
-		obj, err := objStore.ReadObject(commitHash)
+	// Arguments before "--" that are not revisions but name files are
+	// taken as paths, as Git does when it is unambiguous
+	var revs []string
+	for _, rev := range opts.revs {
+		if strings.Contains(rev, "..") || !utils.PathExists(rev) {
+			revs = append(revs, rev)
+			continue
+		}
+		if _, err := resolveRevision(objStore, refManager, strings.TrimPrefix(rev, "^")); err == nil {
+			fmt.Printf("Error: ambiguous argument '%s': both revision and filename\n", rev)
+			fmt.Println("Use '--' to separate paths from revisions")
+			os.Exit(1)
+		}
+		opts.paths = append(opts.paths, rev)
+	}
+	if opts.all {
+		list, err := refManager.ListRefs("refs/")
 		if err != nil {
-			fmt.Printf("Error reading commit %s: %v\n", commitHash, err)
-			break
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, ref := range list {
+			if obj, err := peelTag(objStore, ref.Hash); err == nil && obj.Type == objects.CommitType {
+				revs = append(revs, obj.Hash)
+			}
+		}
+		if head, _ := refManager.GetHEAD(); head != "" {
+			revs = append(revs, head)
 		}
+	}
+	if len(revs) == 0 || onlyNegative(revs) {
+		head, err := refManager.GetHEAD()
+		if err != nil || head == "" {
+			if opts.all {
+				return
+			}
+			fmt.Println("No commits yet")
+			return
+		}
+		revs = append(revs, "HEAD")
+	}
 
-		if obj.Type != objects.CommitType {
-			fmt.Printf("Object %s is not a commit\n", commitHash)
-			break
+	walk := newRevWalk(objStore, refManager)
+	walk.firstParent = opts.firstParent
+	if len(opts.paths) > 0 {
+		walk.paths, err = normalizePathspecs(repo, opts.paths)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
 		}
+	}
+	if opts.follow {
+		// The file is followed by name through the whole history, rather
+		// than limiting the history to a fixed path
+		if len(walk.paths) != 1 {
+			fmt.Println("Error: --follow requires exactly one pathspec")
+			os.Exit(1)
+		}
+		score := opts.renames.score
+		if !opts.renames.renames {
+			score = defaultRenameScore
+		}
+		opts.follower = &follower{
+			path:    walk.paths[0],
+			names:   make(map[string]string),
+			renames: renameOptions{renames: true, copies: true, harder: true, score: score},
+		}
+		walk.paths = nil
+	}
+
+	shown, visible, err := selectLogCommits(walk, revs, opts, filter)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
-		// Parse commit
-		commit, err := objects.ParseCommit(obj.Content)
+	opts.format.repo = repo
+	opts.format.color = isTerminal(os.Stdout)
+	decorate := opts.decorate == "short" || opts.decorate == "full" || opts.decorate == "auto" && isTerminal(os.Stdout)
+	if opts.format.name == "format" {
+		// Format strings only show decorations through %d and %D
+		decorate = strings.Contains(opts.format.template, "%d") || strings.Contains(opts.format.template, "%D")
+	}
+	if decorate {
+		opts.format.decorations, err = loadDecorations(objStore, refManager, opts.decorate == "full")
 		if err != nil {
-			fmt.Printf("Error parsing commit %s: %v\n", commitHash, err)
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	done := func() {}
+	if !opts.noPager {
+		w, done = startPager(repo)
+	}
+	out := bufio.NewWriter(w)
+	err = printLog(out, repo, walk, shown, visible, opts)
+	out.Flush()
+	done()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// onlyNegative reports whether every revision argument excludes commits,
+// in which case log starts from HEAD.
+func onlyNegative(revs []string) bool {
+	for _, rev := range revs {
+		if !strings.HasPrefix(rev, "^") {
+			return false
+		}
+	}
+	return true
+}
+
+func compileLogFilter(opts logOptions) (*logFilter, error) {
+	compile := func(patterns []string) ([]*regexp.Regexp, error) {
+		var res []*regexp.Regexp
+		for _, p := range patterns {
+			if opts.ignoreCase {
+				p = "(?i)" + p
+			}
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern '%s': %v", p, err)
+			}
+			res = append(res, re)
+		}
+		return res, nil
+	}
+
+	var filter logFilter
+	var err error
+	if filter.authors, err = compile(opts.authors); err != nil {
+		return nil, err
+	}
+	if filter.committers, err = compile(opts.committers); err != nil {
+		return nil, err
+	}
+	if filter.greps, err = compile(opts.greps); err != nil {
+		return nil, err
+	}
+	return &filter, nil
+}
+
+// matches reports whether a commit passes the filters.
+func (f *logFilter) matches(c *objects.Commit, opts logOptions) bool {
+	if !opts.since.IsZero() && c.Committer.When.Before(opts.since) {
+		return false
+	}
+	if !opts.until.IsZero() && c.Committer.When.After(opts.until) {
+		return false
+	}
+	if len(f.authors) > 0 && !matchesAnyRegexp(f.authors, c.Author.Identity()) {
+		return false
+	}
+	if len(f.committers) > 0 && !matchesAnyRegexp(f.committers, c.Committer.Identity()) {
+		return false
+	}
+	if len(f.greps) > 0 {
+		matched := matchesAnyRegexp(f.greps, c.Message)
+		if opts.allMatch {
+			for _, re := range f.greps {
+				if !re.MatchString(c.Message) {
+					matched = false
+				}
+			}
+		}
+		if matched == opts.invertGrep {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesAnyRegexp(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectLogCommits returns the commits log shows, in order, and the set of
+// commits that pass the filters. The two differ by --skip and --max-count;
+// the graph draws edges towards the commits in the set even past the end
+// of the output.
+func selectLogCommits(walk *revWalk, revs []string, opts logOptions, filter *logFilter) ([]string, map[string]bool, error) {
+	tips, err := walk.selectRange(revs)
+	if err != nil {
+		return nil, nil, err
+	}
+	sorted, err := walk.sort(tips, opts.order)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var shown []string
+	visible := make(map[string]bool)
+	skip := opts.skip
+	for _, hash := range sorted {
+		full := opts.maxCount >= 0 && len(shown) == opts.maxCount
+		if full && !opts.graph {
 			break
 		}
+		c, err := walk.commit(hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		if opts.noMerges && len(c.Parents) > 1 || opts.mergesOnly && len(c.Parents) < 2 {
+			continue
+		}
+		var changed bool
+		if opts.follower != nil {
+			changed, err = opts.follower.changes(walk, hash)
+		} else {
+			changed, err = walk.changesPaths(hash)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if !changed || !filter.matches(c, opts) {
+			continue
+		}
+		visible[hash] = true
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if !full {
+			shown = append(shown, hash)
+		}
+	}
+
+	if opts.reverse {
+		for i, j := 0, len(shown)-1; i < j; i, j = i+1, j-1 {
+			shown[i], shown[j] = shown[j], shown[i]
+		}
+	}
+	return shown, visible, nil
+}
+
+// follower follows a file through renames for log --follow. Walking back
+// in history, the name it looks for changes at each commit that created
+// the file by renaming or copying another.
+type follower struct {
+	path    string            // the file's name before the commits seen so far
+	names   map[string]string // its name in each commit that changed it
+	renames renameOptions     // copies are looked for among all files
+}
+
+// changes reports whether a commit changes the followed file, compared
+// with each of its parents, and moves on to the file's old name if the
+// commit renamed or copied it from there.
+func (f *follower) changes(walk *revWalk, hash string) (bool, error) {
+	tree, err := walk.tree(hash)
+	if err != nil {
+		return false, err
+	}
+	parents, err := walk.parents(hash)
+	if err != nil {
+		return false, err
+	}
+	specs := []string{f.path}
+	parentTree := map[string]*index.IndexEntry{}
+	for i, p := range parents {
+		t, err := walk.tree(p)
+		if err != nil {
+			return false, err
+		}
+		if sameAtPaths(tree, t, specs) {
+			return false, nil
+		}
+		if i == 0 {
+			parentTree = t
+		}
+	}
+	if len(parents) == 0 && sameAtPaths(tree, parentTree, specs) {
+		return false, nil
+	}
+	f.names[hash] = f.path
 
-		// Display commit info
-		fmt.Printf("commit %s\n", commitHash)
-		fmt.Printf("Author: %s\n", commit.Author)
-		fmt.Printf("Date: %s\n", commit.Timestamp.Format(time.RFC3339))
-		fmt.Printf("\n    %s\n\n", commit.Message)
+	if tree[f.path] != nil && parentTree[f.path] == nil {
+		changes, err := diffWithRenames(walk.objStore, parentTree, tree, f.renames)
+		if err != nil {
+			return false, err
+		}
+		for _, change := range changes {
+			if change.Path == f.path && change.OldPath != "" {
+				f.path = change.OldPath
+				break
+			}
+		}
+	}
+	return true, nil
+}
 
-		// Move to parent commit
-		if len(commit.Parents) > 0 {
-			commitHash = commit.Parents[0]
+// printLog prints the shown commits, drawing the graph beside them if
+// asked to.
+func printLog(out *bufio.Writer, repo *repository.GitRepository, walk *revWalk, shown []string, visible map[string]bool, opts logOptions) error {
+	// A "format:" string separates commits with newlines rather than
+	// ending each with one, so the final newline is held back
+	pending := false
+	emit := func(line string) {
+		if pending {
+			out.WriteByte('\n')
+		}
+		out.WriteString(line)
+		if opts.format.separator {
+			pending = true
 		} else {
-			commitHash = ""
+			out.WriteByte('\n')
 		}
 	}
+
+	var g *graph
+	if opts.graph {
+		g = &graph{}
+	}
+	memo := make(map[string]string)
+
+	for i, hash := range shown {
+		c, err := walk.commit(hash)
+		if err != nil {
+			return err
+		}
+		var extra []string
+		if opts.showSignature {
+			extra = signatureCheckLines(repo, c)
+		}
+		lines := opts.format.lines(hash, c, extra)
+		diffLines, err := logDiffLines(walk, hash, c, opts)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, diffLines...)
+
+		if g == nil {
+			if i > 0 && opts.format.multiLine() {
+				emit("")
+			}
+			for _, line := range lines {
+				emit(line)
+			}
+			continue
+		}
+
+		parents, err := walk.rewrittenParents(hash, visible, memo)
+		if err != nil {
+			return err
+		}
+		row := g.next(hash, parents, i > 0 && opts.format.multiLine())
+		if i > 0 && opts.format.multiLine() {
+			emit(row.separator)
+		}
+		for _, line := range row.before {
+			emit(line)
+		}
+		for j, line := range lines {
+			prefix := row.padding
+			if j < len(row.lines) {
+				prefix = row.lines[j]
+			}
+			emit(prefix + line)
+		}
+		for j := len(lines); j < len(row.lines); j++ {
+			emit(row.lines[j])
+		}
+	}
+	return nil
+}
+
+// logDiffLines returns the --stat, -p, --name-only or --name-status
+// output for a commit, preceded by the line that separates it from the
+// message. Merges show no diff, except for the combined diff of -c and
+// --cc.
+func logDiffLines(walk *revWalk, hash string, c *objects.Commit, opts logOptions) ([]string, error) {
+	if len(c.Parents) > 1 {
+		return mergeDiffLines(walk, hash, c, opts)
+	}
+	if !opts.stat && !opts.patch && !opts.nameOnly && !opts.nameStatus {
+		return nil, nil
+	}
+
+	newTree, err := walk.tree(hash)
+	if err != nil {
+		return nil, err
+	}
+	parent := ""
+	if len(c.Parents) == 1 {
+		parent = c.Parents[0]
+	}
+	oldTree, err := walk.tree(parent)
+	if err != nil {
+		return nil, err
+	}
+	var changes []fileDiff
+	if opts.follower != nil {
+		name := opts.follower.names[hash]
+		// The followed file is shown the way it was found
+		all, err := diffWithRenames(walk.objStore, oldTree, newTree, opts.follower.renames)
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range all {
+			if change.Path == name {
+				changes = append(changes, change)
+			}
+		}
+	} else {
+		for _, change := range diffEntries(oldTree, newTree) {
+			if len(walk.paths) == 0 || matchPathspec(change.Path, walk.paths) {
+				changes = append(changes, change)
+			}
+		}
+		if changes, err = detectRenames(walk.objStore, oldTree, changes, opts.renames); err != nil {
+			return nil, err
+		}
+	}
+
+	var stat, patch []string
+	switch {
+	case opts.nameOnly:
+		for _, change := range changes {
+			patch = append(patch, change.Path)
+		}
+	case opts.nameStatus:
+		patch = nameStatusLines(changes)
+	}
+	if opts.stat {
+		text, err := formatStat(walk.objStore, changes)
+		if err != nil {
+			return nil, err
+		}
+		stat = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	}
+	if opts.patch && len(changes) > 0 {
+		text, err := formatPatch(walk.objStore, changes)
+		if err != nil {
+			return nil, err
+		}
+		patch = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	}
+
+	// The one-line format puts the diff right after the subject; the others
+	// leave a blank line, or "---" before a stat followed by a patch
+	var lines []string
+	switch {
+	case opts.format.name == "oneline":
+	case opts.stat && opts.patch:
+		lines = append(lines, "---")
+	default:
+		lines = append(lines, "")
+	}
+	lines = append(lines, stat...)
+	if opts.stat && len(patch) > 0 {
+		lines = append(lines, "")
+	}
+	return append(lines, patch...), nil
+}
+
+// mergeDiffLines returns what -c and --cc show for a merge, which is what
+// show prints for it: a combined diff against all of its parents.
+func mergeDiffLines(walk *revWalk, hash string, c *objects.Commit, opts logOptions) ([]string, error) {
+	if opts.combined == "" {
+		return nil, nil
+	}
+	s := &shower{walk: walk, opts: showOptions{
+		stat:       opts.stat,
+		patch:      opts.patch,
+		nameOnly:   opts.nameOnly,
+		nameStatus: opts.nameStatus,
+		combined:   opts.combined,
+		renames:    opts.renames,
+		format:     opts.format,
+	}}
+	lines, err := s.diffLines(hash, c)
+	if err == nil && len(lines) == 0 {
+		// Unlike show, log keeps the separating line of an empty diff
+		lines = []string{""}
+	}
+	return lines, err
+}
+
+// signatureCheckLines returns the result of verifying a signed commit, as
+// log --show-signature prints it. Unsigned commits give no lines.
+func signatureCheckLines(repo *repository.GitRepository, commit *objects.Commit) []string {
+	if _, ok := commit.Signature(); !ok {
+		return nil
+	}
+	result, err := verifyCommit(repo, commit)
+	if err != nil {
+		return []string{fmt.Sprintf("error: %v", err)}
+	}
+	return strings.Split(strings.TrimSuffix(result.Output, "\n"), "\n")
+}
+
+// indentMessage indents every line of a commit message by four spaces, as
+// log and show display it.
+func indentMessage(message string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(message, "\n"), "\n") {
+		b.WriteString("    ")
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return b.String()
 }
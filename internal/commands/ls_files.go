@@ -0,0 +1,211 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"mygit/internal/index"
+	"mygit/internal/objects"
+	"mygit/internal/repository"
+	"mygit/internal/utils"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LsFiles handles the `ls-files` command, which lists files in the index
+// and the working directory:
+//
+//	mygit ls-files [-c] [-s] [-d] [-m] [-o [--exclude-standard] [-i]] [-z] [--full-name] [<path>...]
+//
+// With no option the files in the index (-c) are listed. -s adds the mode,
+// object and stage of each, as "<mode> <object> <stage>\t<path>". Paths are
+// limited to and relative to the current directory.
+func LsFiles(args []string) {
+	cached, stage, deleted, modified, others := false, false, false, false, false
+	excludeStandard, ignored, fullName := false, false, false
+	terminator := byte('\n')
+	var paths []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-c" || arg == "--cached":
+			cached = true
+		case arg == "-s" || arg == "--stage":
+			stage = true
+		case arg == "-d" || arg == "--deleted":
+			deleted = true
+		case arg == "-m" || arg == "--modified":
+			modified = true
+		case arg == "-o" || arg == "--others":
+			others = true
+		case arg == "--exclude-standard":
+			excludeStandard = true
+		case arg == "-i" || arg == "--ignored":
+			ignored = true
+		case arg == "-z":
+			terminator = 0
+		case arg == "--full-name":
+			fullName = true
+		case arg == "--":
+			paths = append(paths, args[i+1:]...)
+			i = len(args)
+		case strings.HasPrefix(arg, "-"):
+			fmt.Printf("fatal: unknown option '%s'\n", arg)
+			os.Exit(128)
+		default:
+			paths = append(paths, arg)
+		}
+	}
+	if ignored && !excludeStandard {
+		fmt.Println("fatal: ls-files -i must be used with --exclude-standard")
+		os.Exit(128)
+	}
+	if !deleted && !modified && !others {
+		cached = true
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(128)
+	}
+
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	idx := index.NewIndex(repo.GitDir)
+	if err := idx.Load(); err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	objStore := objects.NewObjectStore(repo.GitDir)
+
+	prefix := ""
+	if rel, err := filepath.Rel(repo.WorkDir, cwd); err == nil && rel != "." {
+		prefix = filepath.ToSlash(rel)
+	}
+	specs, err := normalizePathspecs(repo, paths)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	if len(specs) == 0 && prefix != "" {
+		specs = []string{prefix}
+	}
+	selected := func(p string) bool {
+		return len(specs) == 0 || matchPathspec(p, specs)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	show := func(p string, entry *index.IndexEntry) {
+		name := p
+		if !fullName && prefix != "" {
+			name = relativeTo(p, prefix)
+		}
+		if stage && entry != nil {
+			fmt.Fprintf(out, "%s %s 0\t", objects.ModeFromPermissions(entry.Permissions), entry.Hash)
+		}
+		out.WriteString(name)
+		out.WriteByte(terminator)
+	}
+
+	if others {
+		files, err := otherFiles(repo, idx, excludeStandard, ignored)
+		if err != nil {
+			out.Flush()
+			fmt.Printf("fatal: %v\n", err)
+			os.Exit(128)
+		}
+		for _, p := range files {
+			if selected(p) {
+				show(p, nil)
+			}
+		}
+	}
+
+	changed := make(map[string]bool)
+	if deleted || modified {
+		list, err := utils.GetUnstagedChanges(repo, idx, objStore)
+		if err != nil {
+			out.Flush()
+			fmt.Printf("fatal: %v\n", err)
+			os.Exit(128)
+		}
+		for _, p := range list {
+			changed[p] = true
+		}
+	}
+
+	entries := idx.GetAll()
+	names := make([]string, 0, len(entries))
+	for p := range entries {
+		if selected(p) {
+			names = append(names, p)
+		}
+	}
+	sort.Strings(names)
+	for _, p := range names {
+		entry := entries[p]
+		if cached {
+			show(p, entry)
+		}
+		if !changed[p] {
+			continue
+		}
+		missing := !utils.PathExists(filepath.Join(repo.WorkDir, p))
+		if deleted && missing {
+			show(p, entry)
+		}
+		if modified {
+			show(p, entry)
+		}
+	}
+}
+
+// otherFiles lists the files in the working directory that are not in the
+// index. With exclude set, ignored files are left out, or with onlyIgnored
+// only they are listed.
+func otherFiles(repo *repository.GitRepository, idx *index.Index, exclude, onlyIgnored bool) ([]string, error) {
+	ignore, err := utils.NewIgnore(repo.WorkDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	err = filepath.WalkDir(repo.WorkDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(repo.WorkDir, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if relPath == "." {
+			return nil
+		}
+		if relPath == repository.GitDir {
+			return filepath.SkipDir
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if _, tracked := idx.Get(relPath); tracked {
+			return nil
+		}
+		if exclude && ignore.IsIgnored(relPath) != onlyIgnored {
+			return nil
+		}
+		files = append(files, relPath)
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
@@ -0,0 +1,248 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// lsTreeOptions holds the options of ls-tree.
+type lsTreeOptions struct {
+	recursive  bool
+	showTrees  bool // -t: show trees even when recursing into them
+	onlyTrees  bool // -d
+	long       bool
+	nameOnly   bool
+	objectOnly bool
+	fullName   bool
+	abbrev     int
+	terminator byte
+	prefix     string // the current directory, relative to the top
+	specs      []string
+}
+
+// LsTree handles the `ls-tree` command, which lists the contents of a tree
+// one entry per line as "<mode> <type> <object>\t<path>":
+//
+//	mygit ls-tree [-r] [-t] [-d] [-l] [-z] [--name-only | --object-only] [--abbrev[=<n>]] [--full-name] [--full-tree] <tree-ish> [<path>...]
+//
+// Like Git, it lists the part of the tree for the current directory, with
+// paths relative to it. A path names an entry, and a path ending in "/"
+// the contents of a directory.
+func LsTree(args []string) {
+	opts := lsTreeOptions{terminator: '\n'}
+	fullTree := false
+	var positional []string
+
+	for _, arg := range args {
+		switch {
+		case arg == "-r":
+			opts.recursive = true
+		case arg == "-t":
+			opts.showTrees = true
+		case arg == "-d":
+			opts.onlyTrees = true
+		case arg == "-l" || arg == "--long":
+			opts.long = true
+		case arg == "-z":
+			opts.terminator = 0
+		case arg == "--name-only" || arg == "--name-status":
+			opts.nameOnly = true
+		case arg == "--object-only":
+			opts.objectOnly = true
+		case arg == "--full-name":
+			opts.fullName = true
+		case arg == "--full-tree":
+			fullTree = true
+		case arg == "--abbrev":
+			opts.abbrev = abbrevLength
+		case strings.HasPrefix(arg, "--abbrev="):
+			n, err := fmt.Sscanf(strings.TrimPrefix(arg, "--abbrev="), "%d", &opts.abbrev)
+			if n != 1 || err != nil || opts.abbrev < 4 || opts.abbrev > 40 {
+				fmt.Printf("fatal: invalid --abbrev value: %s\n", strings.TrimPrefix(arg, "--abbrev="))
+				os.Exit(128)
+			}
+		case strings.HasPrefix(arg, "-"):
+			fmt.Printf("fatal: unknown option '%s'\n", arg)
+			os.Exit(128)
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) == 0 {
+		fmt.Println("usage: mygit ls-tree [<options>] <tree-ish> [<path>...]")
+		os.Exit(129)
+	}
+	if opts.nameOnly && opts.objectOnly {
+		fmt.Println("fatal: --name-only and --object-only cannot be used together")
+		os.Exit(128)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(128)
+	}
+
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+
+	treeHash, err := resolveTreeHash(objStore, refManager, positional[0])
+	if err != nil {
+		fmt.Printf("fatal: Not a valid object name %s\n", positional[0])
+		os.Exit(128)
+	}
+
+	if !fullTree {
+		rel, err := filepath.Rel(repo.WorkDir, cwd)
+		if err == nil && rel != "." {
+			opts.prefix = filepath.ToSlash(rel)
+		}
+	} else {
+		opts.fullName = true
+	}
+	for _, p := range positional[1:] {
+		spec := strings.TrimPrefix(path.Clean(path.Join("/", opts.prefix, p)), "/")
+		if spec == "" || strings.HasSuffix(p, "/") || p == "." || p == ".." {
+			// The contents of a directory rather than the directory
+			spec += "/"
+		}
+		opts.specs = append(opts.specs, strings.TrimPrefix(spec, "/"))
+	}
+	if len(positional) == 1 {
+		// Without paths, the current directory is listed
+		opts.specs = []string{strings.TrimPrefix(opts.prefix+"/", "/")}
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	err = lsTree(out, objStore, treeHash, "", opts)
+	out.Flush()
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+}
+
+// lsTree lists the entries of the tree at dir that the pathspecs select,
+// recursing into subtrees that are selected or lead to selected paths.
+func lsTree(out *bufio.Writer, objStore *objects.ObjectStore, treeHash, dir string, opts lsTreeOptions) error {
+	obj, err := objStore.ReadObject(treeHash)
+	if err != nil {
+		return err
+	}
+	tree, err := objects.ParseTree(obj.Content)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range tree.Entries {
+		p := e.Name
+		if dir != "" {
+			p = dir + "/" + e.Name
+		}
+		selected, leadsTo := lsTreeMatch(p, opts.specs)
+		isTree := e.Type == objects.TreeType
+
+		switch {
+		case selected && isTree:
+			if !opts.recursive || opts.showTrees || opts.onlyTrees {
+				if err := lsTreeEntry(out, objStore, e, p, opts); err != nil {
+					return err
+				}
+			}
+			if opts.recursive {
+				if err := lsTree(out, objStore, e.Hash, p, opts); err != nil {
+					return err
+				}
+			}
+		case selected:
+			if !opts.onlyTrees {
+				if err := lsTreeEntry(out, objStore, e, p, opts); err != nil {
+					return err
+				}
+			}
+		case leadsTo && isTree:
+			if opts.showTrees {
+				if err := lsTreeEntry(out, objStore, e, p, opts); err != nil {
+					return err
+				}
+			}
+			if err := lsTree(out, objStore, e.Hash, p, opts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lsTreeMatch reports whether a path is selected by one of the specs, and
+// whether it is a directory on the way to a selected path.
+func lsTreeMatch(p string, specs []string) (selected, leadsTo bool) {
+	for _, spec := range specs {
+		if spec == "" || spec == p || strings.HasPrefix(p, strings.TrimSuffix(spec, "/")+"/") {
+			selected = true
+		}
+		if strings.HasPrefix(spec, p+"/") {
+			leadsTo = true
+		}
+	}
+	return selected, leadsTo
+}
+
+// lsTreeEntry prints one entry of ls-tree.
+func lsTreeEntry(out *bufio.Writer, objStore *objects.ObjectStore, e objects.TreeEntry, p string, opts lsTreeOptions) error {
+	name := p
+	if !opts.fullName && opts.prefix != "" {
+		name = relativeTo(p, opts.prefix)
+		if e.Type == objects.TreeType && name == "." {
+			name = "./"
+		}
+	}
+	hash := e.Hash
+	if opts.abbrev > 0 {
+		hash = hash[:opts.abbrev]
+	}
+
+	switch {
+	case opts.nameOnly:
+		out.WriteString(name)
+	case opts.objectOnly:
+		out.WriteString(hash)
+	case opts.long:
+		size := "-"
+		if e.Type == objects.BlobType {
+			obj, err := objStore.ReadObject(e.Hash)
+			if err != nil {
+				return err
+			}
+			size = fmt.Sprint(len(obj.Content))
+		}
+		fmt.Fprintf(out, "%06s %s %s %7s\t%s", e.Mode, e.Type, hash, size, name)
+	default:
+		fmt.Fprintf(out, "%06s %s %s\t%s", e.Mode, e.Type, hash, name)
+	}
+	out.WriteByte(opts.terminator)
+	return nil
+}
+
+// relativeTo returns a slash-separated path relative to dir, both being
+// relative to the top of the repository.
+func relativeTo(p, dir string) string {
+	rel, err := filepath.Rel(filepath.FromSlash("/"+dir), filepath.FromSlash("/"+p))
+	if err != nil {
+		return p
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,157 @@
+package commands
+
+import (
+	"fmt"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"os"
+)
+
+// MergeBase handles the `merge-base` command, which finds common
+// ancestors of commits:
+//
+//	mygit merge-base [-a | --all] <commit> <commit>...
+//	mygit merge-base [-a | --all] --octopus <commit>...
+//	mygit merge-base --is-ancestor <commit> <commit>
+//	mygit merge-base --independent <commit>...
+//
+// With more than two commits, the merge base of the first and a
+// hypothetical merge of the others is found. --is-ancestor prints nothing
+// and exits 0 if the first commit is an ancestor of the second, 1 if not.
+func MergeBase(args []string) {
+	all, octopus, isAncestor, independent := false, false, false, false
+	var revs []string
+
+	usage := func() {
+		fmt.Println("usage: mygit merge-base [-a | --all] <commit> <commit>...")
+		fmt.Println("   or: mygit merge-base [-a | --all] --octopus <commit>...")
+		fmt.Println("   or: mygit merge-base --is-ancestor <commit> <commit>")
+		fmt.Println("   or: mygit merge-base --independent <commit>...")
+		os.Exit(129)
+	}
+	for _, arg := range args {
+		switch arg {
+		case "-a", "--all":
+			all = true
+		case "--octopus":
+			octopus = true
+		case "--is-ancestor":
+			isAncestor = true
+		case "--independent":
+			independent = true
+		default:
+			if len(arg) > 1 && arg[0] == '-' {
+				usage()
+			}
+			revs = append(revs, arg)
+		}
+	}
+
+	modes := 0
+	for _, set := range []bool{octopus, isAncestor, independent} {
+		if set {
+			modes++
+		}
+	}
+	if modes > 1 {
+		fmt.Println("fatal: options '--octopus', '--is-ancestor' and '--independent' cannot be used together")
+		os.Exit(128)
+	}
+	if all && (isAncestor || independent) {
+		fmt.Println("fatal: options '--all' and '--is-ancestor' or '--independent' cannot be used together")
+		os.Exit(128)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(128)
+	}
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	walk := newRevWalk(objects.NewObjectStore(repo.GitDir), refs.NewRefManager(repo.GitDir))
+	commits := make([]string, 0, len(revs))
+	for _, rev := range revs {
+		hash, err := walk.peelCommit(rev)
+		if err != nil {
+			fmt.Printf("fatal: Not a valid object name %s\n", rev)
+			os.Exit(128)
+		}
+		commits = append(commits, hash)
+	}
+
+	var result []string
+	switch {
+	case isAncestor:
+		if len(commits) != 2 {
+			fmt.Println("fatal: --is-ancestor takes exactly two commits")
+			os.Exit(128)
+		}
+		ok, err := walk.isAncestor(commits[0], commits[1])
+		if err != nil {
+			fmt.Printf("fatal: %v\n", err)
+			os.Exit(128)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	case independent:
+		if len(commits) == 0 {
+			usage()
+		}
+		result, err = walk.independent(commits)
+	case octopus:
+		if len(commits) == 0 {
+			usage()
+		}
+		result, err = octopusMergeBases(walk, commits, all)
+	default:
+		if len(commits) < 2 {
+			usage()
+		}
+		result, err = walk.mergeBases(commits[0], commits[1:], all)
+	}
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	if len(result) == 0 {
+		os.Exit(1)
+	}
+	for _, hash := range result {
+		fmt.Println(hash)
+	}
+}
+
+// octopusMergeBases returns the common ancestors of all the commits, as
+// needed for a merge of all of them at once.
+func octopusMergeBases(walk *revWalk, commits []string, all bool) ([]string, error) {
+	bases := commits[:1]
+	for _, c := range commits[1:] {
+		var next []string
+		seen := make(map[string]bool)
+		for _, b := range bases {
+			found, err := walk.mergeBases(b, []string{c}, true)
+			if err != nil {
+				return nil, err
+			}
+			for _, hash := range found {
+				if !seen[hash] {
+					seen[hash] = true
+					next = append(next, hash)
+				}
+			}
+		}
+		bases = next
+	}
+	if !all && len(bases) > 1 {
+		bases = bases[:1]
+	}
+	return bases, nil
+}
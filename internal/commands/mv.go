@@ -0,0 +1,173 @@
+package commands
+
+import (
+	"fmt"
+	"mygit/internal/index"
+	"mygit/internal/repository"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Mv handles the `mv` command.
+// It moves or renames a tracked file or directory in the working directory
+// and updates the index to match.
+func Mv(args []string) {
+	force := false
+	skipErrors := false
+	dryRun := false
+	var positional []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-f" || arg == "--force":
+			force = true
+		case arg == "-k":
+			skipErrors = true
+		case arg == "-n" || arg == "--dry-run":
+			dryRun = true
+		case arg == "--":
+			positional = append(positional, args[i+1:]...)
+			i = len(args)
+		case strings.HasPrefix(arg, "-"):
+			fmt.Printf("Error: unknown option '%s'\n", arg)
+			os.Exit(1)
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	if len(positional) < 2 {
+		fmt.Println("Usage: mygit mv [-f] [-k] [-n] <source>... <destination>")
+		os.Exit(1)
+	}
+
+	// Find repository
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	idx := index.NewIndex(repo.GitDir)
+	if err := idx.Load(); err != nil {
+		fmt.Printf("Error loading index: %v\n", err)
+		os.Exit(1)
+	}
+
+	paths, err := normalizePathspecs(repo, positional)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(1)
+	}
+	sources, destination := paths[:len(paths)-1], paths[len(paths)-1]
+
+	// With several sources, or a destination that is a directory, each
+	// source is moved into the destination directory.
+	destInfo, destErr := os.Stat(filepath.Join(repo.WorkDir, destination))
+	intoDir := destErr == nil && destInfo.IsDir()
+	if len(sources) > 1 && !intoDir {
+		fmt.Printf("fatal: destination '%s' is not a directory\n", positional[len(positional)-1])
+		os.Exit(1)
+	}
+
+	for i, source := range sources {
+		target := destination
+		if intoDir {
+			target = path.Join(destination, path.Base(source))
+		}
+
+		if err := movePath(repo, idx, source, target, force, dryRun); err != nil {
+			if skipErrors {
+				continue
+			}
+			fmt.Printf("fatal: %v, source=%s, destination=%s\n", err, positional[i], target)
+			os.Exit(128)
+		}
+	}
+
+	if dryRun {
+		return
+	}
+	if err := idx.Save(); err != nil {
+		fmt.Printf("Error saving index: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// movePath renames source to target in the working directory and moves the
+// index entries of source (a file, or every file under a directory) along.
+func movePath(repo *repository.GitRepository, idx *index.Index, source, target string, force, dryRun bool) error {
+	if source == target || strings.HasPrefix(target, source+"/") {
+		return fmt.Errorf("can not move directory into itself")
+	}
+
+	srcFull := filepath.Join(repo.WorkDir, source)
+	dstFull := filepath.Join(repo.WorkDir, target)
+
+	srcInfo, err := os.Lstat(srcFull)
+	if err != nil {
+		return fmt.Errorf("bad source")
+	}
+
+	// Index entries that move, keyed by their old path
+	moves := make(map[string]string)
+	if srcInfo.IsDir() {
+		for p := range idx.GetAll() {
+			if strings.HasPrefix(p, source+"/") {
+				moves[p] = target + strings.TrimPrefix(p, source)
+			}
+		}
+		if len(moves) == 0 {
+			return fmt.Errorf("source directory is empty")
+		}
+	} else {
+		if _, tracked := idx.Get(source); !tracked {
+			return fmt.Errorf("not under version control")
+		}
+		moves[source] = target
+	}
+
+	if dstInfo, err := os.Lstat(dstFull); err == nil {
+		if srcInfo.IsDir() || dstInfo.IsDir() || !force {
+			return fmt.Errorf("destination exists")
+		}
+	}
+
+	fmt.Printf("Renaming %s to %s\n", source, target)
+	if dryRun {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dstFull), 0755); err != nil {
+		return err
+	}
+	if !srcInfo.IsDir() && force {
+		os.Remove(dstFull)
+		idx.Remove(target)
+	}
+	if err := os.Rename(srcFull, dstFull); err != nil {
+		return fmt.Errorf("renaming failed: %w", err)
+	}
+
+	for oldPath, newPath := range moves {
+		entry, _ := idx.Get(oldPath)
+		idx.Remove(oldPath)
+		moved := *entry
+		moved.Path = newPath
+		if info, err := os.Lstat(filepath.Join(repo.WorkDir, newPath)); err == nil {
+			moved.Size = info.Size()
+			moved.ModTime = info.ModTime()
+		}
+		idx.Set(&moved)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"io"
+	"mygit/internal/config"
+	"mygit/internal/repository"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// getPager returns the pager command to use, looked up the way Git does:
+// $GIT_PAGER, core.pager, $PAGER and finally less. An empty result or
+// "cat" means no pager.
+func getPager(repo *repository.GitRepository) string {
+	if pager, ok := os.LookupEnv("GIT_PAGER"); ok {
+		return pager
+	}
+
+	cfg := config.NewConfig(filepath.Join(repo.GitDir, "config"))
+	if err := cfg.Load(); err == nil {
+		if pager, ok := cfg.Get("core.pager"); ok {
+			return pager
+		}
+	}
+
+	if pager, ok := os.LookupEnv("PAGER"); ok {
+		return pager
+	}
+	return "less"
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// startPager pipes standard output through the user's pager when it is a
+// terminal. It returns the writer to print to and a function to call once
+// everything is written, which waits for the user to quit the pager.
+func startPager(repo *repository.GitRepository) (io.Writer, func()) {
+	pager := getPager(repo)
+	if !isTerminal(os.Stdout) || pager == "" || pager == "cat" {
+		return os.Stdout, func() {}
+	}
+
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	// Like Git, quit right away if everything fits on one screen
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		cmd.Env = append(cmd.Env, "LESS=FRX")
+	}
+	if _, ok := os.LookupEnv("LV"); !ok {
+		cmd.Env = append(cmd.Env, "LV=-c")
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return os.Stdout, func() {}
+	}
+	if err := cmd.Start(); err != nil {
+		return os.Stdout, func() {}
+	}
+	return stdin, func() {
+		stdin.Close()
+		cmd.Wait()
+	}
+}
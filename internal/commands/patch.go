@@ -0,0 +1,442 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mygit/internal/diff"
+	"mygit/internal/index"
+	"mygit/internal/objects"
+	"mygit/internal/repository"
+	"mygit/internal/utils"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// patchSession drives the interactive hunk selection shared by `add -p`,
+// `reset -p` and `restore -p`. Each file is offered as a series of hunks of
+// the diff from an old to a new version. In forward mode the selected hunks
+// are applied to the old version (staging them); in reverse mode they are
+// taken back out of the new version (unstaging or discarding them).
+type patchSession struct {
+	repo    *repository.GitRepository
+	in      *bufio.Reader
+	verb    string // "Stage", "Unstage" or "Discard"
+	reverse bool
+	quit    bool
+}
+
+// fileChange is the difference between two versions of one file.
+type fileChange struct {
+	path      string
+	old, new  []byte
+	oldExists bool
+	newExists bool
+}
+
+// patchResult is the version of a file a patch session settled on.
+type patchResult struct {
+	content []byte
+	exists  bool
+	changed bool // false if nothing was selected
+}
+
+func newPatchSession(repo *repository.GitRepository, verb string, reverse bool) *patchSession {
+	return &patchSession{
+		repo:    repo,
+		in:      bufio.NewReader(os.Stdin),
+		verb:    verb,
+		reverse: reverse,
+	}
+}
+
+// run offers the hunks of one file change and returns the resulting content.
+func (s *patchSession) run(fc fileChange) (patchResult, error) {
+	if s.quit {
+		return patchResult{}, nil
+	}
+
+	fmt.Printf("diff --git a/%s b/%s\n", fc.path, fc.path)
+
+	// Whole-file additions and deletions are a single yes/no question
+	if fc.oldExists != fc.newExists {
+		what := "addition"
+		if !fc.newExists {
+			what = "deletion"
+		}
+		answer, err := s.ask(fmt.Sprintf("%s %s [y,n,q,a,d,?]? ", s.verb, what), "ynqad")
+		if err != nil {
+			return patchResult{}, err
+		}
+		switch answer {
+		case "y", "a":
+			if s.reverse {
+				return patchResult{content: fc.old, exists: fc.oldExists, changed: true}, nil
+			}
+			return patchResult{content: fc.new, exists: fc.newExists, changed: true}, nil
+		case "q":
+			s.quit = true
+		}
+		return patchResult{}, nil
+	}
+
+	if diff.IsBinary(fc.old) || diff.IsBinary(fc.new) {
+		fmt.Printf("Cannot %s binary file %s\n", strings.ToLower(s.verb), fc.path)
+		return patchResult{}, nil
+	}
+
+	oldLines := diff.SplitLines(fc.old)
+	newLines := diff.SplitLines(fc.new)
+	fmt.Printf("--- a/%s\n+++ b/%s\n", fc.path, fc.path)
+
+	queue := diff.Hunks(diff.Lines(oldLines, newLines), diff.DefaultContext)
+	selected := make([]bool, len(queue))
+
+	for i := 0; i < len(queue); i++ {
+		fmt.Print(queue[i].String())
+
+		options := "y,n,q,a,d"
+		allowed := "ynqad?"
+		if len(queue[i].Split()) > 1 {
+			options += ",s"
+			allowed += "s"
+		}
+		options += ",e,?"
+		allowed += "e"
+
+		answer, err := s.ask(fmt.Sprintf("(%d/%d) %s this hunk [%s]? ", i+1, len(queue), s.verb, options), allowed)
+		if err != nil {
+			return patchResult{}, err
+		}
+
+		switch answer {
+		case "y":
+			selected[i] = true
+		case "n":
+		case "a":
+			for j := i; j < len(queue); j++ {
+				selected[j] = true
+			}
+			i = len(queue)
+		case "d":
+			i = len(queue)
+		case "q":
+			s.quit = true
+			i = len(queue)
+		case "s":
+			parts := queue[i].Split()
+			fmt.Printf("Split into %d hunks.\n", len(parts))
+			queue = append(queue[:i], append(parts, queue[i+1:]...)...)
+			selected = append(selected[:i], append(make([]bool, len(parts)), selected[i+1:]...)...)
+			i--
+		case "e":
+			edited, ok, err := s.editHunk(queue[i], oldLines, newLines)
+			if err != nil {
+				return patchResult{}, err
+			}
+			if ok {
+				queue[i] = edited
+				selected[i] = true
+			} else {
+				i--
+			}
+		case "?":
+			s.printHelp()
+			i--
+		}
+	}
+
+	var chosen []diff.Hunk
+	for i, h := range queue {
+		if selected[i] {
+			if s.reverse {
+				h = h.Reverse()
+			}
+			chosen = append(chosen, h)
+		}
+	}
+	if len(chosen) == 0 {
+		return patchResult{}, nil
+	}
+
+	base := oldLines
+	if s.reverse {
+		base = newLines
+	}
+	result, err := diff.Apply(base, chosen)
+	if err != nil {
+		return patchResult{}, err
+	}
+	return patchResult{content: diff.JoinLines(result), exists: true, changed: true}, nil
+}
+
+// ask prints a prompt and reads a one-letter answer out of allowed.
+func (s *patchSession) ask(prompt, allowed string) (string, error) {
+	for {
+		fmt.Print(prompt)
+		line, err := s.in.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+		if err != nil && answer == "" {
+			if err == io.EOF {
+				// Treat end of input like "q"
+				fmt.Println()
+				return "q", nil
+			}
+			return "", err
+		}
+		if answer != "" && strings.Contains(allowed, answer[:1]) {
+			return answer[:1], nil
+		}
+		s.printHelp()
+	}
+}
+
+func (s *patchSession) printHelp() {
+	verb := strings.ToLower(s.verb)
+	fmt.Printf("y - %s this hunk\n", verb)
+	fmt.Printf("n - do not %s this hunk\n", verb)
+	fmt.Printf("q - quit; do not %s this hunk or any of the remaining ones\n", verb)
+	fmt.Printf("a - %s this hunk and all later hunks in the file\n", verb)
+	fmt.Printf("d - do not %s this hunk or any of the later hunks in the file\n", verb)
+	fmt.Println("s - split the current hunk into smaller hunks")
+	fmt.Println("e - manually edit the current hunk")
+	fmt.Println("? - print help")
+}
+
+// editHunk lets the user edit a hunk in their editor. It returns false if
+// the user gave up on an edit that does not apply.
+func (s *patchSession) editHunk(h diff.Hunk, oldLines, newLines []string) (diff.Hunk, bool, error) {
+	editPath := filepath.Join(s.repo.GitDir, "ADD_EDIT.patch")
+	defer os.Remove(editPath)
+
+	var buf bytes.Buffer
+	buf.WriteString("# Manual hunk edit mode -- see bottom for a quick guide.\n")
+	buf.WriteString(h.String())
+	buf.WriteString("# ---\n")
+	if s.reverse {
+		buf.WriteString("# To remove '+' lines, make them ' ' lines (context).\n")
+		buf.WriteString("# To remove '-' lines, delete them.\n")
+	} else {
+		buf.WriteString("# To remove '-' lines, make them ' ' lines (context).\n")
+		buf.WriteString("# To remove '+' lines, delete them.\n")
+	}
+	buf.WriteString("# Lines starting with # will be removed.\n")
+	buf.WriteString("# If the patch applies cleanly, the edited hunk will immediately be\n")
+	fmt.Fprintf(&buf, "# marked for %s.\n", strings.ToLower(s.verb)+"ing")
+	buf.WriteString("# If it does not apply cleanly, you will be given an opportunity to\n")
+	buf.WriteString("# edit again.  If all lines of the hunk are removed, then the edit is\n")
+	buf.WriteString("# aborted and the hunk is left unchanged.\n")
+
+	for {
+		if err := os.WriteFile(editPath, buf.Bytes(), 0644); err != nil {
+			return diff.Hunk{}, false, err
+		}
+		if err := launchEditor(s.repo, editPath); err != nil {
+			return diff.Hunk{}, false, err
+		}
+		text, err := os.ReadFile(editPath)
+		if err != nil {
+			return diff.Hunk{}, false, err
+		}
+
+		edited, err := diff.ParseHunkLines(string(text), h)
+		if err == nil && len(edited.Lines) == 0 {
+			return diff.Hunk{}, false, nil
+		}
+		if err == nil {
+			if s.reverse {
+				_, err = diff.Apply(newLines, []diff.Hunk{edited.Reverse()})
+			} else {
+				_, err = diff.Apply(oldLines, []diff.Hunk{edited})
+			}
+		}
+		if err == nil {
+			return edited, true, nil
+		}
+
+		answer, askErr := s.ask("Your edited hunk does not apply. Edit again (saying \"no\" discards!) [y/n]? ", "yn")
+		if askErr != nil {
+			return diff.Hunk{}, false, askErr
+		}
+		if answer != "y" {
+			return diff.Hunk{}, false, nil
+		}
+		buf.Reset()
+		buf.Write(text)
+	}
+}
+
+// contentFunc reads one version of a file, reporting whether it exists.
+type contentFunc func(path string) ([]byte, bool, error)
+
+// patchPaths runs a patch session over paths, offering each file whose two
+// versions differ, and hands every changed result to apply.
+func patchPaths(s *patchSession, paths []string, oldContent, newContent contentFunc, apply func(path string, res patchResult) error) error {
+	offered := false
+	for _, path := range paths {
+		if s.quit {
+			break
+		}
+		old, oldExists, err := oldContent(path)
+		if err != nil {
+			return err
+		}
+		new, newExists, err := newContent(path)
+		if err != nil {
+			return err
+		}
+		if oldExists == newExists && bytes.Equal(old, new) {
+			continue
+		}
+
+		offered = true
+		res, err := s.run(fileChange{path: path, old: old, new: new, oldExists: oldExists, newExists: newExists})
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if res.changed {
+			if err := apply(path, res); err != nil {
+				return err
+			}
+		}
+	}
+	if !offered {
+		fmt.Println("No changes.")
+	}
+	return nil
+}
+
+// entryContent returns a contentFunc reading the blobs of entries.
+func entryContent(objStore *objects.ObjectStore, entries map[string]*index.IndexEntry) contentFunc {
+	return func(path string) ([]byte, bool, error) {
+		entry, exists := entries[path]
+		if !exists {
+			return nil, false, nil
+		}
+		obj, err := objStore.ReadObject(entry.Hash)
+		if err != nil {
+			return nil, false, err
+		}
+		return obj.Content, true, nil
+	}
+}
+
+// worktreeContent returns a contentFunc reading the working directory.
+func worktreeContent(repo *repository.GitRepository) contentFunc {
+	return func(path string) ([]byte, bool, error) {
+		return readWorkdirFile(repo, path)
+	}
+}
+
+// indexSnapshot copies the entries of idx, so that a session can read the
+// index as it was before any hunk was applied.
+func indexSnapshot(idx *index.Index) map[string]*index.IndexEntry {
+	entries := make(map[string]*index.IndexEntry)
+	for path, entry := range idx.GetAll() {
+		entries[path] = entry
+	}
+	return entries
+}
+
+// matchingPaths returns the sorted paths of all entry sets matching specs.
+func matchingPaths(specs []string, sets ...map[string]*index.IndexEntry) []string {
+	var paths []string
+	for _, set := range sets {
+		for path := range set {
+			if matchPathspec(path, specs) {
+				paths = append(paths, path)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return uniqueStrings(paths)
+}
+
+// addPatch implements `add -p`: it stages selected hunks of the changes
+// between the index and the working directory of tracked files.
+func addPatch(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, specs []string) error {
+	indexEntries := indexSnapshot(idx)
+	paths := matchingPaths(specs, indexEntries)
+	s := newPatchSession(repo, "Stage", false)
+
+	return patchPaths(s, paths, entryContent(objStore, indexEntries), worktreeContent(repo), func(path string, res patchResult) error {
+		if !res.exists {
+			idx.Remove(path)
+			return nil
+		}
+		hash, err := objStore.WriteObject(res.content, objects.BlobType)
+		if err != nil {
+			return err
+		}
+
+		// Only a fully staged file gets the stat information of the working
+		// copy; otherwise it must keep showing up as modified.
+		existing := indexEntries[path]
+		fullPath := filepath.Join(repo.WorkDir, path)
+		if worktree, info, err := utils.ReadWorktreeFile(fullPath); err == nil && bytes.Equal(worktree, res.content) {
+			perm := utils.WorktreePermissions(info, existing, utils.LoadWorktreeOptions(repo))
+			idx.AddWithMode(path, hash, info, perm)
+			return nil
+		}
+		idx.Set(&index.IndexEntry{Path: path, Hash: hash, Size: int64(len(res.content)), Permissions: existing.Permissions})
+		return nil
+	})
+}
+
+// resetPatch implements `reset -p` and `restore -p --staged`: it takes
+// selected hunks of the changes between source and the index back out of
+// the index.
+func resetPatch(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, source map[string]*index.IndexEntry, specs []string) error {
+	indexEntries := indexSnapshot(idx)
+	paths := matchingPaths(specs, source, indexEntries)
+	s := newPatchSession(repo, "Unstage", true)
+
+	return patchPaths(s, paths, entryContent(objStore, source), entryContent(objStore, indexEntries), func(path string, res patchResult) error {
+		if !res.exists {
+			idx.Remove(path)
+			return nil
+		}
+		if entry, exists := source[path]; exists && objStore.HashObject(res.content, objects.BlobType) == entry.Hash {
+			idx.Set(entry)
+			return nil
+		}
+		hash, err := objStore.WriteObject(res.content, objects.BlobType)
+		if err != nil {
+			return err
+		}
+		perm := source[path]
+		if current, exists := indexEntries[path]; exists {
+			perm = current
+		}
+		idx.Set(&index.IndexEntry{Path: path, Hash: hash, Size: int64(len(res.content)), Permissions: perm.Permissions})
+		return nil
+	})
+}
+
+// restoreWorktreePatch implements `restore -p` and `checkout -p`: it
+// discards selected hunks of the changes between source and the working
+// directory.
+func restoreWorktreePatch(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, source map[string]*index.IndexEntry, specs []string) error {
+	paths := matchingPaths(specs, source, idx.GetAll())
+	s := newPatchSession(repo, "Discard", true)
+
+	return patchPaths(s, paths, entryContent(objStore, source), worktreeContent(repo), func(path string, res patchResult) error {
+		if !res.exists {
+			return removeWorkdirFile(repo, path)
+		}
+		if entry, exists := source[path]; exists && objStore.HashObject(res.content, objects.BlobType) == entry.Hash {
+			_, err := checkoutBlob(repo, objStore, path, entry.Hash, entry.Permissions)
+			return err
+		}
+
+		// Partially discarded files keep their current permissions
+		fullPath := filepath.Join(repo.WorkDir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(fullPath, res.content, 0644)
+	})
+}
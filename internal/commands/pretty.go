@@ -0,0 +1,447 @@
+package commands
+
+import (
+	"fmt"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// prettyFormat describes how log prints each commit: one of Git's named
+// formats (oneline, short, medium, full, fuller) or a format string with
+// placeholders.
+type prettyFormat struct {
+	name      string // the named format, or "format" for a format string
+	template  string
+	separator bool   // "format:" strings separate commits rather than end each one
+	abbrev    bool   // abbreviate hashes in the commit header
+	dateMode  string // as given to --date
+	color     bool   // expand %C placeholders to colors
+
+	repo        *repository.GitRepository
+	decorations map[string][]string // nil unless decorating
+}
+
+// abbrevLength is the length hashes are abbreviated to.
+const abbrevLength = 7
+
+// parsePrettyFormat parses the argument of --pretty or --format.
+func parsePrettyFormat(spec string) (prettyFormat, error) {
+	switch spec {
+	case "oneline", "short", "medium", "full", "fuller":
+		return prettyFormat{name: spec}, nil
+	}
+	if rest, ok := strings.CutPrefix(spec, "format:"); ok {
+		return prettyFormat{name: "format", template: rest, separator: true}, nil
+	}
+	if rest, ok := strings.CutPrefix(spec, "tformat:"); ok {
+		return prettyFormat{name: "format", template: rest}, nil
+	}
+	if strings.Contains(spec, "%") {
+		return prettyFormat{name: "format", template: spec}, nil
+	}
+	return prettyFormat{}, fmt.Errorf("invalid --pretty format: %s", spec)
+}
+
+// multiLine reports whether commits are separated by a blank line.
+func (f *prettyFormat) multiLine() bool {
+	return f.name != "oneline" && f.name != "format"
+}
+
+// lines returns the lines printed for a commit. extra lines, such as the
+// result of --show-signature, go right after the commit header.
+func (f *prettyFormat) lines(hash string, c *objects.Commit, extra []string) []string {
+	if f.name == "format" {
+		return strings.Split(f.expand(f.template, hash, c), "\n")
+	}
+
+	header := hash
+	if f.abbrev {
+		header = hash[:abbrevLength]
+	}
+	if decoration := f.decoration(hash); decoration != "" {
+		header += " (" + decoration + ")"
+	}
+	if f.name == "oneline" {
+		return append([]string{header + " " + subject(c.Message)}, extra...)
+	}
+
+	lines := []string{"commit " + header}
+	lines = append(lines, extra...)
+	if len(c.Parents) > 1 {
+		merge := "Merge:"
+		for _, p := range c.Parents {
+			merge += " " + p[:abbrevLength]
+		}
+		lines = append(lines, merge)
+	}
+	switch f.name {
+	case "short":
+		lines = append(lines, "Author: "+c.Author.Identity())
+	case "medium":
+		lines = append(lines,
+			"Author: "+c.Author.Identity(),
+			"Date:   "+formatDate(c.Author.When, f.dateMode))
+	case "full":
+		lines = append(lines,
+			"Author: "+c.Author.Identity(),
+			"Commit: "+c.Committer.Identity())
+	case "fuller":
+		lines = append(lines,
+			"Author:     "+c.Author.Identity(),
+			"AuthorDate: "+formatDate(c.Author.When, f.dateMode),
+			"Commit:     "+c.Committer.Identity(),
+			"CommitDate: "+formatDate(c.Committer.When, f.dateMode))
+	}
+	lines = append(lines, "")
+
+	message := c.Message
+	if f.name == "short" {
+		message, _ = splitMessage(message)
+	}
+	return append(lines, strings.Split(strings.TrimSuffix(indentMessage(message), "\n"), "\n")...)
+}
+
+// expand replaces the placeholders of a format string with details of a
+// commit. Unknown placeholders are left as they are, as Git does.
+func (f *prettyFormat) expand(template, hash string, c *objects.Commit) string {
+	var b strings.Builder
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' || i+1 == len(template) {
+			b.WriteByte(template[i])
+			continue
+		}
+		n, value := f.placeholder(template[i+1:], hash, c)
+		if n == 0 {
+			b.WriteByte('%')
+			continue
+		}
+		b.WriteString(value)
+		i += n
+	}
+	return b.String()
+}
+
+// placeholder expands the placeholder at the start of s (just after the
+// "%"), returning how many bytes it takes up, or 0 if it is not one.
+func (f *prettyFormat) placeholder(s, hash string, c *objects.Commit) (int, string) {
+	switch s[0] {
+	case '%':
+		return 1, "%"
+	case 'n':
+		return 1, "\n"
+	case 'H':
+		return 1, hash
+	case 'h':
+		return 1, hash[:abbrevLength]
+	case 'T':
+		return 1, c.Tree
+	case 't':
+		return 1, c.Tree[:abbrevLength]
+	case 'P':
+		return 1, strings.Join(c.Parents, " ")
+	case 'p':
+		abbrev := make([]string, len(c.Parents))
+		for i, p := range c.Parents {
+			abbrev[i] = p[:abbrevLength]
+		}
+		return 1, strings.Join(abbrev, " ")
+	case 's':
+		return 1, subject(c.Message)
+	case 'b':
+		_, body := splitMessage(c.Message)
+		return 1, body
+	case 'B':
+		return 1, strings.TrimRight(c.Message, "\n") + "\n"
+	case 'd':
+		if decoration := f.decoration(hash); decoration != "" {
+			return 1, " (" + decoration + ")"
+		}
+		return 1, ""
+	case 'D':
+		return 1, f.decoration(hash)
+	case 'a', 'c':
+		if len(s) < 2 {
+			return 0, ""
+		}
+		person := c.Author
+		if s[0] == 'c' {
+			person = c.Committer
+		}
+		if value, ok := f.personField(s[1], person); ok {
+			return 2, value
+		}
+	case 'x':
+		if len(s) >= 3 {
+			if v, err := strconv.ParseUint(s[1:3], 16, 8); err == nil {
+				return 3, string([]byte{byte(v)})
+			}
+		}
+	case 'C':
+		return colorPlaceholder(s, f.color)
+	case 'G':
+		if strings.HasPrefix(s, "G?") {
+			return 2, f.signatureStatus(c)
+		}
+	}
+	return 0, ""
+}
+
+// personField expands the author (%a) and committer (%c) placeholders.
+func (f *prettyFormat) personField(field byte, p objects.Signature) (string, bool) {
+	switch field {
+	case 'n':
+		return p.Name, true
+	case 'e':
+		return p.Email, true
+	case 'd':
+		return formatDate(p.When, f.dateMode), true
+	case 'r':
+		return formatDate(p.When, "relative"), true
+	case 't':
+		return formatDate(p.When, "unix"), true
+	case 'i':
+		return formatDate(p.When, "iso"), true
+	case 'I':
+		return formatDate(p.When, "iso-strict"), true
+	case 's':
+		return formatDate(p.When, "short"), true
+	case 'D':
+		return formatDate(p.When, "rfc"), true
+	}
+	return "", false
+}
+
+// signatureStatus returns the %G? status of a commit: G for a good
+// signature, B for a bad one and N for none.
+func (f *prettyFormat) signatureStatus(c *objects.Commit) string {
+	if _, ok := c.Signature(); !ok {
+		return "N"
+	}
+	result, err := verifyCommit(f.repo, c)
+	if err != nil || !result.Good {
+		return "B"
+	}
+	return "G"
+}
+
+// ansiCodes are the SGR codes of the color names %C() accepts.
+var ansiCodes = map[string]int{
+	"black": 30, "red": 31, "green": 32, "yellow": 33,
+	"blue": 34, "magenta": 35, "cyan": 36, "white": 37,
+	"bold": 1, "dim": 2, "italic": 3, "ul": 4, "blink": 5, "reverse": 7,
+}
+
+// colorPlaceholder expands %Cred, %Cgreen, %Cblue, %Creset and
+// %C(<color>...). Like Git, it only colors output going to a terminal.
+func colorPlaceholder(s string, color bool) (int, string) {
+	n, spec := 0, ""
+	for _, name := range []string{"red", "green", "blue", "reset"} {
+		if strings.HasPrefix(s[1:], name) {
+			n, spec = 1+len(name), name
+		}
+	}
+	if n == 0 {
+		end := strings.IndexByte(s, ')')
+		if !strings.HasPrefix(s, "C(") || end < 0 {
+			return 0, ""
+		}
+		n = end + 1
+		spec = strings.TrimPrefix(strings.TrimPrefix(s[2:end], "auto"), ",")
+	}
+	if !color {
+		return n, ""
+	}
+	return n, ansiColor(spec)
+}
+
+// ansiColor returns the escape sequence for a color description such as
+// "bold red" or "yellow blue"; the second color is the background.
+func ansiColor(spec string) string {
+	var codes []string
+	colors := 0
+	for _, word := range strings.Fields(spec) {
+		if word == "reset" {
+			return "\033[m"
+		}
+		code, ok := ansiCodes[word]
+		if !ok {
+			continue
+		}
+		if code >= 30 {
+			if colors == 1 {
+				code += 10
+			}
+			colors++
+		}
+		codes = append(codes, strconv.Itoa(code))
+	}
+	if len(codes) == 0 {
+		return ""
+	}
+	return "\033[" + strings.Join(codes, ";") + "m"
+}
+
+// decoration returns the refs pointing at a commit, as log --decorate
+// shows them: "HEAD -> main, tag: v1.0, origin/main".
+func (f *prettyFormat) decoration(hash string) string {
+	if f.decorations == nil {
+		return ""
+	}
+	return strings.Join(f.decorations[hash], ", ")
+}
+
+// loadDecorations maps commits to the names of the refs pointing at them.
+// With full set, refs are named in full ("refs/heads/main"). The HEAD
+// comes first, with the branch it is on, then the other refs in reverse
+// order of their full names, as Git lists them.
+func loadDecorations(objStore *objects.ObjectStore, refManager *refs.RefManager, full bool) (map[string][]string, error) {
+	list, err := refManager.ListRefs("refs/")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name > list[j].Name })
+
+	head, _ := refManager.GetHEAD()
+	branch, _ := refManager.GetCurrentBranch()
+	headRef := ""
+	if branch != "" {
+		headRef = "refs/heads/" + branch
+	}
+
+	decorations := make(map[string][]string)
+	if head != "" {
+		label := "HEAD"
+		if headRef != "" {
+			if hash, _ := refManager.GetRef(headRef); hash == head {
+				label += " -> " + refLabel(headRef, full)
+			}
+		}
+		decorations[head] = append(decorations[head], label)
+	}
+	for _, ref := range list {
+		if ref.Name == headRef && ref.Hash == head {
+			continue
+		}
+		hash := ref.Hash
+		if obj, err := peelTag(objStore, hash); err == nil {
+			hash = obj.Hash
+		}
+		label := refLabel(ref.Name, full)
+		if strings.HasPrefix(ref.Name, "refs/tags/") {
+			label = "tag: " + label
+		}
+		decorations[hash] = append(decorations[hash], label)
+	}
+	return decorations, nil
+}
+
+// refLabel shortens a ref name the way decorations show it.
+func refLabel(name string, full bool) string {
+	if full {
+		return name
+	}
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+		if rest, ok := strings.CutPrefix(name, prefix); ok {
+			return rest
+		}
+	}
+	return name
+}
+
+// splitMessage splits a commit message into its subject paragraph and its
+// body. The body ends with a newline unless it is empty.
+func splitMessage(message string) (string, string) {
+	message = strings.TrimLeft(message, "\n")
+	subjectPart, body, _ := strings.Cut(message, "\n\n")
+	body = strings.Trim(body, "\n")
+	if body != "" {
+		body += "\n"
+	}
+	return strings.TrimRight(subjectPart, "\n"), body
+}
+
+// subject returns the subject of a commit message: its first paragraph,
+// joined into one line.
+func subject(message string) string {
+	subjectPart, _ := splitMessage(message)
+	return strings.Join(strings.Fields(strings.ReplaceAll(subjectPart, "\n", " ")), " ")
+}
+
+// formatDate formats a date as --date=<mode> asks: default, local, iso,
+// iso-strict, rfc, short, unix, raw or relative.
+func formatDate(t time.Time, mode string) string {
+	switch mode {
+	case "local":
+		return t.Local().Format("Mon Jan 2 15:04:05 2006")
+	case "iso", "iso8601":
+		return t.Format("2006-01-02 15:04:05 -0700")
+	case "iso-strict", "iso8601-strict":
+		return t.Format("2006-01-02T15:04:05-07:00")
+	case "rfc", "rfc2822":
+		return t.Format("Mon, 2 Jan 2006 15:04:05 -0700")
+	case "short":
+		return t.Format("2006-01-02")
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10)
+	case "raw":
+		return fmt.Sprintf("%d %s", t.Unix(), t.Format("-0700"))
+	case "relative":
+		return relativeDate(t, time.Now())
+	}
+	return t.Format(gitDateFormat)
+}
+
+// validDateModes are the modes --date accepts.
+var validDateModes = map[string]bool{
+	"default": true, "local": true, "iso": true, "iso8601": true,
+	"iso-strict": true, "iso8601-strict": true, "rfc": true, "rfc2822": true,
+	"short": true, "unix": true, "raw": true, "relative": true,
+}
+
+// relativeDate describes how long before now t was, rounding as Git does:
+// "5 minutes ago", "3 weeks ago", "1 year, 2 months ago".
+func relativeDate(t, now time.Time) string {
+	diff := int64(now.Sub(t) / time.Second)
+	if diff < 0 {
+		return "in the future"
+	}
+	if diff < 90 {
+		return fmt.Sprintf("%d %s ago", diff, plural(int(diff), "second", "seconds"))
+	}
+	diff = (diff + 30) / 60
+	if diff < 90 {
+		return fmt.Sprintf("%d %s ago", diff, plural(int(diff), "minute", "minutes"))
+	}
+	diff = (diff + 30) / 60
+	if diff < 36 {
+		return fmt.Sprintf("%d %s ago", diff, plural(int(diff), "hour", "hours"))
+	}
+	diff = (diff + 12) / 24
+	if diff < 14 {
+		return fmt.Sprintf("%d %s ago", diff, plural(int(diff), "day", "days"))
+	}
+	if diff < 70 {
+		weeks := (diff + 3) / 7
+		return fmt.Sprintf("%d %s ago", weeks, plural(int(weeks), "week", "weeks"))
+	}
+	if diff < 365 {
+		months := (diff + 15) / 30
+		return fmt.Sprintf("%d %s ago", months, plural(int(months), "month", "months"))
+	}
+	if diff < 1825 {
+		totalMonths := (diff*12*2 + 365) / (365 * 2)
+		years, months := totalMonths/12, totalMonths%12
+		if months == 0 {
+			return fmt.Sprintf("%d %s ago", years, plural(int(years), "year", "years"))
+		}
+		return fmt.Sprintf("%d %s, %d %s ago", years, plural(int(years), "year", "years"),
+			months, plural(int(months), "month", "months"))
+	}
+	years := (diff + 183) / 365
+	return fmt.Sprintf("%d %s ago", years, plural(int(years), "year", "years"))
+}
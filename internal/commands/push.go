@@ -8,6 +8,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"mygit/internal/hooks"
 	"mygit/internal/objects"
 	"mygit/internal/repository"
 	"net/http"
@@ -42,6 +43,7 @@ type GitPush struct {
 	remote   string
 	branch   string
 	force    bool
+	noVerify bool
 	username string
 	password string
 	timeout  time.Duration
@@ -51,6 +53,7 @@ type GitPush struct {
 // PushOptions contains configuration for push operations
 type PushOptions struct {
 	Force    bool
+	NoVerify bool
 	Username string
 	Password string
 	Timeout  time.Duration
@@ -66,6 +69,7 @@ func Push(args []string) {
 		fmt.Println("\nSupported protocol: HTTPS only")
 		fmt.Println("Options:")
 		fmt.Println("  --force: Force push (non-fast-forward)")
+		fmt.Println("  --no-verify: Do not run the pre-push hook")
 		fmt.Println("  --username=<user>: Username for authentication")
 		fmt.Println("  --password=<pass>: Password for authentication")
 		return
@@ -82,6 +86,8 @@ func Push(args []string) {
 
 		if arg == "--force" {
 			opts.Force = true
+		} else if arg == "--no-verify" {
+			opts.NoVerify = true
 		} else if strings.HasPrefix(arg, "--username=") {
 			opts.Username = strings.TrimPrefix(arg, "--username=")
 		} else if strings.HasPrefix(arg, "--password=") {
@@ -126,6 +132,7 @@ func NewGitPush(repoPath, remote, branch string, opts *PushOptions) *GitPush {
 
 	if opts != nil {
 		gp.force = opts.Force
+		gp.noVerify = opts.NoVerify
 		gp.username = opts.Username
 		gp.password = opts.Password
 		if opts.Timeout > 0 {
@@ -590,6 +597,22 @@ func (gp *GitPush) Push(objStore *objects.ObjectStore) error {
 		fmt.Println("Note: This is a simplified implementation. Fast-forward checking is basic.")
 	}
 
+	// The pre-push hook gets one "<local ref> <local sha> <remote ref> <remote sha>"
+	// line per ref to update, and can stop the push
+	if !gp.noVerify {
+		repo, err := repository.FindRepository(gp.repoPath)
+		if err != nil {
+			return err
+		}
+		refLine := fmt.Sprintf("%s %s %s %s\n", remoteBranchRef, localCommit, remoteBranchRef, remoteCommit)
+		if err := hooks.Run(repo, "pre-push", strings.NewReader(refLine), gp.remote, remoteURL); err != nil {
+			if _, ok := err.(*hooks.Error); ok {
+				return fmt.Errorf("failed to push some refs to '%s': pre-push hook declined", remoteURL)
+			}
+			return err
+		}
+	}
+
 	// Get objects to send
 	remoteCommits := []string{remoteCommit}
 	objectHashes, err := objStore.GetObjectsToSend(localCommit, remoteCommits)
@@ -0,0 +1,210 @@
+package commands
+
+import (
+	"container/heap"
+	"mygit/internal/objects"
+	"sort"
+)
+
+// Flags painted on commits while looking for merge bases, as in Git's
+// paint_down_to_common.
+const (
+	paintOne = 1 << iota
+	paintTwo
+	paintStale
+	paintResult
+)
+
+// reachQueue orders commits by generation number and then by commit time,
+// highest first, so that a commit is always visited before any commit it
+// can reach. It holds the paint flags of the commits and keeps count of
+// the queued commits that are not stale, so that telling whether any are
+// left does not need to scan the queue.
+type reachQueue struct {
+	walk     *revWalk
+	items    []string
+	flags    map[string]int
+	queued   map[string]int // commit -> number of times it is in items
+	nonStale int
+}
+
+func newReachQueue(w *revWalk) *reachQueue {
+	return &reachQueue{walk: w, flags: make(map[string]int), queued: make(map[string]int)}
+}
+
+func (q *reachQueue) Len() int { return len(q.items) }
+
+func (q *reachQueue) Less(i, j int) bool {
+	gi, gj := q.walk.generation(q.items[i]), q.walk.generation(q.items[j])
+	if gi != gj {
+		return gi > gj
+	}
+	return q.walk.commitTime(q.items[i]) > q.walk.commitTime(q.items[j])
+}
+
+func (q *reachQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+func (q *reachQueue) Push(x any) {
+	hash := x.(string)
+	q.items = append(q.items, hash)
+	q.queued[hash]++
+	if q.flags[hash]&paintStale == 0 {
+		q.nonStale++
+	}
+}
+
+func (q *reachQueue) Pop() any {
+	last := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	q.queued[last]--
+	if q.flags[last]&paintStale == 0 {
+		q.nonStale--
+	}
+	return last
+}
+
+// paint adds flags to a commit. Once it becomes stale, its entries still
+// in the queue no longer count as non-stale.
+func (q *reachQueue) paint(hash string, f int) {
+	if f&paintStale != 0 && q.flags[hash]&paintStale == 0 {
+		q.nonStale -= q.queued[hash]
+	}
+	q.flags[hash] |= f
+}
+
+// mergeBases returns the best common ancestors of one and any of twos:
+// the common ancestors that no other common ancestor can reach. They are
+// sorted newest first; without all, only the first is returned.
+func (w *revWalk) mergeBases(one string, twos []string, all bool) ([]string, error) {
+	for _, two := range twos {
+		if two == one {
+			return []string{one}, nil
+		}
+	}
+
+	q := newReachQueue(w)
+	flags := q.flags
+	q.paint(one, paintOne)
+	heap.Push(q, one)
+	for _, two := range twos {
+		if flags[two]&paintTwo == 0 {
+			q.paint(two, paintTwo)
+			heap.Push(q, two)
+		}
+	}
+
+	// Paint down from both sides until only commits below a common
+	// ancestor, which are stale, are left to visit
+	var found []string
+	for q.nonStale > 0 {
+		hash := heap.Pop(q).(string)
+		f := flags[hash] & (paintOne | paintTwo | paintStale)
+		if f == paintOne|paintTwo {
+			if flags[hash]&paintResult == 0 {
+				q.paint(hash, paintResult)
+				found = append(found, hash)
+			}
+			f |= paintStale
+		}
+		parents, err := w.allParents(hash)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range parents {
+			if flags[p]&f == f {
+				continue
+			}
+			q.paint(p, f)
+			heap.Push(q, p)
+		}
+	}
+
+	var bases []string
+	for _, hash := range found {
+		if flags[hash]&paintStale == 0 {
+			bases = append(bases, hash)
+		}
+	}
+	if len(bases) > 1 {
+		var err error
+		if bases, err = w.independent(bases); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(bases, func(i, j int) bool {
+		return w.commitTime(bases[i]) > w.commitTime(bases[j])
+	})
+	if !all && len(bases) > 1 {
+		bases = bases[:1]
+	}
+	return bases, nil
+}
+
+// independent returns the commits that none of the others can reach, in
+// the order given.
+func (w *revWalk) independent(commits []string) ([]string, error) {
+	redundant := make(map[string]bool)
+	for i, c := range commits {
+		var others []string
+		for j, o := range commits {
+			if j != i && o != c && !redundant[o] {
+				others = append(others, o)
+			}
+		}
+		reached, err := w.reachesAny(others, c)
+		if err != nil {
+			return nil, err
+		}
+		if reached {
+			redundant[c] = true
+		}
+	}
+
+	var result []string
+	seen := make(map[string]bool)
+	for _, c := range commits {
+		if !redundant[c] && !seen[c] {
+			seen[c] = true
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+// isAncestor reports whether ancestor can be reached from commit,
+// counting a commit as its own ancestor.
+func (w *revWalk) isAncestor(ancestor, commit string) (bool, error) {
+	if ancestor == commit {
+		return true, nil
+	}
+	return w.reachesAny([]string{commit}, ancestor)
+}
+
+// reachesAny reports whether target is reachable from any of the given
+// commits. With a commit-graph, commits whose generation number is below
+// the target's are not entered, since they cannot reach it.
+func (w *revWalk) reachesAny(from []string, target string) (bool, error) {
+	cutoff := w.generation(target)
+	if cutoff == objects.GenerationInfinity {
+		cutoff = 0
+	}
+	seen := make(map[string]bool)
+	stack := append([]string(nil), from...)
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if hash == target {
+			return true, nil
+		}
+		if seen[hash] || w.generation(hash) < cutoff {
+			continue
+		}
+		seen[hash] = true
+		parents, err := w.allParents(hash)
+		if err != nil {
+			return false, err
+		}
+		stack = append(stack, parents...)
+	}
+	return false, nil
+}
@@ -0,0 +1,1386 @@
+package commands
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"mygit/internal/config"
+	"mygit/internal/diff"
+	"mygit/internal/hooks"
+	"mygit/internal/index"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"mygit/internal/utils"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// rebaseDir is the directory under .mygit where a rebase keeps its state
+// while it is stopped, named as in Git.
+const rebaseDir = "rebase-merge"
+
+// detachedHead is the head-name of a rebase that did not start on a branch.
+const detachedHead = "detached HEAD"
+
+// todoItem is one line of a rebase todo list.
+type todoItem struct {
+	command string // pick, reword, edit, squash, fixup, drop, exec or break
+	hash    string // the commit, for the commands that take one
+	rest    string // the commit's subject, or the shell command of exec
+}
+
+// todoCommands maps the commands of a todo list, and their one-letter
+// abbreviations, to their full names.
+var todoCommands = map[string]string{
+	"pick": "pick", "p": "pick",
+	"reword": "reword", "r": "reword",
+	"edit": "edit", "e": "edit",
+	"squash": "squash", "s": "squash",
+	"fixup": "fixup", "f": "fixup",
+	"exec": "exec", "x": "exec",
+	"break": "break", "b": "break",
+	"drop": "drop", "d": "drop",
+}
+
+// todoHelp is appended to the todo list the user edits.
+const todoHelp = `
+# Commands:
+# p, pick <commit> = use commit
+# r, reword <commit> = use commit, but edit the commit message
+# e, edit <commit> = use commit, but stop for amending
+# s, squash <commit> = use commit, but meld into previous commit
+# f, fixup <commit> = like "squash" but keep only the previous
+#                    commit's log message
+# x, exec <command> = run command (the rest of the line) using shell
+# b, break = stop here (continue rebase later with 'mygit rebase --continue')
+# d, drop <commit> = remove commit
+#
+# These lines can be re-ordered; they are executed from top to bottom.
+#
+# If you remove a line here THAT COMMIT WILL BE LOST.
+#
+# However, if you remove everything, the rebase will be aborted.
+#
+`
+
+func (t todoItem) String() string {
+	switch t.command {
+	case "break":
+		return t.command
+	case "exec":
+		return t.command + " " + t.rest
+	}
+	return strings.TrimSpace(t.command + " " + t.hash + " " + t.rest)
+}
+
+// abbrev formats the line with the commit's hash abbreviated.
+func (t todoItem) abbrev() string {
+	if t.takesCommit() {
+		t.hash = t.hash[:abbrevLength]
+	}
+	return t.String()
+}
+
+// takesCommit reports whether the command replays a commit.
+func (t todoItem) takesCommit() bool {
+	return t.command != "exec" && t.command != "break"
+}
+
+// isFixup reports whether the command melds its commit into the previous one.
+func (t todoItem) isFixup() bool {
+	return t.command == "squash" || t.command == "fixup"
+}
+
+// rebaseOptions holds the options of a rebase being started.
+type rebaseOptions struct {
+	interactive bool
+	onto        string
+	autosquash  bool
+	reapply     bool     // --reapply-cherry-picks
+	force       bool     // replay even commits that could be fast-forwarded
+	noVerify    bool     // skip the pre-rebase hook
+	exec        []string // commands to run after each commit
+}
+
+// Rebase handles the `rebase` command, which replays the commits of the
+// current branch on top of another commit:
+//
+//	mygit rebase [-i] [--onto <newbase>] [--autosquash] [-x <cmd>] [<upstream> [<branch>]]
+//	mygit rebase (--continue | --skip | --abort | --quit | --edit-todo)
+//
+// The commits in <upstream>..<branch> are applied one at a time with a
+// three-way merge, starting from <newbase> (<upstream> by default), and
+// the branch is moved to the result. The rebase stops when a commit does
+// not apply cleanly, or as its todo list says; its state is kept in
+// .mygit/rebase-merge until it is continued or aborted.
+func Rebase(args []string) {
+	opts := rebaseOptions{}
+	action := ""
+	autosquashSet := false
+	var positional []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() string {
+			if i+1 >= len(args) {
+				fmt.Printf("error: option '%s' requires a value\n", strings.TrimLeft(arg, "-"))
+				os.Exit(129)
+			}
+			i++
+			return args[i]
+		}
+
+		switch {
+		case arg == "-i" || arg == "--interactive":
+			opts.interactive = true
+		case arg == "--onto":
+			opts.onto = value()
+		case strings.HasPrefix(arg, "--onto="):
+			opts.onto = strings.TrimPrefix(arg, "--onto=")
+		case arg == "--autosquash":
+			opts.autosquash, autosquashSet = true, true
+		case arg == "--no-autosquash":
+			opts.autosquash, autosquashSet = false, true
+		case arg == "--reapply-cherry-picks":
+			opts.reapply = true
+		case arg == "-f" || arg == "--force-rebase" || arg == "--no-ff":
+			opts.force = true
+		case arg == "--no-verify":
+			opts.noVerify = true
+		case arg == "-x" || arg == "--exec":
+			opts.exec = append(opts.exec, value())
+		case strings.HasPrefix(arg, "--exec="):
+			opts.exec = append(opts.exec, strings.TrimPrefix(arg, "--exec="))
+		case arg == "--continue" || arg == "--skip" || arg == "--abort" || arg == "--quit" || arg == "--edit-todo":
+			action = arg
+		case strings.HasPrefix(arg, "-"):
+			fmt.Printf("error: unknown option '%s'\n", strings.TrimLeft(arg, "-"))
+			os.Exit(129)
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(1)
+	}
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	r := newRebaser(repo)
+	if action != "" {
+		if len(positional) > 0 {
+			fmt.Printf("fatal: %s takes no arguments\n", action)
+			os.Exit(128)
+		}
+		if !utils.PathExists(r.dir) {
+			fmt.Println("fatal: No rebase in progress?")
+			os.Exit(128)
+		}
+		if err := r.load(); err != nil {
+			fmt.Printf("fatal: %v\n", err)
+			os.Exit(128)
+		}
+
+		switch action {
+		case "--continue":
+			err = r.resume()
+		case "--skip":
+			err = r.skip()
+		case "--abort":
+			err = r.abort()
+		case "--quit":
+			err = os.RemoveAll(r.dir)
+		case "--edit-todo":
+			err = r.editTodo()
+		}
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(positional) > 2 {
+		fmt.Println("usage: mygit rebase [-i] [--onto <newbase>] [<upstream> [<branch>]]")
+		os.Exit(129)
+	}
+	if !autosquashSet {
+		opts.autosquash = rebaseConfigBool(repo, "rebase.autoSquash")
+	}
+	if err := r.start(positional, opts); err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// rebaser carries out a rebase. Everything it needs to resume is kept in
+// the state directory, so each mygit rebase command starts from there.
+type rebaser struct {
+	repo       *repository.GitRepository
+	objStore   *objects.ObjectStore
+	refManager *refs.RefManager
+	walk       *revWalk
+	dir        string
+
+	headName string // the branch being rebased, or detachedHead
+	onto     string
+	origHead string
+}
+
+func newRebaser(repo *repository.GitRepository) *rebaser {
+	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+	return &rebaser{
+		repo:       repo,
+		objStore:   objStore,
+		refManager: refManager,
+		walk:       newRevWalk(objStore, refManager),
+		dir:        filepath.Join(repo.GitDir, rebaseDir),
+	}
+}
+
+// rebaseConfigBool reads a boolean setting, false if it is not set.
+func rebaseConfigBool(repo *repository.GitRepository, key string) bool {
+	cfg := config.NewConfig(filepath.Join(repo.GitDir, "config"))
+	if err := cfg.Load(); err != nil {
+		return false
+	}
+	return cfg.GetBool(key, false)
+}
+
+// readState returns the content of a state file without its trailing
+// newline, or "" if it does not exist.
+func (r *rebaser) readState(name string) string {
+	content, err := os.ReadFile(filepath.Join(r.dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(string(content), "\n")
+}
+
+func (r *rebaser) writeState(name, content string) error {
+	return os.WriteFile(filepath.Join(r.dir, name), []byte(content), 0644)
+}
+
+func (r *rebaser) hasState(name string) bool {
+	return utils.PathExists(filepath.Join(r.dir, name))
+}
+
+func (r *rebaser) removeState(names ...string) {
+	for _, name := range names {
+		os.Remove(filepath.Join(r.dir, name))
+	}
+}
+
+// load reads the state of the rebase in progress.
+func (r *rebaser) load() error {
+	r.headName = r.readState("head-name")
+	r.onto = r.readState("onto")
+	r.origHead = r.readState("orig-head")
+	if r.onto == "" || r.origHead == "" {
+		return fmt.Errorf("the rebase state in %s is damaged; use 'mygit rebase --quit' to forget it", r.dir)
+	}
+	return nil
+}
+
+// start begins a new rebase of branch (or HEAD) onto upstream.
+func (r *rebaser) start(positional []string, opts rebaseOptions) error {
+	if utils.PathExists(r.dir) {
+		fmt.Println("fatal: It seems that there is already a rebase-merge directory, and")
+		fmt.Println("I wonder if you are in the middle of another rebase.  If that is the")
+		fmt.Println("case, please try")
+		fmt.Println("\tmygit rebase (--continue | --abort | --skip)")
+		fmt.Println("If that is not the case, please")
+		fmt.Printf("\trm -fr \"%s\"\n", r.dir)
+		fmt.Println("and run me again.  I am stopping in case you still have something")
+		fmt.Println("valuable there.")
+		os.Exit(128)
+	}
+	if len(positional) == 0 {
+		fmt.Println("There is no tracking information for the current branch.")
+		fmt.Println("Please specify which branch you want to rebase against.")
+		fmt.Println()
+		fmt.Println("    mygit rebase <branch>")
+		fmt.Println()
+		os.Exit(1)
+	}
+
+	upstreamName := positional[0]
+	upstream, err := r.walk.peelCommit(upstreamName)
+	if err != nil {
+		fmt.Printf("fatal: invalid upstream '%s'\n", upstreamName)
+		os.Exit(128)
+	}
+	ontoName := upstreamName
+	r.onto = upstream
+	if opts.onto != "" {
+		ontoName = opts.onto
+		if r.onto, err = r.walk.peelCommit(opts.onto); err != nil {
+			fmt.Printf("fatal: Does not point to a valid commit '%s'\n", opts.onto)
+			os.Exit(128)
+		}
+	}
+
+	currentHead, err := r.refManager.GetHEAD()
+	if err != nil || currentHead == "" {
+		return fmt.Errorf("cannot rebase: HEAD does not point to a commit")
+	}
+	if err := r.requireClean(currentHead); err != nil {
+		return err
+	}
+
+	// The branch to rebase: the one named, or the current one
+	r.headName = detachedHead
+	if branch, err := r.refManager.GetCurrentBranch(); err == nil {
+		r.headName = "refs/heads/" + branch
+	}
+	r.origHead = currentHead
+	if len(positional) == 2 {
+		branch := positional[1]
+		if hash, _ := r.refManager.GetRef("refs/heads/" + branch); hash != "" {
+			r.headName, r.origHead = "refs/heads/"+branch, hash
+		} else if r.origHead, err = r.walk.peelCommit(branch); err != nil {
+			fmt.Printf("fatal: no such branch/commit '%s'\n", branch)
+			os.Exit(128)
+		} else {
+			r.headName = detachedHead
+		}
+	}
+
+	if !opts.noVerify {
+		hookArgs := []string{upstreamName}
+		if len(positional) == 2 {
+			hookArgs = append(hookArgs, positional[1])
+		}
+		if err := hooks.Run(r.repo, "pre-rebase", nil, hookArgs...); err != nil {
+			if _, ok := err.(*hooks.Error); !ok {
+				return err
+			}
+			return fmt.Errorf("The pre-rebase hook refused to rebase.")
+		}
+	}
+
+	commits, err := r.commitsToReplay(upstream, opts.reapply)
+	if err != nil {
+		return err
+	}
+
+	// Nothing to do if the branch already sits on top of onto
+	if !opts.interactive && !opts.force && len(opts.exec) == 0 {
+		upToDate, err := r.upToDate(upstream)
+		if err != nil {
+			return err
+		}
+		if upToDate {
+			if err := r.checkoutStart(currentHead, r.origHead, false); err != nil {
+				return err
+			}
+			fmt.Printf("Current branch %s is up to date.\n", r.shortHeadName())
+			return nil
+		}
+	}
+
+	todo := make([]todoItem, 0, len(commits))
+	for _, hash := range commits {
+		c, err := r.walk.commit(hash)
+		if err != nil {
+			return err
+		}
+		todo = append(todo, todoItem{command: "pick", hash: hash, rest: firstLine(c.Message)})
+	}
+	if opts.autosquash {
+		todo = autosquash(todo)
+	}
+	todo = addExecs(todo, opts.exec)
+
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return err
+	}
+	for name, value := range map[string]string{
+		"head-name": r.headName,
+		"onto":      r.onto,
+		"orig-head": r.origHead,
+	} {
+		if err := r.writeState(name, value+"\n"); err != nil {
+			return err
+		}
+	}
+	if opts.interactive {
+		r.writeState("interactive", "")
+	}
+	if opts.force {
+		r.writeState("no-ff", "")
+	}
+	if err := r.writeTodo(todo); err != nil {
+		return err
+	}
+
+	if opts.interactive {
+		header := fmt.Sprintf("\n# Rebase %s..%s onto %s (%d %s)\n", upstream[:abbrevLength], r.origHead[:abbrevLength],
+			r.onto[:abbrevLength], len(todo), plural(len(todo), "command", "commands"))
+		todo, err = r.userEditTodo(todo, header, true)
+		if err != nil {
+			os.RemoveAll(r.dir)
+			return err
+		}
+		if len(todo) == 0 {
+			os.RemoveAll(r.dir)
+			return fmt.Errorf("nothing to do")
+		}
+		if err := r.writeTodo(todo); err != nil {
+			return err
+		}
+	}
+
+	if err := r.refManager.SetRef("ORIG_HEAD", r.origHead); err != nil {
+		return err
+	}
+	if err := r.checkoutStart(currentHead, r.onto, true); err != nil {
+		os.RemoveAll(r.dir)
+		return err
+	}
+	r.refManager.AppendReflog("HEAD", currentHead, r.onto, getAuthor(r.repo), "rebase (start): checkout "+ontoName)
+	return r.run()
+}
+
+// requireClean refuses to rebase over local changes.
+func (r *rebaser) requireClean(head string) error {
+	idx := index.NewIndex(r.repo.GitDir)
+	if err := idx.Load(); err != nil {
+		return err
+	}
+	unstaged, err := utils.GetUnstagedChanges(r.repo, idx, r.objStore)
+	if err != nil {
+		return err
+	}
+	if len(unstaged) > 0 || len(idx.Conflicts()) > 0 {
+		return fmt.Errorf("cannot rebase: You have unstaged changes.\nerror: Please commit or stash them.")
+	}
+	headTree, err := utils.GetTreeEntriesFromCommit(r.objStore, head)
+	if err != nil {
+		return err
+	}
+	if len(diffEntries(headTree, idx.GetAll())) > 0 {
+		return fmt.Errorf("cannot rebase: Your index contains uncommitted changes.\nerror: Please commit or stash them.")
+	}
+	return nil
+}
+
+// commitsToReplay lists the commits of the branch that are not in
+// upstream, oldest first. Merges are left out, and so are commits whose
+// change upstream already has, unless reapply is set.
+func (r *rebaser) commitsToReplay(upstream string, reapply bool) ([]string, error) {
+	tips, err := r.walk.selectRange([]string{"^" + upstream, r.origHead})
+	if err != nil {
+		return nil, err
+	}
+	sorted, err := r.walk.sort(tips, orderTopo)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[string]bool)
+	if !reapply {
+		tips, err := r.walk.selectRange([]string{"^" + r.origHead, upstream})
+		if err != nil {
+			return nil, err
+		}
+		upstreamOnly, err := r.walk.sort(tips, orderTopo)
+		if err != nil {
+			return nil, err
+		}
+		for _, hash := range upstreamOnly {
+			id, err := r.patchID(hash)
+			if err != nil {
+				return nil, err
+			}
+			if id != "" {
+				applied[id] = true
+			}
+		}
+	}
+
+	var commits []string
+	skipped := false
+	for i := len(sorted) - 1; i >= 0; i-- {
+		hash := sorted[i]
+		c, err := r.walk.commit(hash)
+		if err != nil {
+			return nil, err
+		}
+		if len(c.Parents) > 1 {
+			continue
+		}
+		if len(applied) > 0 {
+			id, err := r.patchID(hash)
+			if err != nil {
+				return nil, err
+			}
+			if applied[id] {
+				fmt.Printf("warning: skipped previously applied commit %s\n", hash[:abbrevLength])
+				skipped = true
+				continue
+			}
+		}
+		commits = append(commits, hash)
+	}
+	if skipped {
+		fmt.Println("hint: use --reapply-cherry-picks to include skipped commits")
+	}
+	return commits, nil
+}
+
+// patchID identifies the change a commit makes, independently of where it
+// is applied: two commits with the same patch ID make the same change. It
+// is "" for merges.
+func (r *rebaser) patchID(hash string) (string, error) {
+	c, err := r.walk.commit(hash)
+	if err != nil {
+		return "", err
+	}
+	if len(c.Parents) > 1 {
+		return "", nil
+	}
+	parentTree := make(map[string]*index.IndexEntry)
+	if len(c.Parents) == 1 {
+		if parentTree, err = r.walk.tree(c.Parents[0]); err != nil {
+			return "", err
+		}
+	}
+	tree, err := r.walk.tree(hash)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha1.New()
+	for _, change := range diffEntries(parentTree, tree) {
+		fmt.Fprintf(h, "%s\n", change.Path)
+		oldContent, err := blobContent(r.objStore, change.Old)
+		if err != nil {
+			return "", err
+		}
+		newContent, err := blobContent(r.objStore, change.New)
+		if err != nil {
+			return "", err
+		}
+		if diff.IsBinary(oldContent) || diff.IsBinary(newContent) {
+			fmt.Fprintf(h, "binary %x %x\n", sha1.Sum(oldContent), sha1.Sum(newContent))
+			continue
+		}
+		for _, e := range diff.Lines(diff.SplitLines(oldContent), diff.SplitLines(newContent)) {
+			switch e.Kind {
+			case diff.Insert:
+				fmt.Fprintf(h, "+%s", e.Text)
+			case diff.Delete:
+				fmt.Fprintf(h, "-%s", e.Text)
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// upToDate reports whether the branch already has onto as the base of its
+// commits, so that replaying them would change nothing.
+func (r *rebaser) upToDate(upstream string) (bool, error) {
+	onBranch, err := r.walk.isAncestor(r.onto, r.origHead)
+	if err != nil || !onBranch || upstream == r.onto {
+		return onBranch, err
+	}
+
+	// With --onto, onto must also be where the branch left upstream
+	bases, err := r.walk.mergeBases(upstream, []string{r.origHead}, true)
+	if err != nil {
+		return false, err
+	}
+	return len(bases) == 1 && bases[0] == r.onto, nil
+}
+
+// checkoutStart moves the working directory and index from the commit
+// HEAD is at to target. With detach, HEAD is detached at target;
+// otherwise it is pointed at the branch being rebased.
+func (r *rebaser) checkoutStart(from, target string, detach bool) error {
+	if err := r.switchTo(from, target); err != nil {
+		return err
+	}
+	if detach || r.headName == detachedHead {
+		return r.refManager.SetRef("HEAD", target)
+	}
+	current, _ := r.refManager.GetCurrentBranch()
+	if "refs/heads/"+current != r.headName {
+		r.refManager.AppendReflog("HEAD", from, target, getAuthor(r.repo),
+			fmt.Sprintf("checkout: moving from %s to %s", current, r.shortHeadName()))
+	}
+	return r.refManager.SetHEAD(r.headName)
+}
+
+// switchTo updates the index and working directory from one commit's tree
+// to another's.
+func (r *rebaser) switchTo(from, to string) error {
+	if from == to {
+		return nil
+	}
+	idx := index.NewIndex(r.repo.GitDir)
+	if err := idx.Load(); err != nil {
+		return err
+	}
+	fromTree, err := utils.GetTreeEntriesFromCommit(r.objStore, from)
+	if err != nil {
+		return err
+	}
+	toTree, err := utils.GetTreeEntriesFromCommit(r.objStore, to)
+	if err != nil {
+		return err
+	}
+	if _, err := switchTrees(r.repo, r.objStore, idx, fromTree, toTree, false, ""); err != nil {
+		return err
+	}
+	return idx.Save()
+}
+
+// shortHeadName returns the name of the branch being rebased.
+func (r *rebaser) shortHeadName() string {
+	return strings.TrimPrefix(r.headName, "refs/heads/")
+}
+
+// readTodo reads the remaining todo list.
+func (r *rebaser) readTodo() ([]todoItem, error) {
+	return r.parseTodo(r.readState("git-rebase-todo"), false)
+}
+
+func (r *rebaser) writeTodo(todo []todoItem) error {
+	var b strings.Builder
+	for _, item := range todo {
+		b.WriteString(item.String())
+		b.WriteString("\n")
+	}
+	return r.writeState("git-rebase-todo", b.String())
+}
+
+// parseTodo parses a todo list, resolving the commits it names. With
+// starting set, a squash or fixup must follow a commit in the list, as
+// there is no commit yet to meld it into.
+func (r *rebaser) parseTodo(text string, starting bool) ([]todoItem, error) {
+	var todo []todoItem
+	picked := !starting
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		word, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+		command, ok := todoCommands[word]
+		if !ok {
+			return nil, fmt.Errorf("invalid line %d: %s", i+1, line)
+		}
+
+		item := todoItem{command: command}
+		switch command {
+		case "exec":
+			if rest == "" {
+				return nil, fmt.Errorf("missing command on line %d: %s", i+1, line)
+			}
+			item.rest = rest
+		case "break":
+		default:
+			name, subject, _ := strings.Cut(rest, " ")
+			hash, err := r.walk.peelCommit(name)
+			if err != nil || name == "" {
+				return nil, fmt.Errorf("invalid line %d: %s", i+1, line)
+			}
+			item.hash, item.rest = hash, subject
+			if item.isFixup() && !picked {
+				return nil, fmt.Errorf("cannot '%s' without a previous commit", command)
+			}
+			if command != "drop" {
+				picked = true
+			}
+		}
+		todo = append(todo, item)
+	}
+	return todo, nil
+}
+
+// userEditTodo lets the user edit a todo list, with commits abbreviated,
+// and returns the edited list.
+func (r *rebaser) userEditTodo(todo []todoItem, header string, starting bool) ([]todoItem, error) {
+	var b strings.Builder
+	for _, item := range todo {
+		b.WriteString(item.abbrev())
+		b.WriteString("\n")
+	}
+	b.WriteString(header)
+	b.WriteString(todoHelp)
+
+	path := filepath.Join(r.dir, "git-rebase-todo")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return nil, err
+	}
+	if err := launchEditor(r.repo, path); err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return r.parseTodo(string(content), starting)
+}
+
+// editTodo lets the user edit the rest of the todo list of a stopped
+// rebase.
+func (r *rebaser) editTodo() error {
+	todo, err := r.readTodo()
+	if err != nil {
+		return err
+	}
+	header := "\n# You are editing the todo file of an ongoing interactive rebase.\n# To continue rebase after editing, run:\n#     mygit rebase --continue\n#\n"
+	edited, err := r.userEditTodo(todo, header, false)
+	if err != nil {
+		r.writeTodo(todo)
+		return err
+	}
+	return r.writeTodo(edited)
+}
+
+// autosquash moves the commits whose subjects start with "fixup! " or
+// "squash! " to just after the commit they name, by subject, by the
+// start of its subject or by hash, and makes them fixup or squash it.
+func autosquash(todo []todoItem) []todoItem {
+	followers := make(map[int][]int)
+	moved := make(map[int]int) // the commits moved, and where to
+	for i, item := range todo {
+		command, target := "", item.rest
+		for {
+			if rest, ok := strings.CutPrefix(target, "fixup! "); ok {
+				if command == "" {
+					command = "fixup"
+				}
+				target = rest
+			} else if rest, ok := strings.CutPrefix(target, "squash! "); ok {
+				if command == "" {
+					command = "squash"
+				}
+				target = rest
+			} else {
+				break
+			}
+		}
+		if command == "" {
+			continue
+		}
+
+		found := -1
+		for j := 0; j < i && found < 0; j++ {
+			if todo[j].rest == target {
+				found = j
+			}
+		}
+		for j := 0; j < i && found < 0; j++ {
+			if len(target) >= 4 && strings.HasPrefix(todo[j].hash, target) {
+				found = j
+			}
+		}
+		for j := 0; j < i && found < 0; j++ {
+			if _, ok := moved[j]; !ok && strings.HasPrefix(todo[j].rest, target) {
+				found = j
+			}
+		}
+		if found < 0 {
+			continue
+		}
+		// A fixup of a fixup goes with the commit it fixes
+		if target, ok := moved[found]; ok {
+			found = target
+		}
+		todo[i].command = command
+		followers[found] = append(followers[found], i)
+		moved[i] = found
+	}
+
+	var sorted []todoItem
+	for i, item := range todo {
+		if _, ok := moved[i]; ok {
+			continue
+		}
+		sorted = append(sorted, item)
+		for _, j := range followers[i] {
+			sorted = append(sorted, todo[j])
+		}
+	}
+	return sorted
+}
+
+// addExecs adds the given exec commands after each commit of the todo
+// list, or after the last of a commit and its fixups.
+func addExecs(todo []todoItem, commands []string) []todoItem {
+	if len(commands) == 0 {
+		return todo
+	}
+	var result []todoItem
+	for i, item := range todo {
+		result = append(result, item)
+		if i+1 < len(todo) && todo[i+1].isFixup() {
+			continue
+		}
+		for _, cmd := range commands {
+			result = append(result, todoItem{command: "exec", rest: cmd})
+		}
+	}
+	return result
+}
+
+// run carries out the todo list until it is done or a command stops.
+func (r *rebaser) run() error {
+	for {
+		todo, err := r.readTodo()
+		if err != nil {
+			return err
+		}
+		if len(todo) == 0 {
+			return r.finish()
+		}
+
+		item := todo[0]
+		if err := r.writeTodo(todo[1:]); err != nil {
+			return err
+		}
+		done := r.readState("done")
+		if done != "" {
+			done += "\n"
+		}
+		if err := r.writeState("done", done+item.String()+"\n"); err != nil {
+			return err
+		}
+
+		var next *todoItem
+		if len(todo) > 1 {
+			next = &todo[1]
+		}
+		if err := r.do(item, next); err != nil {
+			return err
+		}
+	}
+}
+
+// do carries out one todo command. Commands that stop the rebase exit.
+func (r *rebaser) do(item todoItem, next *todoItem) error {
+	switch item.command {
+	case "drop":
+		return nil
+	case "break":
+		os.Exit(0)
+	case "exec":
+		fmt.Printf("Executing: %s\n", item.rest)
+		cmd := exec.Command("sh", "-c", item.rest)
+		cmd.Dir = r.repo.WorkDir
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Printf("warning: execution failed: %s\n", item.rest)
+			fmt.Println("You can fix the problem, and then run")
+			fmt.Println()
+			fmt.Println("  mygit rebase --continue")
+			fmt.Println()
+			os.Exit(1)
+		}
+		return nil
+	}
+
+	commit, err := r.walk.commit(item.hash)
+	if err != nil {
+		return err
+	}
+	if len(commit.Parents) > 1 {
+		return fmt.Errorf("commit %s is a merge, which rebase does not replay", item.hash)
+	}
+	head, err := r.refManager.GetHEAD()
+	if err != nil {
+		return err
+	}
+	subject := firstLine(commit.Message)
+
+	// A commit already on top of HEAD needs no replaying
+	if !item.isFixup() && len(commit.Parents) == 1 && commit.Parents[0] == head && !r.hasState("no-ff") {
+		if err := r.switchTo(head, item.hash); err != nil {
+			return err
+		}
+		if err := r.refManager.UpdateHEAD(item.hash, getAuthor(r.repo), "rebase: fast-forward"); err != nil {
+			return err
+		}
+		return r.afterPick(item, item.hash, commit)
+	}
+
+	conflicts, err := r.apply(commit, item.hash, head)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		r.writeState("message", commit.Message)
+		r.writeState("author", commit.Author.String()+"\n")
+		r.writeState("stopped-sha", item.hash+"\n")
+		label := item.hash[:abbrevLength]
+		fmt.Printf("error: could not apply %s... %s\n", label, subject)
+		fmt.Println("hint: Resolve all conflicts manually, mark them as resolved with")
+		fmt.Println("hint: \"mygit add/rm <conflicted_files>\", then run \"mygit rebase --continue\".")
+		fmt.Println("hint: You can instead skip this commit: run \"mygit rebase --skip\".")
+		fmt.Println("hint: To abort and get back to the state before \"mygit rebase\", run \"mygit rebase --abort\".")
+		fmt.Printf("Could not apply %s... %s\n", label, subject)
+		os.Exit(1)
+	}
+
+	if item.isFixup() {
+		return r.commitFixup(item, commit, next)
+	}
+	return r.commitPick(item, commit, commit.Message, "rebase ("+item.command+")")
+}
+
+// apply merges the change a commit makes into HEAD, updating the index and
+// working directory. It returns the paths left with conflicts.
+func (r *rebaser) apply(commit *objects.Commit, hash, head string) ([]string, error) {
+	idx := index.NewIndex(r.repo.GitDir)
+	if err := idx.Load(); err != nil {
+		return nil, err
+	}
+	base := make(map[string]*index.IndexEntry)
+	if len(commit.Parents) == 1 {
+		var err error
+		if base, err = r.walk.tree(commit.Parents[0]); err != nil {
+			return nil, err
+		}
+	}
+	ours, err := utils.GetTreeEntriesFromCommit(r.objStore, head)
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := r.walk.tree(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	label := fmt.Sprintf("%s (%s)", hash[:abbrevLength], firstLine(commit.Message))
+	conflicts, err := mergeTrees(r.repo, r.objStore, idx, base, ours, theirs, "HEAD", label)
+	if err != nil {
+		return nil, err
+	}
+	return conflicts, idx.Save()
+}
+
+// indexTree writes the index as a tree.
+func (r *rebaser) indexTree() (string, error) {
+	idx := index.NewIndex(r.repo.GitDir)
+	if err := idx.Load(); err != nil {
+		return "", err
+	}
+	return r.objStore.BuildTreeFromIndex(idx.GetAll())
+}
+
+// commitPick commits the index as the replayed version of a commit, on
+// top of HEAD. A commit that has become empty is dropped.
+func (r *rebaser) commitPick(item todoItem, commit *objects.Commit, message, reflogAction string) error {
+	tree, err := r.indexTree()
+	if err != nil {
+		return err
+	}
+	head, err := r.refManager.GetHEAD()
+	if err != nil {
+		return err
+	}
+	headCommit, err := readCommit(r.objStore, head)
+	if err != nil {
+		return err
+	}
+	if tree == headCommit.Tree && !r.originallyEmpty(commit) {
+		return nil
+	}
+
+	if item.command == "reword" {
+		if message, err = editMessage(r.repo, message); err != nil {
+			return err
+		}
+	}
+	hash, err := writeCommit(r.repo, r.objStore, tree, []string{head}, commit.Author, message)
+	if err != nil {
+		return err
+	}
+	if err := r.refManager.UpdateHEAD(hash, getAuthor(r.repo), reflogAction+": "+firstLine(message)); err != nil {
+		return err
+	}
+	return r.afterPick(item, hash, commit)
+}
+
+// originallyEmpty reports whether a commit changes nothing from its parent.
+func (r *rebaser) originallyEmpty(commit *objects.Commit) bool {
+	if len(commit.Parents) == 0 {
+		return false
+	}
+	parent, err := readCommit(r.objStore, commit.Parents[0])
+	return err == nil && parent.Tree == commit.Tree
+}
+
+// afterPick records a replayed commit and, for edit, stops the rebase.
+func (r *rebaser) afterPick(item todoItem, hash string, commit *objects.Commit) error {
+	if err := r.recordRewrite(item.hash, hash, ""); err != nil {
+		return err
+	}
+	if item.command != "edit" {
+		return nil
+	}
+
+	r.writeState("amend", hash+"\n")
+	r.writeState("stopped-sha", item.hash+"\n")
+	fmt.Printf("Stopped at %s...  %s\n", item.hash[:abbrevLength], firstLine(commit.Message))
+	fmt.Println("You can amend the commit now, with")
+	fmt.Println()
+	fmt.Println("  mygit commit --amend ")
+	fmt.Println()
+	fmt.Println("Once you are satisfied with your changes, run")
+	fmt.Println()
+	fmt.Println("  mygit rebase --continue")
+	os.Exit(0)
+	return nil
+}
+
+// commitFixup melds the index into the HEAD commit for a squash or fixup.
+// The message combines the messages so far; at the end of a series of
+// fixups that included a squash, the user edits it.
+func (r *rebaser) commitFixup(item todoItem, commit *objects.Commit, next *todoItem) error {
+	head, err := r.refManager.GetHEAD()
+	if err != nil {
+		return err
+	}
+	headCommit, err := readCommit(r.objStore, head)
+	if err != nil {
+		return err
+	}
+	tree, err := r.indexTree()
+	if err != nil {
+		return err
+	}
+
+	// The combined message, with the messages of fixups commented out
+	combined := r.readState("message-squash")
+	count := 2
+	if combined == "" {
+		combined = "# This is a combination of 2 commits.\n# This is the 1st commit message:\n\n" + headCommit.Message
+	} else {
+		first, rest, _ := strings.Cut(combined, "\n")
+		fmt.Sscanf(first, "# This is a combination of %d commits.", &count)
+		count++
+		combined = fmt.Sprintf("# This is a combination of %d commits.\n%s", count, rest)
+	}
+	if item.command == "squash" {
+		combined += fmt.Sprintf("\n# This is the commit message #%d:\n\n%s", count, commit.Message)
+		r.writeState("squashed", "")
+	} else {
+		combined += fmt.Sprintf("\n# The commit message #%d will be skipped:\n\n%s", count, commentLines(commit.Message))
+	}
+	if !strings.HasSuffix(combined, "\n") {
+		combined += "\n"
+	}
+
+	message := cleanupMessage(combined, true)
+	last := next == nil || !next.isFixup()
+	if last && r.hasState("squashed") {
+		if message, err = editMessage(r.repo, combined); err != nil {
+			return err
+		}
+	}
+
+	hash, err := writeCommit(r.repo, r.objStore, tree, headCommit.Parents, headCommit.Author, message)
+	if err != nil {
+		return err
+	}
+	if err := r.refManager.UpdateHEAD(hash, getAuthor(r.repo), fmt.Sprintf("rebase (%s): %s", item.command, firstLine(message))); err != nil {
+		return err
+	}
+	if last {
+		r.removeState("message-squash", "squashed")
+	} else if err := r.writeState("message-squash", combined); err != nil {
+		return err
+	}
+	return r.recordRewrite(item.hash, hash, head)
+}
+
+// commentLines turns each line of a message into a comment.
+func commentLines(message string) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(message, "\n"), "\n") {
+		b.WriteString("# " + line)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// editMessage lets the user edit a commit message and returns it cleaned
+// up. An empty message aborts.
+func editMessage(repo *repository.GitRepository, message string) (string, error) {
+	path := filepath.Join(repo.GitDir, "COMMIT_EDITMSG")
+	text := strings.TrimRight(message, "\n") + "\n\n" +
+		"# Please enter the commit message for your changes. Lines starting\n" +
+		"# with '#' will be ignored, and an empty message aborts the commit.\n"
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		return "", err
+	}
+	if err := launchEditor(repo, path); err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	message = cleanupMessage(string(content), true)
+	if message == "" {
+		return "", fmt.Errorf("Aborting commit due to empty commit message.")
+	}
+	return message, nil
+}
+
+// writeCommit writes a commit with the given author, committed now by the
+// configured user, and signed if commit.gpgSign asks for it.
+func writeCommit(repo *repository.GitRepository, objStore *objects.ObjectStore, tree string, parents []string, author objects.Signature, message string) (string, error) {
+	commit := objects.NewCommit(tree, message, author, parents)
+	commit.Committer = objects.NewSignature(getAuthor(repo), time.Now())
+	if signByDefault(repo, "commit.gpgSign") {
+		if err := signCommit(repo, commit, ""); err != nil {
+			return "", err
+		}
+	}
+	return objStore.WriteObject(commit.Serialize(), objects.CommitType)
+}
+
+// recordRewrite notes that a commit was rewritten, for the post-rewrite
+// hook. When a fixup replaces the commit replaced, earlier entries that
+// pointed at it are updated too.
+func (r *rebaser) recordRewrite(old, new, replaced string) error {
+	var lines []string
+	for _, line := range strings.Split(r.readState("rewritten-list"), "\n") {
+		if line == "" {
+			continue
+		}
+		if from, to, ok := strings.Cut(line, " "); ok && replaced != "" && to == replaced {
+			line = from + " " + new
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, old+" "+new)
+	return r.writeState("rewritten-list", strings.Join(lines, "\n")+"\n")
+}
+
+// resume continues a stopped rebase. The resolution of a conflict is
+// committed first, as are changes staged while stopped for an edit.
+func (r *rebaser) resume() error {
+	idx := index.NewIndex(r.repo.GitDir)
+	if err := idx.Load(); err != nil {
+		return err
+	}
+	if len(idx.Conflicts()) > 0 {
+		return fmt.Errorf("You must edit all merge conflicts and then\nmark them as resolved using mygit add")
+	}
+
+	done := strings.Split(r.readState("done"), "\n")
+	var item todoItem
+	if items, err := r.parseTodo(done[len(done)-1], false); err == nil && len(items) == 1 {
+		item = items[0]
+	}
+	todo, err := r.readTodo()
+	if err != nil {
+		return err
+	}
+	var next *todoItem
+	if len(todo) > 0 {
+		next = &todo[0]
+	}
+
+	switch {
+	case r.hasState("message"):
+		// Stopped by a conflict: commit its resolution
+		commit, err := r.walk.commit(item.hash)
+		if err != nil {
+			return err
+		}
+		if item.isFixup() {
+			err = r.commitFixup(item, commit, next)
+		} else {
+			var message string
+			if message, err = editMessage(r.repo, r.readState("message")); err == nil {
+				item.command = "pick"
+				err = r.commitPick(item, commit, message, "rebase (continue)")
+			}
+		}
+		if err != nil {
+			return err
+		}
+		r.removeState("message", "author", "stopped-sha")
+	case r.hasState("amend"):
+		// Stopped to edit: amend HEAD with what was staged
+		head, err := r.refManager.GetHEAD()
+		if err != nil {
+			return err
+		}
+		headCommit, err := readCommit(r.objStore, head)
+		if err != nil {
+			return err
+		}
+		tree, err := r.indexTree()
+		if err != nil {
+			return err
+		}
+		if tree != headCommit.Tree {
+			hash, err := writeCommit(r.repo, r.objStore, tree, headCommit.Parents, headCommit.Author, headCommit.Message)
+			if err != nil {
+				return err
+			}
+			if err := r.refManager.UpdateHEAD(hash, getAuthor(r.repo), "rebase (continue): "+firstLine(headCommit.Message)); err != nil {
+				return err
+			}
+			if err := r.recordRewrite(item.hash, hash, head); err != nil {
+				return err
+			}
+		}
+		r.removeState("amend", "stopped-sha")
+	}
+
+	head, err := r.refManager.GetHEAD()
+	if err != nil {
+		return err
+	}
+	if err := r.requireClean(head); err != nil {
+		return err
+	}
+	return r.run()
+}
+
+// skip drops the commit the rebase stopped at, with any changes made to
+// the working directory, and continues.
+func (r *rebaser) skip() error {
+	head, err := r.refManager.GetHEAD()
+	if err != nil {
+		return err
+	}
+	headCommit, err := readCommit(r.objStore, head)
+	if err != nil {
+		return err
+	}
+	if _, err := resetToTree(r.repo, r.objStore, headCommit.Tree, true); err != nil {
+		return err
+	}
+	r.removeState("message", "author", "stopped-sha", "amend")
+	return r.run()
+}
+
+// abort returns to the branch and commit the rebase started from.
+func (r *rebaser) abort() error {
+	head, _ := r.refManager.GetHEAD()
+	origCommit, err := readCommit(r.objStore, r.origHead)
+	if err != nil {
+		return err
+	}
+	if _, err := resetToTree(r.repo, r.objStore, origCommit.Tree, true); err != nil {
+		return err
+	}
+	if r.headName == detachedHead {
+		err = r.refManager.SetRef("HEAD", r.origHead)
+	} else {
+		err = r.refManager.SetHEAD(r.headName)
+	}
+	if err != nil {
+		return err
+	}
+	r.refManager.AppendReflog("HEAD", head, r.origHead, getAuthor(r.repo), "rebase (abort): returning to "+r.headName)
+	return os.RemoveAll(r.dir)
+}
+
+// finish points the rebased branch at the result and checks it out again.
+func (r *rebaser) finish() error {
+	head, err := r.refManager.GetHEAD()
+	if err != nil {
+		return err
+	}
+	identity := getAuthor(r.repo)
+
+	if r.headName != detachedHead {
+		if err := r.refManager.SetRef(r.headName, head); err != nil {
+			return err
+		}
+		r.refManager.AppendReflog(r.headName, r.origHead, head, identity,
+			fmt.Sprintf("rebase (finish): %s onto %s", r.headName, r.onto))
+		if err := r.refManager.SetHEAD(r.headName); err != nil {
+			return err
+		}
+		r.refManager.AppendReflog("HEAD", head, head, identity, "rebase (finish): returning to "+r.headName)
+	}
+
+	if rewritten := r.readState("rewritten-list"); rewritten != "" {
+		hooks.Run(r.repo, "post-rewrite", strings.NewReader(rewritten+"\n"), "rebase")
+	}
+	if err := os.RemoveAll(r.dir); err != nil {
+		return err
+	}
+	fmt.Printf("Successfully rebased and updated %s.\n", r.headName)
+	return nil
+}
+
+// rebaseStatusLines describes a rebase in progress for status, or returns
+// nil if there is none.
+func rebaseStatusLines(repo *repository.GitRepository, unmerged bool) []string {
+	r := newRebaser(repo)
+	if !utils.PathExists(r.dir) || r.load() != nil {
+		return nil
+	}
+	onto := r.onto[:abbrevLength]
+
+	var lines []string
+	if r.hasState("interactive") {
+		lines = append(lines, "interactive rebase in progress; onto "+onto)
+		done, _ := r.parseTodo(r.readState("done"), false)
+		if len(done) > 0 {
+			lines = append(lines, fmt.Sprintf("Last %s done (%d %s done):",
+				plural(len(done), "command", "commands"), len(done), plural(len(done), "command", "commands")))
+			for _, item := range done[max(len(done)-2, 0):] {
+				lines = append(lines, "   "+item.abbrev())
+			}
+		}
+		todo, _ := r.readTodo()
+		if len(todo) > 0 {
+			lines = append(lines, fmt.Sprintf("Next %s to do (%d remaining %s):",
+				plural(len(todo), "command", "commands"), len(todo), plural(len(todo), "command", "commands")))
+			for _, item := range todo[:min(len(todo), 2)] {
+				lines = append(lines, "   "+item.abbrev())
+			}
+			lines = append(lines, "  (use \"mygit rebase --edit-todo\" to view and edit)")
+		} else {
+			lines = append(lines, "No commands remaining.")
+		}
+	} else {
+		lines = append(lines, "rebase in progress; onto "+onto)
+	}
+
+	branch := r.shortHeadName()
+	switch {
+	case r.hasState("message") && unmerged:
+		lines = append(lines,
+			fmt.Sprintf("You are currently rebasing branch '%s' on '%s'.", branch, onto),
+			"  (fix conflicts and then run \"mygit rebase --continue\")",
+			"  (use \"mygit rebase --skip\" to skip this patch)",
+			"  (use \"mygit rebase --abort\" to check out the original branch)")
+	case r.hasState("message"):
+		lines = append(lines,
+			fmt.Sprintf("You are currently rebasing branch '%s' on '%s'.", branch, onto),
+			"  (all conflicts fixed: run \"mygit rebase --continue\")")
+	default:
+		lines = append(lines,
+			fmt.Sprintf("You are currently editing a commit while rebasing branch '%s' on '%s'.", branch, onto),
+			"  (use \"mygit commit --amend\" to amend the current commit)",
+			"  (use \"mygit rebase --continue\" once you are satisfied with your changes)")
+	}
+	return lines
+}
@@ -0,0 +1,335 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mygit/internal/config"
+	"mygit/internal/hooks"
+	"mygit/internal/objects"
+	"mygit/internal/pack"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// receiveCapabilities are the protocol capabilities receive-pack offers.
+const receiveCapabilities = "report-status delete-refs side-band-64k ofs-delta agent=mygit/1.0"
+
+// refUpdate is one "<old> <new> <ref>" command sent by a pushing client.
+type refUpdate struct {
+	oldHash string
+	newHash string
+	ref     string
+	status  string // "" while pending or once applied, else the reason it was refused
+}
+
+func (u *refUpdate) isDelete() bool {
+	return u.newHash == refs.ZeroHash
+}
+
+// sidebandWriter wraps everything written to it in side-band packets on
+// the given band (1 for data, 2 for progress messages).
+type sidebandWriter struct {
+	w       io.Writer
+	band    byte
+	maxData int
+}
+
+func (s *sidebandWriter) Write(p []byte) (int, error) {
+	for rest := p; len(rest) > 0; {
+		n := min(len(rest), s.maxData)
+		if _, err := fmt.Fprintf(s.w, "%04x%c", n+5, s.band); err != nil {
+			return 0, err
+		}
+		if _, err := s.w.Write(rest[:n]); err != nil {
+			return 0, err
+		}
+		rest = rest[n:]
+	}
+	if f, ok := s.w.(*bufio.Writer); ok {
+		return len(p), f.Flush()
+	}
+	return len(p), nil
+}
+
+// ReceivePack is the server side of a push. The pushing client runs it
+// (for example with `git push --receive-pack="mygit receive-pack"`) and
+// talks Git's receive-pack protocol to it over standard input and output.
+// It runs the pre-receive, update and post-receive hooks around the ref
+// updates.
+func ReceivePack(args []string) {
+	statelessRPC := false
+	advertiseOnly := false
+	var dir string
+	for _, arg := range args {
+		switch arg {
+		case "--stateless-rpc":
+			statelessRPC = true
+		case "--advertise-refs", "--http-backend-info-refs":
+			advertiseOnly = true
+		default:
+			dir = arg
+		}
+	}
+	if dir == "" {
+		fmt.Fprintln(os.Stderr, "usage: mygit receive-pack <directory>")
+		os.Exit(1)
+	}
+
+	repo := receiveRepository(dir)
+	if repo == nil {
+		fmt.Fprintf(os.Stderr, "fatal: '%s' does not appear to be a mygit repository\n", dir)
+		os.Exit(128)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	refManager := refs.NewRefManager(repo.GitDir)
+	if !statelessRPC || advertiseOnly {
+		if err := advertiseRefs(out, refManager); err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+			os.Exit(1)
+		}
+		out.Flush()
+	}
+	if advertiseOnly {
+		return
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	updates, caps, err := readRefUpdates(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(1)
+	}
+	if len(updates) == 0 {
+		return
+	}
+
+	// With side-band, hook output and the status report are multiplexed
+	// onto standard output; otherwise hook output goes to standard error.
+	sideband := caps["side-band-64k"] || caps["side-band"]
+	var progress io.Writer = os.Stderr
+	var report io.Writer = out
+	if sideband {
+		maxData := 65515
+		if !caps["side-band-64k"] {
+			maxData = 995
+		}
+		progress = &sidebandWriter{w: out, band: 2, maxData: maxData}
+		report = &sidebandWriter{w: out, band: 1, maxData: maxData}
+	}
+
+	objStore := objects.NewObjectStore(repo.GitDir)
+	unpackStatus := "ok"
+	for _, u := range updates {
+		if !u.isDelete() {
+			if _, err := pack.Unpack(in, objStore); err != nil {
+				unpackStatus = err.Error()
+			}
+			break
+		}
+	}
+
+	if unpackStatus != "ok" {
+		for _, u := range updates {
+			u.status = "unpacker error"
+		}
+	} else {
+		applyRefUpdates(repo, objStore, refManager, updates, progress)
+	}
+
+	if caps["report-status"] {
+		var status bytes.Buffer
+		writePktLine(&status, "unpack "+unpackStatus+"\n")
+		for _, u := range updates {
+			if u.status == "" {
+				writePktLine(&status, "ok "+u.ref+"\n")
+			} else {
+				writePktLine(&status, "ng "+u.ref+" "+u.status+"\n")
+			}
+		}
+		writePktLine(&status, "")
+		report.Write(status.Bytes())
+	}
+	if sideband {
+		writePktLine(out, "")
+	}
+}
+
+// receiveRepository opens the repository a push is sent to, given either
+// its working directory or its .mygit directory.
+func receiveRepository(dir string) *repository.GitRepository {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil
+	}
+	if filepath.Base(dir) == repository.GitDir {
+		dir = filepath.Dir(dir)
+	}
+	repo := repository.NewGitRepository(dir)
+	if !repo.Exists() {
+		return nil
+	}
+	return repo
+}
+
+// advertiseRefs sends the refs of the repository, the first one carrying
+// the capabilities, followed by a flush packet.
+func advertiseRefs(w io.Writer, refManager *refs.RefManager) error {
+	list, err := refManager.ListRefs("refs/")
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		// An empty repository still has to send its capabilities
+		list = []refs.Ref{{Name: "capabilities^{}", Hash: refs.ZeroHash}}
+	}
+	for i, ref := range list {
+		line := ref.Hash + " " + ref.Name
+		if i == 0 {
+			line += "\x00" + receiveCapabilities
+		}
+		if err := writePktLine(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return writePktLine(w, "")
+}
+
+// readRefUpdates reads the client's update commands, up to the flush
+// packet, and the capabilities it asked for.
+func readRefUpdates(r *bufio.Reader) ([]*refUpdate, map[string]bool, error) {
+	caps := make(map[string]bool)
+	var updates []*refUpdate
+	for {
+		line, err := readPktLine(r)
+		if err != nil {
+			if err == io.EOF && len(updates) == 0 {
+				return nil, caps, nil
+			}
+			return nil, nil, err
+		}
+		if line == "" {
+			return updates, caps, nil
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if command, capList, found := strings.Cut(line, "\x00"); found {
+			line = command
+			for _, c := range strings.Fields(capList) {
+				caps[c] = true
+			}
+		}
+		if strings.HasPrefix(line, "shallow ") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, nil, fmt.Errorf("protocol error: expected old/new/ref, got '%s'", line)
+		}
+		updates = append(updates, &refUpdate{oldHash: fields[0], newHash: fields[1], ref: fields[2]})
+	}
+}
+
+// applyRefUpdates runs the receive hooks and updates the refs they allow,
+// recording a reason in the status of every update that is refused.
+func applyRefUpdates(repo *repository.GitRepository, objStore *objects.ObjectStore, refManager *refs.RefManager, updates []*refUpdate, progress io.Writer) {
+	// Hooks run by a push are run in the .mygit directory, as Git does
+	hookOpts := hooks.Options{Output: progress, Dir: repo.GitDir}
+
+	hookOpts.Stdin = strings.NewReader(updateLines(updates))
+	if err := hooks.RunWith(repo, "pre-receive", hookOpts); err != nil {
+		for _, u := range updates {
+			u.status = "pre-receive hook declined"
+		}
+		return
+	}
+	hookOpts.Stdin = nil
+
+	cfg := config.NewConfig(filepath.Join(repo.GitDir, "config"))
+	cfg.Load()
+	denyCurrent, _ := cfg.Get("receive.denyCurrentBranch")
+	currentBranch, _ := refManager.GetCurrentBranch()
+	identity := getAuthor(repo)
+
+	var applied []*refUpdate
+	for _, u := range updates {
+		current, err := refManager.GetRef(u.ref)
+		if current == "" {
+			current = refs.ZeroHash
+		}
+
+		switch {
+		case !strings.HasPrefix(u.ref, "refs/") || refs.CheckRefName(strings.TrimPrefix(u.ref, "refs/")) != nil:
+			u.status = "funny refname"
+		case err != nil:
+			u.status = "failed to lock"
+		case u.ref == "refs/heads/"+currentBranch && !allowCurrentBranchUpdate(denyCurrent, u, progress):
+			u.status = "branch is currently checked out"
+		case !u.isDelete() && !objStore.HasObject(u.newHash):
+			u.status = "missing necessary objects"
+		case current != u.oldHash:
+			u.status = "failed to lock"
+		}
+		if u.status != "" {
+			continue
+		}
+
+		if err := hooks.RunWith(repo, "update", hookOpts, u.ref, u.oldHash, u.newHash); err != nil {
+			u.status = "hook declined"
+			continue
+		}
+
+		if u.isDelete() {
+			err = refManager.DeleteRef(u.ref)
+		} else {
+			err = refManager.SetRef(u.ref, u.newHash)
+			if err == nil {
+				refManager.AppendReflog(u.ref, u.oldHash, u.newHash, identity, "push")
+			}
+		}
+		if err != nil {
+			u.status = "failed to update ref"
+			continue
+		}
+		applied = append(applied, u)
+	}
+
+	if len(applied) > 0 {
+		hookOpts.Stdin = strings.NewReader(updateLines(applied))
+		hooks.RunWith(repo, "post-receive", hookOpts)
+	}
+}
+
+// allowCurrentBranchUpdate applies receive.denyCurrentBranch to a push
+// that updates the branch checked out in the receiving repository, which
+// would leave its index and working tree out of step with the branch.
+func allowCurrentBranchUpdate(setting string, u *refUpdate, progress io.Writer) bool {
+	switch strings.ToLower(setting) {
+	case "ignore", "false":
+		return true
+	case "warn":
+		fmt.Fprintf(progress, "warning: updating the current branch %s\n", u.ref)
+		return true
+	}
+	fmt.Fprintf(progress, "error: refusing to update checked out branch: %s\n", u.ref)
+	fmt.Fprintln(progress, "error: set receive.denyCurrentBranch to 'ignore' or 'warn' in the receiving repository to allow it")
+	return false
+}
+
+// updateLines formats updates as the "<old> <new> <ref>" lines the
+// pre-receive and post-receive hooks read.
+func updateLines(updates []*refUpdate) string {
+	var b strings.Builder
+	for _, u := range updates {
+		fmt.Fprintf(&b, "%s %s %s\n", u.oldHash, u.newHash, u.ref)
+	}
+	return b.String()
+}
@@ -0,0 +1,391 @@
+package commands
+
+import (
+	"fmt"
+	"mygit/internal/config"
+	"mygit/internal/diff"
+	"mygit/internal/index"
+	"mygit/internal/objects"
+	"mygit/internal/repository"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// defaultRenameScore is the similarity, in percent, a new file needs
+	// with an old one to be taken as renamed or copied from it.
+	defaultRenameScore = 50
+	// renameLimit bounds the files compared for inexact renames: with more
+	// new files times candidate sources than its square, only exact
+	// renames are found.
+	renameLimit = 1000
+)
+
+// renameOptions says whether and how changes are paired up as renames
+// and copies.
+type renameOptions struct {
+	renames bool
+	copies  bool // copies from modified files as well
+	harder  bool // copies from unmodified files too
+	score   int  // the similarity in percent a pair needs
+	set     bool // given on the command line, so configuration is ignored
+}
+
+// parseRenameOption handles the rename options shared by the commands
+// that show diffs: -M, -C, --find-renames, --find-copies,
+// --find-copies-harder and --no-renames. It reports whether arg was one.
+func parseRenameOption(arg string, opts *renameOptions) (bool, error) {
+	var value string
+	switch {
+	case arg == "--no-renames":
+		*opts = renameOptions{set: true}
+		return true, nil
+	case arg == "--find-copies-harder":
+		opts.copies, opts.harder = true, true
+	case strings.HasPrefix(arg, "-M"):
+		value = arg[2:]
+	case arg == "--find-renames" || strings.HasPrefix(arg, "--find-renames="):
+		value = strings.TrimPrefix(strings.TrimPrefix(arg, "--find-renames"), "=")
+	case strings.HasPrefix(arg, "-C") || arg == "--find-copies" || strings.HasPrefix(arg, "--find-copies="):
+		if strings.HasPrefix(arg, "-C") {
+			value = arg[2:]
+		} else {
+			value = strings.TrimPrefix(strings.TrimPrefix(arg, "--find-copies"), "=")
+		}
+		// A second -C also looks at unmodified files
+		opts.harder = opts.harder || opts.copies
+		opts.copies = true
+	default:
+		return false, nil
+	}
+	opts.renames, opts.set = true, true
+	opts.score = defaultRenameScore
+	if value != "" {
+		score, err := parseRenameScore(value)
+		if err != nil {
+			return true, err
+		}
+		opts.score = score
+	}
+	return true, nil
+}
+
+// parseRenameScore parses a similarity as Git does: "<n>%" is a
+// percentage, and plain digits are a fraction, so "5" and "50%" are the
+// same.
+func parseRenameScore(s string) (int, error) {
+	num, scale := 0, 1
+	dot := false
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == '.' && !dot:
+			dot, scale = true, 1
+		case ch == '%' && i == len(s)-1:
+			if dot {
+				scale *= 100
+			} else {
+				scale = 100
+			}
+		case ch >= '0' && ch <= '9':
+			if scale < 100000 {
+				num, scale = num*10+int(ch-'0'), scale*10
+			}
+		default:
+			return 0, fmt.Errorf("invalid similarity '%s'", s)
+		}
+	}
+	if num >= scale {
+		return 100, nil
+	}
+	return num * 100 / scale, nil
+}
+
+// configRenames returns the rename detection the first of the given
+// configuration keys asks for: "true", "false" or "copies". Renames are
+// found when none is set.
+func configRenames(repo *repository.GitRepository, keys ...string) renameOptions {
+	opts := renameOptions{renames: true, score: defaultRenameScore}
+	cfg := config.NewConfig(filepath.Join(repo.GitDir, "config"))
+	if err := cfg.Load(); err != nil {
+		return opts
+	}
+	for _, key := range keys {
+		value, ok := cfg.Get(key)
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(value) {
+		case "copies", "copy":
+			opts.copies = true
+		default:
+			opts.renames = cfg.GetBool(key, true)
+		}
+		return opts
+	}
+	return opts
+}
+
+// resolve fills in the options from configuration unless they were given
+// on the command line.
+func (o *renameOptions) resolve(repo *repository.GitRepository, keys ...string) {
+	if !o.set {
+		*o = configRenames(repo, keys...)
+	}
+}
+
+// renameSource is a file new files may have been renamed or copied from.
+type renameSource struct {
+	path    string
+	entry   *index.IndexEntry
+	deleted bool
+	used    int // pairs it is the source of
+}
+
+// renamePair pairs a new file, by its index in the changes, with a source.
+type renamePair struct {
+	dst, src int
+	score    int
+}
+
+// detectRenames pairs the added files among changes, the differences from
+// the old entries, with deleted files they were renamed from, or with
+// copies also with modified (and with harder, unmodified) files. Files
+// with the same content are paired first; the rest by the share of their
+// lines they have in common. Each pair replaces the deletion and addition
+// it stands for.
+func detectRenames(objStore *objects.ObjectStore, old map[string]*index.IndexEntry, changes []fileDiff, opts renameOptions) ([]fileDiff, error) {
+	if !opts.renames {
+		return changes, nil
+	}
+
+	var dsts []int
+	var srcs []*renameSource
+	for i, c := range changes {
+		switch {
+		case c.Old == nil && renamable(c.New):
+			dsts = append(dsts, i)
+		case c.New == nil && renamable(c.Old):
+			srcs = append(srcs, &renameSource{path: c.Path, entry: c.Old, deleted: true})
+		case c.Old != nil && c.New != nil && opts.copies && renamable(c.Old):
+			srcs = append(srcs, &renameSource{path: c.Path, entry: c.Old})
+		}
+	}
+	if len(dsts) == 0 || len(srcs) == 0 && !opts.harder {
+		return changes, nil
+	}
+	if opts.harder {
+		for p, entry := range old {
+			if !renamable(entry) {
+				continue
+			}
+			if i := sort.Search(len(changes), func(i int) bool { return changes[i].Path >= p }); i == len(changes) || changes[i].Path != p {
+				srcs = append(srcs, &renameSource{path: p, entry: entry})
+			}
+		}
+		sort.Slice(srcs, func(i, j int) bool { return srcs[i].path < srcs[j].path })
+	}
+
+	// Without copies, a deleted file is the source of one rename at most
+	usable := func(src *renameSource) bool { return opts.copies || src.used == 0 }
+	var pairs []renamePair
+	paired := make(map[int]bool)
+
+	// Exact renames first, preferring a source with the same file name
+	for _, dst := range dsts {
+		newEntry := changes[dst].New
+		best := -1
+		for s, src := range srcs {
+			if src.entry.Hash != newEntry.Hash || !usable(src) || isSymlinkEntry(src.entry) != isSymlinkEntry(newEntry) {
+				continue
+			}
+			if best < 0 || path.Base(src.path) == path.Base(changes[dst].Path) && path.Base(srcs[best].path) != path.Base(changes[dst].Path) {
+				best = s
+			}
+		}
+		if best >= 0 {
+			srcs[best].used++
+			paired[dst] = true
+			pairs = append(pairs, renamePair{dst: dst, src: best, score: 100})
+		}
+	}
+
+	// Then by similarity, best scores first
+	var left []int
+	for _, dst := range dsts {
+		if !paired[dst] {
+			left = append(left, dst)
+		}
+	}
+	if len(left) > 0 && len(left)*len(srcs) <= renameLimit*renameLimit {
+		contents := make(map[string][]string)
+		lines := func(entry *index.IndexEntry) ([]string, bool, error) {
+			if l, ok := contents[entry.Hash]; ok {
+				return l, l != nil, nil
+			}
+			content, err := blobContent(objStore, entry)
+			if err != nil {
+				return nil, false, err
+			}
+			var l []string
+			if len(content) > 0 && !diff.IsBinary(content) {
+				l = diff.SplitLines(content)
+			}
+			contents[entry.Hash] = l
+			return l, l != nil, nil
+		}
+
+		var candidates []renamePair
+		for _, dst := range left {
+			newEntry := changes[dst].New
+			newLines, ok, err := lines(newEntry)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			for s, src := range srcs {
+				if isSymlinkEntry(src.entry) != isSymlinkEntry(newEntry) {
+					continue
+				}
+				oldLines, ok, err := lines(src.entry)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					continue
+				}
+				if score := contentSimilarity(oldLines, newLines, opts.score); score >= opts.score {
+					candidates = append(candidates, renamePair{dst: dst, src: s, score: score})
+				}
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+		for _, c := range candidates {
+			if paired[c.dst] || !usable(srcs[c.src]) {
+				continue
+			}
+			srcs[c.src].used++
+			paired[c.dst] = true
+			pairs = append(pairs, c)
+		}
+	}
+	if len(pairs) == 0 {
+		return changes, nil
+	}
+
+	// A deleted file is renamed to the last of its new files in path
+	// order, and copied to the others
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].dst < pairs[j].dst })
+	renamedTo := make(map[int]int)
+	for _, p := range pairs {
+		if srcs[p.src].deleted {
+			renamedTo[p.src] = p.dst
+		}
+	}
+	gone := make(map[string]bool)
+	for s := range renamedTo {
+		gone[srcs[s].path] = true
+	}
+
+	var result []fileDiff
+	for i, c := range changes {
+		if !paired[i] && !(c.New == nil && gone[c.Path]) {
+			result = append(result, c)
+		}
+	}
+	for _, p := range pairs {
+		src := srcs[p.src]
+		rename, ok := renamedTo[p.src]
+		result = append(result, fileDiff{
+			Path:    changes[p.dst].Path,
+			OldPath: src.path,
+			Old:     src.entry,
+			New:     changes[p.dst].New,
+			Score:   p.score,
+			Copy:    !ok || rename != p.dst,
+		})
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result, nil
+}
+
+// diffWithRenames compares two sets of entries as diffEntries does, then
+// pairs up renames and copies.
+func diffWithRenames(objStore *objects.ObjectStore, old, new map[string]*index.IndexEntry, opts renameOptions) ([]fileDiff, error) {
+	return detectRenames(objStore, old, diffEntries(old, new), opts)
+}
+
+// contentSimilarity returns how alike two files are in percent: the bytes
+// of the lines they have in common out of the size of the larger. It
+// returns 0 without comparing when the sizes alone rule out minScore.
+func contentSimilarity(a, b []string, minScore int) int {
+	sizeA, sizeB := 0, 0
+	for _, line := range a {
+		sizeA += len(line)
+	}
+	for _, line := range b {
+		sizeB += len(line)
+	}
+	larger, smaller := max(sizeA, sizeB), min(sizeA, sizeB)
+	if larger == 0 || smaller*100 < minScore*larger {
+		return 0
+	}
+	common := 0
+	for _, e := range diff.Lines(a, b) {
+		if e.Kind == diff.Equal {
+			common += len(e.Text)
+		}
+	}
+	return common * 100 / larger
+}
+
+// renamable reports whether an entry can take part in a rename: anything
+// but a submodule.
+func renamable(entry *index.IndexEntry) bool {
+	return entry != nil && objects.ModeFromPermissions(entry.Permissions) != objects.ModeGitlink
+}
+
+func isSymlinkEntry(entry *index.IndexEntry) bool {
+	return objects.ModeFromPermissions(entry.Permissions) == objects.ModeSymlink
+}
+
+// renameName shows a rename in a diffstat the way Git does, with the
+// common leading and trailing directories outside braces, as in
+// "src/{old.go => new.go}".
+func renameName(a, b string) string {
+	pfx := 0
+	for i := 0; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
+		if a[i] == '/' {
+			pfx = i + 1
+		}
+	}
+	// The suffix may share the slash that ends the prefix
+	floor := pfx
+	if pfx > 0 {
+		floor--
+	}
+	sfx := 0
+	for i, j := len(a), len(b); i >= floor && j >= floor; i, j = i-1, j-1 {
+		ca, cb := byte(0), byte(0)
+		if i < len(a) {
+			ca = a[i]
+		}
+		if j < len(b) {
+			cb = b[j]
+		}
+		if ca != cb {
+			break
+		}
+		if ca == '/' {
+			sfx = len(a) - i
+		}
+	}
+	if pfx+sfx == 0 {
+		return a + " => " + b
+	}
+	aMid, bMid := max(len(a)-pfx-sfx, 0), max(len(b)-pfx-sfx, 0)
+	return a[:pfx] + "{" + a[pfx:pfx+aMid] + " => " + b[pfx:pfx+bMid] + "}" + a[len(a)-sfx:]
+}
@@ -0,0 +1,327 @@
+package commands
+
+import (
+	"fmt"
+	"mygit/internal/index"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"mygit/internal/utils"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ResetMode selects how much of the repository state `reset` rewrites.
+type ResetMode int
+
+const (
+	ResetSoft  ResetMode = iota // move the branch only
+	ResetMixed                  // move the branch and reset the index
+	ResetHard                   // move the branch and reset the index and working directory
+)
+
+// Reset handles the `reset` command.
+//   - `reset [--soft|--mixed|--hard] [<commit>]` moves the current branch to
+//     <commit> and optionally rewrites the index and working directory.
+//   - `reset [<commit>] [--] <paths>...` copies the entries for <paths> from
+//     <commit> into the index, unstaging any changes to them.
+//
+// The previous position of HEAD is saved in ORIG_HEAD and the reflog, so
+// `mygit reset ORIG_HEAD` or `mygit reset HEAD@{1}` undoes a reset.
+func Reset(args []string) {
+	mode := ResetMixed
+	modeGiven := false
+	patch := false
+	var positional []string
+	var pathspecs []string
+	sawDashDash := false
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--soft":
+			mode, modeGiven = ResetSoft, true
+		case arg == "--mixed":
+			mode, modeGiven = ResetMixed, true
+		case arg == "--hard":
+			mode, modeGiven = ResetHard, true
+		case arg == "-p" || arg == "--patch":
+			patch = true
+		case arg == "--":
+			pathspecs = append(pathspecs, args[i+1:]...)
+			sawDashDash = true
+			i = len(args)
+		case strings.HasPrefix(arg, "-"):
+			fmt.Printf("Error: unknown option '%s'\n", arg)
+			os.Exit(1)
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	// Find repository
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+
+	// Without "--", the first argument is a commit if it resolves to one,
+	// and everything else is a path.
+	rev := "HEAD"
+	if len(positional) > 0 {
+		if sawDashDash {
+			if len(positional) > 1 {
+				fmt.Println("Usage: mygit reset [<commit>] -- <paths>...")
+				os.Exit(1)
+			}
+			rev = positional[0]
+		} else if _, err := resolveRevision(objStore, refManager, positional[0]); err == nil {
+			rev = positional[0]
+			pathspecs = append(positional[1:], pathspecs...)
+		} else if len(positional) == 1 && !utils.PathExists(positional[0]) {
+			fmt.Printf("fatal: ambiguous argument '%s': unknown revision or path not in the working tree.\n", positional[0])
+			os.Exit(1)
+		} else {
+			pathspecs = append(positional, pathspecs...)
+		}
+	}
+
+	if patch {
+		if modeGiven {
+			fmt.Println("fatal: --patch is incompatible with --soft/--mixed/--hard")
+			os.Exit(1)
+		}
+		if len(pathspecs) == 0 {
+			pathspecs = []string{repo.WorkDir}
+		}
+		if err := resetPathsPatch(repo, objStore, refManager, rev, pathspecs); err != nil {
+			fmt.Printf("error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(pathspecs) > 0 {
+		if modeGiven && mode != ResetMixed {
+			fmt.Println("fatal: Cannot do soft or hard reset with paths.")
+			os.Exit(1)
+		}
+		if err := resetPaths(repo, objStore, refManager, rev, pathspecs); err != nil {
+			fmt.Printf("error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	target, err := resolveRevision(objStore, refManager, rev)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(1)
+	}
+	commit, err := readCommit(objStore, target)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := resetHead(repo, objStore, refManager, target, mode, "reset: moving to "+rev); err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if mode == ResetHard {
+		fmt.Printf("HEAD is now at %s %s\n", target[:7], firstLine(commit.Message))
+	}
+}
+
+// resetHead moves HEAD to target, saving the old position in ORIG_HEAD, and
+// then resets the index (mixed) or the index and working directory (hard).
+func resetHead(repo *repository.GitRepository, objStore *objects.ObjectStore, refManager *refs.RefManager, target string, mode ResetMode, reflogMessage string) error {
+	commit, err := readCommit(objStore, target)
+	if err != nil {
+		return err
+	}
+
+	oldHead, _ := refManager.GetHEAD()
+	if oldHead != "" {
+		if err := refManager.SetRef("ORIG_HEAD", oldHead); err != nil {
+			return err
+		}
+	}
+	if err := refManager.UpdateHEAD(target, getAuthor(repo), reflogMessage); err != nil {
+		return fmt.Errorf("failed to update HEAD: %w", err)
+	}
+
+	if mode == ResetSoft {
+		return nil
+	}
+
+	newIndex, err := resetToTree(repo, objStore, commit.Tree, mode == ResetHard)
+	if err != nil {
+		return err
+	}
+	if mode == ResetMixed {
+		printUnstagedAfterReset(repo, objStore, newIndex)
+	}
+	return nil
+}
+
+// resetToTree rewrites the index to match a tree and, with hard, the
+// working directory too. It returns the new index.
+func resetToTree(repo *repository.GitRepository, objStore *objects.ObjectStore, treeHash string, hard bool) (*index.Index, error) {
+	idx := index.NewIndex(repo.GitDir)
+	if err := idx.Load(); err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	targetEntries, err := utils.GetTreeEntriesRecursive(objStore, treeHash, "")
+	if err != nil {
+		return nil, err
+	}
+
+	newIndex := index.NewIndex(repo.GitDir)
+	if hard {
+		// Remove tracked and unmerged files that do not exist in the target
+		remove := func(path string) error {
+			if _, exists := targetEntries[path]; exists {
+				return nil
+			}
+			return removeWorkdirFile(repo, path)
+		}
+		for path := range idx.GetAll() {
+			if err := remove(path); err != nil {
+				return nil, err
+			}
+		}
+		for path := range idx.Conflicts() {
+			if err := remove(path); err != nil {
+				return nil, err
+			}
+		}
+		if err := updateWorkspaceFromTree(repo, objStore, newIndex, treeHash, "", nil); err != nil {
+			return nil, err
+		}
+	} else {
+		for path, entry := range targetEntries {
+			// Keep the stat information of entries that do not change
+			if current, exists := idx.Get(path); exists && current.Hash == entry.Hash {
+				newIndex.Set(current)
+			} else {
+				newIndex.Set(entry)
+			}
+		}
+	}
+
+	if err := newIndex.Save(); err != nil {
+		return nil, fmt.Errorf("failed to save index: %w", err)
+	}
+	return newIndex, nil
+}
+
+// resetPaths copies the entries for the given paths from rev into the index.
+func resetPaths(repo *repository.GitRepository, objStore *objects.ObjectStore, refManager *refs.RefManager, rev string, pathspecs []string) error {
+	specs, err := normalizePathspecs(repo, pathspecs)
+	if err != nil {
+		return err
+	}
+
+	// Resetting paths on an unborn branch simply unstages them
+	targetEntries := make(map[string]*index.IndexEntry)
+	if treeHash, err := resolveTreeHash(objStore, refManager, rev); err == nil {
+		targetEntries, err = utils.GetTreeEntriesRecursive(objStore, treeHash, "")
+		if err != nil {
+			return err
+		}
+	} else if rev != "HEAD" {
+		return err
+	}
+
+	idx := index.NewIndex(repo.GitDir)
+	if err := idx.Load(); err != nil {
+		return fmt.Errorf("failed to load index: %w", err)
+	}
+
+	for path := range idx.GetAll() {
+		if matchPathspec(path, specs) {
+			if _, exists := targetEntries[path]; !exists {
+				idx.Remove(path)
+			}
+		}
+	}
+	for path, entry := range targetEntries {
+		if !matchPathspec(path, specs) {
+			continue
+		}
+		if current, exists := idx.Get(path); !exists || current.Hash != entry.Hash {
+			idx.Set(entry)
+		}
+	}
+
+	if err := idx.Save(); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+
+	printUnstagedAfterReset(repo, objStore, idx)
+	return nil
+}
+
+// resetPathsPatch interactively unstages hunks of the differences between
+// rev and the index for the given paths.
+func resetPathsPatch(repo *repository.GitRepository, objStore *objects.ObjectStore, refManager *refs.RefManager, rev string, pathspecs []string) error {
+	specs, err := normalizePathspecs(repo, pathspecs)
+	if err != nil {
+		return err
+	}
+
+	targetEntries := make(map[string]*index.IndexEntry)
+	if treeHash, err := resolveTreeHash(objStore, refManager, rev); err == nil {
+		targetEntries, err = utils.GetTreeEntriesRecursive(objStore, treeHash, "")
+		if err != nil {
+			return err
+		}
+	} else if rev != "HEAD" {
+		return err
+	}
+
+	idx := index.NewIndex(repo.GitDir)
+	if err := idx.Load(); err != nil {
+		return fmt.Errorf("failed to load index: %w", err)
+	}
+	if err := resetPatch(repo, objStore, idx, targetEntries, specs); err != nil {
+		return err
+	}
+	if err := idx.Save(); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+	return nil
+}
+
+// printUnstagedAfterReset lists the files that differ between the index and
+// the working directory, as Git does after a mixed reset.
+func printUnstagedAfterReset(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index) {
+	changed, err := utils.GetUnstagedChanges(repo, idx, objStore)
+	if err != nil || len(changed) == 0 {
+		return
+	}
+	sort.Strings(changed)
+
+	fmt.Println("Unstaged changes after reset:")
+	for _, path := range changed {
+		status := "M"
+		if !utils.PathExists(filepath.Join(repo.WorkDir, path)) {
+			status = "D"
+		}
+		fmt.Printf("%s\t%s\n", status, path)
+	}
+}
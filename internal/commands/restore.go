@@ -0,0 +1,245 @@
+package commands
+
+import (
+	"fmt"
+	"mygit/internal/index"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"mygit/internal/utils"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RestoreOptions selects where restored content comes from and what it overwrites.
+type RestoreOptions struct {
+	Source   string // revision to restore from; empty means the index (or HEAD for --staged)
+	Staged   bool   // restore the index
+	Worktree bool   // restore the working directory
+	Patch    bool   // interactively pick the hunks to restore
+}
+
+// Restore handles the `restore` command.
+// It restores files in the working directory and/or the index from the
+// index or from any commit.
+func Restore(args []string) {
+	opts := RestoreOptions{}
+	var pathspecs []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--staged" || arg == "-S":
+			opts.Staged = true
+		case arg == "--worktree" || arg == "-W":
+			opts.Worktree = true
+		case arg == "--patch" || arg == "-p":
+			opts.Patch = true
+		case strings.HasPrefix(arg, "--source="):
+			opts.Source = strings.TrimPrefix(arg, "--source=")
+		case arg == "--source" || arg == "-s":
+			if i+1 >= len(args) {
+				fmt.Printf("Error: %s requires a value\n", arg)
+				os.Exit(1)
+			}
+			i++
+			opts.Source = args[i]
+		case arg == "--":
+			pathspecs = append(pathspecs, args[i+1:]...)
+			i = len(args)
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			fmt.Printf("Error: unknown option '%s'\n", arg)
+			os.Exit(1)
+		default:
+			pathspecs = append(pathspecs, arg)
+		}
+	}
+
+	if len(pathspecs) == 0 && opts.Patch {
+		pathspecs = []string{"."}
+	}
+	if len(pathspecs) == 0 {
+		fmt.Println("Usage: mygit restore [--staged] [--worktree] [--source=<rev>] [-p] <pathspec>...")
+		os.Exit(1)
+	}
+
+	// Find repository
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := restorePaths(repo, opts, pathspecs); err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// restorePaths restores the files matching pathspecs according to opts.
+func restorePaths(repo *repository.GitRepository, opts RestoreOptions, pathspecs []string) error {
+	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+	idx := index.NewIndex(repo.GitDir)
+	if err := idx.Load(); err != nil {
+		return fmt.Errorf("failed to load index: %w", err)
+	}
+
+	if !opts.Staged && !opts.Worktree {
+		opts.Worktree = true
+	}
+	if opts.Source == "" && opts.Staged {
+		opts.Source = "HEAD"
+	}
+
+	specs, err := normalizePathspecs(repo, pathspecs)
+	if err != nil {
+		return err
+	}
+
+	// Collect the entries we restore from
+	var sourceTree string
+	var sourceEntries map[string]*index.IndexEntry
+	if opts.Source != "" {
+		sourceTree, err = resolveTreeHash(objStore, refManager, opts.Source)
+		if err != nil {
+			return fmt.Errorf("could not resolve '%s': %w", opts.Source, err)
+		}
+		sourceEntries, err = utils.GetTreeEntriesRecursive(objStore, sourceTree, "")
+		if err != nil {
+			return err
+		}
+	} else {
+		sourceEntries = make(map[string]*index.IndexEntry)
+		for path, entry := range idx.GetAll() {
+			sourceEntries[path] = entry
+		}
+	}
+
+	// Every path known to either side that the pathspecs select
+	matched := make(map[string]bool)
+	for path := range sourceEntries {
+		if matchPathspec(path, specs) {
+			matched[path] = true
+		}
+	}
+	for path := range idx.GetAll() {
+		if matchPathspec(path, specs) {
+			matched[path] = true
+		}
+	}
+	for i, spec := range specs {
+		found := false
+		for path := range matched {
+			if matchPathspec(path, []string{spec}) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("pathspec '%s' did not match any file(s) known to mygit", pathspecs[i])
+		}
+	}
+
+	if opts.Patch {
+		return restorePatch(repo, objStore, idx, opts, sourceEntries, specs)
+	}
+
+	paths := make([]string, 0, len(matched))
+	for path := range matched {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	if opts.Worktree {
+		if sourceTree != "" {
+			var target *index.Index
+			if opts.Staged {
+				target = idx
+			}
+			filter := func(path string) bool { return matched[path] }
+			if err := updateWorkspaceFromTree(repo, objStore, target, sourceTree, "", filter); err != nil {
+				return err
+			}
+		} else {
+			for _, path := range paths {
+				entry := sourceEntries[path]
+				if _, err := checkoutBlob(repo, objStore, path, entry.Hash, entry.Permissions); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Tracked files that do not exist in the source are removed
+		for _, path := range paths {
+			if _, exists := sourceEntries[path]; exists {
+				continue
+			}
+			if err := removeWorkdirFile(repo, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	if opts.Staged {
+		for _, path := range paths {
+			if entry, exists := sourceEntries[path]; exists {
+				if !opts.Worktree {
+					idx.Set(entry)
+				}
+			} else {
+				idx.Remove(path)
+			}
+		}
+		if err := idx.Save(); err != nil {
+			return fmt.Errorf("failed to save index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// restorePatch interactively discards hunks from the index and/or the
+// working directory. With both, the index is handled first.
+func restorePatch(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, opts RestoreOptions, source map[string]*index.IndexEntry, specs []string) error {
+	if opts.Staged {
+		if err := resetPatch(repo, objStore, idx, source, specs); err != nil {
+			return err
+		}
+		if err := idx.Save(); err != nil {
+			return fmt.Errorf("failed to save index: %w", err)
+		}
+	}
+	if opts.Worktree {
+		if err := restoreWorktreePatch(repo, objStore, idx, source, specs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeWorkdirFile deletes a file from the working directory together with
+// any parent directories that become empty.
+func removeWorkdirFile(repo *repository.GitRepository, relPath string) error {
+	fullPath := filepath.Join(repo.WorkDir, relPath)
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	dir := filepath.Dir(fullPath)
+	for dir != repo.WorkDir && strings.HasPrefix(dir, repo.WorkDir) {
+		if err := os.Remove(dir); err != nil {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	return nil
+}
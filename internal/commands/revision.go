@@ -0,0 +1,346 @@
+package commands
+
+import (
+	"fmt"
+	"mygit/internal/index"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// resolveRevision turns a revision expression into an object hash.
+// Supported forms are HEAD, branch and tag names, full ref paths,
+// full or abbreviated hashes, <ref>@{<n>} reflog lookups, the
+// suffixes ~<n>, ^<n> and ^{<type>}, <rev>:<path> for an object in
+// the tree of a revision and :<path> for a file in the index.
+func resolveRevision(objStore *objects.ObjectStore, refManager *refs.RefManager, rev string) (string, error) {
+	if rev == "" {
+		return "", fmt.Errorf("empty revision")
+	}
+	if rev == "@" {
+		rev = "HEAD"
+	}
+
+	// The path after a colon may contain anything, so it is split off first
+	if colon := strings.Index(rev, ":"); colon >= 0 {
+		return resolvePathRevision(objStore, refManager, rev[:colon], rev[colon+1:])
+	}
+
+	// <rev>^{<type>} peels tags (and commits, to their tree) until it
+	// reaches an object of that type; ^{} peels tags only
+	if idx := strings.LastIndex(rev, "^{"); idx > 0 && strings.HasSuffix(rev, "}") {
+		hash, err := resolveRevision(objStore, refManager, rev[:idx])
+		if err != nil {
+			return "", err
+		}
+		return peelRevision(objStore, hash, rev[idx+2:len(rev)-1], rev)
+	}
+
+	// Peel ~ and ^ suffixes off the end, innermost first.
+	if idx := strings.LastIndexAny(rev, "~^"); idx > 0 {
+		base, err := resolveRevision(objStore, refManager, rev[:idx])
+		if err != nil {
+			return "", err
+		}
+
+		op := rev[idx]
+		count := 1
+		if numStr := rev[idx+1:]; numStr != "" {
+			n, err := strconv.Atoi(numStr)
+			if err != nil {
+				return "", fmt.Errorf("invalid revision: %s", rev)
+			}
+			count = n
+		}
+
+		if op == '~' {
+			for i := 0; i < count; i++ {
+				commit, err := readCommit(objStore, base)
+				if err != nil {
+					return "", err
+				}
+				if len(commit.Parents) == 0 {
+					return "", fmt.Errorf("revision %s does not exist", rev)
+				}
+				base = commit.Parents[0]
+			}
+			return base, nil
+		}
+
+		if count == 0 {
+			return base, nil
+		}
+		commit, err := readCommit(objStore, base)
+		if err != nil {
+			return "", err
+		}
+		if count > len(commit.Parents) {
+			return "", fmt.Errorf("revision %s does not exist", rev)
+		}
+		return commit.Parents[count-1], nil
+	}
+
+	// <ref>@{<n>} looks the ref up in its reflog
+	if at := strings.Index(rev, "@{"); at >= 0 && strings.HasSuffix(rev, "}") {
+		return resolveReflogRevision(refManager, rev[:at], rev[at+2:len(rev)-1])
+	}
+
+	_, hash, err := refManager.ResolveRef(rev)
+	if err != nil {
+		return "", err
+	}
+	if hash != "" {
+		return hash, nil
+	}
+	if rev == "HEAD" {
+		return "", fmt.Errorf("HEAD does not point to a commit yet")
+	}
+
+	hash, err = objStore.ResolvePrefix(rev)
+	if err != nil {
+		return "", fmt.Errorf("unknown revision '%s'", rev)
+	}
+	return hash, nil
+}
+
+// resolvePathRevision resolves <rev>:<path> to the object at path in the
+// tree of rev, or :<path> to the blob staged for path in the index. Paths
+// are relative to the top of the repository unless they start with ./ or
+// ../, which makes them relative to the current directory.
+func resolvePathRevision(objStore *objects.ObjectStore, refManager *refs.RefManager, rev, p string) (string, error) {
+	if p == "." || strings.HasPrefix(p, "./") || strings.HasPrefix(p, "../") {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		rel, err := filepath.Rel(filepath.Dir(refManager.GitDir), filepath.Join(cwd, p))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("'%s' is outside repository", p)
+		}
+		p = filepath.ToSlash(rel)
+	}
+	p = strings.Trim(path.Clean("/"+p), "/")
+
+	if rev == "" {
+		idx := index.NewIndex(refManager.GitDir)
+		if err := idx.Load(); err != nil {
+			return "", err
+		}
+		entry, ok := idx.Get(p)
+		if !ok {
+			return "", fmt.Errorf("path '%s' does not exist in the index", p)
+		}
+		return entry.Hash, nil
+	}
+
+	hash, err := resolveTreeHash(objStore, refManager, rev)
+	if err != nil {
+		return "", err
+	}
+	if p == "" {
+		return hash, nil
+	}
+	for _, name := range strings.Split(p, "/") {
+		obj, err := objStore.ReadObject(hash)
+		if err != nil {
+			return "", err
+		}
+		if obj.Type != objects.TreeType {
+			return "", fmt.Errorf("path '%s' does not exist in '%s'", p, rev)
+		}
+		tree, err := objects.ParseTree(obj.Content)
+		if err != nil {
+			return "", err
+		}
+		hash = ""
+		for _, entry := range tree.Entries {
+			if entry.Name == name {
+				hash = entry.Hash
+				break
+			}
+		}
+		if hash == "" {
+			return "", fmt.Errorf("path '%s' does not exist in '%s'", p, rev)
+		}
+	}
+	return hash, nil
+}
+
+// peelRevision peels an object to the given type for <rev>^{<type>}. An
+// empty type peels annotated tags to the object they point at.
+func peelRevision(objStore *objects.ObjectStore, hash, typ, rev string) (string, error) {
+	obj, err := peelTag(objStore, hash)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case typ == "" || typ == "object":
+		return obj.Hash, nil
+	case typ == string(objects.TagType):
+		tagObj, err := objStore.ReadObject(hash)
+		if err != nil {
+			return "", err
+		}
+		if tagObj.Type == objects.TagType {
+			return hash, nil
+		}
+	case typ == string(obj.Type):
+		return obj.Hash, nil
+	case typ == string(objects.TreeType) && obj.Type == objects.CommitType:
+		commit, err := objects.ParseCommit(obj.Content)
+		if err != nil {
+			return "", err
+		}
+		return commit.Tree, nil
+	case typ != string(objects.CommitType) && typ != string(objects.TreeType) && typ != string(objects.BlobType):
+		return "", fmt.Errorf("invalid object type in '%s'", rev)
+	}
+	return "", fmt.Errorf("'%s' does not name a %s", rev, typ)
+}
+
+// resolveReflogRevision returns the value a ref had n moves ago.
+func resolveReflogRevision(refManager *refs.RefManager, name, nStr string) (string, error) {
+	n, err := strconv.Atoi(nStr)
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("unsupported reflog selector @{%s}", nStr)
+	}
+
+	refPath := "HEAD"
+	if name != "" && name != "HEAD" {
+		refPath, _, err = refManager.ResolveRef(name)
+		if err != nil {
+			return "", err
+		}
+		if refPath == "" {
+			return "", fmt.Errorf("unknown revision '%s'", name)
+		}
+	}
+
+	entries, err := refManager.ReadReflog(refPath)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case n < len(entries):
+		return entries[n].NewHash, nil
+	case n == len(entries) && n > 0 && entries[n-1].OldHash != refs.ZeroHash:
+		return entries[n-1].OldHash, nil
+	default:
+		return "", fmt.Errorf("log for '%s' only has %d entries", refPath, len(entries))
+	}
+}
+
+// readCommit reads and parses the commit object with the given hash. An
+// annotated tag is peeled to the commit it points at.
+func readCommit(objStore *objects.ObjectStore, hash string) (*objects.Commit, error) {
+	obj, err := peelTag(objStore, hash)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Type != objects.CommitType {
+		return nil, fmt.Errorf("object %s is not a commit", hash)
+	}
+	return objects.ParseCommit(obj.Content)
+}
+
+// resolveTreeHash resolves a tree-ish (a commit or a tree) to a tree hash.
+func resolveTreeHash(objStore *objects.ObjectStore, refManager *refs.RefManager, rev string) (string, error) {
+	hash, err := resolveRevision(objStore, refManager, rev)
+	if err != nil {
+		return "", err
+	}
+
+	obj, err := peelTag(objStore, hash)
+	if err != nil {
+		return "", err
+	}
+	switch obj.Type {
+	case objects.CommitType:
+		commit, err := objects.ParseCommit(obj.Content)
+		if err != nil {
+			return "", err
+		}
+		return commit.Tree, nil
+	case objects.TreeType:
+		return obj.Hash, nil
+	default:
+		return "", fmt.Errorf("%s is not a tree-ish", rev)
+	}
+}
+
+// peelTag reads an object, following annotated tags until it reaches an
+// object that is not a tag.
+func peelTag(objStore *objects.ObjectStore, hash string) (*objects.Object, error) {
+	for {
+		obj, err := objStore.ReadObject(hash)
+		if err != nil {
+			return nil, err
+		}
+		if obj.Type != objects.TagType {
+			return obj, nil
+		}
+		tag, err := objects.ParseTag(obj.Content)
+		if err != nil {
+			return nil, err
+		}
+		hash = tag.Object
+	}
+}
+
+// normalizePathspecs converts paths given on the command line, which are
+// relative to the current directory, into slash-separated paths relative
+// to the repository root.
+func normalizePathspecs(repo *repository.GitRepository, specs []string) ([]string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		abs := spec
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(cwd, spec)
+		}
+		rel, err := filepath.Rel(repo.WorkDir, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("'%s' is outside repository", spec)
+		}
+		normalized = append(normalized, filepath.ToSlash(rel))
+	}
+	return normalized, nil
+}
+
+// matchPathspec reports whether a repository path is selected by any of the
+// given (normalized) pathspecs. A pathspec selects a path if it names the
+// path itself, one of its parent directories, or matches it as a glob.
+func matchPathspec(p string, specs []string) bool {
+	for _, spec := range specs {
+		if spec == "." || spec == p || strings.HasPrefix(p, spec+"/") {
+			return true
+		}
+		if strings.ContainsAny(spec, "*?[") {
+			if matched, _ := path.Match(spec, p); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// leadsToPathspec reports whether a directory is a parent of one of the
+// given (normalized) pathspecs, so that what it holds may match.
+func leadsToPathspec(dir string, specs []string) bool {
+	for _, spec := range specs {
+		if strings.HasPrefix(spec, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
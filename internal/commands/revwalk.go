@@ -0,0 +1,585 @@
+package commands
+
+import (
+	"container/heap"
+	"fmt"
+	"mygit/internal/config"
+	"mygit/internal/index"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/utils"
+	"path/filepath"
+	"strings"
+)
+
+// Commit orders, as chosen by --date-order and --topo-order. The default
+// order is that of a walk that always continues with the most recent
+// commit it has reached.
+const (
+	orderWalk = iota
+	orderDate
+	orderTopo
+)
+
+// revWalk selects and orders commits for history commands such as log.
+// Parsed commits and flattened trees are cached, since a walk visits most
+// commits several times.
+type revWalk struct {
+	objStore    *objects.ObjectStore
+	refManager  *refs.RefManager
+	commits     map[string]*objects.Commit
+	trees       map[string]map[string]*index.IndexEntry
+	firstParent bool     // follow only the first parent of merges
+	paths       []string // limit history to these pathspecs
+
+	included map[string]bool     // commits in the selected range
+	simple   map[string][]string // parents after history simplification
+
+	graph       *objects.CommitGraph // nil if there is no commit-graph
+	graphLoaded bool
+}
+
+func newRevWalk(objStore *objects.ObjectStore, refManager *refs.RefManager) *revWalk {
+	return &revWalk{
+		objStore:   objStore,
+		refManager: refManager,
+		commits:    make(map[string]*objects.Commit),
+		trees:      make(map[string]map[string]*index.IndexEntry),
+		simple:     make(map[string][]string),
+	}
+}
+
+// commit returns the parsed commit with the given hash.
+func (w *revWalk) commit(hash string) (*objects.Commit, error) {
+	if c, ok := w.commits[hash]; ok {
+		return c, nil
+	}
+	c, err := readCommit(w.objStore, hash)
+	if err != nil {
+		return nil, err
+	}
+	w.commits[hash] = c
+	return c, nil
+}
+
+// commitGraph returns the repository's commit-graph, or nil if it has none
+// or core.commitGraph is false.
+func (w *revWalk) commitGraph() *objects.CommitGraph {
+	if !w.graphLoaded {
+		w.graphLoaded = true
+		cfg := config.NewConfig(filepath.Join(w.refManager.GitDir, "config"))
+		if cfg.Load() == nil && !cfg.GetBool("core.commitGraph", true) {
+			return nil
+		}
+		// A damaged graph is ignored; the commits themselves are still there
+		w.graph, _ = w.objStore.ReadCommitGraph()
+	}
+	return w.graph
+}
+
+// allParents returns every parent of a commit, from the commit-graph when
+// it has the commit.
+func (w *revWalk) allParents(hash string) ([]string, error) {
+	if g := w.commitGraph(); g != nil {
+		if pos, ok := g.Lookup(hash); ok {
+			positions := g.Parents(pos)
+			parents := make([]string, len(positions))
+			for i, p := range positions {
+				parents[i] = g.Hash(p)
+			}
+			return parents, nil
+		}
+	}
+	c, err := w.commit(hash)
+	if err != nil {
+		return nil, err
+	}
+	return c.Parents, nil
+}
+
+// parents returns the parents of a commit that the walk follows.
+func (w *revWalk) parents(hash string) ([]string, error) {
+	parents, err := w.allParents(hash)
+	if err != nil {
+		return nil, err
+	}
+	if w.firstParent && len(parents) > 1 {
+		return parents[:1], nil
+	}
+	return parents, nil
+}
+
+// generation returns a commit's generation number from the commit-graph,
+// or objects.GenerationInfinity if the graph does not have it.
+func (w *revWalk) generation(hash string) uint32 {
+	if g := w.commitGraph(); g != nil {
+		if pos, ok := g.Lookup(hash); ok {
+			return g.Generation(pos)
+		}
+	}
+	return objects.GenerationInfinity
+}
+
+// commitTime returns a commit's committer time in seconds since the epoch.
+func (w *revWalk) commitTime(hash string) int64 {
+	if g := w.commitGraph(); g != nil {
+		if pos, ok := g.Lookup(hash); ok {
+			return g.CommitTime(pos)
+		}
+	}
+	c, err := w.commit(hash)
+	if err != nil {
+		return 0
+	}
+	return c.Committer.When.Unix()
+}
+
+// peelCommit resolves a revision to the commit it names, following tags.
+func (w *revWalk) peelCommit(rev string) (string, error) {
+	hash, err := resolveRevision(w.objStore, w.refManager, rev)
+	if err != nil {
+		return "", err
+	}
+	obj, err := peelTag(w.objStore, hash)
+	if err != nil {
+		return "", err
+	}
+	if obj.Type != objects.CommitType {
+		return "", fmt.Errorf("%s is a %s, not a commit", rev, obj.Type)
+	}
+	return obj.Hash, nil
+}
+
+// ancestors returns the commits reachable from the given ones, including
+// themselves, following every parent.
+func (w *revWalk) ancestors(starts []string) (map[string]bool, error) {
+	seen := make(map[string]bool)
+	stack := append([]string(nil), starts...)
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		parents, err := w.allParents(hash)
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack, parents...)
+	}
+	return seen, nil
+}
+
+// selectRange parses revision arguments and marks the commits they select.
+// An argument is a revision to include, "^<rev>" to exclude the history of
+// <rev>, "<a>..<b>" for the commits in b but not a, or "<a>...<b>" for the
+// commits in either but not both. It returns the tips to start from.
+func (w *revWalk) selectRange(args []string) ([]string, error) {
+	var tips, hidden []string
+	var symmetric [][2]string
+
+	for _, arg := range args {
+		if left, right, ok := strings.Cut(arg, "..."); ok {
+			a, err := w.peelCommit(orHEAD(left))
+			if err != nil {
+				return nil, err
+			}
+			b, err := w.peelCommit(orHEAD(right))
+			if err != nil {
+				return nil, err
+			}
+			tips = append(tips, a, b)
+			symmetric = append(symmetric, [2]string{a, b})
+			continue
+		}
+		if left, right, ok := strings.Cut(arg, ".."); ok {
+			a, err := w.peelCommit(orHEAD(left))
+			if err != nil {
+				return nil, err
+			}
+			b, err := w.peelCommit(orHEAD(right))
+			if err != nil {
+				return nil, err
+			}
+			hidden = append(hidden, a)
+			tips = append(tips, b)
+			continue
+		}
+		if rev, ok := strings.CutPrefix(arg, "^"); ok {
+			hash, err := w.peelCommit(rev)
+			if err != nil {
+				return nil, err
+			}
+			hidden = append(hidden, hash)
+			continue
+		}
+		hash, err := w.peelCommit(arg)
+		if err != nil {
+			return nil, err
+		}
+		tips = append(tips, hash)
+	}
+
+	excluded, err := w.ancestors(hidden)
+	if err != nil {
+		return nil, err
+	}
+	for _, pair := range symmetric {
+		left, err := w.ancestors(pair[:1])
+		if err != nil {
+			return nil, err
+		}
+		right, err := w.ancestors(pair[1:])
+		if err != nil {
+			return nil, err
+		}
+		for hash := range left {
+			if right[hash] {
+				excluded[hash] = true
+			}
+		}
+	}
+
+	// Walk from the tips, following simplified parents when limiting to
+	// paths, so that side branches that changed nothing are not entered
+	w.included = make(map[string]bool)
+	stack := append([]string(nil), tips...)
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if w.included[hash] || excluded[hash] {
+			continue
+		}
+		w.included[hash] = true
+		parents, err := w.simplifiedParents(hash)
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack, parents...)
+	}
+
+	var kept []string
+	for _, tip := range tips {
+		if w.included[tip] {
+			kept = append(kept, tip)
+		}
+	}
+	return kept, nil
+}
+
+// orHEAD returns rev, or HEAD for the empty side of a range.
+func orHEAD(rev string) string {
+	if rev == "" {
+		return "HEAD"
+	}
+	return rev
+}
+
+// simplifiedParents returns the parents history is followed through. When
+// limiting to paths, a merge that has the same content at those paths as
+// one of its parents is followed through that parent only, as Git does.
+func (w *revWalk) simplifiedParents(hash string) ([]string, error) {
+	if parents, ok := w.simple[hash]; ok {
+		return parents, nil
+	}
+	parents, err := w.parents(hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(w.paths) > 0 && len(parents) > 1 {
+		for _, p := range parents {
+			same, err := w.treesame(hash, p)
+			if err != nil {
+				return nil, err
+			}
+			if same {
+				parents = []string{p}
+				break
+			}
+		}
+	}
+	w.simple[hash] = parents
+	return parents, nil
+}
+
+// changesPaths reports whether a commit changes anything at the walk's
+// pathspecs, compared with its (simplified) parents. Without pathspecs
+// every commit counts as a change.
+func (w *revWalk) changesPaths(hash string) (bool, error) {
+	if len(w.paths) == 0 {
+		return true, nil
+	}
+	parents, err := w.simplifiedParents(hash)
+	if err != nil {
+		return false, err
+	}
+	if len(parents) == 0 {
+		same, err := w.treesame(hash, "")
+		return !same, err
+	}
+	for _, p := range parents {
+		same, err := w.treesame(hash, p)
+		if err != nil || same {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// treesame reports whether two commits have the same content at the
+// walk's pathspecs. An empty hash stands for the empty tree.
+func (w *revWalk) treesame(a, b string) (bool, error) {
+	ta, err := w.tree(a)
+	if err != nil {
+		return false, err
+	}
+	tb, err := w.tree(b)
+	if err != nil {
+		return false, err
+	}
+	return sameAtPaths(ta, tb, w.paths), nil
+}
+
+// sameAtPaths reports whether two flattened trees have the same entries
+// at the pathspecs.
+func sameAtPaths(ta, tb map[string]*index.IndexEntry, specs []string) bool {
+	for path, ea := range ta {
+		if !matchPathspec(path, specs) {
+			continue
+		}
+		eb, ok := tb[path]
+		if !ok || !sameEntry(ea, eb) {
+			return false
+		}
+	}
+	for path := range tb {
+		if _, ok := ta[path]; !ok && matchPathspec(path, specs) {
+			return false
+		}
+	}
+	return true
+}
+
+// tree returns the flattened tree of a commit, or an empty tree for "".
+func (w *revWalk) tree(hash string) (map[string]*index.IndexEntry, error) {
+	if hash == "" {
+		return map[string]*index.IndexEntry{}, nil
+	}
+	if entries, ok := w.trees[hash]; ok {
+		return entries, nil
+	}
+	c, err := w.commit(hash)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := utils.GetTreeEntriesRecursive(w.objStore, c.Tree, "")
+	if err != nil {
+		return nil, err
+	}
+	w.trees[hash] = entries
+	return entries, nil
+}
+
+// sort returns the selected commits in the given order, starting from the
+// tips selectRange returned.
+func (w *revWalk) sort(tips []string, order int) ([]string, error) {
+	if order == orderWalk {
+		return w.walkOrder(tips)
+	}
+
+	// Kahn's algorithm over the selected commits: a commit is ready once
+	// all of its selected children have been shown
+	indegree := make(map[string]int)
+	for hash := range w.included {
+		parents, err := w.sortParents(hash)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range parents {
+			if w.included[p] {
+				indegree[p]++
+			}
+		}
+	}
+
+	walked, err := w.walkOrder(tips)
+	if err != nil {
+		return nil, err
+	}
+	queue := &commitQueue{walk: w, lifo: order == orderTopo}
+	for _, hash := range walked {
+		if indegree[hash] == 0 {
+			queue.push(hash)
+		}
+	}
+	if queue.lifo {
+		// The tips are shown newest first, so the newest goes on top
+		for i, j := 0, len(queue.items)-1; i < j; i, j = i+1, j-1 {
+			queue.items[i], queue.items[j] = queue.items[j], queue.items[i]
+		}
+	}
+
+	var sorted []string
+	for queue.Len() > 0 {
+		hash := queue.pop()
+		sorted = append(sorted, hash)
+		parents, _ := w.sortParents(hash)
+		for _, p := range parents {
+			if !w.included[p] {
+				continue
+			}
+			indegree[p]--
+			if indegree[p] == 0 {
+				queue.push(p)
+			}
+		}
+	}
+	return sorted, nil
+}
+
+// sortParents returns the parents that order commits when sorting. Like
+// Git, --first-parent limits which commits are selected but not how they
+// are ordered.
+func (w *revWalk) sortParents(hash string) ([]string, error) {
+	if w.firstParent {
+		return w.allParents(hash)
+	}
+	return w.simplifiedParents(hash)
+}
+
+// walkOrder returns the selected commits in the order a walk that always
+// continues with the most recently committed commit reaches them.
+func (w *revWalk) walkOrder(tips []string) ([]string, error) {
+	queue := &commitQueue{walk: w}
+	seen := make(map[string]bool)
+	for _, tip := range tips {
+		if !seen[tip] {
+			seen[tip] = true
+			queue.push(tip)
+		}
+	}
+
+	var order []string
+	for queue.Len() > 0 {
+		hash := queue.pop()
+		order = append(order, hash)
+		parents, err := w.simplifiedParents(hash)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range parents {
+			if w.included[p] && !seen[p] {
+				seen[p] = true
+				queue.push(p)
+			}
+		}
+	}
+	return order, nil
+}
+
+// rewrittenParents returns the parents log --graph draws edges to. When
+// limiting to paths, each parent is replaced by its nearest ancestor that
+// changes them, as Git rewrites parents. Parents that are not in visible,
+// because they are outside the range or filtered out, get no edge.
+func (w *revWalk) rewrittenParents(hash string, visible map[string]bool, memo map[string]string) ([]string, error) {
+	parents, err := w.simplifiedParents(hash)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	seen := make(map[string]bool)
+	for _, p := range parents {
+		p, err := w.rewriteParent(p, memo)
+		if err != nil {
+			return nil, err
+		}
+		if visible[p] && !seen[p] {
+			seen[p] = true
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+// rewriteParent follows the first parents of a commit past those that do
+// not change the walk's paths. It returns "" if there is none left.
+func (w *revWalk) rewriteParent(hash string, memo map[string]string) (string, error) {
+	var chain []string
+	for hash != "" && w.included[hash] {
+		if rewritten, ok := memo[hash]; ok {
+			hash = rewritten
+			break
+		}
+		changed, err := w.changesPaths(hash)
+		if err != nil {
+			return "", err
+		}
+		if changed {
+			break
+		}
+		chain = append(chain, hash)
+		parents, err := w.simplifiedParents(hash)
+		if err != nil {
+			return "", err
+		}
+		hash = ""
+		if len(parents) > 0 {
+			hash = parents[0]
+		}
+	}
+	for _, c := range chain {
+		memo[c] = hash
+	}
+	return hash, nil
+}
+
+// commitQueue orders commits by committer date, newest first, or as a
+// stack when lifo is set. Ties keep insertion order.
+type commitQueue struct {
+	walk  *revWalk
+	lifo  bool
+	items []string
+	seq   map[string]int
+	next  int
+}
+
+func (q *commitQueue) Len() int { return len(q.items) }
+
+func (q *commitQueue) Less(i, j int) bool {
+	ti, tj := q.walk.commitTime(q.items[i]), q.walk.commitTime(q.items[j])
+	if ti != tj {
+		return ti > tj
+	}
+	return q.seq[q.items[i]] < q.seq[q.items[j]]
+}
+
+func (q *commitQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+func (q *commitQueue) Push(x any) { q.items = append(q.items, x.(string)) }
+
+func (q *commitQueue) Pop() any {
+	last := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return last
+}
+
+func (q *commitQueue) push(hash string) {
+	if q.seq == nil {
+		q.seq = make(map[string]int)
+	}
+	q.seq[hash] = q.next
+	q.next++
+	if q.lifo {
+		q.items = append(q.items, hash)
+		return
+	}
+	heap.Push(q, hash)
+}
+
+func (q *commitQueue) pop() string {
+	if q.lifo {
+		return q.Pop().(string)
+	}
+	return heap.Pop(q).(string)
+}
@@ -0,0 +1,226 @@
+package commands
+
+import (
+	"fmt"
+	"mygit/internal/index"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"mygit/internal/utils"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Rm handles the `rm` command.
+// It removes files from the index and, unless --cached is given, from the
+// working directory, so the deletion is staged for the next commit.
+func Rm(args []string) {
+	cached := false
+	recursive := false
+	force := false
+	quiet := false
+	dryRun := false
+	var pathspecs []string
+
+	// Combined short options such as -rf are taken one letter at a time
+	var expanded []string
+	for i, arg := range args {
+		if arg == "--" {
+			expanded = append(expanded, args[i:]...)
+			break
+		}
+		if len(arg) > 2 && arg[0] == '-' && arg[1] != '-' {
+			for _, c := range arg[1:] {
+				expanded = append(expanded, "-"+string(c))
+			}
+			continue
+		}
+		expanded = append(expanded, arg)
+	}
+	args = expanded
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--cached":
+			cached = true
+		case arg == "-r":
+			recursive = true
+		case arg == "-f" || arg == "--force":
+			force = true
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case arg == "-n" || arg == "--dry-run":
+			dryRun = true
+		case arg == "--":
+			pathspecs = append(pathspecs, args[i+1:]...)
+			i = len(args)
+		case strings.HasPrefix(arg, "-"):
+			fmt.Printf("Error: unknown option '%s'\n", arg)
+			os.Exit(1)
+		default:
+			pathspecs = append(pathspecs, arg)
+		}
+	}
+
+	if len(pathspecs) == 0 {
+		fmt.Println("Usage: mygit rm [--cached] [-r] [-f] [-n] [-q] [--] <pathspec>...")
+		os.Exit(1)
+	}
+
+	// Find repository
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+	idx := index.NewIndex(repo.GitDir)
+	if err := idx.Load(); err != nil {
+		fmt.Printf("Error loading index: %v\n", err)
+		os.Exit(1)
+	}
+
+	specs, err := normalizePathspecs(repo, pathspecs)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Collect the tracked files each pathspec selects
+	var paths []string
+	for i, spec := range specs {
+		found := false
+		for path := range idx.GetAll() {
+			if !matchPathspec(path, []string{spec}) {
+				continue
+			}
+			found = true
+			if path != spec && !recursive && !strings.ContainsAny(spec, "*?[") {
+				fmt.Printf("fatal: not removing '%s' recursively without -r\n", pathspecs[i])
+				os.Exit(1)
+			}
+			paths = append(paths, path)
+		}
+		if !found {
+			fmt.Printf("fatal: pathspec '%s' did not match any files\n", pathspecs[i])
+			os.Exit(1)
+		}
+	}
+	sort.Strings(paths)
+	paths = uniqueStrings(paths)
+
+	if !force {
+		if err := checkRemovable(repo, objStore, refManager, idx, paths, cached); err != nil {
+			fmt.Printf("error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	for _, path := range paths {
+		if !quiet {
+			fmt.Printf("rm '%s'\n", path)
+		}
+		if dryRun {
+			continue
+		}
+		idx.Remove(path)
+		if !cached {
+			if err := removeWorkdirFile(repo, path); err != nil {
+				fmt.Printf("fatal: failed to remove %s: %v\n", path, err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	if dryRun {
+		return
+	}
+	if err := idx.Save(); err != nil {
+		fmt.Printf("Error saving index: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// checkRemovable refuses to remove files whose content would be lost:
+// files with local modifications or with changes staged in the index.
+// With cached, only files whose staged content matches neither the working
+// directory nor HEAD are refused, since the working copy is kept.
+func checkRemovable(repo *repository.GitRepository, objStore *objects.ObjectStore, refManager *refs.RefManager, idx *index.Index, paths []string, cached bool) error {
+	headTree := make(map[string]*index.IndexEntry)
+	if headCommit, err := refManager.GetHEAD(); err == nil && headCommit != "" {
+		tree, err := utils.GetTreeEntriesFromCommit(objStore, headCommit)
+		if err != nil {
+			return err
+		}
+		headTree = tree
+	}
+
+	unstagedList, err := utils.GetUnstagedChanges(repo, idx, objStore)
+	if err != nil {
+		return err
+	}
+	unstaged := make(map[string]bool)
+	for _, path := range unstagedList {
+		if utils.PathExists(filepath.Join(repo.WorkDir, path)) {
+			unstaged[path] = true
+		}
+	}
+
+	var bothDiffer, stagedOnly, localOnly []string
+	for _, path := range paths {
+		entry, _ := idx.Get(path)
+		staged := !sameEntry(entry, headTree[path])
+		local := unstaged[path]
+
+		switch {
+		case staged && local:
+			bothDiffer = append(bothDiffer, path)
+		case cached:
+			// The working copy stays, so nothing is lost
+		case staged:
+			stagedOnly = append(stagedOnly, path)
+		case local:
+			localOnly = append(localOnly, path)
+		}
+	}
+
+	var msgs []string
+	if len(bothDiffer) > 0 {
+		msgs = append(msgs, "the following files have staged content different from both the\nfile and the HEAD:\n    "+
+			strings.Join(bothDiffer, "\n    ")+"\n(use -f to force removal)")
+	}
+	if len(stagedOnly) > 0 {
+		msgs = append(msgs, "the following files have changes staged in the index:\n    "+
+			strings.Join(stagedOnly, "\n    ")+"\n(use --cached to keep the file, or -f to force removal)")
+	}
+	if len(localOnly) > 0 {
+		msgs = append(msgs, "the following files have local modifications:\n    "+
+			strings.Join(localOnly, "\n    ")+"\n(use --cached to keep the file, or -f to force removal)")
+	}
+	if len(msgs) > 0 {
+		return fmt.Errorf("%s", strings.Join(msgs, "\nerror: "))
+	}
+	return nil
+}
+
+// uniqueStrings removes adjacent duplicates from a sorted slice.
+func uniqueStrings(sorted []string) []string {
+	var out []string
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
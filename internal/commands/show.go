@@ -1,19 +1,113 @@
 package commands
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"mygit/internal/diff"
+	"mygit/internal/index"
 	"mygit/internal/objects"
 	"mygit/internal/refs"
 	"mygit/internal/repository"
 	"os"
-	"time"
+	"sort"
+	"strings"
 )
 
+// showOptions holds the options of show.
+type showOptions struct {
+	names      []string
+	stat       bool
+	patch      bool
+	nameOnly   bool
+	nameStatus bool
+	combined   string // "c" for a combined diff showing every hunk; merges get --cc otherwise
+	renames    renameOptions
+	noPager    bool
+	format     prettyFormat
+}
+
 func Show(args []string) {
-	// Default to HEAD if no commit specified
-	commitHash := "HEAD"
-	if len(args) > 0 {
-		commitHash = args[0]
+	opts := showOptions{}
+	opts.format.name = "medium"
+	explicitPatch, noPatch := false, false
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--oneline":
+			opts.format.name = "oneline"
+			opts.format.abbrev = true
+		case strings.HasPrefix(arg, "--pretty") || strings.HasPrefix(arg, "--format"):
+			spec := "medium"
+			if v, ok := strings.CutPrefix(arg, "--pretty="); ok {
+				spec = v
+			} else if v, ok := strings.CutPrefix(arg, "--format="); ok {
+				spec = v
+			} else if arg == "--format" {
+				if i+1 >= len(args) {
+					fmt.Println("Error: option '--format' requires a value")
+					os.Exit(1)
+				}
+				i++
+				spec = args[i]
+			} else if arg != "--pretty" {
+				fmt.Printf("Error: unknown option '%s'\n", arg)
+				os.Exit(1)
+			}
+			format, err := parsePrettyFormat(spec)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			format.abbrev = opts.format.abbrev
+			opts.format = format
+		case arg == "--abbrev-commit":
+			opts.format.abbrev = true
+		case strings.HasPrefix(arg, "--date="):
+			mode := strings.TrimPrefix(arg, "--date=")
+			if !validDateModes[mode] {
+				fmt.Printf("Error: unknown date format %s\n", mode)
+				os.Exit(1)
+			}
+			opts.format.dateMode = mode
+		case arg == "--stat":
+			opts.stat = true
+		case arg == "-p" || arg == "-u" || arg == "--patch":
+			explicitPatch = true
+		case arg == "--name-only":
+			opts.nameOnly, opts.nameStatus = true, false
+		case arg == "--name-status":
+			opts.nameStatus, opts.nameOnly = true, false
+		case arg == "-s" || arg == "--no-patch":
+			noPatch = true
+		case arg == "--no-pager":
+			opts.noPager = true
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			if ok, err := parseRenameOption(arg, &opts.renames); ok {
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(1)
+				}
+				continue
+			}
+			fmt.Printf("Error: unknown option '%s'\n", arg)
+			os.Exit(1)
+		default:
+			opts.names = append(opts.names, arg)
+		}
+	}
+	// A patch is shown unless another kind of output was asked for, and
+	// --name-only or --name-status replaces the others
+	opts.patch = explicitPatch || !opts.stat
+	if opts.nameOnly || opts.nameStatus {
+		opts.stat, opts.patch = false, false
+	}
+	if noPatch {
+		opts.stat, opts.patch, opts.nameOnly, opts.nameStatus = false, false, false, false
+	}
+	if len(opts.names) == 0 {
+		opts.names = []string{"HEAD"}
 	}
 
 	// Find repository
@@ -29,48 +123,433 @@ func Show(args []string) {
 		os.Exit(1)
 	}
 
-	// Initialize object store
+	// Initialize object store and ref manager
 	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+	opts.renames.resolve(repo, "diff.renames")
+
+	// Resolve everything first, so that a bad name shows nothing
+	hashes := make([]string, len(opts.names))
+	for i, name := range opts.names {
+		hash, err := resolveRevision(objStore, refManager, name)
+		if err != nil {
+			if name == "HEAD" {
+				fmt.Println("No commits yet")
+				return
+			}
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		hashes[i] = hash
+	}
 
-	// Resolve commit hash
-	if commitHash == "HEAD" {
-		refManager := refs.NewRefManager(repo.GitDir)
-		resolvedHash, err := refManager.GetHEAD()
-		if err != nil || resolvedHash == "" {
-			fmt.Println("No commits yet")
-			return
+	opts.format.repo = repo
+	opts.format.color = isTerminal(os.Stdout)
+	if isTerminal(os.Stdout) || opts.format.name == "format" &&
+		(strings.Contains(opts.format.template, "%d") || strings.Contains(opts.format.template, "%D")) {
+		opts.format.decorations, err = loadDecorations(objStore, refManager, false)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
 		}
-		commitHash = resolvedHash
 	}
 
-	// Read commit object
-	obj, err := objStore.ReadObject(commitHash)
+	var w io.Writer = os.Stdout
+	done := func() {}
+	if !opts.noPager {
+		w, done = startPager(repo)
+	}
+	out := bufio.NewWriter(w)
+	s := &shower{out: out, walk: newRevWalk(objStore, refManager), opts: opts, commits: make(map[string]bool)}
+	for i, hash := range hashes {
+		if err = s.show(hash, opts.names[i]); err != nil {
+			break
+		}
+	}
+	out.Flush()
+	done()
 	if err != nil {
-		fmt.Printf("Error reading commit %s: %v\n", commitHash, err)
+		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
+}
 
-	if obj.Type != objects.CommitType {
-		fmt.Printf("Object %s is not a commit\n", commitHash)
-		os.Exit(1)
+// shower prints objects for show, keeping track of whether anything has
+// been printed yet so that objects can be separated.
+type shower struct {
+	out        *bufio.Writer
+	walk       *revWalk
+	opts       showOptions
+	shownOne   bool
+	unfinished bool            // the last line printed has no newline yet
+	commits    map[string]bool // commits shown so far, each is shown once
+}
+
+// show prints one object; name is how it was given on the command line.
+func (s *shower) show(hash, name string) error {
+	obj, err := s.walk.objStore.ReadObject(hash)
+	if err != nil {
+		return err
 	}
 
-	// Parse commit
-	commit, err := objects.ParseCommit(obj.Content)
+	switch obj.Type {
+	case objects.BlobType:
+		s.finishLine()
+		s.out.Write(obj.Content)
+	case objects.TreeType:
+		tree, err := objects.ParseTree(obj.Content)
+		if err != nil {
+			return err
+		}
+		s.separate()
+		fmt.Fprintf(s.out, "tree %s\n\n", name)
+		for _, e := range tree.Entries {
+			if e.Type == objects.TreeType {
+				fmt.Fprintf(s.out, "%s/\n", e.Name)
+			} else {
+				fmt.Fprintln(s.out, e.Name)
+			}
+		}
+		s.shownOne = true
+	case objects.TagType:
+		tag, err := objects.ParseTag(obj.Content)
+		if err != nil {
+			return err
+		}
+		s.separate()
+		fmt.Fprintf(s.out, "tag %s\n", tag.Name)
+		if tag.Tagger != nil {
+			s.out.WriteString(s.taggerLines(*tag.Tagger))
+		}
+		s.out.WriteString("\n" + tag.Message + tag.Signature)
+		s.shownOne = true
+		// The object the tag points at comes next
+		return s.show(tag.Object, tag.Object)
+	case objects.CommitType:
+		if s.commits[hash] {
+			return nil
+		}
+		s.commits[hash] = true
+		c, err := objects.ParseCommit(obj.Content)
+		if err != nil {
+			return err
+		}
+		// Terminated formats end each commit with a newline; the others
+		// separate commits with one
+		f := s.opts.format
+		if s.shownOne && !(f.name == "oneline" || f.name == "format" && !f.separator) && !s.unfinished {
+			s.out.WriteByte('\n')
+		}
+		s.finishLine()
+		lines := f.lines(hash, c, nil)
+		diffLines, err := s.diffLines(hash, c)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, diffLines...)
+		s.out.WriteString(strings.Join(lines, "\n"))
+		if f.separator {
+			s.unfinished = true
+		} else {
+			s.out.WriteByte('\n')
+		}
+		s.shownOne = true
+	default:
+		return fmt.Errorf("unknown object type %s", obj.Type)
+	}
+	return nil
+}
+
+// separate prints the blank line that goes before a tag or tree when
+// something has been shown already.
+func (s *shower) separate() {
+	s.finishLine()
+	if s.shownOne {
+		s.out.WriteByte('\n')
+	}
+}
+
+// finishLine ends the last line printed for a "format:" commit.
+func (s *shower) finishLine() {
+	if s.unfinished {
+		s.out.WriteByte('\n')
+		s.unfinished = false
+	}
+}
+
+// taggerLines returns the lines about the tagger that the format shows.
+func (s *shower) taggerLines(tagger objects.Signature) string {
+	f := s.opts.format
+	switch f.name {
+	case "oneline":
+		return ""
+	case "medium":
+		return fmt.Sprintf("Tagger: %s\nDate:   %s\n", tagger.Identity(), formatDate(tagger.When, f.dateMode))
+	case "fuller":
+		return fmt.Sprintf("Tagger:     %s\nTaggerDate: %s\n", tagger.Identity(), formatDate(tagger.When, f.dateMode))
+	default:
+		return fmt.Sprintf("Tagger: %s\n", tagger.Identity())
+	}
+}
+
+// diffLines returns the diff shown after a commit's message: the changes
+// against its first parent, or a combined diff against all parents for a
+// merge, preceded by the line separating it from the message.
+func (s *shower) diffLines(hash string, c *objects.Commit) ([]string, error) {
+	names := s.opts.nameOnly || s.opts.nameStatus
+	if !s.opts.stat && !s.opts.patch && !names {
+		return nil, nil
+	}
+
+	newTree, err := s.walk.tree(hash)
 	if err != nil {
-		fmt.Printf("Error parsing commit %s: %v\n", commitHash, err)
-		os.Exit(1)
+		return nil, err
+	}
+	parent := ""
+	if len(c.Parents) > 0 {
+		parent = c.Parents[0]
 	}
+	oldTree, err := s.walk.tree(parent)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := diffWithRenames(s.walk.objStore, oldTree, newTree, s.opts.renames)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.walk.paths) > 0 {
+		// Only log walks are limited to paths
+		var kept []fileDiff
+		for _, change := range changes {
+			if matchPathspec(change.Path, s.walk.paths) {
+				kept = append(kept, change)
+			}
+		}
+		changes = kept
+	}
+
+	merge := len(c.Parents) > 1
+	var combined []combinedDiff
+	if merge && (s.opts.patch || names) {
+		parentTrees := make([]map[string]*index.IndexEntry, len(c.Parents))
+		for i, p := range c.Parents {
+			if parentTrees[i], err = s.walk.tree(p); err != nil {
+				return nil, err
+			}
+		}
+		for _, change := range combinedChanges(parentTrees, newTree) {
+			if len(s.walk.paths) == 0 || matchPathspec(change.Path, s.walk.paths) {
+				combined = append(combined, change)
+			}
+		}
+	}
+
+	var stat, patch []string
+	switch {
+	case s.opts.nameOnly && merge:
+		for _, change := range combined {
+			patch = append(patch, change.Path)
+		}
+	case s.opts.nameStatus && merge:
+		for _, change := range combined {
+			var letters strings.Builder
+			for _, parent := range change.Parents {
+				switch {
+				case parent == nil:
+					letters.WriteByte('A')
+				case change.New == nil:
+					letters.WriteByte('D')
+				default:
+					letters.WriteByte('M')
+				}
+			}
+			patch = append(patch, letters.String()+"\t"+change.Path)
+		}
+	case s.opts.nameOnly:
+		for _, change := range changes {
+			patch = append(patch, change.Path)
+		}
+	case s.opts.nameStatus:
+		patch = nameStatusLines(changes)
+	default:
+		if s.opts.stat {
+			text, err := formatStat(s.walk.objStore, changes)
+			if err != nil {
+				return nil, err
+			}
+			stat = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+		}
+		if s.opts.patch {
+			var text string
+			if merge {
+				text, err = formatCombinedPatch(s.walk.objStore, combined, s.opts.combined != "c")
+			} else {
+				text, err = formatPatch(s.walk.objStore, changes)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if text != "" {
+				patch = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+			}
+		}
+	}
+	// A merge gets its blank line even when no path is left to show
+	if len(stat) == 0 && len(patch) == 0 && !(merge && s.opts.patch) {
+		return nil, nil
+	}
+
+	// As in log, except that a merge always gets a blank line
+	var lines []string
+	switch {
+	case merge:
+		lines = append(lines, "")
+	case s.opts.format.name == "oneline":
+	case len(stat) > 0 && len(patch) > 0:
+		lines = append(lines, "---")
+	default:
+		lines = append(lines, "")
+	}
+	lines = append(lines, stat...)
+	if len(stat) > 0 && len(patch) > 0 {
+		lines = append(lines, "")
+	}
+	return append(lines, patch...), nil
+}
+
+// combinedDiff is a path of a merge that differs from every parent.
+// Parents has an entry, nil where missing, for each parent, and New is
+// nil if the merge deleted the path.
+type combinedDiff struct {
+	Path    string
+	Parents []*index.IndexEntry
+	New     *index.IndexEntry
+}
+
+// combinedChanges returns the paths where a merge differs from all of its
+// parents, in order.
+func combinedChanges(parents []map[string]*index.IndexEntry, merged map[string]*index.IndexEntry) []combinedDiff {
+	paths := make(map[string]bool)
+	for p := range merged {
+		paths[p] = true
+	}
+	for _, tree := range parents {
+		for p := range tree {
+			paths[p] = true
+		}
+	}
+
+	var changes []combinedDiff
+	for p := range paths {
+		change := combinedDiff{Path: p, New: merged[p]}
+		differs := true
+		for _, tree := range parents {
+			entry := tree[p]
+			if sameEntry(entry, change.New) && (entry == nil ||
+				objects.ModeFromPermissions(entry.Permissions) == objects.ModeFromPermissions(change.New.Permissions)) {
+				differs = false
+				break
+			}
+			change.Parents = append(change.Parents, entry)
+		}
+		if differs {
+			changes = append(changes, change)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
 
-	// Display detailed commit info
-	fmt.Printf("commit %s\n", commitHash)
-	fmt.Printf("Author: %s\n", commit.Author)
-	fmt.Printf("Date: %s\n", commit.Timestamp.Format(time.RFC3339))
-	fmt.Printf("\n    %s\n\n", commit.Message)
+// formatCombinedPatch renders the changes of a merge as a Git-style
+// combined diff. With dense, as for diff --cc, hunks and paths that take
+// one parent's version are left out; otherwise, as for diff -c, they are
+// shown and the header reads "diff --combined".
+func formatCombinedPatch(objStore *objects.ObjectStore, changes []combinedDiff, dense bool) (string, error) {
+	mode := func(entry *index.IndexEntry) string {
+		if entry == nil {
+			return "000000"
+		}
+		return objects.ModeFromPermissions(entry.Permissions)
+	}
+	hash := func(entry *index.IndexEntry) string {
+		if entry == nil {
+			return refs.ZeroHash[:abbrevLength]
+		}
+		return entry.Hash[:abbrevLength]
+	}
 
-	// TODO: Show diff (will implement in Phase 5)
-	fmt.Printf("Tree: %s\n", commit.Tree)
-	if len(commit.Parents) > 0 {
-		fmt.Printf("Parent: %s\n", commit.Parents[0])
+	var b strings.Builder
+	for _, c := range changes {
+		newContent, err := blobContent(objStore, c.New)
+		if err != nil {
+			return "", err
+		}
+		parentContents := make([][]byte, len(c.Parents))
+		binary := diff.IsBinary(newContent)
+		modeDiffers, added := false, c.New != nil
+		for i, entry := range c.Parents {
+			if parentContents[i], err = blobContent(objStore, entry); err != nil {
+				return "", err
+			}
+			binary = binary || diff.IsBinary(parentContents[i])
+			modeDiffers = modeDiffers || mode(entry) != mode(c.New)
+			added = added && entry == nil
+		}
+
+		hunks := ""
+		if !binary {
+			hunks = diff.Combined(parentContents, newContent, diff.DefaultContext, dense)
+			if hunks == "" && !modeDiffers {
+				continue
+			}
+		}
+
+		if dense {
+			fmt.Fprintf(&b, "diff --cc %s\nindex ", c.Path)
+		} else {
+			fmt.Fprintf(&b, "diff --combined %s\nindex ", c.Path)
+		}
+		for i, entry := range c.Parents {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(hash(entry))
+		}
+		fmt.Fprintf(&b, "..%s\n", hash(c.New))
+		if modeDiffers {
+			if added {
+				fmt.Fprintf(&b, "new file mode %s\n", mode(c.New))
+			} else {
+				if c.New == nil {
+					b.WriteString("deleted file ")
+				}
+				b.WriteString("mode ")
+				for i, entry := range c.Parents {
+					if i > 0 {
+						b.WriteByte(',')
+					}
+					b.WriteString(mode(entry))
+				}
+				if c.New != nil {
+					fmt.Fprintf(&b, "..%s", mode(c.New))
+				}
+				b.WriteByte('\n')
+			}
+		}
+		if binary {
+			b.WriteString("Binary files differ\n")
+			continue
+		}
+
+		oldName, newName := "a/"+c.Path, "b/"+c.Path
+		if added {
+			oldName = "/dev/null"
+		}
+		if c.New == nil {
+			newName = "/dev/null"
+		}
+		fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+		b.WriteString(hunks)
 	}
+	return b.String(), nil
 }
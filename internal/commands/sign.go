@@ -0,0 +1,82 @@
+package commands
+
+import (
+	"fmt"
+	"mygit/internal/config"
+	"mygit/internal/objects"
+	"mygit/internal/repository"
+	"mygit/internal/signing"
+	"path/filepath"
+)
+
+// signingOptions reads the signing settings from the repository config.
+// A non-empty key overrides user.signingKey.
+func signingOptions(repo *repository.GitRepository, key string) signing.Options {
+	cfg := config.NewConfig(filepath.Join(repo.GitDir, "config"))
+	cfg.Load()
+
+	opts := signing.Options{Identity: getAuthor(repo)}
+	opts.Format, _ = cfg.Get("gpg.format")
+	opts.SigningKey, _ = cfg.Get("user.signingKey")
+	opts.GPGProgram, _ = cfg.Get("gpg.program")
+	opts.SSHProgram, _ = cfg.Get("gpg.ssh.program")
+	opts.AllowedSigners, _ = cfg.Get("gpg.ssh.allowedSignersFile")
+	if key != "" {
+		opts.SigningKey = key
+	}
+	return opts
+}
+
+// signByDefault reports whether a boolean config setting such as
+// commit.gpgSign asks for signing without -S.
+func signByDefault(repo *repository.GitRepository, key string) bool {
+	cfg := config.NewConfig(filepath.Join(repo.GitDir, "config"))
+	cfg.Load()
+	return cfg.GetBool(key, false)
+}
+
+// signCommit signs a commit in place, storing the signature in its gpgsig
+// header.
+func signCommit(repo *repository.GitRepository, commit *objects.Commit, key string) error {
+	sig, err := signing.Sign(signingOptions(repo, key), commit.Payload())
+	if err != nil {
+		return err
+	}
+	commit.SetSignature(sig)
+	return nil
+}
+
+// signTag signs a tag in place, appending the signature to its message.
+func signTag(repo *repository.GitRepository, tag *objects.Tag, key string) error {
+	sig, err := signing.Sign(signingOptions(repo, key), tag.Payload())
+	if err != nil {
+		return err
+	}
+	tag.Signature = sig
+	return nil
+}
+
+// verifyCommit checks the signature of a commit. It fails if the commit is
+// not signed.
+func verifyCommit(repo *repository.GitRepository, commit *objects.Commit) (*signing.Result, error) {
+	sig, ok := commit.Signature()
+	if !ok {
+		return nil, fmt.Errorf("no signature found")
+	}
+	opts := signingOptions(repo, "")
+	opts.SignedAt = commit.Committer.When
+	return signing.Verify(opts, commit.Payload(), sig)
+}
+
+// verifyTag checks the signature of a tag. It fails if the tag is not
+// signed.
+func verifyTag(repo *repository.GitRepository, tag *objects.Tag) (*signing.Result, error) {
+	if tag.Signature == "" {
+		return nil, fmt.Errorf("no signature found")
+	}
+	opts := signingOptions(repo, "")
+	if tag.Tagger != nil {
+		opts.SignedAt = tag.Tagger.When
+	}
+	return signing.Verify(opts, tag.Payload(), tag.Signature)
+}
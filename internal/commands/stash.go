@@ -0,0 +1,751 @@
+package commands
+
+import (
+	"fmt"
+	"io/fs"
+	"mygit/internal/diff"
+	"mygit/internal/index"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"mygit/internal/utils"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stashRef is the ref holding the newest stash entry. Older entries live
+// in its reflog, so stash@{n} is simply the n-th reflog entry.
+const stashRef = "refs/stash"
+
+// Stash handles the `stash` command.
+//
+// A stash entry is a merge-like commit W whose tree is the working
+// directory and whose parents are HEAD, a commit I holding the index and,
+// with --include-untracked, a commit U holding the untracked files:
+//
+//	  .----W
+//	 /    /|
+//	H----I |
+//	      U
+func Stash(args []string) {
+	sub := "push"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		sub, args = args[0], args[1:]
+	}
+
+	// Find repository
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch sub {
+	case "push":
+		stashPush(repo, args, "")
+	case "save":
+		// The old form takes the message as its argument
+		var opts []string
+		var words []string
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "-") && len(words) == 0 {
+				opts = append(opts, arg)
+			} else {
+				words = append(words, arg)
+			}
+		}
+		stashPush(repo, opts, strings.Join(words, " "))
+	case "list":
+		stashList(repo)
+	case "show":
+		stashShow(repo, args)
+	case "apply":
+		stashApply(repo, args, false)
+	case "pop":
+		stashApply(repo, args, true)
+	case "drop":
+		stashDrop(repo, args)
+	case "clear":
+		if err := refs.NewRefManager(repo.GitDir).DeleteRef(stashRef); err != nil {
+			fmt.Printf("error: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Printf("error: unknown subcommand: %s\n", sub)
+		fmt.Println("usage: mygit stash [push [-u] [-k] [-m <message>]]")
+		fmt.Println("   or: mygit stash list")
+		fmt.Println("   or: mygit stash show [-p] [--stat] [-u] [<stash>]")
+		fmt.Println("   or: mygit stash (apply | pop) [--index] [<stash>]")
+		fmt.Println("   or: mygit stash drop [<stash>]")
+		fmt.Println("   or: mygit stash clear")
+		os.Exit(1)
+	}
+}
+
+// stashPush saves the local changes as a new stash entry and resets the
+// working directory and index to HEAD.
+func stashPush(repo *repository.GitRepository, args []string, message string) {
+	includeUntracked := false
+	keepIndex := false
+	quiet := false
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-u" || arg == "--include-untracked":
+			includeUntracked = true
+		case arg == "--no-include-untracked":
+			includeUntracked = false
+		case arg == "-k" || arg == "--keep-index":
+			keepIndex = true
+		case arg == "--no-keep-index":
+			keepIndex = false
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case arg == "-m" || arg == "--message":
+			if i+1 >= len(args) {
+				fmt.Printf("error: %s requires a value\n", arg)
+				os.Exit(1)
+			}
+			i++
+			message = args[i]
+		case strings.HasPrefix(arg, "--message="):
+			message = strings.TrimPrefix(arg, "--message=")
+		default:
+			fmt.Printf("Error: unknown option '%s'\n", arg)
+			os.Exit(1)
+		}
+	}
+
+	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+	idx := index.NewIndex(repo.GitDir)
+	if err := idx.Load(); err != nil {
+		fmt.Printf("Error loading index: %v\n", err)
+		os.Exit(1)
+	}
+
+	head, err := refManager.GetHEAD()
+	if err != nil || head == "" {
+		fmt.Println("You do not have the initial commit yet")
+		os.Exit(1)
+	}
+	headCommit, err := readCommit(objStore, head)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(1)
+	}
+	headEntries, err := utils.GetTreeEntriesRecursive(objStore, headCommit.Tree, "")
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Is there anything to save at all?
+	unstaged, err := utils.GetUnstagedChanges(repo, idx, objStore)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(1)
+	}
+	var untracked []string
+	if includeUntracked {
+		untracked, err = untrackedFiles(repo, idx)
+		if err != nil {
+			fmt.Printf("fatal: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if len(diffEntries(headEntries, idx.GetAll())) == 0 && len(unstaged) == 0 && len(untracked) == 0 {
+		fmt.Println("No local changes to save")
+		return
+	}
+
+	branch, err := refManager.GetCurrentBranch()
+	if err != nil {
+		branch = "(no branch)"
+	}
+	headDesc := fmt.Sprintf("%s: %s %s", branch, head[:7], firstLine(headCommit.Message))
+	author := getAuthor(repo)
+
+	// I: the index, on top of HEAD
+	indexTree, err := objStore.BuildTreeFromIndex(idx.GetAll())
+	if err != nil {
+		fmt.Printf("Error building tree: %v\n", err)
+		os.Exit(1)
+	}
+	indexCommit, err := writeStashCommit(objStore, indexTree, "index on "+headDesc, author, []string{head})
+	if err != nil {
+		fmt.Printf("Error writing commit object: %v\n", err)
+		os.Exit(1)
+	}
+	parents := []string{head, indexCommit}
+
+	// U: the untracked files, in a commit of their own
+	if len(untracked) > 0 {
+		untrackedTree, err := worktreeTree(repo, objStore, nil, untracked)
+		if err != nil {
+			fmt.Printf("Error building tree: %v\n", err)
+			os.Exit(1)
+		}
+		untrackedCommit, err := writeStashCommit(objStore, untrackedTree, "untracked files on "+headDesc, author, nil)
+		if err != nil {
+			fmt.Printf("Error writing commit object: %v\n", err)
+			os.Exit(1)
+		}
+		parents = append(parents, untrackedCommit)
+	}
+
+	// W: the working directory version of every tracked file
+	var tracked []string
+	for path := range idx.GetAll() {
+		tracked = append(tracked, path)
+	}
+	worktreeTreeHash, err := worktreeTree(repo, objStore, idx, tracked)
+	if err != nil {
+		fmt.Printf("Error building tree: %v\n", err)
+		os.Exit(1)
+	}
+	if message == "" {
+		message = "WIP on " + headDesc
+	} else {
+		message = "On " + branch + ": " + message
+	}
+	stashCommit, err := writeStashCommit(objStore, worktreeTreeHash, message, author, parents)
+	if err != nil {
+		fmt.Printf("Error writing commit object: %v\n", err)
+		os.Exit(1)
+	}
+
+	oldStash, _ := refManager.GetRef(stashRef)
+	if err := refManager.SetRef(stashRef, stashCommit); err != nil {
+		fmt.Printf("Error updating %s: %v\n", stashRef, err)
+		os.Exit(1)
+	}
+	if err := refManager.AppendReflog(stashRef, oldStash, stashCommit, author, message); err != nil {
+		fmt.Printf("Error updating %s: %v\n", stashRef, err)
+		os.Exit(1)
+	}
+	if !quiet {
+		fmt.Printf("Saved working directory and index state %s\n", message)
+	}
+
+	// Back to a clean tree. With --keep-index the index is what remains,
+	// both staged and checked out.
+	target := headCommit.Tree
+	if keepIndex {
+		target = indexTree
+	}
+	if _, err := resetToTree(repo, objStore, target, true); err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+	for _, path := range untracked {
+		if err := removeWorkdirFile(repo, path); err != nil {
+			fmt.Printf("error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// writeStashCommit writes one of the commits making up a stash entry.
+func writeStashCommit(objStore *objects.ObjectStore, tree, message, author string, parents []string) (string, error) {
+	commit := objects.NewCommit(tree, message, objects.NewSignature(author, time.Now()), parents)
+	return objStore.WriteObject(commit.Serialize(), objects.CommitType)
+}
+
+// worktreeTree writes a tree holding the working directory version of the
+// given paths; paths missing from disk are left out. Modes of tracked files
+// are taken from idx as core.fileMode and core.symlinks require; idx may be
+// nil for untracked files.
+func worktreeTree(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, paths []string) (string, error) {
+	opts := utils.LoadWorktreeOptions(repo)
+	entries := make(map[string]*index.IndexEntry)
+	for _, path := range paths {
+		content, info, err := utils.ReadWorktreeFile(filepath.Join(repo.WorkDir, path))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		hash, err := objStore.WriteObject(content, objects.BlobType)
+		if err != nil {
+			return "", err
+		}
+
+		var existing *index.IndexEntry
+		if idx != nil {
+			existing, _ = idx.Get(path)
+		}
+		entries[path] = &index.IndexEntry{
+			Path:        path,
+			Hash:        hash,
+			Permissions: utils.WorktreePermissions(info, existing, opts),
+		}
+	}
+	return objStore.BuildTreeFromIndex(entries)
+}
+
+// untrackedFiles lists the files in the working directory that are neither
+// tracked nor ignored.
+func untrackedFiles(repo *repository.GitRepository, idx *index.Index) ([]string, error) {
+	ignore, err := utils.NewIgnore(repo.WorkDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	err = filepath.WalkDir(repo.WorkDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(repo.WorkDir, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if relPath == "." {
+			return nil
+		}
+		if relPath == ".mygit" || ignore.Matches(relPath, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if _, tracked := idx.Get(relPath); !tracked {
+			files = append(files, relPath)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// stashEntry is a stash entry resolved from the command line.
+type stashEntry struct {
+	n      int
+	hash   string
+	commit *objects.Commit
+}
+
+// name returns the stash@{n} name of the entry.
+func (e *stashEntry) name() string {
+	return fmt.Sprintf("stash@{%d}", e.n)
+}
+
+// resolveStash finds the stash entry named by args: nothing (the newest
+// entry), a number n, or stash@{n}.
+func resolveStash(repo *repository.GitRepository, args []string) (*stashEntry, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("too many arguments")
+	}
+
+	n := 0
+	if len(args) == 1 {
+		spec := args[0]
+		if strings.HasPrefix(spec, "stash@{") && strings.HasSuffix(spec, "}") {
+			spec = spec[len("stash@{") : len(spec)-1]
+		}
+		var err error
+		n, err = strconv.Atoi(spec)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s is not a valid reference", args[0])
+		}
+	}
+
+	refManager := refs.NewRefManager(repo.GitDir)
+	entries, err := refManager.ReadReflog(stashRef)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("No stash entries found.")
+	}
+	if n >= len(entries) {
+		return nil, fmt.Errorf("stash@{%d} is not a valid reference", n)
+	}
+
+	hash := entries[n].NewHash
+	commit, err := readCommit(objects.NewObjectStore(repo.GitDir), hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(commit.Parents) < 2 {
+		return nil, fmt.Errorf("'%s' is not a stash-like commit", hash)
+	}
+	return &stashEntry{n: n, hash: hash, commit: commit}, nil
+}
+
+// stashList prints the stash entries, newest first.
+func stashList(repo *repository.GitRepository) {
+	refManager := refs.NewRefManager(repo.GitDir)
+	entries, err := refManager.ReadReflog(stashRef)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+	for i, entry := range entries {
+		fmt.Printf("stash@{%d}: %s\n", i, entry.Message)
+	}
+}
+
+// stashShow prints the changes a stash entry records, against the commit
+// it was made on.
+func stashShow(repo *repository.GitRepository, args []string) {
+	showPatch := false
+	showStat := false
+	includeUntracked := false
+	var rest []string
+	for _, arg := range args {
+		switch arg {
+		case "-p", "--patch":
+			showPatch = true
+		case "--stat":
+			showStat = true
+		case "-u", "--include-untracked":
+			includeUntracked = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				fmt.Printf("Error: unknown option '%s'\n", arg)
+				os.Exit(1)
+			}
+			rest = append(rest, arg)
+		}
+	}
+	if !showPatch {
+		showStat = true
+	}
+
+	entry, err := resolveStash(repo, rest)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+
+	objStore := objects.NewObjectStore(repo.GitDir)
+	base, err := utils.GetTreeEntriesFromCommit(objStore, entry.commit.Parents[0])
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(1)
+	}
+	stashed, err := utils.GetTreeEntriesRecursive(objStore, entry.commit.Tree, "")
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(1)
+	}
+	if includeUntracked && len(entry.commit.Parents) > 2 {
+		untracked, err := utils.GetTreeEntriesFromCommit(objStore, entry.commit.Parents[2])
+		if err != nil {
+			fmt.Printf("fatal: %v\n", err)
+			os.Exit(1)
+		}
+		for path, e := range untracked {
+			stashed[path] = e
+		}
+	}
+
+	changes := diffEntries(base, stashed)
+	if showStat && len(changes) > 0 {
+		stat, err := formatStat(objStore, changes)
+		if err != nil {
+			fmt.Printf("fatal: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(stat)
+	}
+	if showPatch {
+		if showStat && len(changes) > 0 {
+			fmt.Println()
+		}
+		patch, err := formatPatch(objStore, changes)
+		if err != nil {
+			fmt.Printf("fatal: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(patch)
+	}
+}
+
+// stashDrop removes a stash entry.
+func stashDrop(repo *repository.GitRepository, args []string) {
+	for _, arg := range args {
+		if arg != "-q" && arg != "--quiet" && strings.HasPrefix(arg, "-") {
+			fmt.Printf("Error: unknown option '%s'\n", arg)
+			os.Exit(1)
+		}
+	}
+	entry, err := resolveStash(repo, withoutFlags(args))
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := dropStash(repo, entry); err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func dropStash(repo *repository.GitRepository, entry *stashEntry) error {
+	if err := refs.NewRefManager(repo.GitDir).DropReflogEntry(stashRef, entry.n); err != nil {
+		return err
+	}
+	fmt.Printf("Dropped %s (%s)\n", entry.name(), entry.hash)
+	return nil
+}
+
+// withoutFlags returns the arguments that are not options.
+func withoutFlags(args []string) []string {
+	var rest []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			rest = append(rest, arg)
+		}
+	}
+	return rest
+}
+
+// stashApply applies a stash entry to the working directory and, with
+// --index, the index. With pop, the entry is dropped if it applied
+// without conflicts.
+func stashApply(repo *repository.GitRepository, args []string, pop bool) {
+	restoreIndex := false
+	quiet := false
+	for _, arg := range args {
+		switch {
+		case arg == "--index":
+			restoreIndex = true
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case strings.HasPrefix(arg, "-"):
+			fmt.Printf("Error: unknown option '%s'\n", arg)
+			os.Exit(1)
+		}
+	}
+
+	entry, err := resolveStash(repo, withoutFlags(args))
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+
+	conflicts, err := applyStash(repo, entry, restoreIndex)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(conflicts) > 0 {
+		if pop {
+			fmt.Println("The stash entry is kept in case you need it again.")
+		}
+		os.Exit(1)
+	}
+	if !quiet {
+		Status(nil)
+	}
+	if pop {
+		if err := dropStash(repo, entry); err != nil {
+			fmt.Printf("error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// applyStash merges the changes recorded in a stash entry into the working
+// directory: files the stash changed are taken from it when they are
+// unchanged since the stash was made, and merged otherwise. It returns the
+// paths that were left with conflicts.
+func applyStash(repo *repository.GitRepository, entry *stashEntry, restoreIndex bool) ([]string, error) {
+	objStore := objects.NewObjectStore(repo.GitDir)
+	idx := index.NewIndex(repo.GitDir)
+	if err := idx.Load(); err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+
+	base, err := utils.GetTreeEntriesFromCommit(objStore, entry.commit.Parents[0])
+	if err != nil {
+		return nil, err
+	}
+	stashedIndex, err := utils.GetTreeEntriesFromCommit(objStore, entry.commit.Parents[1])
+	if err != nil {
+		return nil, err
+	}
+	stashed, err := utils.GetTreeEntriesRecursive(objStore, entry.commit.Tree, "")
+	if err != nil {
+		return nil, err
+	}
+	untracked := make(map[string]*index.IndexEntry)
+	if len(entry.commit.Parents) > 2 {
+		untracked, err = utils.GetTreeEntriesFromCommit(objStore, entry.commit.Parents[2])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ours := indexSnapshot(idx)
+	unstagedList, err := utils.GetUnstagedChanges(repo, idx, objStore)
+	if err != nil {
+		return nil, err
+	}
+	unstaged := make(map[string]bool)
+	for _, path := range unstagedList {
+		unstaged[path] = true
+	}
+
+	// Check everything before touching anything
+	for path := range untracked {
+		if _, err := os.Lstat(filepath.Join(repo.WorkDir, path)); err == nil {
+			return nil, fmt.Errorf("%s already exists, no checkout\nerror: could not restore untracked files from stash", path)
+		}
+	}
+
+	indexChanges := diffEntries(base, stashedIndex)
+	if restoreIndex {
+		for _, c := range indexChanges {
+			if !sameEntry(ours[c.Path], c.Old) && !sameEntry(ours[c.Path], c.New) {
+				return nil, fmt.Errorf("conflicts in index. Try without --index.")
+			}
+		}
+	}
+
+	changes := diffEntries(base, stashed)
+	var overwritten []string
+	for _, c := range changes {
+		if sameEntry(ours[c.Path], c.New) {
+			continue
+		}
+		_, onDisk := os.Lstat(filepath.Join(repo.WorkDir, c.Path))
+		if unstaged[c.Path] || (ours[c.Path] == nil && onDisk == nil) {
+			overwritten = append(overwritten, c.Path)
+		}
+	}
+	if len(overwritten) > 0 {
+		return nil, fmt.Errorf("Your local changes to the following files would be overwritten by merge:\n\t%s\nPlease commit your changes or stash them before you merge.\nAborting",
+			strings.Join(overwritten, "\n\t"))
+	}
+
+	// Apply the working directory changes
+	var conflicts []string
+	for _, c := range changes {
+		current := ours[c.Path]
+		switch {
+		case sameEntry(current, c.New):
+			// Already as stashed
+		case sameEntry(current, c.Old):
+			if c.New == nil {
+				if err := removeWorkdirFile(repo, c.Path); err != nil {
+					return nil, err
+				}
+			} else if _, err := checkoutBlob(repo, objStore, c.Path, c.New.Hash, c.New.Permissions); err != nil {
+				return nil, err
+			}
+		default:
+			conflicted, err := mergeStashedFile(repo, objStore, c, current)
+			if err != nil {
+				return nil, err
+			}
+			if conflicted {
+				conflicts = append(conflicts, c.Path)
+			}
+		}
+	}
+
+	// Update the index: either restore the stashed index, or only stage
+	// the files the stash added so they do not turn up as untracked.
+	if restoreIndex {
+		for _, c := range indexChanges {
+			if !sameEntry(ours[c.Path], c.Old) {
+				continue
+			}
+			if c.New == nil {
+				idx.Remove(c.Path)
+			} else {
+				idx.Set(c.New)
+			}
+		}
+	} else {
+		for _, c := range changes {
+			if c.Old != nil || c.New == nil || ours[c.Path] != nil {
+				continue
+			}
+			info, err := os.Lstat(filepath.Join(repo.WorkDir, c.Path))
+			if err != nil {
+				return nil, err
+			}
+			idx.AddWithMode(c.Path, c.New.Hash, info, c.New.Permissions)
+		}
+	}
+
+	// Untracked files come back untracked
+	for path, e := range untracked {
+		if _, err := checkoutBlob(repo, objStore, path, e.Hash, e.Permissions); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := idx.Save(); err != nil {
+		return nil, fmt.Errorf("failed to save index: %w", err)
+	}
+	return conflicts, nil
+}
+
+// mergeStashedFile merges the stashed change to a file with the changes
+// made to it since, writing the result (with conflict markers if needed)
+// to the working directory. It reports whether there were conflicts.
+func mergeStashedFile(repo *repository.GitRepository, objStore *objects.ObjectStore, c fileDiff, current *index.IndexEntry) (bool, error) {
+	if current == nil || c.New == nil {
+		// Deleted on one side and modified on the other: keep what exists
+		if current == nil {
+			if _, err := checkoutBlob(repo, objStore, c.Path, c.New.Hash, c.New.Permissions); err != nil {
+				return false, err
+			}
+			fmt.Printf("CONFLICT (modify/delete): %s deleted in Updated upstream and modified in Stashed changes.\n", c.Path)
+		} else {
+			fmt.Printf("CONFLICT (modify/delete): %s deleted in Stashed changes and modified in Updated upstream.\n", c.Path)
+		}
+		return true, nil
+	}
+
+	base, err := blobContent(objStore, c.Old)
+	if err != nil {
+		return false, err
+	}
+	ours, err := blobContent(objStore, current)
+	if err != nil {
+		return false, err
+	}
+	theirs, err := blobContent(objStore, c.New)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Printf("Auto-merging %s\n", c.Path)
+	if diff.IsBinary(base) || diff.IsBinary(ours) || diff.IsBinary(theirs) {
+		fmt.Printf("warning: Cannot merge binary files: %s (Updated upstream vs. Stashed changes)\n", c.Path)
+		fmt.Printf("CONFLICT (content): Merge conflict in %s\n", c.Path)
+		return true, nil
+	}
+
+	merged, conflicted := diff.MergeBytes(base, ours, theirs, "Updated upstream", "Stashed changes")
+	if err := os.WriteFile(filepath.Join(repo.WorkDir, c.Path), merged, 0644); err != nil {
+		return false, err
+	}
+	if conflicted {
+		fmt.Printf("CONFLICT (content): Merge conflict in %s\n", c.Path)
+	}
+	return conflicted, nil
+}
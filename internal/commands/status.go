@@ -9,9 +9,21 @@ import (
 	"mygit/internal/utils"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
 func Status(args []string) {
+	var renames renameOptions
+	for _, arg := range args {
+		if arg == "--no-renames" || arg == "--find-renames" || strings.HasPrefix(arg, "--find-renames=") {
+			if _, err := parseRenameOption(arg, &renames); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+
 	// Find repository
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -34,21 +46,41 @@ func Status(args []string) {
 
 	objStore := objects.NewObjectStore(repo.GitDir)
 	refManager := refs.NewRefManager(repo.GitDir)
+	renames.resolve(repo, "status.renames", "diff.renames")
 
-	// Load .gitignore patterns
+	// Load ignore rules (.gitignore files, info/exclude and core.excludesFile)
 	ignore, err := utils.NewIgnore(repo.WorkDir)
 	if err != nil {
 		fmt.Printf("Error loading .gitignore: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Get current branch name
+	// Get current branch name; a rebase in progress is described instead
 	currentBranch, err := refManager.GetCurrentBranch()
-	if err != nil || currentBranch == "" {
+	if lines := rebaseStatusLines(repo, len(idx.Conflicts()) > 0); lines != nil {
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+		fmt.Println()
+	} else if head, _ := refManager.GetHEAD(); err != nil && len(head) > abbrevLength {
+		fmt.Printf("HEAD detached at %s\n", head[:abbrevLength])
+	} else if err != nil || currentBranch == "" {
 		fmt.Println("On branch main") // Default fallback
 	} else {
 		fmt.Printf("On branch %s\n", currentBranch)
 	}
+	if lines := bisectStatusLines(repo); lines != nil {
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+		fmt.Println()
+	}
+	if lines := pickStatusLines(repo, len(idx.Conflicts()) > 0); lines != nil {
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+		fmt.Println()
+	}
 
 	// Get HEAD commit and its tree
 	headCommitHash, err := refManager.GetHEAD()
@@ -67,23 +99,40 @@ func Status(args []string) {
 	}
 
 	indexEntries := idx.GetAll()
+	conflicts := idx.Conflicts()
 
-	// Find staged changes (index vs HEAD)
-	stagedFiles := make([]string, 0)
-	for path, indexEntry := range indexEntries {
-		if headEntry, exists := headTreeEntries[path]; !exists {
-			// New file
-			stagedFiles = append(stagedFiles, fmt.Sprintf("new file:   %s", path))
-		} else if indexEntry.Hash != headEntry.Hash {
-			// Modified file
-			stagedFiles = append(stagedFiles, fmt.Sprintf("modified:   %s", path))
+	// Find staged changes (index vs HEAD), pairing up renames
+	headEntries, stagedEntries := make(map[string]*index.IndexEntry), make(map[string]*index.IndexEntry)
+	for path, entry := range headTreeEntries {
+		if _, unmerged := conflicts[path]; !unmerged {
+			headEntries[path] = entry
 		}
 	}
-
-	// Check for deleted files (in HEAD but not in index)
-	for path := range headTreeEntries {
-		if _, exists := indexEntries[path]; !exists {
-			stagedFiles = append(stagedFiles, fmt.Sprintf("deleted:    %s", path))
+	for path, entry := range indexEntries {
+		if _, unmerged := conflicts[path]; !unmerged {
+			stagedEntries[path] = entry
+		}
+	}
+	changes, err := diffWithRenames(objStore, headEntries, stagedEntries, renames)
+	if err != nil {
+		fmt.Printf("Error detecting renames: %v\n", err)
+		os.Exit(1)
+	}
+	stagedFiles := make([]string, 0, len(changes))
+	for _, change := range changes {
+		switch letter := change.statusLetter(); {
+		case change.OldPath != "" && change.Copy:
+			stagedFiles = append(stagedFiles, fmt.Sprintf("copied:     %s -> %s", change.OldPath, change.Path))
+		case change.OldPath != "":
+			stagedFiles = append(stagedFiles, fmt.Sprintf("renamed:    %s -> %s", change.OldPath, change.Path))
+		case letter == "A":
+			stagedFiles = append(stagedFiles, fmt.Sprintf("new file:   %s", change.Path))
+		case letter == "D":
+			stagedFiles = append(stagedFiles, fmt.Sprintf("deleted:    %s", change.Path))
+		case letter == "T":
+			stagedFiles = append(stagedFiles, fmt.Sprintf("typechange: %s", change.Path))
+		default:
+			stagedFiles = append(stagedFiles, fmt.Sprintf("modified:   %s", change.Path))
 		}
 	}
 
@@ -97,19 +146,44 @@ func Status(args []string) {
 		fmt.Println()
 	}
 
+	if len(conflicts) > 0 {
+		unmerged := make([]string, 0, len(conflicts))
+		for path := range conflicts {
+			unmerged = append(unmerged, path)
+		}
+		sort.Strings(unmerged)
+		fmt.Println("Unmerged paths:")
+		fmt.Println("  (use \"mygit add <file>...\" to mark resolution)")
+		fmt.Println()
+		for _, path := range unmerged {
+			fmt.Printf("        %-17s%s\n", conflicts[path]+":", path)
+		}
+		fmt.Println()
+	}
+
 	// Check for modified files (working directory vs index)
-	modifiedFiles, err := utils.GetUnstagedChanges(repo, idx, objStore)
+	unstaged, err := utils.GetUnstagedChanges(repo, idx, objStore)
 	if err != nil {
 		fmt.Printf("Error checking for unstaged changes: %v\n", err)
 	}
+	modifiedFiles := make([]string, 0, len(unstaged))
+	for _, path := range unstaged {
+		if _, unmerged := conflicts[path]; !unmerged {
+			modifiedFiles = append(modifiedFiles, path)
+		}
+	}
 
 	if len(modifiedFiles) > 0 {
 		fmt.Println("Changes not staged for commit:")
-		fmt.Println("  (use \"mygit add <file>...\" to update what will be committed)")
+		fmt.Println("  (use \"mygit add/rm <file>...\" to update what will be committed)")
 		fmt.Println("  (use \"mygit checkout -- <file>...\" to discard changes in working directory)")
 		fmt.Println()
-		for _, fileStatus := range modifiedFiles {
-			fmt.Printf("        modified:   %s\n", fileStatus)
+		for _, path := range modifiedFiles {
+			if utils.PathExists(filepath.Join(repo.WorkDir, path)) {
+				fmt.Printf("        modified:   %s\n", path)
+			} else {
+				fmt.Printf("        deleted:    %s\n", path)
+			}
 		}
 		fmt.Println()
 	}
@@ -127,7 +201,7 @@ func Status(args []string) {
 		}
 		relPath = filepath.ToSlash(relPath)
 
-		if ignore.IsIgnored(relPath) {
+		if relPath != "." && ignore.Matches(relPath, info.IsDir()) {
 			if info.IsDir() {
 				return filepath.SkipDir
 			}
@@ -143,7 +217,9 @@ func Status(args []string) {
 		_, trackedInIndex := indexEntries[relPath]
 		_, trackedInHead := headTreeEntries[relPath]
 
-		if !trackedInIndex && !trackedInHead {
+		_, unmerged := conflicts[relPath]
+
+		if !trackedInIndex && !trackedInHead && !unmerged {
 			untrackedFiles = append(untrackedFiles, relPath)
 		}
 
@@ -164,7 +240,7 @@ func Status(args []string) {
 		fmt.Println()
 	}
 
-	if len(stagedFiles) == 0 && len(modifiedFiles) == 0 && len(untrackedFiles) == 0 {
+	if len(stagedFiles) == 0 && len(conflicts) == 0 && len(modifiedFiles) == 0 && len(untrackedFiles) == 0 {
 		fmt.Println("nothing to commit, working tree clean")
 	}
 }
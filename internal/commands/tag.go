@@ -0,0 +1,353 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// tagOptions holds the flags of the tag command.
+type tagOptions struct {
+	annotate   bool     // -a: make an annotated tag
+	messages   []string // -m, each one a paragraph
+	file       string   // -F, "-" for standard input
+	sign       bool     // -s or -u: make a signed tag
+	noSign     bool     // --no-sign: override tag.gpgSign
+	signingKey string   // -u <key>, overriding user.signingKey
+	force      bool     // -f: replace an existing tag
+}
+
+// Tag lists, creates, deletes and verifies tags.
+func Tag(args []string) {
+	opts := tagOptions{}
+	mode := "create"
+	var rest []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() string {
+			if i+1 >= len(args) {
+				fmt.Printf("error: switch '%s' requires a value\n", arg)
+				os.Exit(1)
+			}
+			i++
+			return args[i]
+		}
+
+		switch {
+		case arg == "-l" || arg == "--list":
+			mode = "list"
+		case arg == "-d" || arg == "--delete":
+			mode = "delete"
+		case arg == "-v" || arg == "--verify":
+			mode = "verify"
+		case arg == "-a" || arg == "--annotate":
+			opts.annotate = true
+		case arg == "-m" || arg == "--message":
+			opts.messages = append(opts.messages, value())
+		case strings.HasPrefix(arg, "--message="):
+			opts.messages = append(opts.messages, strings.TrimPrefix(arg, "--message="))
+		case arg == "-F" || arg == "--file":
+			opts.file = value()
+		case strings.HasPrefix(arg, "--file="):
+			opts.file = strings.TrimPrefix(arg, "--file=")
+		case arg == "-s" || arg == "--sign":
+			opts.sign, opts.noSign = true, false
+		case arg == "-u" || arg == "--local-user":
+			opts.sign, opts.noSign, opts.signingKey = true, false, value()
+		case strings.HasPrefix(arg, "--local-user="):
+			opts.sign, opts.noSign, opts.signingKey = true, false, strings.TrimPrefix(arg, "--local-user=")
+		case arg == "--no-sign":
+			opts.sign, opts.noSign = false, true
+		case arg == "-f" || arg == "--force":
+			opts.force = true
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			fmt.Printf("Error: unknown option '%s'\n", arg)
+			os.Exit(1)
+		default:
+			rest = append(rest, arg)
+		}
+	}
+
+	if len(opts.messages) > 0 && opts.file != "" {
+		fmt.Println("fatal: options '-m' and '-F' cannot be used together")
+		os.Exit(1)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(1)
+	}
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if mode == "create" && len(rest) == 0 {
+		mode = "list"
+	}
+
+	switch mode {
+	case "list":
+		if err := listTags(repo, rest); err != nil {
+			fmt.Printf("Error listing tags: %v\n", err)
+			os.Exit(1)
+		}
+	case "delete":
+		deleteTags(repo, rest)
+	case "verify":
+		verifyTags(repo, rest, true)
+	default:
+		if len(rest) > 2 {
+			fmt.Println("fatal: too many arguments")
+			os.Exit(1)
+		}
+		target := "HEAD"
+		if len(rest) == 2 {
+			target = rest[1]
+		}
+		createTag(repo, rest[0], target, opts)
+	}
+}
+
+// listTags prints the names of all tags, or of those matching one of the
+// given glob patterns, in sorted order.
+func listTags(repo *repository.GitRepository, patterns []string) error {
+	names, err := tagNames(repo)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if len(patterns) > 0 && !matchesAny(name, patterns) {
+			continue
+		}
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// tagNames returns the names of all tags, sorted.
+func tagNames(repo *repository.GitRepository) ([]string, error) {
+	tags, err := refs.NewRefManager(repo.GitDir).ListRefs("refs/tags/")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = strings.TrimPrefix(tag.Name, "refs/tags/")
+	}
+	return names, nil
+}
+
+// matchesAny reports whether name matches one of the glob patterns.
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// createTag creates a lightweight tag, or an annotated (and possibly
+// signed) tag object, named name and pointing at target.
+func createTag(repo *repository.GitRepository, name, target string, opts tagOptions) {
+	if refs.CheckRefName(name) != nil {
+		fmt.Printf("fatal: '%s' is not a valid tag name.\n", name)
+		os.Exit(1)
+	}
+
+	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+
+	refPath := "refs/tags/" + name
+	existing, err := refManager.GetRef(refPath)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(1)
+	}
+	if existing != "" && !opts.force {
+		fmt.Printf("fatal: tag '%s' already exists\n", name)
+		os.Exit(1)
+	}
+
+	hash, err := resolveRevision(objStore, refManager, target)
+	if err != nil {
+		fmt.Printf("fatal: Failed to resolve '%s' as a valid ref.\n", target)
+		os.Exit(1)
+	}
+
+	sign := opts.sign || (!opts.noSign && signByDefault(repo, "tag.gpgSign"))
+	annotated := opts.annotate || sign || len(opts.messages) > 0 || opts.file != ""
+	if annotated {
+		obj, err := objStore.ReadObject(hash)
+		if err != nil {
+			fmt.Printf("fatal: %v\n", err)
+			os.Exit(1)
+		}
+
+		message, err := tagMessage(repo, name, opts)
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+			os.Exit(1)
+		}
+
+		tagger := objects.NewSignature(getAuthor(repo), time.Now())
+		tag := objects.NewTag(hash, obj.Type, name, message, tagger)
+		if sign {
+			if err := signTag(repo, tag, opts.signingKey); err != nil {
+				fmt.Printf("error: %v\nerror: unable to sign the tag\n", err)
+				os.Exit(1)
+			}
+		}
+		hash, err = objStore.WriteObject(tag.Serialize(), objects.TagType)
+		if err != nil {
+			fmt.Printf("Error writing tag object: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := refManager.SetRef(refPath, hash); err != nil {
+		fmt.Printf("Error creating tag '%s': %v\n", name, err)
+		os.Exit(1)
+	}
+	if existing != "" && existing != hash {
+		fmt.Printf("Updated tag '%s' (was %s)\n", name, existing[:7])
+	}
+}
+
+// tagMessage returns the cleaned-up message for an annotated tag, taken
+// from -m, -F or the user's editor.
+func tagMessage(repo *repository.GitRepository, name string, opts tagOptions) (string, error) {
+	if len(opts.messages) > 0 {
+		return cleanupMessage(strings.Join(opts.messages, "\n\n"), false), nil
+	}
+
+	if opts.file != "" {
+		var content []byte
+		var err error
+		if opts.file == "-" {
+			content, err = io.ReadAll(os.Stdin)
+		} else {
+			content, err = os.ReadFile(opts.file)
+		}
+		if err != nil {
+			return "", fmt.Errorf("could not read '%s': %w", opts.file, err)
+		}
+		return cleanupMessage(string(content), false), nil
+	}
+
+	template := fmt.Sprintf("\n#\n# Write a message for tag:\n#   %s\n# Lines starting with '#' will be ignored.\n", name)
+	editPath := filepath.Join(repo.GitDir, "TAG_EDITMSG")
+	if err := os.WriteFile(editPath, []byte(template), 0644); err != nil {
+		return "", err
+	}
+	if err := launchEditor(repo, editPath); err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(editPath)
+	if err != nil {
+		return "", err
+	}
+	message := cleanupMessage(string(content), true)
+	if message == "" {
+		return "", fmt.Errorf("no tag message?")
+	}
+	return message, nil
+}
+
+// deleteTags removes the named tags.
+func deleteTags(repo *repository.GitRepository, names []string) {
+	refManager := refs.NewRefManager(repo.GitDir)
+	failed := false
+	for _, name := range names {
+		if refs.CheckRefName(name) != nil {
+			fmt.Printf("error: '%s' is not a valid tag name.\n", name)
+			failed = true
+			continue
+		}
+		refPath := "refs/tags/" + name
+		hash, err := refManager.GetRef(refPath)
+		if err != nil || hash == "" {
+			fmt.Printf("error: tag '%s' not found.\n", name)
+			failed = true
+			continue
+		}
+		if err := refManager.DeleteRef(refPath); err != nil {
+			fmt.Printf("error: %v\n", err)
+			failed = true
+			continue
+		}
+		fmt.Printf("Deleted tag '%s' (was %s)\n", name, hash[:7])
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// verifyTags checks the signatures of the named tags, exiting with an
+// error if any of them is unsigned or has a bad signature. With verbose,
+// each tag is printed before its verification result.
+func verifyTags(repo *repository.GitRepository, names []string, verbose bool) {
+	if len(names) == 0 {
+		fmt.Println("usage: mygit tag -v <tagname>...")
+		os.Exit(1)
+	}
+
+	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+	failed := false
+	for _, name := range names {
+		hash, err := resolveRevision(objStore, refManager, name)
+		if err != nil {
+			fmt.Printf("error: tag '%s' not found.\n", name)
+			failed = true
+			continue
+		}
+		if !verifyTagObject(repo, objStore, name, hash, verbose) {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// verifyTagObject checks the signature of the tag object with the given
+// hash and reports the result.
+func verifyTagObject(repo *repository.GitRepository, objStore *objects.ObjectStore, name, hash string, verbose bool) bool {
+	obj, err := objStore.ReadObject(hash)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return false
+	}
+	if obj.Type != objects.TagType {
+		fmt.Printf("error: %s: cannot verify a non-tag object of type %s.\n", name, obj.Type)
+		return false
+	}
+	tag, err := objects.ParseTag(obj.Content)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return false
+	}
+
+	if verbose {
+		fmt.Print(string(tag.Payload()))
+	}
+	result, err := verifyTag(repo, tag)
+	if err != nil {
+		fmt.Printf("error: %s: %v\n", name, err)
+		return false
+	}
+	fmt.Println(result.Output)
+	return result.Good
+}
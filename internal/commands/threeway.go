@@ -0,0 +1,294 @@
+package commands
+
+import (
+	"fmt"
+	"mygit/internal/diff"
+	"mygit/internal/index"
+	"mygit/internal/objects"
+	"mygit/internal/repository"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// mergeTrees applies the changes from base to theirs on top of ours, the
+// tree the index and working directory hold, as rebase and cherry-pick do.
+// Paths only one side changed take that side's version; paths both sides
+// changed are merged line by line. A path that cannot be merged is left in
+// the working directory with conflict markers (or as the side that still
+// has it) and marked unmerged in the index. A file one side renamed gets
+// the other side's changes under its new name (see followRenames). It
+// returns the unmerged paths. Nothing is modified if an untracked file is
+// in the way.
+func mergeTrees(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, base, ours, theirs map[string]*index.IndexEntry, oursLabel, theirsLabel string) ([]string, error) {
+	tracked := ours
+	renames := configRenames(repo, "merge.renames", "diff.renames")
+	renames.copies = false
+	base, ours, theirs, renamedAway, err := followRenames(objStore, base, ours, theirs, renames)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]bool)
+	for _, tree := range []map[string]*index.IndexEntry{base, ours, theirs} {
+		for path := range tree {
+			paths[path] = true
+		}
+	}
+	var changed []string
+	for path := range paths {
+		// A file moved to a new name on our side has to be written there
+		moved := tracked[path] == nil && ours[path] != nil
+		if moved || !sameBlob(base[path], theirs[path]) && !sameBlob(ours[path], theirs[path]) {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+
+	// A file that only their side has must not overwrite an untracked one
+	var inTheWay []string
+	for _, path := range changed {
+		if tracked[path] == nil && theirs[path] != nil {
+			if _, err := os.Lstat(filepath.Join(repo.WorkDir, path)); err == nil {
+				inTheWay = append(inTheWay, path)
+			}
+		}
+	}
+	if len(inTheWay) > 0 {
+		return nil, fmt.Errorf("The following untracked working tree files would be overwritten by merge:\n\t%s\nPlease move or remove them before you merge.\nAborting",
+			strings.Join(inTheWay, "\n\t"))
+	}
+
+	// Their renames take our version of a file away from its old name
+	for _, path := range renamedAway {
+		idx.Remove(path)
+		if err := removeWorkdirFile(repo, path); err != nil {
+			return nil, err
+		}
+	}
+
+	var conflicts []string
+	for _, path := range changed {
+		b, o, t := base[path], ours[path], theirs[path]
+		switch {
+		case sameBlob(b, o):
+			// Only their side changed the path
+			if t == nil {
+				idx.Remove(path)
+				if err := removeWorkdirFile(repo, path); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			info, err := checkoutBlob(repo, objStore, path, t.Hash, t.Permissions)
+			if err != nil {
+				return nil, err
+			}
+			idx.AddWithMode(path, t.Hash, info, t.Permissions)
+		case sameBlob(b, t):
+			// Their side only renamed the file: our version moves with it
+			info, err := checkoutBlob(repo, objStore, path, o.Hash, o.Permissions)
+			if err != nil {
+				return nil, err
+			}
+			idx.AddWithMode(path, o.Hash, info, o.Permissions)
+		case o == nil || t == nil:
+			if err := modifyDeleteConflict(repo, objStore, idx, path, t, oursLabel, theirsLabel); err != nil {
+				return nil, err
+			}
+			conflicts = append(conflicts, path)
+		default:
+			conflicted, err := mergeFile(repo, objStore, idx, path, b, o, t, oursLabel, theirsLabel)
+			if err != nil {
+				return nil, err
+			}
+			if conflicted {
+				conflicts = append(conflicts, path)
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+// followRenames lines up files one side renamed with the other side's
+// version: the base and other side's entries of a renamed file are moved
+// to its new name, where the usual merge then combines the two sides'
+// changes. A file both sides renamed alike only has its base moved; one
+// renamed differently on each side, or renamed onto a name already in
+// use, is left alone. It returns the moved entries, and the old names of
+// files their side renamed that our side still has.
+func followRenames(objStore *objects.ObjectStore, base, ours, theirs map[string]*index.IndexEntry, opts renameOptions) (map[string]*index.IndexEntry, map[string]*index.IndexEntry, map[string]*index.IndexEntry, []string, error) {
+	oursRenames, err := renamesBetween(objStore, base, ours, opts)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	theirsRenames, err := renamesBetween(objStore, base, theirs, opts)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if len(oursRenames) == 0 && len(theirsRenames) == 0 {
+		return base, ours, theirs, nil, nil
+	}
+
+	copyTree := func(tree map[string]*index.IndexEntry) map[string]*index.IndexEntry {
+		c := make(map[string]*index.IndexEntry, len(tree))
+		for path, entry := range tree {
+			c[path] = entry
+		}
+		return c
+	}
+	base, ours, theirs = copyTree(base), copyTree(ours), copyTree(theirs)
+	move := func(tree map[string]*index.IndexEntry, from, to string) {
+		tree[to] = tree[from]
+		delete(tree, from)
+	}
+
+	var renamedAway []string
+	for _, old := range sortedKeys(theirsRenames) {
+		renamed := theirsRenames[old]
+		if ourName, ok := oursRenames[old]; ok {
+			if ourName == renamed {
+				move(base, old, renamed)
+			}
+			continue
+		}
+		if ours[old] == nil || ours[renamed] != nil || base[renamed] != nil {
+			continue
+		}
+		move(base, old, renamed)
+		move(ours, old, renamed)
+		renamedAway = append(renamedAway, old)
+	}
+	for _, old := range sortedKeys(oursRenames) {
+		renamed := oursRenames[old]
+		if _, ok := theirsRenames[old]; ok || theirs[old] == nil || theirs[renamed] != nil || base[renamed] != nil {
+			continue
+		}
+		move(base, old, renamed)
+		move(theirs, old, renamed)
+	}
+	return base, ours, theirs, renamedAway, nil
+}
+
+// renamesBetween returns the files renamed from base to side, from old
+// name to new.
+func renamesBetween(objStore *objects.ObjectStore, base, side map[string]*index.IndexEntry, opts renameOptions) (map[string]string, error) {
+	changes, err := diffWithRenames(objStore, base, side, opts)
+	if err != nil {
+		return nil, err
+	}
+	renames := make(map[string]string)
+	for _, c := range changes {
+		if c.OldPath != "" && !c.Copy {
+			renames[c.OldPath] = c.Path
+		}
+	}
+	return renames, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// modifyDeleteConflict handles a path one side deleted and the other
+// changed: the changed version is left in the working directory, and the
+// path is unmerged until it is added or removed.
+func modifyDeleteConflict(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, path string, theirs *index.IndexEntry, oursLabel, theirsLabel string) error {
+	if theirs == nil {
+		printModifyDelete(path, theirsLabel, oursLabel)
+		idx.SetConflict(path, index.DeletedByThem)
+		return nil
+	}
+
+	printModifyDelete(path, oursLabel, theirsLabel)
+	if _, err := checkoutBlob(repo, objStore, path, theirs.Hash, theirs.Permissions); err != nil {
+		return err
+	}
+	idx.SetConflict(path, index.DeletedByUs)
+	return nil
+}
+
+// printModifyDelete reports a path deleted on one side and modified on
+// the other, whose modified version is left in the working directory.
+func printModifyDelete(path, deletedIn, modifiedIn string) {
+	fmt.Printf("CONFLICT (modify/delete): %s deleted in %s and modified in %s.  Version %s of %s left in tree.\n",
+		path, deletedIn, modifiedIn, modifiedIn, path)
+}
+
+// mergeFile merges the two sides' changes to a file. A clean result is
+// written and staged; a conflicted one is written with conflict markers
+// and the path marked unmerged. It reports whether there were conflicts.
+func mergeFile(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, path string, base, ours, theirs *index.IndexEntry, oursLabel, theirsLabel string) (bool, error) {
+	kind, what := index.BothModified, "content"
+	if base == nil {
+		kind, what = index.BothAdded, "add/add"
+	}
+
+	// The mode merges like content: a change on one side wins
+	perm := ours.Permissions
+	if base != nil && objects.ModeFromPermissions(ours.Permissions) == objects.ModeFromPermissions(base.Permissions) {
+		perm = theirs.Permissions
+	}
+
+	baseContent, err := blobContent(objStore, base)
+	if err != nil {
+		return false, err
+	}
+	oursContent, err := blobContent(objStore, ours)
+	if err != nil {
+		return false, err
+	}
+	theirsContent, err := blobContent(objStore, theirs)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Printf("Auto-merging %s\n", path)
+	symlink := (ours.Permissions|theirs.Permissions)&os.ModeSymlink != 0
+	if symlink || diff.IsBinary(baseContent) || diff.IsBinary(oursContent) || diff.IsBinary(theirsContent) {
+		// Our version stays in place
+		if !symlink {
+			fmt.Printf("warning: Cannot merge binary files: %s (%s vs. %s)\n", path, oursLabel, theirsLabel)
+		}
+		fmt.Printf("CONFLICT (%s): Merge conflict in %s\n", what, path)
+		idx.SetConflict(path, kind)
+		return true, nil
+	}
+
+	merged, conflicted := diff.MergeBytes(baseContent, oursContent, theirsContent, oursLabel, theirsLabel)
+	if conflicted {
+		// The conflicted file is not worth an object; it only goes to disk
+		if err := os.WriteFile(filepath.Join(repo.WorkDir, path), merged, 0644); err != nil {
+			return false, err
+		}
+		fmt.Printf("CONFLICT (%s): Merge conflict in %s\n", what, path)
+		idx.SetConflict(path, kind)
+		return true, nil
+	}
+
+	hash, err := objStore.WriteObject(merged, objects.BlobType)
+	if err != nil {
+		return false, err
+	}
+	info, err := checkoutBlob(repo, objStore, path, hash, perm)
+	if err != nil {
+		return false, err
+	}
+	idx.AddWithMode(path, hash, info, perm)
+	return false, nil
+}
+
+// sameBlob reports whether two tree entries have the same content and
+// mode, or are both absent.
+func sameBlob(a, b *index.IndexEntry) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Hash == b.Hash && objects.ModeFromPermissions(a.Permissions) == objects.ModeFromPermissions(b.Permissions)
+}
@@ -0,0 +1,214 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"mygit/internal/index"
+	"mygit/internal/objects"
+	"mygit/internal/repository"
+	"mygit/internal/utils"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// updateIndexOptions holds the options of update-index that apply to the
+// paths after them.
+type updateIndexOptions struct {
+	add         bool
+	remove      bool
+	forceRemove bool
+	chmod       string // "+x" or "-x"
+}
+
+// UpdateIndex handles the `update-index` command, which changes index
+// entries directly:
+//
+//	mygit update-index [--add] [--remove] [--force-remove] [--chmod=(+|-)x] [--cacheinfo <mode>,<object>,<path>] [--index-info] [--] [<file>...]
+//
+// Each file is registered with its content from the working directory. As
+// in Git, options apply to the files that follow them, and a file not yet
+// in the index is only added with --add.
+func UpdateIndex(args []string) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(128)
+	}
+
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	idx := index.NewIndex(repo.GitDir)
+	if err := idx.Load(); err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	objStore := objects.NewObjectStore(repo.GitDir)
+
+	fail := func(err error) {
+		fmt.Println(err)
+		os.Exit(128)
+	}
+
+	var opts updateIndexOptions
+	onlyPaths := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if onlyPaths || !strings.HasPrefix(arg, "-") {
+			p, err := normalizePathspecs(repo, []string{arg})
+			if err != nil {
+				fail(fmt.Errorf("fatal: %v", err))
+			}
+			if err := updateIndexPath(repo, objStore, idx, p[0], opts); err != nil {
+				fail(err)
+			}
+			continue
+		}
+
+		switch {
+		case arg == "--":
+			onlyPaths = true
+		case arg == "--add":
+			opts.add = true
+		case arg == "--remove":
+			opts.remove = true
+		case arg == "--force-remove":
+			opts.forceRemove = true
+		case arg == "--chmod=+x" || arg == "--chmod=-x":
+			opts.chmod = strings.TrimPrefix(arg, "--chmod=")
+		case arg == "--cacheinfo":
+			// Either "<mode>,<object>,<path>" or three separate arguments
+			var fields []string
+			if i+1 < len(args) && strings.Count(args[i+1], ",") >= 2 {
+				fields = strings.SplitN(args[i+1], ",", 3)
+				i++
+			} else if i+3 < len(args) {
+				fields = args[i+1 : i+4]
+				i += 3
+			} else {
+				fmt.Println("error: option 'cacheinfo' expects <mode>,<sha1>,<path>")
+				os.Exit(129)
+			}
+			if err := updateIndexCacheInfo(idx, fields[0], fields[1], fields[2], opts.add); err != nil {
+				fail(err)
+			}
+		case arg == "--index-info":
+			if err := updateIndexInfo(idx); err != nil {
+				fail(err)
+			}
+		default:
+			fmt.Printf("error: unknown option '%s'\n", strings.TrimLeft(arg, "-"))
+			os.Exit(129)
+		}
+	}
+
+	if err := idx.Save(); err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+}
+
+// updateIndexPath updates the index entry of a path from the working
+// directory, or removes it if allowed.
+func updateIndexPath(repo *repository.GitRepository, objStore *objects.ObjectStore, idx *index.Index, p string, opts updateIndexOptions) error {
+	if opts.forceRemove {
+		idx.Remove(p)
+		return nil
+	}
+
+	existing, tracked := idx.Get(p)
+	content, info, err := utils.ReadWorktreeFile(filepath.Join(repo.WorkDir, p))
+	switch {
+	case os.IsNotExist(err) && opts.remove:
+		idx.Remove(p)
+		return nil
+	case os.IsNotExist(err):
+		return fmt.Errorf("error: %s: does not exist and --remove not passed\nfatal: Unable to process path %s", p, p)
+	case err != nil:
+		return fmt.Errorf("error: %s: %v\nfatal: Unable to process path %s", p, err, p)
+	case info.IsDir():
+		return fmt.Errorf("error: %s: is a directory - add files inside instead\nfatal: Unable to process path %s", p, p)
+	case !tracked && !opts.add:
+		return fmt.Errorf("error: %s: cannot add to the index - missing --add option?\nfatal: Unable to process path %s", p, p)
+	}
+
+	hash, err := objStore.WriteObject(content, objects.BlobType)
+	if err != nil {
+		return fmt.Errorf("fatal: %v", err)
+	}
+	perm := utils.WorktreePermissions(info, existing, utils.LoadWorktreeOptions(repo))
+	idx.AddWithMode(p, hash, info, chmodPermissions(perm, opts.chmod))
+	return nil
+}
+
+// updateIndexCacheInfo sets an index entry to an object that need not be
+// in the working directory. The entry gets no file size or time, so the
+// working directory file is always rechecked against it.
+func updateIndexCacheInfo(idx *index.Index, mode, hash, p string, add bool) error {
+	switch mode {
+	case objects.ModeFile, objects.ModeExecutable, objects.ModeSymlink:
+	default:
+		return fmt.Errorf("fatal: --cacheinfo cannot add %s", p)
+	}
+	if len(hash) != 40 || strings.Trim(hash, "0123456789abcdef") != "" {
+		return fmt.Errorf("fatal: --cacheinfo cannot add %s", p)
+	}
+	if _, tracked := idx.Get(p); !tracked && !add {
+		return fmt.Errorf("error: %s: cannot add to the index - missing --add option?\nfatal: --cacheinfo cannot add %s", p, p)
+	}
+	idx.Set(&index.IndexEntry{
+		Path:        p,
+		Hash:        hash,
+		ModTime:     time.Unix(0, 0),
+		Permissions: objects.PermissionsFromMode(mode),
+	})
+	return nil
+}
+
+// updateIndexInfo reads index entries from standard input in the format
+// ls-files --stage prints, "<mode> <object> <stage>\t<path>", or the
+// format of ls-tree, "<mode> <type> <object>\t<path>". A mode of 0 removes
+// the path.
+func updateIndexInfo(idx *index.Index) error {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := scanner.Text()
+		meta, p, ok := strings.Cut(line, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) < 2 || len(fields) > 3 {
+			return fmt.Errorf("fatal: malformed index info %s", line)
+		}
+		hash := fields[1]
+		if len(fields) == 3 && len(fields[1]) != 40 {
+			// ls-tree puts the type before the object
+			hash = fields[2]
+		}
+		if fields[0] == "0" {
+			idx.Remove(p)
+			continue
+		}
+		if err := updateIndexCacheInfo(idx, fields[0], hash, p, true); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// chmodPermissions applies a --chmod value to index permissions.
+func chmodPermissions(perm os.FileMode, chmod string) os.FileMode {
+	if perm&os.ModeSymlink != 0 {
+		return perm
+	}
+	switch chmod {
+	case "+x":
+		return perm | 0111
+	case "-x":
+		return perm &^ 0111
+	}
+	return perm
+}
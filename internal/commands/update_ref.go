@@ -0,0 +1,347 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// refChange is one change update-ref makes to a ref. With haveOld set the
+// ref must currently point at oldHash, where an empty oldHash means that
+// it must not exist.
+type refChange struct {
+	ref     string
+	newHash string
+	oldHash string
+	haveOld bool
+	delete  bool
+	verify  bool // only check the old value
+	noDeref bool
+}
+
+// UpdateRef handles the `update-ref` command, which safely points a ref at
+// an object or deletes it:
+//
+//	mygit update-ref [-m <reason>] [--no-deref] <ref> <new-value> [<old-value>]
+//	mygit update-ref [-m <reason>] [--no-deref] -d <ref> [<old-value>]
+//	mygit update-ref [-m <reason>] [--no-deref] --stdin [-z]
+//
+// When an old value is given the ref is only changed if it still has that
+// value. With --stdin, update, create, delete and verify commands are read
+// from standard input and are applied together only if all of them check
+// out. Updates are recorded in the reflog with the reason.
+func UpdateRef(args []string) {
+	message := ""
+	deleteRef, noDeref, fromStdin, nulTerminated := false, false, false, false
+	var positional []string
+
+	usage := func() {
+		fmt.Println("usage: mygit update-ref [<options>] -d <refname> [<old-val>]")
+		fmt.Println("   or: mygit update-ref [<options>]    <refname> <new-val> [<old-val>]")
+		fmt.Println("   or: mygit update-ref [<options>] --stdin [-z]")
+		os.Exit(129)
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-m":
+			if i+1 >= len(args) {
+				usage()
+			}
+			i++
+			message = args[i]
+		case arg == "-d":
+			deleteRef = true
+		case arg == "--no-deref":
+			noDeref = true
+		case arg == "--stdin":
+			fromStdin = true
+		case arg == "-z":
+			nulTerminated = true
+		case arg == "--":
+			positional = append(positional, args[i+1:]...)
+			i = len(args)
+		case strings.HasPrefix(arg, "-"):
+			usage()
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(128)
+	}
+
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+
+	var updates []refChange
+	switch {
+	case fromStdin:
+		if deleteRef || len(positional) > 0 {
+			usage()
+		}
+		updates, err = readRefChanges(objStore, refManager, nulTerminated, noDeref)
+	case deleteRef:
+		if len(positional) < 1 || len(positional) > 2 {
+			usage()
+		}
+		u := refChange{ref: positional[0], delete: true, noDeref: noDeref}
+		if len(positional) == 2 {
+			u.haveOld = true
+			u.oldHash, err = resolveRefValue(objStore, refManager, positional[1])
+		}
+		updates = []refChange{u}
+	default:
+		if len(positional) < 2 || len(positional) > 3 || nulTerminated {
+			usage()
+		}
+		u := refChange{ref: positional[0], noDeref: noDeref}
+		u.newHash, err = resolveRefValue(objStore, refManager, positional[1])
+		if err == nil && len(positional) == 3 {
+			u.haveOld = true
+			u.oldHash, err = resolveRefValue(objStore, refManager, positional[2])
+		}
+		updates = []refChange{u}
+	}
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	if err := applyRefChanges(repo, refManager, updates, message); err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+}
+
+// readRefChanges reads update-ref --stdin commands, one per line (or, with
+// -z, with NUL-separated arguments):
+//
+//	update <ref> <new-value> [<old-value>]
+//	create <ref> <new-value>
+//	delete <ref> [<old-value>]
+//	verify <ref> [<old-value>]
+//	option no-deref
+func readRefChanges(objStore *objects.ObjectStore, refManager *refs.RefManager, nulTerminated, noDeref bool) ([]refChange, error) {
+	scanner := bufio.NewScanner(os.Stdin)
+	if nulTerminated {
+		scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+			if i := strings.IndexByte(string(data), 0); i >= 0 {
+				return i + 1, data[:i], nil
+			}
+			if atEOF && len(data) > 0 {
+				return len(data), data, nil
+			}
+			return 0, nil, nil
+		})
+	}
+
+	// counts gives the number of arguments each command takes, required
+	// and optional; with -z each is a separate NUL-terminated field
+	counts := map[string][2]int{
+		"update": {2, 1},
+		"create": {2, 0},
+		"delete": {1, 1},
+		"verify": {1, 1},
+	}
+
+	var updates []refChange
+	nextNoDeref := noDeref
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" && !nulTerminated {
+			continue
+		}
+		command, rest, _ := strings.Cut(line, " ")
+		if command == "option" {
+			if rest != "no-deref" {
+				return nil, fmt.Errorf("option unknown: %s", rest)
+			}
+			nextNoDeref = true
+			continue
+		}
+		count, ok := counts[command]
+		if !ok {
+			return nil, fmt.Errorf("unknown command: %s", line)
+		}
+
+		var fields []string
+		if nulTerminated {
+			if rest != "" {
+				fields = append(fields, rest)
+			}
+			// -z gives every argument as its own field, empty for a
+			// missing old value
+			for len(fields) < count[0]+count[1] && scanner.Scan() {
+				fields = append(fields, scanner.Text())
+			}
+		} else {
+			fields = strings.Split(rest, " ")
+			if rest == "" {
+				fields = nil
+			}
+		}
+		if len(fields) < count[0] || len(fields) > count[0]+count[1] {
+			return nil, fmt.Errorf("%s: wrong number of arguments", command)
+		}
+
+		u := refChange{ref: fields[0], noDeref: nextNoDeref}
+		nextNoDeref = noDeref
+		values := fields[1:]
+		switch command {
+		case "update", "create":
+			hash, err := resolveRefValue(objStore, refManager, values[0])
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %v", command, u.ref, err)
+			}
+			if hash == "" {
+				return nil, fmt.Errorf("%s %s: missing <new-oid>", command, u.ref)
+			}
+			u.newHash = hash
+			values = values[1:]
+			if command == "create" {
+				u.haveOld = true
+			}
+		case "delete":
+			u.delete = true
+		case "verify":
+			u.verify = true
+			// Without a value, verify checks that the ref does not exist
+			u.haveOld = true
+		}
+		if len(values) == 1 && (values[0] != "" || command == "verify") {
+			hash, err := resolveRefValue(objStore, refManager, values[0])
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %v", command, u.ref, err)
+			}
+			u.oldHash, u.haveOld = hash, true
+		}
+		updates = append(updates, u)
+	}
+	return updates, scanner.Err()
+}
+
+// resolveRefValue resolves a new or old value given to update-ref. The
+// empty string and the zero hash stand for a ref that does not exist.
+func resolveRefValue(objStore *objects.ObjectStore, refManager *refs.RefManager, value string) (string, error) {
+	if value == "" || value == refs.ZeroHash {
+		return "", nil
+	}
+	hash, err := resolveRevision(objStore, refManager, value)
+	if err != nil || !objStore.HasObject(hash) {
+		return "", fmt.Errorf("invalid object name %s", value)
+	}
+	return hash, nil
+}
+
+// applyRefChanges checks the old values of all updates and, only if every
+// check passes, makes the updates and records them in the reflogs.
+func applyRefChanges(repo *repository.GitRepository, refManager *refs.RefManager, updates []refChange, message string) error {
+	identity := ""
+	if sig, err := envSignature(repo, "COMMITTER"); err == nil {
+		identity = sig.Identity()
+	}
+
+	targets := make([]string, len(updates))
+	current := make([]string, len(updates))
+	seen := make(map[string]bool)
+	for i, u := range updates {
+		if !updatableRef(u.ref) {
+			return fmt.Errorf("refusing to update ref with bad name '%s'", u.ref)
+		}
+		target := u.ref
+		if !u.noDeref {
+			target = symbolicRefTarget(refManager, u.ref)
+		}
+		if seen[target] {
+			return fmt.Errorf("multiple updates for ref '%s' not allowed", target)
+		}
+		seen[target] = true
+
+		hash, err := refManager.GetRef(target)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(hash, "ref: ") {
+			// --no-deref replaces a symbolic ref
+			hash = ""
+		}
+		targets[i], current[i] = target, hash
+		if !u.haveOld {
+			continue
+		}
+		switch {
+		case u.oldHash == "" && hash != "":
+			return fmt.Errorf("cannot lock ref '%s': reference already exists", u.ref)
+		case u.oldHash != "" && hash == "":
+			return fmt.Errorf("cannot lock ref '%s': unable to resolve reference '%s'", u.ref, target)
+		case u.oldHash != hash:
+			return fmt.Errorf("cannot lock ref '%s': is at %s but expected %s", u.ref, hash, u.oldHash)
+		}
+	}
+
+	for i, u := range updates {
+		target := targets[i]
+		switch {
+		case u.verify:
+		case u.delete:
+			if err := refManager.DeleteRef(target); err != nil {
+				return err
+			}
+		default:
+			if err := refManager.SetRef(target, u.newHash); err != nil {
+				return err
+			}
+			if err := refManager.AppendReflog(target, current[i], u.newHash, identity, message); err != nil {
+				return err
+			}
+			if target != u.ref {
+				// Moving a branch through HEAD is logged for HEAD too
+				if err := refManager.AppendReflog(u.ref, current[i], u.newHash, identity, message); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// symbolicRefTarget follows a symbolic ref such as HEAD to the ref it
+// points at. Other refs are returned as they are.
+func symbolicRefTarget(refManager *refs.RefManager, name string) string {
+	for range 5 {
+		content, err := os.ReadFile(filepath.Join(refManager.GitDir, name))
+		if err != nil {
+			return name
+		}
+		target, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "ref: ")
+		if !ok {
+			return name
+		}
+		name = target
+	}
+	return name
+}
+
+// updatableRef reports whether update-ref may write a ref: a pseudo ref
+// such as HEAD or ORIG_HEAD, or a valid name under refs/.
+func updatableRef(name string) bool {
+	if name != "" && strings.Trim(name, "ABCDEFGHIJKLMNOPQRSTUVWXYZ_") == "" {
+		return true
+	}
+	return strings.HasPrefix(name, "refs/") && refs.CheckRefName(name) == nil
+}
@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"fmt"
+	"mygit/internal/objects"
+	"mygit/internal/refs"
+	"mygit/internal/repository"
+	"os"
+)
+
+// VerifyCommit checks the signatures of the given commits. It exits with
+// an error if any of them is unsigned or has a bad signature.
+func VerifyCommit(args []string) {
+	verbose := false
+	var revs []string
+	for _, arg := range args {
+		switch arg {
+		case "-v", "--verbose":
+			verbose = true
+		default:
+			revs = append(revs, arg)
+		}
+	}
+	if len(revs) == 0 {
+		fmt.Println("usage: mygit verify-commit [-v] <commit>...")
+		os.Exit(1)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(1)
+	}
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	objStore := objects.NewObjectStore(repo.GitDir)
+	refManager := refs.NewRefManager(repo.GitDir)
+	failed := false
+	for _, rev := range revs {
+		hash, err := resolveRevision(objStore, refManager, rev)
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+			failed = true
+			continue
+		}
+		commit, err := readCommit(objStore, hash)
+		if err != nil {
+			fmt.Printf("error: %s: %v\n", rev, err)
+			failed = true
+			continue
+		}
+
+		if verbose {
+			fmt.Print(string(commit.Payload()))
+		}
+		result, err := verifyCommit(repo, commit)
+		if err != nil {
+			fmt.Printf("error: %s: %v\n", rev, err)
+			failed = true
+			continue
+		}
+		fmt.Println(result.Output)
+		if !result.Good {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// VerifyTag checks the signatures of the given tags. It exits with an
+// error if any of them is unsigned or has a bad signature.
+func VerifyTag(args []string) {
+	verbose := false
+	var names []string
+	for _, arg := range args {
+		switch arg {
+		case "-v", "--verbose":
+			verbose = true
+		default:
+			names = append(names, arg)
+		}
+	}
+	if len(names) == 0 {
+		fmt.Println("usage: mygit verify-tag [-v] <tag>...")
+		os.Exit(1)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(1)
+	}
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	verifyTags(repo, names, verbose)
+}
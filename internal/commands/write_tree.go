@@ -0,0 +1,92 @@
+package commands
+
+import (
+	"fmt"
+	"mygit/internal/index"
+	"mygit/internal/objects"
+	"mygit/internal/repository"
+	"os"
+	"sort"
+	"strings"
+)
+
+// WriteTree handles the `write-tree` command, which writes the index as a
+// tree object and prints its hash:
+//
+//	mygit write-tree [--missing-ok] [--prefix=<dir>/]
+//
+// With --prefix only the part of the index under that directory is
+// written. Every object the index names must exist unless --missing-ok is
+// given.
+func WriteTree(args []string) {
+	missingOK := false
+	prefix := ""
+	for _, arg := range args {
+		switch {
+		case arg == "--missing-ok":
+			missingOK = true
+		case strings.HasPrefix(arg, "--prefix="):
+			prefix = strings.Trim(strings.TrimPrefix(arg, "--prefix="), "/")
+		default:
+			fmt.Println("usage: mygit write-tree [--missing-ok] [--prefix=<prefix>/]")
+			os.Exit(129)
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting current directory: %v\n", err)
+		os.Exit(128)
+	}
+
+	repo, err := repository.FindRepository(cwd)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	idx := index.NewIndex(repo.GitDir)
+	if err := idx.Load(); err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	objStore := objects.NewObjectStore(repo.GitDir)
+
+	entries := make(map[string]*index.IndexEntry)
+	var paths []string
+	for p, entry := range idx.GetAll() {
+		if prefix != "" {
+			if !strings.HasPrefix(p, prefix+"/") {
+				continue
+			}
+			stripped := *entry
+			stripped.Path = strings.TrimPrefix(p, prefix+"/")
+			entry = &stripped
+		}
+		entries[entry.Path] = entry
+		paths = append(paths, entry.Path)
+	}
+	if prefix != "" && len(entries) == 0 {
+		fmt.Printf("fatal: prefix %s not found\n", prefix)
+		os.Exit(128)
+	}
+
+	if !missingOK {
+		sort.Strings(paths)
+		for _, p := range paths {
+			entry := entries[p]
+			if !objStore.HasObject(entry.Hash) {
+				fmt.Printf("error: invalid object %s %s for '%s'\n", objects.ModeFromPermissions(entry.Permissions), entry.Hash, p)
+				fmt.Println("fatal: write-tree: error building trees")
+				os.Exit(128)
+			}
+		}
+	}
+
+	treeHash, err := objStore.BuildTreeFromIndex(entries)
+	if err != nil {
+		fmt.Printf("fatal: %v\n", err)
+		os.Exit(128)
+	}
+	fmt.Println(treeHash)
+}
@@ -100,12 +100,42 @@ func (c *Config) Get(key string) (string, bool) {
 	actualKey := parts[len(parts)-1]
 
 	if sectionValues, ok := c.values[section]; ok {
-		val, ok := sectionValues[actualKey]
-		return val, ok
+		if val, ok := sectionValues[actualKey]; ok {
+			return val, true
+		}
+	}
+
+	// Section and key names are case-insensitive in Git (core.fileMode is
+	// usually written as filemode), so fall back to a case-insensitive lookup.
+	for name, sectionValues := range c.values {
+		if !strings.EqualFold(name, section) {
+			continue
+		}
+		for k, val := range sectionValues {
+			if strings.EqualFold(k, actualKey) {
+				return val, true
+			}
+		}
 	}
 	return "", false
 }
 
+// GetBool returns a boolean configuration value, or defaultValue if the key
+// is not set or is not a valid boolean.
+func (c *Config) GetBool(key string, defaultValue bool) bool {
+	val, ok := c.Get(key)
+	if !ok {
+		return defaultValue
+	}
+	switch strings.ToLower(val) {
+	case "true", "yes", "on", "1", "":
+		return true
+	case "false", "no", "off", "0":
+		return false
+	}
+	return defaultValue
+}
+
 // Set sets a configuration value.
 func (c *Config) Set(key, value string) {
 	parts := strings.Split(key, ".")
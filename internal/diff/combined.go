@@ -0,0 +1,376 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// lostLine is a line that one or more parents have but the merge result
+// does not. parents has bit i set when parent i had the line.
+type lostLine struct {
+	text    string
+	parents uint
+}
+
+// resultLine is a line of the merge result together with the lines lost
+// just before it. changed has bit i set when the line is not in parent i.
+type resultLine struct {
+	text        string
+	changed     uint
+	lost        []lostLine
+	parentLine  []int // first line number in each parent when a hunk starts here
+	mark        bool
+	noPreDelete bool
+}
+
+// Combined returns the hunks of a combined diff of a merge result against
+// all of its parents, the way git diff --cc prints it: one column per
+// parent marks whether a line was added ('+') or removed ('-') relative to
+// that parent. With dense set, hunks where the result simply takes one
+// side's version are left out. It returns an empty string if no hunk is
+// left to show.
+func Combined(parents [][]byte, result []byte, context int, dense bool) string {
+	text := SplitLines(result)
+	count := len(text)
+	// One extra line holds the lines lost at the end of the file, and
+	// another the trailing line numbers
+	lines := make([]resultLine, count+2)
+	for i := range lines {
+		if i < count {
+			lines[i].text = text[i]
+		}
+		lines[i].parentLine = make([]int, len(parents))
+	}
+
+	for n, parent := range parents {
+		bit := uint(1) << n
+		// Lines a run of changes deletes go before the lines it inserts
+		lost := make([][]string, count+1)
+		pos, runStart := 0, 0
+		for _, e := range Lines(SplitLines(parent), text) {
+			switch e.Kind {
+			case Insert:
+				lines[e.NewIndex].changed |= bit
+				pos++
+			case Delete:
+				lost[runStart] = append(lost[runStart], e.Text)
+			default:
+				pos++
+				runStart = pos
+			}
+		}
+		for i, l := range lost {
+			if len(l) > 0 {
+				lines[i].lost = coalesceLost(lines[i].lost, l, bit)
+			}
+		}
+	}
+
+	// Number the parents' lines, counting those a parent shares with the
+	// result and those it lost
+	for n := range parents {
+		bit := uint(1) << n
+		lno := 1
+		for i := 0; i <= count; i++ {
+			lines[i].parentLine[n] = lno
+			for _, l := range lines[i].lost {
+				if l.parents&bit != 0 {
+					lno++
+				}
+			}
+			if i < count && lines[i].changed&bit == 0 {
+				lno++
+			}
+		}
+		lines[count+1].parentLine[n] = lno
+	}
+
+	all := uint(1)<<len(parents) - 1
+	if !markHunks(lines[:count+1], all, context, dense) {
+		return ""
+	}
+	return formatCombined(lines, count, len(parents))
+}
+
+// coalesceLost merges the lines a parent lost at one place into the lines
+// other parents lost there, sharing the lines they have in common as found
+// by their longest common subsequence.
+func coalesceLost(base []lostLine, lost []string, bit uint) []lostLine {
+	if len(base) == 0 {
+		merged := make([]lostLine, len(lost))
+		for i, text := range lost {
+			merged[i] = lostLine{text: text, parents: bit}
+		}
+		return merged
+	}
+
+	const (
+		match = iota
+		fromNew
+		fromBase
+	)
+	lcs := make([][]int, len(base)+1)
+	dirs := make([][]int, len(base)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(lost)+1)
+		dirs[i] = make([]int, len(lost)+1)
+		dirs[i][0] = fromBase
+	}
+	for j := 1; j <= len(lost); j++ {
+		dirs[0][j] = fromNew
+	}
+	for i := 1; i <= len(base); i++ {
+		for j := 1; j <= len(lost); j++ {
+			switch {
+			case base[i-1].text == lost[j-1]:
+				lcs[i][j] = lcs[i-1][j-1] + 1
+				dirs[i][j] = match
+			case lcs[i][j-1] >= lcs[i-1][j]:
+				lcs[i][j] = lcs[i][j-1]
+				dirs[i][j] = fromNew
+			default:
+				lcs[i][j] = lcs[i-1][j]
+				dirs[i][j] = fromBase
+			}
+		}
+	}
+
+	// Walk back from the end, collecting the merged lines in reverse
+	var merged []lostLine
+	i, j := len(base), len(lost)
+	for i > 0 || j > 0 {
+		switch dirs[i][j] {
+		case match:
+			l := base[i-1]
+			l.parents |= bit
+			merged = append(merged, l)
+			i--
+			j--
+		case fromNew:
+			merged = append(merged, lostLine{text: lost[j-1], parents: bit})
+			j--
+		default:
+			merged = append(merged, base[i-1])
+			i--
+		}
+	}
+	for a, b := 0, len(merged)-1; a < b; a, b = a+1, b-1 {
+		merged[a], merged[b] = merged[b], merged[a]
+	}
+	return merged
+}
+
+// interesting reports whether a line differs from some parent or has lost
+// lines before it.
+func (l *resultLine) interesting(all uint) bool {
+	return l.changed&all != 0 || len(l.lost) > 0
+}
+
+// markHunks marks the lines to show: the interesting ones and their
+// context. In dense mode, groups of changes where the result matches one
+// of the parents are dropped first. It reports whether anything is marked.
+func markHunks(lines []resultLine, all uint, context int, dense bool) bool {
+	for i := range lines {
+		lines[i].mark = lines[i].interesting(all)
+	}
+	if !dense {
+		return giveContext(lines, all, context)
+	}
+
+	last := len(lines) - 1
+	for i := 0; i <= last; {
+		for i <= last && !lines[i].mark {
+			i++
+		}
+		if i > last {
+			break
+		}
+		begin := i
+		j := i + 1
+		for ; j <= last; j++ {
+			if lines[j].mark {
+				continue
+			}
+			// Carry on if another change follows within the context
+			la := adjustHunkTail(lines, all, begin, j) + context
+			if la > last+1 {
+				la = last + 1
+			}
+			found := false
+			for la > 0 {
+				la--
+				if la < j {
+					break
+				}
+				if lines[la].mark {
+					found = true
+					break
+				}
+			}
+			if !found {
+				break
+			}
+			j = la
+		}
+		end := j
+
+		// The hunk is only interesting if its lines differ from different
+		// sets of parents, or from all of them
+		var same uint
+		interesting := false
+		for k := begin; k < end && !interesting; k++ {
+			diffs := []uint{}
+			if d := lines[k].changed & all; d != 0 {
+				diffs = append(diffs, d)
+			}
+			for _, l := range lines[k].lost {
+				diffs = append(diffs, l.parents)
+			}
+			for _, d := range diffs {
+				if same == 0 {
+					same = d
+				} else if same != d {
+					interesting = true
+					break
+				}
+			}
+		}
+		if !interesting && same != all {
+			for k := begin; k < end; k++ {
+				lines[k].mark = false
+			}
+		}
+		i = end
+	}
+	return giveContext(lines, all, context)
+}
+
+// adjustHunkTail moves the end of a hunk back over a last line that is
+// only there for the lines lost before it, as that line already serves as
+// context.
+func adjustHunkTail(lines []resultLine, all uint, begin, i int) int {
+	if begin+1 <= i && lines[i-1].changed&all == 0 {
+		return i - 1
+	}
+	return i
+}
+
+// findMarked returns the index of the first line from i on whose mark is
+// the given one, or len(lines) if there is none.
+func findMarked(lines []resultLine, i int, mark bool) int {
+	for i < len(lines) && lines[i].mark != mark {
+		i++
+	}
+	return i
+}
+
+// giveContext marks the context lines around the marked ones, joining
+// groups separated by short gaps. It reports whether anything is marked.
+func giveContext(lines []resultLine, all uint, context int) bool {
+	i := findMarked(lines, 0, true)
+	if i == len(lines) {
+		return false
+	}
+
+	for i < len(lines) {
+		for j := max(i-context, 0); j < i; j++ {
+			if !lines[j].mark {
+				lines[j].noPreDelete = true
+			}
+			lines[j].mark = true
+		}
+
+		for {
+			j := findMarked(lines, i, false)
+			if j == len(lines) {
+				return true
+			}
+			k := findMarked(lines, j, true)
+			j = adjustHunkTail(lines, all, i, j)
+
+			if k < j+context {
+				// The gap is small; show it and carry on
+				for ; j < k; j++ {
+					lines[j].mark = true
+				}
+				i = k
+				continue
+			}
+
+			i = k
+			for end := min(j+context, len(lines)); j < end; j++ {
+				lines[j].mark = true
+			}
+			break
+		}
+	}
+	return true
+}
+
+// formatCombined prints the marked lines as combined diff hunks.
+func formatCombined(lines []resultLine, count, numParents int) string {
+	var b strings.Builder
+	lno := 0
+	for {
+		for lno <= count && !lines[lno].mark {
+			lno++
+		}
+		if lno > count {
+			break
+		}
+		end := lno + 1
+		for end <= count && lines[end].mark {
+			end++
+		}
+		resultLines := end - lno
+		if end > count {
+			// The last line only holds lines lost at the end
+			resultLines--
+		}
+
+		marker := strings.Repeat("@", numParents+1)
+		b.WriteString(marker)
+		for n := 0; n < numParents; n++ {
+			start := lines[lno].parentLine[n]
+			fmt.Fprintf(&b, " -%d,%d", start, lines[end].parentLine[n]-start)
+		}
+		fmt.Fprintf(&b, " +%d,%d %s\n", lno+1, resultLines, marker)
+
+		for ; lno < end; lno++ {
+			l := &lines[lno]
+			if !l.noPreDelete {
+				for _, lost := range l.lost {
+					for n := 0; n < numParents; n++ {
+						if lost.parents&(1<<n) != 0 {
+							b.WriteByte('-')
+						} else {
+							b.WriteByte(' ')
+						}
+					}
+					writeLine(&b, lost.text)
+				}
+			}
+			if lno == count {
+				lno++
+				break
+			}
+			for n := 0; n < numParents; n++ {
+				if l.changed&(1<<n) != 0 {
+					b.WriteByte('+')
+				} else {
+					b.WriteByte(' ')
+				}
+			}
+			writeLine(&b, l.text)
+		}
+	}
+	return b.String()
+}
+
+// writeLine writes a line, ending it with a newline if it has none.
+func writeLine(b *strings.Builder, line string) {
+	b.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		b.WriteByte('\n')
+	}
+}
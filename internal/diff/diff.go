@@ -0,0 +1,220 @@
+package diff
+
+import (
+	"bytes"
+)
+
+// OpKind is the kind of a single line edit.
+type OpKind int
+
+const (
+	Equal OpKind = iota
+	Delete
+	Insert
+)
+
+// Edit is one line of an edit script. OldIndex and NewIndex are 0-based line
+// numbers into the old and new inputs; the one that does not apply to the
+// edit kind is -1.
+type Edit struct {
+	Kind     OpKind
+	OldIndex int
+	NewIndex int
+	Text     string
+}
+
+// SplitLines splits data into lines, keeping the trailing newline on each
+// line so the input can be reassembled byte for byte. The last line may not
+// end in a newline.
+func SplitLines(data []byte) []string {
+	var lines []string
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i == -1 {
+			lines = append(lines, string(data))
+			break
+		}
+		lines = append(lines, string(data[:i+1]))
+		data = data[i+1:]
+	}
+	return lines
+}
+
+// JoinLines is the inverse of SplitLines.
+func JoinLines(lines []string) []byte {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line)
+	}
+	return buf.Bytes()
+}
+
+// IsBinary reports whether data looks like binary content, using the same
+// heuristic as Git: a NUL byte in the first 8000 bytes.
+func IsBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) != -1
+}
+
+// Lines computes an edit script turning a into b using Myers' O(ND)
+// algorithm in its linear-space form: the middle of the shortest path is
+// found by searching from both ends at once, and the two halves are diffed
+// on their own. Common prefixes and suffixes are trimmed at every step,
+// which keeps the search small for the usual case of a few localized
+// changes.
+func Lines(a, b []string) []Edit {
+	d := &differ{a: a, b: b, edits: make([]Edit, 0, len(a)+len(b))}
+	// Both searches need room for diagonals -D..D, with D at most half of
+	// the total length
+	size := 2*((len(a)+len(b)+1)/2) + 2
+	d.forward, d.backward = make([]int, size), make([]int, size)
+	d.compare(0, len(a), 0, len(b))
+	return deletionsFirst(d.edits)
+}
+
+// deletionsFirst reorders each run of changes so that its deletions come
+// before its insertions, as Git shows them.
+func deletionsFirst(edits []Edit) []Edit {
+	var inserts []Edit
+	out := edits[:0]
+	for i, e := range edits {
+		switch e.Kind {
+		case Insert:
+			inserts = append(inserts, e)
+		case Delete:
+			out = append(out, e)
+		}
+		if e.Kind == Equal || i == len(edits)-1 {
+			out = append(out, inserts...)
+			inserts = inserts[:0]
+			if e.Kind == Equal {
+				out = append(out, e)
+			}
+		}
+	}
+	return out
+}
+
+// differ holds the inputs, the script built so far, and the buffers the
+// searches share.
+type differ struct {
+	a, b              []string
+	edits             []Edit
+	forward, backward []int
+}
+
+// compare appends the script for a[aLo:aHi] against b[bLo:bHi].
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.edits = append(d.edits, Edit{Kind: Equal, OldIndex: aLo, NewIndex: bLo, Text: d.a[aLo]})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aHi-suffix > aLo && bHi-suffix > bLo && d.a[aHi-suffix-1] == d.b[bHi-suffix-1] {
+		suffix++
+	}
+	aHi, bHi = aHi-suffix, bHi-suffix
+
+	if aLo < aHi && bLo < bHi {
+		if x, y, ok := d.middle(aLo, aHi, bLo, bHi); ok {
+			d.compare(aLo, x, bLo, y)
+			d.compare(x, aHi, y, bHi)
+			aLo, bLo = aHi, bHi
+		}
+	}
+	// What is left has nothing in common
+	for ; aLo < aHi; aLo++ {
+		d.edits = append(d.edits, Edit{Kind: Delete, OldIndex: aLo, NewIndex: -1, Text: d.a[aLo]})
+	}
+	for ; bLo < bHi; bLo++ {
+		d.edits = append(d.edits, Edit{Kind: Insert, OldIndex: -1, NewIndex: bLo, Text: d.b[bLo]})
+	}
+
+	for i := 0; i < suffix; i++ {
+		d.edits = append(d.edits, Edit{Kind: Equal, OldIndex: aHi + i, NewIndex: bHi + i, Text: d.a[aHi+i]})
+	}
+}
+
+// middle runs the forward and backward searches over a[aLo:aHi] against
+// b[bLo:bHi] until their paths meet, and returns the point where they do,
+// which splits the shortest edit script in two. It reports false if the
+// ranges have no line in common.
+func (d *differ) middle(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	n, m := aHi-aLo, bHi-bLo
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	size := 2*maxD + 2
+	vf, vb := d.forward[:size], d.backward[:size]
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[offset+1], vb[offset+1] = 0, 0
+
+	// With an odd difference in length the paths meet on a forward step,
+	// otherwise on a backward one
+	delta := n - m
+	odd := delta%2 != 0
+	// Diagonals that ran off the edges are not searched again
+	fStart, fEnd, bStart, bEnd := 0, 0, 0, 0
+
+	for step := 0; step < maxD; step++ {
+		for k := -step + fStart; k <= step-fEnd; k += 2 {
+			i := offset + k
+			var x int
+			if k == -step || (k != step && vf[i-1] < vf[i+1]) {
+				x = vf[i+1]
+			} else {
+				x = vf[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			vf[i] = x
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case odd:
+				j := offset + delta - k
+				if j >= 0 && j < size && vb[j] != -1 && x >= n-vb[j] {
+					return aLo + x, bLo + y, true
+				}
+			}
+		}
+
+		for k := -step + bStart; k <= step-bEnd; k += 2 {
+			i := offset + k
+			var x int
+			if k == -step || (k != step && vb[i-1] < vb[i+1]) {
+				x = vb[i+1]
+			} else {
+				x = vb[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aHi-x-1] == d.b[bHi-y-1] {
+				x++
+				y++
+			}
+			vb[i] = x
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !odd:
+				j := offset + delta - k
+				if j >= 0 && j < size && vf[j] != -1 && vf[j] >= n-x {
+					fx := vf[j]
+					return aLo + fx, bLo + fx - (j - offset), true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
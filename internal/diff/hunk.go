@@ -0,0 +1,320 @@
+package diff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultContext is the number of unchanged lines shown around each change.
+const DefaultContext = 3
+
+// Hunk is a group of nearby changes together with surrounding context, in
+// unified diff form. Starts are 1-based line numbers as printed in the
+// "@@ -OldStart,OldLines +NewStart,NewLines @@" header; Lines are prefixed
+// with ' ', '-' or '+' and keep their trailing newline (the last line of a
+// file may have none).
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []string
+}
+
+// Hunks groups an edit script into hunks with the given amount of context.
+// Changes separated by at most 2*context unchanged lines share a hunk.
+func Hunks(edits []Edit, context int) []Hunk {
+	var hunks []Hunk
+
+	i := 0
+	for i < len(edits) {
+		// Find the next change
+		for i < len(edits) && edits[i].Kind == Equal {
+			i++
+		}
+		if i >= len(edits) {
+			break
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+
+		// Extend the hunk while the next change is close enough
+		end := i
+		for end < len(edits) {
+			for end < len(edits) && edits[end].Kind != Equal {
+				end++
+			}
+			run := end
+			for run < len(edits) && edits[run].Kind == Equal {
+				run++
+			}
+			if run >= len(edits) || run-end > 2*context {
+				break
+			}
+			end = run
+		}
+		stop := end + context
+		if stop > len(edits) {
+			stop = len(edits)
+		}
+
+		hunks = append(hunks, newHunk(edits[start:stop], edits, start))
+		i = stop
+	}
+
+	return hunks
+}
+
+// newHunk builds a hunk from a slice of the edit script starting at index
+// start, computing its header from the surrounding script.
+func newHunk(slice, all []Edit, start int) Hunk {
+	// Count the lines before the hunk on each side
+	oldBefore, newBefore := 0, 0
+	for _, e := range all[:start] {
+		if e.Kind != Insert {
+			oldBefore++
+		}
+		if e.Kind != Delete {
+			newBefore++
+		}
+	}
+
+	h := Hunk{}
+	for _, e := range slice {
+		switch e.Kind {
+		case Equal:
+			h.Lines = append(h.Lines, " "+e.Text)
+			h.OldLines++
+			h.NewLines++
+		case Delete:
+			h.Lines = append(h.Lines, "-"+e.Text)
+			h.OldLines++
+		case Insert:
+			h.Lines = append(h.Lines, "+"+e.Text)
+			h.NewLines++
+		}
+	}
+	h.OldStart = headerStart(oldBefore, h.OldLines)
+	h.NewStart = headerStart(newBefore, h.NewLines)
+	return h
+}
+
+// headerStart converts the number of lines preceding a hunk into the start
+// number printed in its header. An empty side names the line after which
+// the change happens, so it is one less than usual.
+func headerStart(before, count int) int {
+	if count == 0 {
+		return before
+	}
+	return before + 1
+}
+
+// oldIndex is the 0-based index of the first old line the hunk covers.
+func (h Hunk) oldIndex() int {
+	if h.OldLines == 0 {
+		return h.OldStart
+	}
+	return h.OldStart - 1
+}
+
+// Header returns the "@@ ... @@" line of the hunk, without a newline.
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", formatRange(h.OldStart, h.OldLines), formatRange(h.NewStart, h.NewLines))
+}
+
+func formatRange(start, count int) string {
+	if count == 1 {
+		return strconv.Itoa(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// String renders the hunk in unified diff format.
+func (h Hunk) String() string {
+	var b strings.Builder
+	b.WriteString(h.Header())
+	b.WriteByte('\n')
+	for _, line := range h.Lines {
+		b.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			b.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+	return b.String()
+}
+
+// Split divides a hunk into smaller hunks, one per run of changes separated
+// by context lines. Each part keeps the context on both sides of its
+// changes. A hunk with a single run of changes is returned unchanged.
+func (h Hunk) Split() []Hunk {
+	type run struct{ start, end int } // indexes into h.Lines
+	var runs []run
+	for i := 0; i < len(h.Lines); {
+		if h.Lines[i][0] == ' ' {
+			i++
+			continue
+		}
+		r := run{start: i}
+		for i < len(h.Lines) && h.Lines[i][0] != ' ' {
+			i++
+		}
+		r.end = i
+		runs = append(runs, r)
+	}
+	if len(runs) < 2 {
+		return []Hunk{h}
+	}
+
+	var parts []Hunk
+	for n := range runs {
+		from := 0
+		if n > 0 {
+			from = runs[n-1].end
+		}
+		to := len(h.Lines)
+		if n+1 < len(runs) {
+			to = runs[n+1].start
+		}
+
+		// Line numbers of the part follow from the lines before it
+		oldBefore, newBefore := h.oldIndex(), h.NewStart-1
+		if h.NewLines == 0 {
+			newBefore = h.NewStart
+		}
+		for _, line := range h.Lines[:from] {
+			if line[0] != '+' {
+				oldBefore++
+			}
+			if line[0] != '-' {
+				newBefore++
+			}
+		}
+
+		part := Hunk{Lines: append([]string(nil), h.Lines[from:to]...)}
+		for _, line := range part.Lines {
+			if line[0] != '+' {
+				part.OldLines++
+			}
+			if line[0] != '-' {
+				part.NewLines++
+			}
+		}
+		part.OldStart = headerStart(oldBefore, part.OldLines)
+		part.NewStart = headerStart(newBefore, part.NewLines)
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// ParseHunkLines rebuilds a hunk from edited lines, as produced by the "e"
+// action of an interactive patch session. Lines starting with '#' are
+// dropped, a "\ No newline at end of file" marker removes the newline of
+// the line before it, and the line counts are recomputed. The old start is
+// taken from orig, which the edited hunk replaces.
+func ParseHunkLines(text string, orig Hunk) (Hunk, error) {
+	h := Hunk{OldStart: orig.OldStart, NewStart: orig.NewStart}
+	for _, line := range SplitLines([]byte(text)) {
+		switch {
+		case strings.HasPrefix(line, "#"), strings.HasPrefix(line, "@@"):
+			continue
+		case strings.HasPrefix(line, "\\"):
+			if len(h.Lines) > 0 {
+				h.Lines[len(h.Lines)-1] = strings.TrimSuffix(h.Lines[len(h.Lines)-1], "\n")
+			}
+			continue
+		case line == "\n":
+			// Editors often strip the space of empty context lines
+			line = " \n"
+		case line[0] != ' ' && line[0] != '-' && line[0] != '+':
+			return Hunk{}, fmt.Errorf("corrupt patch line: %q", strings.TrimSuffix(line, "\n"))
+		}
+		h.Lines = append(h.Lines, line)
+		if line[0] != '+' {
+			h.OldLines++
+		}
+		if line[0] != '-' {
+			h.NewLines++
+		}
+	}
+
+	// An emptied side changes how the start line is numbered
+	if orig.OldLines == 0 && h.OldLines > 0 {
+		h.OldStart++
+	} else if orig.OldLines > 0 && h.OldLines == 0 {
+		h.OldStart--
+	}
+	return h, nil
+}
+
+// Apply applies hunks computed against old and returns the new lines. The
+// hunks must be in order and each one's old side must match old at its
+// position; otherwise an error is returned. Context shared by neighbouring
+// hunks (as after Split) is allowed to overlap.
+func Apply(old []string, hunks []Hunk) ([]string, error) {
+	var result []string
+	pos := 0
+
+	for _, h := range hunks {
+		var oldSide, newSide []string
+		for _, line := range h.Lines {
+			if line[0] != '+' {
+				oldSide = append(oldSide, line[1:])
+			}
+			if line[0] != '-' {
+				newSide = append(newSide, line[1:])
+			}
+		}
+
+		start := h.oldIndex()
+		if start < 0 || start+len(oldSide) > len(old) || !equalLines(old[start:start+len(oldSide)], oldSide) {
+			return nil, fmt.Errorf("hunk %s does not apply", h.Header())
+		}
+
+		// Drop the context both sides share, so that neighbouring hunks
+		// only ever touch the lines they actually change.
+		for len(oldSide) > 0 && len(newSide) > 0 && oldSide[0] == newSide[0] {
+			oldSide, newSide = oldSide[1:], newSide[1:]
+			start++
+		}
+		for len(oldSide) > 0 && len(newSide) > 0 && oldSide[len(oldSide)-1] == newSide[len(newSide)-1] {
+			oldSide, newSide = oldSide[:len(oldSide)-1], newSide[:len(newSide)-1]
+		}
+
+		if start < pos {
+			return nil, fmt.Errorf("hunk %s overlaps the previous hunk", h.Header())
+		}
+		result = append(result, old[pos:start]...)
+		result = append(result, newSide...)
+		pos = start + len(oldSide)
+	}
+
+	result = append(result, old[pos:]...)
+	return result, nil
+}
+
+// Reverse returns the hunk that undoes h: additions become deletions and
+// the old and new sides swap.
+func (h Hunk) Reverse() Hunk {
+	r := Hunk{
+		OldStart: h.NewStart,
+		OldLines: h.NewLines,
+		NewStart: h.OldStart,
+		NewLines: h.OldLines,
+		Lines:    make([]string, len(h.Lines)),
+	}
+	for i, line := range h.Lines {
+		switch line[0] {
+		case '+':
+			r.Lines[i] = "-" + line[1:]
+		case '-':
+			r.Lines[i] = "+" + line[1:]
+		default:
+			r.Lines[i] = line
+		}
+	}
+	return r
+}
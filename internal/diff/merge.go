@@ -0,0 +1,114 @@
+package diff
+
+import (
+	"strings"
+)
+
+// MergeResult is the outcome of a three-way merge.
+type MergeResult struct {
+	Lines     []string
+	Conflicts int
+}
+
+// Merge3 performs a line-based three-way merge of ours and theirs, both
+// derived from base. Regions changed on only one side take that side's
+// version; regions changed identically on both sides are taken once; any
+// other overlapping change is written as a conflict block delimited by
+// Git-style markers carrying oursLabel and theirsLabel.
+func Merge3(base, ours, theirs []string, oursLabel, theirsLabel string) MergeResult {
+	matchOurs := matchBase(base, ours)
+	matchTheirs := matchBase(base, theirs)
+
+	var result MergeResult
+	o, a, b := 0, 0, 0
+	for {
+		// Stable line: present and unchanged on both sides
+		if o < len(base) && matchOurs[o] == a && matchTheirs[o] == b {
+			result.Lines = append(result.Lines, base[o])
+			o, a, b = o+1, a+1, b+1
+			continue
+		}
+
+		// Find the next base line that both sides kept
+		next := o
+		for next < len(base) && (matchOurs[next] == -1 || matchTheirs[next] == -1) {
+			next++
+		}
+
+		endA, endB := len(ours), len(theirs)
+		if next < len(base) {
+			endA, endB = matchOurs[next], matchTheirs[next]
+		}
+
+		baseChunk := base[o:next]
+		oursChunk := ours[a:endA]
+		theirsChunk := theirs[b:endB]
+
+		switch {
+		case equalLines(oursChunk, baseChunk):
+			result.Lines = append(result.Lines, theirsChunk...)
+		case equalLines(theirsChunk, baseChunk), equalLines(oursChunk, theirsChunk):
+			result.Lines = append(result.Lines, oursChunk...)
+		default:
+			result.Conflicts++
+			result.Lines = append(result.Lines, "<<<<<<< "+oursLabel+"\n")
+			result.Lines = appendTerminated(result.Lines, oursChunk)
+			result.Lines = append(result.Lines, "=======\n")
+			result.Lines = appendTerminated(result.Lines, theirsChunk)
+			result.Lines = append(result.Lines, ">>>>>>> "+theirsLabel+"\n")
+		}
+
+		if next >= len(base) {
+			break
+		}
+		o, a, b = next, endA, endB
+	}
+
+	return result
+}
+
+// MergeBytes is Merge3 for whole file contents. It reports whether the
+// result contains conflicts.
+func MergeBytes(base, ours, theirs []byte, oursLabel, theirsLabel string) ([]byte, bool) {
+	result := Merge3(SplitLines(base), SplitLines(ours), SplitLines(theirs), oursLabel, theirsLabel)
+	return JoinLines(result.Lines), result.Conflicts > 0
+}
+
+// matchBase maps each base line to the line of other it is kept as, or -1
+// if the line was deleted or changed.
+func matchBase(base, other []string) []int {
+	match := make([]int, len(base))
+	for i := range match {
+		match[i] = -1
+	}
+	for _, e := range Lines(base, other) {
+		if e.Kind == Equal {
+			match[e.OldIndex] = e.NewIndex
+		}
+	}
+	return match
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// appendTerminated appends lines, making sure the last one ends in a
+// newline so that a following conflict marker starts on its own line.
+func appendTerminated(dst, lines []string) []string {
+	for i, line := range lines {
+		if i == len(lines)-1 && !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+		dst = append(dst, line)
+	}
+	return dst
+}
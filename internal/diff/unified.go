@@ -0,0 +1,31 @@
+package diff
+
+import (
+	"strings"
+)
+
+// Unified returns the hunks of a unified diff between two file contents,
+// with the given amount of context. It returns an empty string if the
+// contents are equal.
+func Unified(old, new []byte, context int) string {
+	edits := Lines(SplitLines(old), SplitLines(new))
+
+	var b strings.Builder
+	for _, h := range Hunks(edits, context) {
+		b.WriteString(h.String())
+	}
+	return b.String()
+}
+
+// Stat counts the lines added and removed between two file contents.
+func Stat(old, new []byte) (added, removed int) {
+	for _, e := range Lines(SplitLines(old), SplitLines(new)) {
+		switch e.Kind {
+		case Insert:
+			added++
+		case Delete:
+			removed++
+		}
+	}
+	return added, removed
+}
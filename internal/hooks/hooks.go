@@ -0,0 +1,115 @@
+// Package hooks runs the scripts in the repository's hooks directory at
+// the points where Git runs them.
+package hooks
+
+import (
+	"fmt"
+	"io"
+	"mygit/internal/config"
+	"mygit/internal/repository"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Error reports a hook that exited with a non-zero status.
+type Error struct {
+	Name     string
+	ExitCode int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("hook '%s' exited with status %d", e.Name, e.ExitCode)
+}
+
+// Dir returns the directory hooks are looked up in: core.hooksPath if it
+// is set, otherwise .mygit/hooks. A relative core.hooksPath is taken
+// relative to the top of the working tree.
+func Dir(repo *repository.GitRepository) string {
+	cfg := config.NewConfig(filepath.Join(repo.GitDir, "config"))
+	if err := cfg.Load(); err == nil {
+		if dir, ok := cfg.Get("core.hooksPath"); ok && dir != "" {
+			if rest, ok := strings.CutPrefix(dir, "~/"); ok {
+				if home, err := os.UserHomeDir(); err == nil {
+					dir = filepath.Join(home, rest)
+				}
+			}
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(repo.WorkDir, dir)
+			}
+			return dir
+		}
+	}
+	return filepath.Join(repo.GitDir, "hooks")
+}
+
+// Find returns the path of the named hook, or "" if there is no such
+// hook. A hook that exists but is not executable is ignored with a hint,
+// as Git does.
+func Find(repo *repository.GitRepository, name string) string {
+	path := filepath.Join(Dir(repo), name)
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return ""
+	}
+	if info.Mode()&0111 == 0 {
+		fmt.Fprintf(os.Stderr, "hint: The '%s' hook was ignored because it's not set as executable.\n", path)
+		return ""
+	}
+	return path
+}
+
+// Options controls how a hook is run.
+type Options struct {
+	Stdin  io.Reader // the hook's standard input; nil for none
+	Output io.Writer // where the hook's output goes; standard error if nil
+	Dir    string    // working directory; the top of the working tree if empty
+}
+
+// Run runs the named hook, if there is one, from the top of the working
+// tree with the given arguments and standard input (nil for none). The
+// hook's output goes to standard error. A hook that exits with a non-zero
+// status is reported as an *Error.
+func Run(repo *repository.GitRepository, name string, stdin io.Reader, args ...string) error {
+	return RunWith(repo, name, Options{Stdin: stdin}, args...)
+}
+
+// RunWith runs the named hook, if there is one, as set out by opts.
+func RunWith(repo *repository.GitRepository, name string, opts Options, args ...string) error {
+	path := Find(repo, name)
+	if path == "" {
+		return nil
+	}
+
+	output := opts.Output
+	if output == nil {
+		output = os.Stderr
+	}
+	dir := opts.Dir
+	if dir == "" {
+		dir = repo.WorkDir
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Dir = dir
+	cmd.Stdin = opts.Stdin
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return &Error{Name: name, ExitCode: exitErr.ExitCode()}
+		}
+		return fmt.Errorf("cannot run hook '%s': %w", name, err)
+	}
+	return nil
+}
+
+// ExitCode returns the status to exit with after a hook failed: the
+// hook's own exit status, or 1.
+func ExitCode(err error) int {
+	if hookErr, ok := err.(*Error); ok && hookErr.ExitCode > 0 {
+		return hookErr.ExitCode
+	}
+	return 1
+}
@@ -3,6 +3,7 @@ package index
 import (
 	"bufio"
 	"fmt"
+	"mygit/internal/trace"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -20,44 +21,56 @@ type IndexEntry struct {
 
 type Index struct {
 	entries   map[string]*IndexEntry
+	conflicts map[string]string // unmerged path -> kind of conflict
 	indexPath string
 }
 
+// Kinds of conflict a merge can leave a path with, as status shows them.
+const (
+	BothModified  = "both modified"
+	BothAdded     = "both added"
+	DeletedByUs   = "deleted by us"
+	DeletedByThem = "deleted by them"
+)
+
+// conflictPrefix starts the index lines that record unmerged paths, as
+// "conflict\t<kind>\t<path>". No entry line can start with it.
+const conflictPrefix = "conflict\t"
+
 func NewIndex(gitDir string) *Index {
 	return &Index{
 		entries:   make(map[string]*IndexEntry),
+		conflicts: make(map[string]string),
 		indexPath: filepath.Join(gitDir, "index"),
 	}
 }
 
 // Load the index file and populate the entries map
 func (idx *Index) Load() error {
-	fmt.Printf("DEBUG: Loading index from: %s\n", idx.indexPath)
-
 	file, err := os.Open(idx.indexPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			fmt.Printf("DEBUG: Index file does not exist, starting with empty index\n")
 			return nil
 		}
 		return fmt.Errorf("failed to open index file: %w", err)
 	}
 	defer file.Close()
 
-	lineCount := 0
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		lineCount++
 		line := strings.TrimSpace(scanner.Text())
-		fmt.Printf("DEBUG: Reading index line %d: '%s'\n", lineCount, line)
-
 		if line == "" {
 			continue
 		}
+		if rest, ok := strings.CutPrefix(line, conflictPrefix); ok {
+			if kind, path, ok := strings.Cut(rest, "\t"); ok {
+				idx.conflicts[path] = kind
+			}
+			continue
+		}
 
 		parts := strings.SplitN(line, " ", 5)
 		if len(parts) != 5 {
-			fmt.Printf("DEBUG: Skipping malformed line with %d parts\n", len(parts))
 			continue
 		}
 
@@ -67,9 +80,6 @@ func (idx *Index) Load() error {
 		modTimeUnix, _ := strconv.ParseInt(parts[3], 10, 64)
 		permsInt, _ := strconv.ParseUint(parts[4], 10, 32)
 
-		fmt.Printf("DEBUG: Loaded entry - Path: '%s', Hash: '%s' (len: %d), Size: %d\n",
-			path, hash, len(hash), size)
-
 		idx.entries[path] = &IndexEntry{
 			Path:        path,
 			Hash:        hash,
@@ -79,62 +89,81 @@ func (idx *Index) Load() error {
 		}
 	}
 
-	fmt.Printf("DEBUG: Loaded %d entries from index\n", len(idx.entries))
+	trace.Printf("index: loaded %d entries from %s\n", len(idx.entries), idx.indexPath)
 	return scanner.Err()
 }
 
 // Save the index to file with full metadata
 func (idx *Index) Save() error {
-	fmt.Printf("DEBUG: Saving index to: %s\n", idx.indexPath)
-	fmt.Printf("DEBUG: Saving %d entries\n", len(idx.entries))
-
 	file, err := os.Create(idx.indexPath)
 	if err != nil {
 		return fmt.Errorf("failed to create index file: %w", err)
 	}
 	defer file.Close()
 
-	for path, entry := range idx.entries {
+	for _, entry := range idx.entries {
 		line := fmt.Sprintf("%s %s %d %d %d\n",
 			entry.Path,
 			entry.Hash,
 			entry.Size,
 			entry.ModTime.Unix(),
 			entry.Permissions)
-
-		fmt.Printf("DEBUG: Writing index line for '%s': '%s'\n", path, strings.TrimSpace(line))
-
 		if _, err := file.WriteString(line); err != nil {
 			return fmt.Errorf("failed to write to index file: %w", err)
 		}
 	}
 
-	fmt.Printf("DEBUG: Index saved successfully\n")
+	for path, kind := range idx.conflicts {
+		if _, err := fmt.Fprintf(file, "%s%s\t%s\n", conflictPrefix, kind, path); err != nil {
+			return fmt.Errorf("failed to write to index file: %w", err)
+		}
+	}
+
+	trace.Printf("index: saved %d entries to %s\n", len(idx.entries), idx.indexPath)
 	return nil
 }
 
 // Add a file to the index
 func (idx *Index) Add(path, hash string, info os.FileInfo) {
-	fmt.Printf("DEBUG: Adding to index - Path: '%s', Hash: '%s' (len: %d)\n", path, hash, len(hash))
-
-	if len(hash) != 40 {
-		fmt.Printf("WARNING: Invalid hash length for '%s': expected 40, got %d\n", path, len(hash))
-	}
+	idx.AddWithMode(path, hash, info, info.Mode())
+}
 
+// AddWithMode adds a file to the index, recording perm as its mode instead
+// of the mode of the file on disk.
+func (idx *Index) AddWithMode(path, hash string, info os.FileInfo, perm os.FileMode) {
 	idx.entries[path] = &IndexEntry{
 		Path:        path,
 		Hash:        hash,
 		Size:        info.Size(),
 		ModTime:     info.ModTime(),
-		Permissions: info.Mode(),
+		Permissions: perm,
 	}
+	delete(idx.conflicts, path)
+}
 
-	fmt.Printf("DEBUG: Entry added successfully\n")
+// Set stores an entry that does not come from the working directory,
+// such as one read from a tree object.
+func (idx *Index) Set(entry *IndexEntry) {
+	idx.entries[entry.Path] = entry
+	delete(idx.conflicts, entry.Path)
 }
 
 // Remove a file from the index
 func (idx *Index) Remove(path string) {
 	delete(idx.entries, path)
+	delete(idx.conflicts, path)
+}
+
+// SetConflict marks a path as left unmerged by a merge, with the kind of
+// conflict. The mark stays until the path is added or removed, which is
+// how a conflict is marked resolved. The path keeps whatever entry it has.
+func (idx *Index) SetConflict(path, kind string) {
+	idx.conflicts[path] = kind
+}
+
+// Conflicts returns the unmerged paths and their kinds of conflict.
+func (idx *Index) Conflicts() map[string]string {
+	return idx.conflicts
 }
 
 // Get a specific entry by path
@@ -145,9 +174,5 @@ func (idx *Index) Get(path string) (*IndexEntry, bool) {
 
 // Get all tracked entries
 func (idx *Index) GetAll() map[string]*IndexEntry {
-	fmt.Printf("DEBUG: GetAll() called, returning %d entries:\n", len(idx.entries))
-	for path, entry := range idx.entries {
-		fmt.Printf("  - Path: '%s', Hash: '%s' (len: %d)\n", path, entry.Hash, len(entry.Hash))
-	}
 	return idx.entries
 }
@@ -2,95 +2,237 @@ package objects
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// Signature records who authored or committed a commit, and when. The
+// time zone of When is the one written to the commit, so a signature
+// round-trips exactly.
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+// NewSignature builds a signature from an identity of the form
+// "Name <email>" and a time.
+func NewSignature(identity string, when time.Time) Signature {
+	sig := Signature{Name: identity, When: when}
+	if open := strings.LastIndex(identity, "<"); open >= 0 {
+		if close := strings.Index(identity[open:], ">"); close >= 0 {
+			sig.Name = strings.TrimSpace(identity[:open])
+			sig.Email = identity[open+1 : open+close]
+		}
+	}
+	return sig
+}
+
+// Identity returns the "Name <email>" part of the signature.
+func (s Signature) Identity() string {
+	return fmt.Sprintf("%s <%s>", s.Name, s.Email)
+}
+
+// String formats the signature as it appears in a commit header:
+// "Name <email> <unix-time> <+hhmm>".
+func (s Signature) String() string {
+	return fmt.Sprintf("%s %d %s", s.Identity(), s.When.Unix(), s.When.Format("-0700"))
+}
+
+// ParseSignature parses the value of an author, committer or tagger header.
+func ParseSignature(value string) (Signature, error) {
+	open := strings.LastIndex(value, "<")
+	close := strings.LastIndex(value, ">")
+	if open < 0 || close < open {
+		return Signature{}, fmt.Errorf("malformed signature: %q", value)
+	}
+
+	sig := Signature{
+		Name:  strings.TrimSuffix(value[:open], " "),
+		Email: value[open+1 : close],
+	}
+
+	fields := strings.Fields(value[close+1:])
+	if len(fields) < 1 {
+		return sig, nil
+	}
+	unix, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return Signature{}, fmt.Errorf("malformed signature time: %q", value)
+	}
+	loc := time.UTC
+	if len(fields) > 1 {
+		loc = parseTimezone(fields[1])
+	}
+	sig.When = time.Unix(unix, 0).In(loc)
+	return sig, nil
+}
+
+// parseTimezone turns a "+hhmm" offset into a fixed time zone.
+func parseTimezone(tz string) *time.Location {
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') {
+		return time.UTC
+	}
+	hours, err1 := strconv.Atoi(tz[1:3])
+	minutes, err2 := strconv.Atoi(tz[3:5])
+	if err1 != nil || err2 != nil {
+		return time.UTC
+	}
+	offset := hours*3600 + minutes*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+	return time.FixedZone("", offset)
+}
+
+// Header is an extra commit header such as encoding, gpgsig or mergetag.
+// Multi-line values are stored with their lines joined by "\n"; in the
+// serialized commit each continuation line starts with a space.
+type Header struct {
+	Key   string
+	Value string
+}
+
 type Commit struct {
 	Tree      string
 	Parents   []string
-	Author    string
-	Committer string
-	Message   string
-	Timestamp time.Time
+	Author    Signature
+	Committer Signature
+	// Headers holds the headers after committer, in order, so that a
+	// parsed commit serializes back to the same bytes.
+	Headers []Header
+	Message string
 }
 
-func NewCommit(treeHash, message, author string, parents []string) *Commit {
-	now := time.Now()
+// NewCommit creates a commit authored and committed by author now. The
+// message is terminated with a newline, as Git does.
+func NewCommit(treeHash, message string, author Signature, parents []string) *Commit {
+	if author.When.IsZero() {
+		author.When = time.Now()
+	}
+	if message != "" && !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
 	return &Commit{
 		Tree:      treeHash,
 		Parents:   parents,
 		Author:    author,
 		Committer: author,
 		Message:   message,
-		Timestamp: now,
 	}
 }
-func (c *Commit) Serialize() []byte {
 
-	var lines []string
-	lines = append(lines, fmt.Sprintf("tree %s", c.Tree))
+// Header returns the value of the first extra header with the given key.
+func (c *Commit) Header(key string) (string, bool) {
+	for _, h := range c.Headers {
+		if h.Key == key {
+			return h.Value, true
+		}
+	}
+	return "", false
+}
 
-	for _, parent := range c.Parents {
-		lines = append(lines, fmt.Sprintf("parent %s", parent))
+// signatureHeader is the header holding a commit's signature.
+const signatureHeader = "gpgsig"
+
+// Signature returns the armored signature of a signed commit.
+func (c *Commit) Signature() (string, bool) {
+	sig, ok := c.Header(signatureHeader)
+	if !ok {
+		return "", false
 	}
+	return sig + "\n", true
+}
 
-	timestamp := c.Timestamp.Unix()
-	timezone := c.Timestamp.Format("-0700")
+// SetSignature adds (or replaces) the commit's signature header.
+func (c *Commit) SetSignature(armored string) {
+	c.RemoveSignature()
+	c.Headers = append(c.Headers, Header{Key: signatureHeader, Value: strings.TrimSuffix(armored, "\n")})
+}
 
-	lines = append(lines, fmt.Sprintf("author %s %d %s", c.Author, timestamp, timezone))
-	lines = append(lines, fmt.Sprintf("committer %s %d %s", c.Committer, timestamp, c.Message))
-	lines = append(lines, "")
-	lines = append(lines, c.Message)
+// RemoveSignature drops the commit's signature header, if any.
+func (c *Commit) RemoveSignature() {
+	headers := c.Headers[:0:0]
+	for _, h := range c.Headers {
+		if h.Key != signatureHeader {
+			headers = append(headers, h)
+		}
+	}
+	c.Headers = headers
+}
 
-	return []byte(strings.Join(lines, "\n"))
+// Payload returns the bytes a commit signature is made over: the commit
+// as serialized without its signature header.
+func (c *Commit) Payload() []byte {
+	unsigned := *c
+	unsigned.RemoveSignature()
+	return unsigned.Serialize()
+}
+
+func (c *Commit) Serialize() []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "tree %s\n", c.Tree)
+
+	for _, parent := range c.Parents {
+		fmt.Fprintf(&b, "parent %s\n", parent)
+	}
+
+	fmt.Fprintf(&b, "author %s\n", c.Author)
+	fmt.Fprintf(&b, "committer %s\n", c.Committer)
+	for _, h := range c.Headers {
+		fmt.Fprintf(&b, "%s %s\n", h.Key, strings.ReplaceAll(h.Value, "\n", "\n "))
+	}
+	b.WriteString("\n")
+	b.WriteString(c.Message)
+
+	return []byte(b.String())
 }
 
 func ParseCommit(content []byte) (*Commit, error) {
-	lines := strings.Split(string(content), "\n")
 	commit := &Commit{
 		Parents: make([]string, 0),
 	}
 
-	messageStart := -1
-	for i, line := range lines {
-		if line == "" {
-			messageStart = i + 1
-			break
-		}
+	// The headers end at the first empty line; the rest is the message
+	text := string(content)
+	headerText, message, found := strings.Cut(text, "\n\n")
+	if !found {
+		headerText = strings.TrimSuffix(text, "\n")
+	}
+	commit.Message = message
 
-		parts := strings.SplitN(line, " ", 2)
-		if len(parts) < 2 {
+	for _, line := range strings.Split(headerText, "\n") {
+		// A line starting with a space continues the previous header
+		if strings.HasPrefix(line, " ") {
+			if len(commit.Headers) == 0 {
+				return nil, fmt.Errorf("malformed commit: continuation line without header")
+			}
+			commit.Headers[len(commit.Headers)-1].Value += "\n" + line[1:]
 			continue
 		}
 
-		switch parts[0] {
+		key, value, _ := strings.Cut(line, " ")
+		var err error
+		switch key {
 		case "tree":
-			commit.Tree = parts[1]
+			commit.Tree = value
 		case "parent":
-			commit.Parents = append(commit.Parents, parts[1])
+			commit.Parents = append(commit.Parents, value)
 		case "author":
-			commit.Author = parsePersonWithTimestamp(parts[1])
+			commit.Author, err = ParseSignature(value)
 		case "committer":
-			commit.Committer = parsePersonWithTimestamp(parts[1])
+			commit.Committer, err = ParseSignature(value)
+		default:
+			commit.Headers = append(commit.Headers, Header{Key: key, Value: value})
+		}
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	if messageStart >= 0 && messageStart < len(lines) {
-		commit.Message = strings.Join(lines[messageStart:], "\n")
+	if commit.Tree == "" {
+		return nil, fmt.Errorf("malformed commit: missing tree")
 	}
-
 	return commit, nil
 }
-
-func parsePersonWithTimestamp(line string) string {
-	// Format: "Name <email> timestamp timezone"
-	// For simplicity, just return the name and email part
-	parts := strings.Fields(line)
-	if len(parts) >= 2 {
-		// Find the last two parts (timestamp and timezone) and exclude them
-		nameEmailParts := parts[:len(parts)-2]
-		return strings.Join(nameEmailParts, " ")
-	}
-	return line
-}
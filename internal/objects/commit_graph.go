@@ -0,0 +1,435 @@
+package objects
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// The commit-graph file, objects/info/commit-graph, stores the parents,
+// tree, commit time and generation number of commits in Git's format, so
+// that history walks need not inflate and parse every commit.
+const (
+	graphSignature   = "CGPH"
+	graphVersion     = 1
+	graphHashVersion = 1 // SHA-1
+	graphHashLen     = 20
+	graphDataLen     = graphHashLen + 16
+
+	graphParentNone   = 0x70000000
+	graphOctopus      = 0x80000000
+	graphLastEdge     = 0x80000000
+	graphMaxLevel     = 0x3FFFFFFF
+	graphChunkEntry   = 12
+	graphHeaderLength = 8
+)
+
+// Chunk IDs of the commit-graph file.
+const (
+	chunkFanout = 0x4f494446 // "OIDF"
+	chunkOIDs   = 0x4f49444c // "OIDL"
+	chunkData   = 0x43444154 // "CDAT"
+	chunkEdges  = 0x45444745 // "EDGE"
+)
+
+// GenerationInfinity is the generation number of a commit that is not in
+// the commit-graph: it may be anywhere in history.
+const GenerationInfinity = ^uint32(0)
+
+// CommitGraph is a loaded commit-graph file. Commits are identified by
+// their position in it, in hash order.
+type CommitGraph struct {
+	fanout []byte
+	oids   []byte
+	data   []byte
+	edges  []byte
+	count  int
+}
+
+// CommitGraphPath returns the path of the commit-graph file.
+func (o *ObjectStore) CommitGraphPath() string {
+	return filepath.Join(o.objectsDir, "info", "commit-graph")
+}
+
+// ReadCommitGraph loads the commit-graph file. It returns nil and no error
+// if there is none.
+func (o *ObjectStore) ReadCommitGraph() (*CommitGraph, error) {
+	content, err := os.ReadFile(o.CommitGraphPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseCommitGraph(content)
+}
+
+func parseCommitGraph(content []byte) (*CommitGraph, error) {
+	if len(content) < graphHeaderLength+graphChunkEntry+graphHashLen || string(content[:4]) != graphSignature {
+		return nil, fmt.Errorf("commit-graph signature does not match")
+	}
+	if content[4] != graphVersion {
+		return nil, fmt.Errorf("commit-graph version %d does not match version %d", content[4], graphVersion)
+	}
+	if content[5] != graphHashVersion {
+		return nil, fmt.Errorf("commit-graph hash version %d does not match version %d", content[5], graphHashVersion)
+	}
+
+	g := &CommitGraph{}
+	chunks := int(content[6])
+	end := len(content) - graphHashLen
+	table := content[graphHeaderLength:]
+	if len(table) < (chunks+1)*graphChunkEntry {
+		return nil, fmt.Errorf("commit-graph chunk lookup table is truncated")
+	}
+	for i := 0; i < chunks; i++ {
+		entry := table[i*graphChunkEntry:]
+		id := binary.BigEndian.Uint32(entry)
+		start := binary.BigEndian.Uint64(entry[4:])
+		stop := binary.BigEndian.Uint64(entry[4+graphChunkEntry:])
+		if start > stop || stop > uint64(end) {
+			return nil, fmt.Errorf("commit-graph chunk %08x is out of bounds", id)
+		}
+		chunk := content[start:stop]
+		switch id {
+		case chunkFanout:
+			g.fanout = chunk
+		case chunkOIDs:
+			g.oids = chunk
+		case chunkData:
+			g.data = chunk
+		case chunkEdges:
+			g.edges = chunk
+		}
+	}
+
+	if len(g.fanout) != 256*4 || g.oids == nil || g.data == nil {
+		return nil, fmt.Errorf("commit-graph is missing a required chunk")
+	}
+	g.count = int(binary.BigEndian.Uint32(g.fanout[255*4:]))
+	if len(g.oids) != g.count*graphHashLen || len(g.data) != g.count*graphDataLen {
+		return nil, fmt.Errorf("commit-graph chunks do not match its %d commits", g.count)
+	}
+	return g, nil
+}
+
+// Len returns the number of commits in the graph.
+func (g *CommitGraph) Len() int {
+	return g.count
+}
+
+// Lookup returns the position of a commit in the graph.
+func (g *CommitGraph) Lookup(hash string) (int, bool) {
+	oid, err := hex.DecodeString(hash)
+	if err != nil || len(oid) != graphHashLen {
+		return 0, false
+	}
+	lo := 0
+	if oid[0] > 0 {
+		lo = int(binary.BigEndian.Uint32(g.fanout[(int(oid[0])-1)*4:]))
+	}
+	hi := int(binary.BigEndian.Uint32(g.fanout[int(oid[0])*4:]))
+	pos := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(g.oid(lo+i), oid) >= 0
+	})
+	if pos < hi && bytes.Equal(g.oid(pos), oid) {
+		return pos, true
+	}
+	return 0, false
+}
+
+func (g *CommitGraph) oid(pos int) []byte {
+	return g.oids[pos*graphHashLen : (pos+1)*graphHashLen]
+}
+
+// Hash returns the hash of the commit at a position.
+func (g *CommitGraph) Hash(pos int) string {
+	return hex.EncodeToString(g.oid(pos))
+}
+
+// Tree returns the hash of the commit's tree.
+func (g *CommitGraph) Tree(pos int) string {
+	return hex.EncodeToString(g.data[pos*graphDataLen : pos*graphDataLen+graphHashLen])
+}
+
+// Parents returns the positions of the commit's parents, in order.
+func (g *CommitGraph) Parents(pos int) []int {
+	d := g.data[pos*graphDataLen+graphHashLen:]
+	first, second := binary.BigEndian.Uint32(d), binary.BigEndian.Uint32(d[4:])
+	if first == graphParentNone {
+		return nil
+	}
+	parents := []int{int(first)}
+	switch {
+	case second == graphParentNone:
+	case second&graphOctopus == 0:
+		parents = append(parents, int(second))
+	default:
+		for i := int(second &^ graphOctopus); (i+1)*4 <= len(g.edges); i++ {
+			edge := binary.BigEndian.Uint32(g.edges[i*4:])
+			parents = append(parents, int(edge&^graphLastEdge))
+			if edge&graphLastEdge != 0 {
+				break
+			}
+		}
+	}
+	return parents
+}
+
+// Generation returns the commit's generation number: 1 for a root commit,
+// and otherwise one more than the highest of its parents'. A commit can
+// only reach commits with a lower generation number.
+func (g *CommitGraph) Generation(pos int) uint32 {
+	return binary.BigEndian.Uint32(g.data[pos*graphDataLen+graphHashLen+8:]) >> 2
+}
+
+// CommitTime returns the committer time of the commit, in seconds since
+// the epoch.
+func (g *CommitGraph) CommitTime(pos int) int64 {
+	d := g.data[pos*graphDataLen+graphHashLen+8:]
+	high := int64(binary.BigEndian.Uint32(d) & 3)
+	return high<<32 | int64(binary.BigEndian.Uint32(d[4:]))
+}
+
+// graphCommit is a commit being written to the commit-graph.
+type graphCommit struct {
+	oid     []byte
+	tree    string
+	parents []string
+	time    int64
+	level   uint32
+}
+
+// WriteCommitGraph writes a commit-graph holding the given commits and
+// every commit they reach, replacing any existing one. Commits the old
+// graph holds are taken from it rather than parsed again. It returns the
+// number of commits written.
+func (o *ObjectStore) WriteCommitGraph(tips []string) (int, error) {
+	old, err := o.ReadCommitGraph()
+	if err != nil {
+		old = nil
+	}
+
+	commits := make(map[string]*graphCommit)
+	stack := append([]string(nil), tips...)
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if _, seen := commits[hash]; seen {
+			continue
+		}
+		c, err := o.graphCommit(old, hash)
+		if err != nil {
+			return 0, err
+		}
+		commits[hash] = c
+		stack = append(stack, c.parents...)
+	}
+
+	// Levels need the parents' levels first; walk without recursion,
+	// since histories can be far deeper than the stack
+	for hash := range commits {
+		stack := []string{hash}
+		for len(stack) > 0 {
+			top := commits[stack[len(stack)-1]]
+			if top.level != 0 {
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			level, ready := uint32(1), true
+			for _, p := range top.parents {
+				pl := commits[p].level
+				if pl == 0 {
+					stack = append(stack, p)
+					ready = false
+				} else if pl+1 > level {
+					level = pl + 1
+				}
+			}
+			if ready {
+				top.level = min(level, graphMaxLevel)
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+
+	hashes := make([]string, 0, len(commits))
+	for hash := range commits {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	positions := make(map[string]uint32, len(hashes))
+	for i, hash := range hashes {
+		positions[hash] = uint32(i)
+	}
+
+	fanout := make([]byte, 256*4)
+	oids := make([]byte, 0, len(hashes)*graphHashLen)
+	data := make([]byte, 0, len(hashes)*graphDataLen)
+	var edges []byte
+	counts := make([]uint32, 256)
+	for _, hash := range hashes {
+		c := commits[hash]
+		counts[c.oid[0]]++
+		oids = append(oids, c.oid...)
+
+		tree, _ := hex.DecodeString(c.tree)
+		data = append(data, tree...)
+		first, second := uint32(graphParentNone), uint32(graphParentNone)
+		if len(c.parents) > 0 {
+			first = positions[c.parents[0]]
+		}
+		switch {
+		case len(c.parents) == 2:
+			second = positions[c.parents[1]]
+		case len(c.parents) > 2:
+			second = graphOctopus | uint32(len(edges)/4)
+			for i, p := range c.parents[1:] {
+				edge := positions[p]
+				if i == len(c.parents)-2 {
+					edge |= graphLastEdge
+				}
+				edges = binary.BigEndian.AppendUint32(edges, edge)
+			}
+		}
+		data = binary.BigEndian.AppendUint32(data, first)
+		data = binary.BigEndian.AppendUint32(data, second)
+		data = binary.BigEndian.AppendUint32(data, c.level<<2|uint32(c.time>>32)&3)
+		data = binary.BigEndian.AppendUint32(data, uint32(c.time))
+	}
+	total := uint32(0)
+	for i, n := range counts {
+		total += n
+		binary.BigEndian.PutUint32(fanout[i*4:], total)
+	}
+
+	type chunk struct {
+		id      uint32
+		content []byte
+	}
+	chunks := []chunk{{chunkFanout, fanout}, {chunkOIDs, oids}, {chunkData, data}}
+	if len(edges) > 0 {
+		chunks = append(chunks, chunk{chunkEdges, edges})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(graphSignature)
+	buf.Write([]byte{graphVersion, graphHashVersion, byte(len(chunks)), 0})
+	offset := uint64(graphHeaderLength + (len(chunks)+1)*graphChunkEntry)
+	for _, c := range chunks {
+		binary.Write(&buf, binary.BigEndian, c.id)
+		binary.Write(&buf, binary.BigEndian, offset)
+		offset += uint64(len(c.content))
+	}
+	binary.Write(&buf, binary.BigEndian, uint32(0))
+	binary.Write(&buf, binary.BigEndian, offset)
+	for _, c := range chunks {
+		buf.Write(c.content)
+	}
+	sum := sha1.Sum(buf.Bytes())
+	buf.Write(sum[:])
+
+	path := o.CommitGraphPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	tmp := path + ".lock"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0444); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return len(hashes), nil
+}
+
+// graphCommit reads what the commit-graph records about a commit, from the
+// old graph if it has the commit.
+func (o *ObjectStore) graphCommit(old *CommitGraph, hash string) (*graphCommit, error) {
+	oid, err := hex.DecodeString(hash)
+	if err != nil || len(oid) != graphHashLen {
+		return nil, fmt.Errorf("invalid commit hash %s", hash)
+	}
+	if old != nil {
+		if pos, ok := old.Lookup(hash); ok {
+			c := &graphCommit{oid: oid, tree: old.Tree(pos), time: old.CommitTime(pos)}
+			for _, p := range old.Parents(pos) {
+				c.parents = append(c.parents, old.Hash(p))
+			}
+			return c, nil
+		}
+	}
+
+	obj, err := o.ReadObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Type != CommitType {
+		return nil, fmt.Errorf("object %s is a %s, not a commit", hash, obj.Type)
+	}
+	commit, err := ParseCommit(obj.Content)
+	if err != nil {
+		return nil, err
+	}
+	return &graphCommit{oid: oid, tree: commit.Tree, parents: commit.Parents, time: commit.Committer.When.Unix()}, nil
+}
+
+// VerifyCommitGraph checks the commit-graph file against its checksum and against
+// the commit objects it describes.
+func (o *ObjectStore) VerifyCommitGraph() error {
+	content, err := os.ReadFile(o.CommitGraphPath())
+	if err != nil {
+		return err
+	}
+	g, err := parseCommitGraph(content)
+	if err != nil {
+		return err
+	}
+	body := content[:len(content)-graphHashLen]
+	if sum := sha1.Sum(body); !bytes.Equal(sum[:], content[len(body):]) {
+		return fmt.Errorf("the commit-graph file has incorrect checksum and is likely corrupt")
+	}
+
+	for pos := 0; pos < g.count; pos++ {
+		hash := g.Hash(pos)
+		if pos > 0 && bytes.Compare(g.oid(pos-1), g.oid(pos)) >= 0 {
+			return fmt.Errorf("commit-graph has incorrect OID order: %s then %s", g.Hash(pos-1), hash)
+		}
+		obj, err := o.ReadObject(hash)
+		if err != nil {
+			return fmt.Errorf("failed to load commit %s from the object database: %v", hash, err)
+		}
+		commit, err := ParseCommit(obj.Content)
+		if err != nil {
+			return fmt.Errorf("failed to parse commit %s: %v", hash, err)
+		}
+		if g.Tree(pos) != commit.Tree {
+			return fmt.Errorf("root tree OID for commit %s in commit-graph is %s != %s", hash, g.Tree(pos), commit.Tree)
+		}
+
+		parents := g.Parents(pos)
+		if len(parents) != len(commit.Parents) {
+			return fmt.Errorf("commit-graph parent list for commit %s has %d parents, not %d", hash, len(parents), len(commit.Parents))
+		}
+		level := uint32(1)
+		for i, p := range parents {
+			if p >= g.count || g.Hash(p) != commit.Parents[i] {
+				return fmt.Errorf("commit-graph parent for %s is wrong", hash)
+			}
+			level = max(level, g.Generation(p)+1)
+		}
+		if g.Generation(pos) != min(level, graphMaxLevel) {
+			return fmt.Errorf("commit-graph generation for commit %s is %d != %d", hash, g.Generation(pos), level)
+		}
+		if g.CommitTime(pos) != commit.Committer.When.Unix() {
+			return fmt.Errorf("commit date for commit %s in commit-graph is %d != %d", hash, g.CommitTime(pos), commit.Committer.When.Unix())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package objects
+
+import "os"
+
+// Tree entry modes used by Git.
+const (
+	ModeFile       = "100644"
+	ModeExecutable = "100755"
+	ModeSymlink    = "120000"
+	ModeTree       = "40000"
+	ModeGitlink    = "160000"
+)
+
+// ModeFromPermissions returns the tree entry mode for a file with the given
+// mode bits, as recorded in the index.
+func ModeFromPermissions(perm os.FileMode) string {
+	switch {
+	case perm&os.ModeSymlink != 0:
+		return ModeSymlink
+	case perm&0111 != 0:
+		return ModeExecutable
+	default:
+		return ModeFile
+	}
+}
+
+// PermissionsFromMode returns the mode bits to record in the index for a tree
+// entry mode.
+func PermissionsFromMode(mode string) os.FileMode {
+	switch mode {
+	case ModeSymlink:
+		return os.ModeSymlink | 0777
+	case ModeExecutable:
+		return 0755
+	default:
+		return 0644
+	}
+}
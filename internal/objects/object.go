@@ -19,6 +19,7 @@ const (
 	BlobType   ObjectType = "blob"
 	TreeType   ObjectType = "tree"
 	CommitType ObjectType = "commit"
+	TagType    ObjectType = "tag"
 )
 
 type Object struct {
@@ -194,6 +195,14 @@ func (o *ObjectStore) traverseObjects(hash string, visited map[string]bool) erro
 				}
 			}
 		}
+	case "tag":
+		tag, err := ParseTag(obj.Content)
+		if err != nil {
+			return err
+		}
+		if err := o.traverseObjects(tag.Object, visited); err != nil {
+			return err
+		}
 	case "tree":
 		data := obj.Content
 		for len(data) > 0 {
@@ -219,3 +228,51 @@ func (o *ObjectStore) traverseObjects(hash string, visited map[string]bool) erro
 
 	return nil
 }
+
+// HasObject reports whether an object with the given full hash is stored.
+func (o *ObjectStore) HasObject(hash string) bool {
+	if len(hash) != 40 {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(o.objectsDir, hash[:2], hash[2:]))
+	return err == nil
+}
+
+// ResolvePrefix expands an abbreviated object hash to the full hash.
+// It fails if no object or more than one object matches the prefix.
+func (o *ObjectStore) ResolvePrefix(prefix string) (string, error) {
+	prefix = strings.ToLower(prefix)
+	if len(prefix) < 4 || len(prefix) > 40 {
+		return "", fmt.Errorf("invalid object name: %s", prefix)
+	}
+	if _, err := hex.DecodeString(prefix[:len(prefix)&^1]); err != nil {
+		return "", fmt.Errorf("invalid object name: %s", prefix)
+	}
+	if len(prefix) == 40 {
+		if o.HasObject(prefix) {
+			return prefix, nil
+		}
+		return "", fmt.Errorf("object not found: %s", prefix)
+	}
+
+	files, err := os.ReadDir(filepath.Join(o.objectsDir, prefix[:2]))
+	if err != nil {
+		return "", fmt.Errorf("object not found: %s", prefix)
+	}
+
+	var matches []string
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), prefix[2:]) {
+			matches = append(matches, prefix[:2]+file.Name())
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("object not found: %s", prefix)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("short object ID %s is ambiguous", prefix)
+	}
+}
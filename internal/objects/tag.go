@@ -0,0 +1,103 @@
+package objects
+
+import (
+	"fmt"
+	"strings"
+)
+
+// signatureMarkers are the lines that start a signature appended to a tag
+// message.
+var signatureMarkers = []string{
+	"-----BEGIN PGP SIGNATURE-----\n",
+	"-----BEGIN PGP MESSAGE-----\n",
+	"-----BEGIN SSH SIGNATURE-----\n",
+	"-----BEGIN SIGNED MESSAGE-----\n",
+}
+
+// Tag is an annotated tag object. Unlike a commit, a signed tag carries
+// its signature at the end of the message rather than in a header.
+type Tag struct {
+	Object    string
+	Type      ObjectType
+	Name      string
+	Tagger    *Signature // nil for (old) tags without a tagger line
+	Message   string
+	Signature string
+}
+
+// NewTag creates an annotated tag pointing at object.
+func NewTag(object string, objType ObjectType, name, message string, tagger Signature) *Tag {
+	if message != "" && !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+	return &Tag{
+		Object:  object,
+		Type:    objType,
+		Name:    name,
+		Tagger:  &tagger,
+		Message: message,
+	}
+}
+
+// Payload returns the bytes a tag signature is made over: the tag without
+// its signature.
+func (t *Tag) Payload() []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "object %s\n", t.Object)
+	fmt.Fprintf(&b, "type %s\n", t.Type)
+	fmt.Fprintf(&b, "tag %s\n", t.Name)
+	if t.Tagger != nil {
+		fmt.Fprintf(&b, "tagger %s\n", t.Tagger)
+	}
+	b.WriteString("\n")
+	b.WriteString(t.Message)
+	return []byte(b.String())
+}
+
+func (t *Tag) Serialize() []byte {
+	return append(t.Payload(), t.Signature...)
+}
+
+func ParseTag(content []byte) (*Tag, error) {
+	headerText, message, _ := strings.Cut(string(content), "\n\n")
+
+	tag := &Tag{}
+	for _, line := range strings.Split(headerText, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "object":
+			tag.Object = value
+		case "type":
+			tag.Type = ObjectType(value)
+		case "tag":
+			tag.Name = value
+		case "tagger":
+			sig, err := ParseSignature(value)
+			if err != nil {
+				return nil, err
+			}
+			tag.Tagger = &sig
+		}
+	}
+	if tag.Object == "" || tag.Type == "" {
+		return nil, fmt.Errorf("malformed tag: missing object or type")
+	}
+
+	// The signature, if any, starts at the last signature marker that
+	// begins a line
+	start := -1
+	for _, marker := range signatureMarkers {
+		if strings.HasPrefix(message, marker) {
+			start = max(start, 0)
+		}
+		if i := strings.LastIndex(message, "\n"+marker); i >= 0 {
+			start = max(start, i+1)
+		}
+	}
+	if start >= 0 {
+		tag.Message, tag.Signature = message[:start], message[start:]
+	} else {
+		tag.Message = message
+	}
+	return tag, nil
+}
@@ -36,21 +36,14 @@ func (t *Tree) AddEntry(mode, name, hash string, objType ObjectType) {
 }
 
 func (t *Tree) Serialize() []byte {
-	fmt.Printf("DEBUG: Serializing tree with %d entries\n", len(t.Entries))
-
+	// Git sorts subtrees as if their names ended in "/"
 	sort.Slice(t.Entries, func(i, j int) bool {
-		return t.Entries[i].Name < t.Entries[j].Name
+		return sortKey(t.Entries[i]) < sortKey(t.Entries[j])
 	})
 
 	var buf bytes.Buffer
 
-	for i, entry := range t.Entries {
-		fmt.Printf("DEBUG: Processing entry %d:\n", i)
-		fmt.Printf("  Mode: '%s'\n", entry.Mode)
-		fmt.Printf("  Name: '%s'\n", entry.Name)
-		fmt.Printf("  Hash: '%s' (length: %d)\n", entry.Hash, len(entry.Hash))
-		fmt.Printf("  Type: %v\n", entry.Type)
-
+	for _, entry := range t.Entries {
 		// Check hash length before processing
 		if len(entry.Hash) != 40 {
 			panic(fmt.Sprintf("INVALID HASH: Entry '%s' has hash '%s' with length %d (expected 40)",
@@ -72,13 +65,19 @@ func (t *Tree) Serialize() []byte {
 		}
 
 		buf.Write(hashBytes)
-		fmt.Printf("  Successfully processed entry '%s'\n", entry.Name)
 	}
 
-	fmt.Printf("DEBUG: Tree serialization complete, total size: %d bytes\n", buf.Len())
 	return buf.Bytes()
 }
 
+// sortKey is the name an entry is ordered by within its tree.
+func sortKey(e TreeEntry) string {
+	if e.Mode == ModeTree {
+		return e.Name + "/"
+	}
+	return e.Name
+}
+
 func ParseTree(content []byte) (*Tree, error) {
 	tree := NewTree()
 	offset := 0
@@ -113,11 +112,14 @@ func ParseTree(content []byte) (*Tree, error) {
 
 		// Determine object type based on mode
 		var objType ObjectType
-		if mode == "100644" || mode == "100755" {
+		switch mode {
+		case ModeFile, ModeExecutable, ModeSymlink:
 			objType = BlobType
-		} else if mode == "40000" {
+		case ModeTree:
 			objType = TreeType
-		} else {
+		case ModeGitlink:
+			objType = CommitType
+		default:
 			objType = BlobType // Default
 		}
 
@@ -200,11 +202,7 @@ func (os *ObjectStore) BuildTreeFromIndex(indexEntries map[string]*index.IndexEn
 		}
 
 		if parentTree, exists := treeMap[parentPath]; exists {
-			mode := "100644"
-			if entry.Permissions&0111 != 0 {
-				mode = "100755"
-			}
-			parentTree.AddEntry(mode, fileName, entry.Hash, BlobType)
+			parentTree.AddEntry(ModeFromPermissions(entry.Permissions), fileName, entry.Hash, BlobType)
 		}
 	}
 
@@ -228,14 +226,10 @@ func (os *ObjectStore) BuildTreeFromIndex(indexEntries map[string]*index.IndexEn
 		return depthI > depthJ
 	})
 
-	fmt.Printf("DEBUG: Processing trees in order: %v\n", paths)
-
 	// Write each tree
 	for _, path := range paths {
 		tree := treeMap[path]
 
-		fmt.Printf("DEBUG: Processing tree for path '%s' with %d entries\n", path, len(tree.Entries))
-
 		// Fill in subtree hashes
 		for i, entry := range tree.Entries {
 			if entry.Type == TreeType && entry.Hash == "PLACEHOLDER" {
@@ -246,12 +240,9 @@ func (os *ObjectStore) BuildTreeFromIndex(indexEntries map[string]*index.IndexEn
 					subPath = subPath + "/" + entry.Name
 				}
 
-				fmt.Printf("DEBUG: Looking for hash for subtree: '%s'\n", subPath)
 				if hash, exists := treeHashes[subPath]; exists {
-					fmt.Printf("DEBUG: Found hash for '%s': %s\n", subPath, hash)
 					tree.Entries[i].Hash = hash
 				} else {
-					fmt.Printf("DEBUG: Available tree hashes: %v\n", treeHashes)
 					return "", fmt.Errorf("missing hash for subtree: %s", subPath)
 				}
 			}
@@ -265,11 +256,8 @@ func (os *ObjectStore) BuildTreeFromIndex(indexEntries map[string]*index.IndexEn
 		}
 
 		treeHashes[path] = hash
-		fmt.Printf("DEBUG: Stored tree hash for path '%s': %s\n", path, hash)
 	}
 
 	// Return root tree hash
-	rootHash := treeHashes[""]
-	fmt.Printf("DEBUG: Returning root tree hash: %s\n", rootHash)
-	return rootHash, nil
+	return treeHashes[""], nil
 }
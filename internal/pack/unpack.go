@@ -0,0 +1,340 @@
+// Package pack reads Git packfiles, as sent by a pushing client, into the
+// object store.
+package pack
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"mygit/internal/objects"
+)
+
+// Object type numbers used in pack entry headers.
+const (
+	typeCommit   = 1
+	typeTree     = 2
+	typeBlob     = 3
+	typeTag      = 4
+	typeOfsDelta = 6
+	typeRefDelta = 7
+)
+
+var objectTypes = map[int]objects.ObjectType{
+	typeCommit: objects.CommitType,
+	typeTree:   objects.TreeType,
+	typeBlob:   objects.BlobType,
+	typeTag:    objects.TagType,
+}
+
+// entry is one object of a pack, before delta resolution.
+type entry struct {
+	offset     int64
+	kind       int
+	data       []byte // the object content, or the delta for delta entries
+	baseOffset int64  // base of an ofs-delta
+	baseHash   string // base of a ref-delta
+
+	resolved bool // content is known
+	written  bool // content is in the store
+	objType  objects.ObjectType
+	content  []byte
+}
+
+// reader reads a pack stream byte-exactly, keeping track of the offset and
+// the checksum of everything read. It implements io.ByteReader so that
+// zlib does not read past the end of each compressed object.
+type reader struct {
+	r      *bufio.Reader
+	sum    hash.Hash
+	offset int64
+}
+
+func (p *reader) ReadByte() (byte, error) {
+	b, err := p.r.ReadByte()
+	if err == nil {
+		p.sum.Write([]byte{b})
+		p.offset++
+	}
+	return b, err
+}
+
+func (p *reader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	p.sum.Write(buf[:n])
+	p.offset += int64(n)
+	return n, err
+}
+
+// Unpack reads a version 2 or 3 packfile from r and writes every object
+// in it to the store. Deltas may be based on objects elsewhere in the pack
+// or, in a thin pack, on objects already in the store. It returns the
+// number of objects written.
+func Unpack(r io.Reader, store *objects.ObjectStore) (int, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	p := &reader{r: br, sum: sha1.New()}
+
+	var header [12]byte
+	if _, err := io.ReadFull(p, header[:]); err != nil {
+		return 0, fmt.Errorf("reading pack header: %w", err)
+	}
+	if string(header[:4]) != "PACK" {
+		return 0, fmt.Errorf("not a pack file")
+	}
+	if version := binary.BigEndian.Uint32(header[4:8]); version != 2 && version != 3 {
+		return 0, fmt.Errorf("unsupported pack version %d", version)
+	}
+	count := binary.BigEndian.Uint32(header[8:12])
+
+	entries := make([]*entry, 0, count)
+	byOffset := make(map[int64]*entry, count)
+	for i := uint32(0); i < count; i++ {
+		e, err := readEntry(p)
+		if err != nil {
+			return 0, fmt.Errorf("reading object %d: %w", i, err)
+		}
+		entries = append(entries, e)
+		byOffset[e.offset] = e
+	}
+
+	expected := p.sum.Sum(nil)
+	var trailer [20]byte
+	if _, err := io.ReadFull(br, trailer[:]); err != nil {
+		return 0, fmt.Errorf("reading pack checksum: %w", err)
+	}
+	if !bytes.Equal(expected, trailer[:]) {
+		return 0, fmt.Errorf("pack checksum mismatch")
+	}
+
+	// Resolve deltas. A ref-delta may name a base that only becomes known
+	// once another delta is resolved, so keep going while progress is made.
+	byHash := make(map[string]*entry)
+	written := 0
+	for pending := len(entries); pending > 0; {
+		progress := false
+		for _, e := range entries {
+			if e.written {
+				continue
+			}
+			ok, err := resolve(e, byOffset, byHash, store)
+			if err != nil {
+				return written, err
+			}
+			if !ok {
+				continue
+			}
+
+			hash, err := store.WriteObject(e.content, e.objType)
+			if err != nil {
+				return written, err
+			}
+			byHash[hash] = e
+			e.written = true
+			written++
+			pending--
+			progress = true
+		}
+		if !progress {
+			return written, fmt.Errorf("%d deltas could not be resolved: missing base objects", pending)
+		}
+	}
+	return written, nil
+}
+
+// readEntry reads the header and compressed data of the next pack entry.
+func readEntry(p *reader) (*entry, error) {
+	e := &entry{offset: p.offset}
+
+	c, err := p.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	e.kind = int(c>>4) & 7
+	size := uint64(c & 0x0f)
+	for shift := 4; c&0x80 != 0; shift += 7 {
+		if c, err = p.ReadByte(); err != nil {
+			return nil, err
+		}
+		size |= uint64(c&0x7f) << shift
+	}
+
+	switch e.kind {
+	case typeOfsDelta:
+		c, err := p.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		distance := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = p.ReadByte(); err != nil {
+				return nil, err
+			}
+			distance = (distance+1)<<7 | int64(c&0x7f)
+		}
+		e.baseOffset = e.offset - distance
+	case typeRefDelta:
+		var base [20]byte
+		if _, err := io.ReadFull(p, base[:]); err != nil {
+			return nil, err
+		}
+		e.baseHash = hex.EncodeToString(base[:])
+	default:
+		objType, ok := objectTypes[e.kind]
+		if !ok {
+			return nil, fmt.Errorf("unknown object type %d", e.kind)
+		}
+		e.objType = objType
+	}
+
+	zr, err := zlib.NewReader(p)
+	if err != nil {
+		return nil, err
+	}
+	e.data, err = io.ReadAll(zr)
+	zr.Close()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(e.data)) != size {
+		return nil, fmt.Errorf("object size mismatch: expected %d, got %d", size, len(e.data))
+	}
+
+	if e.kind != typeOfsDelta && e.kind != typeRefDelta {
+		e.content, e.data = e.data, nil
+		e.resolved = true
+	}
+	return e, nil
+}
+
+// resolve computes the content of a delta entry if its base is available.
+// It reports false if the base is not known yet.
+func resolve(e *entry, byOffset map[int64]*entry, byHash map[string]*entry, store *objects.ObjectStore) (bool, error) {
+	if e.resolved {
+		return true, nil
+	}
+
+	var baseType objects.ObjectType
+	var baseContent []byte
+	switch e.kind {
+	case typeOfsDelta:
+		base, ok := byOffset[e.baseOffset]
+		if !ok {
+			return false, fmt.Errorf("delta base offset %d is not an object", e.baseOffset)
+		}
+		if ok, err := resolve(base, byOffset, byHash, store); !ok || err != nil {
+			return false, err
+		}
+		baseType, baseContent = base.objType, base.content
+	case typeRefDelta:
+		if base, ok := byHash[e.baseHash]; ok {
+			baseType, baseContent = base.objType, base.content
+		} else if store.HasObject(e.baseHash) {
+			obj, err := store.ReadObject(e.baseHash)
+			if err != nil {
+				return false, err
+			}
+			baseType, baseContent = obj.Type, obj.Content
+		} else {
+			return false, nil
+		}
+	}
+
+	content, err := applyDelta(baseContent, e.data)
+	if err != nil {
+		return false, err
+	}
+	e.objType, e.content, e.data = baseType, content, nil
+	e.resolved = true
+	return true, nil
+}
+
+// applyDelta rebuilds an object from its base and a delta made of copy
+// and insert instructions.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	pos := 0
+	varint := func() (int, error) {
+		n, shift := 0, 0
+		for {
+			if pos >= len(delta) {
+				return 0, fmt.Errorf("truncated delta")
+			}
+			c := delta[pos]
+			pos++
+			n |= int(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				return n, nil
+			}
+		}
+	}
+
+	baseSize, err := varint()
+	if err != nil {
+		return nil, err
+	}
+	if baseSize != len(base) {
+		return nil, fmt.Errorf("delta base size mismatch")
+	}
+	resultSize, err := varint()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, resultSize)
+	for pos < len(delta) {
+		op := delta[pos]
+		pos++
+		switch {
+		case op&0x80 != 0:
+			// Copy from the base: bits 0-3 select offset bytes, 4-6 size bytes
+			offset, size := 0, 0
+			for i := 0; i < 4; i++ {
+				if op&(1<<i) != 0 {
+					if pos >= len(delta) {
+						return nil, fmt.Errorf("truncated delta")
+					}
+					offset |= int(delta[pos]) << (8 * i)
+					pos++
+				}
+			}
+			for i := 0; i < 3; i++ {
+				if op&(0x10<<i) != 0 {
+					if pos >= len(delta) {
+						return nil, fmt.Errorf("truncated delta")
+					}
+					size |= int(delta[pos]) << (8 * i)
+					pos++
+				}
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > len(base) {
+				return nil, fmt.Errorf("delta copies past the end of its base")
+			}
+			result = append(result, base[offset:offset+size]...)
+		case op != 0:
+			// Insert the next op bytes
+			if pos+int(op) > len(delta) {
+				return nil, fmt.Errorf("truncated delta")
+			}
+			result = append(result, delta[pos:pos+int(op)]...)
+			pos += int(op)
+		default:
+			return nil, fmt.Errorf("invalid delta instruction")
+		}
+	}
+
+	if len(result) != resultSize {
+		return nil, fmt.Errorf("delta result size mismatch")
+	}
+	return result, nil
+}
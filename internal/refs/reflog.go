@@ -0,0 +1,173 @@
+package refs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ZeroHash is the placeholder Git uses for a ref that does not exist.
+const ZeroHash = "0000000000000000000000000000000000000000"
+
+// ReflogEntry is a single recorded update of a ref.
+type ReflogEntry struct {
+	OldHash  string
+	NewHash  string
+	Identity string // "Name <email>"
+	Time     time.Time
+	Message  string
+}
+
+func (rm *RefManager) reflogPath(refPath string) string {
+	return filepath.Join(rm.GitDir, "logs", refPath)
+}
+
+// AppendReflog records that refPath moved from oldHash to newHash.
+func (rm *RefManager) AppendReflog(refPath, oldHash, newHash, identity, message string) error {
+	if oldHash == "" {
+		oldHash = ZeroHash
+	}
+	if newHash == "" {
+		newHash = ZeroHash
+	}
+
+	logPath := rm.reflogPath(refPath)
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return fmt.Errorf("failed to create reflog directory: %w", err)
+	}
+
+	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open reflog: %w", err)
+	}
+	defer file.Close()
+
+	now := time.Now()
+	message = strings.ReplaceAll(message, "\n", " ")
+	line := fmt.Sprintf("%s %s %s %d %s\t%s\n", oldHash, newHash, identity, now.Unix(), now.Format("-0700"), message)
+	if _, err := file.WriteString(line); err != nil {
+		return fmt.Errorf("failed to write reflog: %w", err)
+	}
+	return nil
+}
+
+// ReadReflog returns the reflog of refPath, newest entry first.
+func (rm *RefManager) ReadReflog(refPath string) ([]ReflogEntry, error) {
+	file, err := os.Open(rm.reflogPath(refPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read reflog: %w", err)
+	}
+	defer file.Close()
+
+	var entries []ReflogEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry, ok := parseReflogLine(scanner.Text())
+		if ok {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// parseReflogLine parses "<old> <new> <identity> <unix> <tz>\t<message>".
+func parseReflogLine(line string) (ReflogEntry, bool) {
+	header, message, _ := strings.Cut(line, "\t")
+	if len(header) < 82 {
+		return ReflogEntry{}, false
+	}
+
+	entry := ReflogEntry{
+		OldHash: header[:40],
+		NewHash: header[41:81],
+		Message: message,
+	}
+
+	rest := header[82:]
+	fields := strings.Fields(rest)
+	if len(fields) >= 2 {
+		unix, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+		if err == nil {
+			entry.Time = time.Unix(unix, 0)
+			entry.Identity = strings.Join(fields[:len(fields)-2], " ")
+			return entry, true
+		}
+	}
+	entry.Identity = rest
+	return entry, true
+}
+
+// UpdateHEAD moves HEAD to hash and records the move in the reflogs.
+// If HEAD points at a branch, the branch is moved; if it is detached,
+// HEAD itself is rewritten.
+func (rm *RefManager) UpdateHEAD(hash, identity, message string) error {
+	oldHash, _ := rm.GetHEAD()
+
+	branch, err := rm.GetCurrentBranch()
+	if err == nil {
+		refPath := "refs/heads/" + branch
+		if err := rm.SetRef(refPath, hash); err != nil {
+			return err
+		}
+		if err := rm.AppendReflog(refPath, oldHash, hash, identity, message); err != nil {
+			return err
+		}
+	} else {
+		if err := rm.SetRef("HEAD", hash); err != nil {
+			return err
+		}
+	}
+
+	return rm.AppendReflog("HEAD", oldHash, hash, identity, message)
+}
+
+// DropReflogEntry removes entry n (0 is the newest) from the reflog of
+// refPath, rewriting the entry after it so the log stays a chain, and
+// points the ref at the newest remaining entry. If no entries remain, the
+// ref is deleted. This is how stash entries are dropped.
+func (rm *RefManager) DropReflogEntry(refPath string, n int) error {
+	content, err := os.ReadFile(rm.reflogPath(refPath))
+	if err != nil {
+		return fmt.Errorf("failed to read reflog: %w", err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if _, ok := parseReflogLine(line); ok {
+			lines = append(lines, line)
+		}
+	}
+	pos := len(lines) - 1 - n
+	if n < 0 || pos < 0 {
+		return fmt.Errorf("log for '%s' only has %d entries", refPath, len(lines))
+	}
+
+	// The entry that followed the dropped one now starts where it started
+	if pos+1 < len(lines) {
+		lines[pos+1] = lines[pos][:40] + lines[pos+1][40:]
+	}
+	lines = append(lines[:pos], lines[pos+1:]...)
+
+	if len(lines) == 0 {
+		return rm.DeleteRef(refPath)
+	}
+	if err := os.WriteFile(rm.reflogPath(refPath), []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write reflog: %w", err)
+	}
+	newest, _ := parseReflogLine(lines[len(lines)-1])
+	return rm.SetRef(refPath, newest.NewHash)
+}
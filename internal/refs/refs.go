@@ -4,9 +4,16 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
+// Ref is a named reference and the object it points to.
+type Ref struct {
+	Name string // full ref path, e.g. refs/heads/main
+	Hash string
+}
+
 type RefManager struct {
 	GitDir string
 }
@@ -47,7 +54,11 @@ func (rm *RefManager) GetRef(refPath string) (string, error) {
 	return strings.TrimSpace(string(content)), nil
 }
 
+// SetRef points a ref at hash, creating it if needed.
 func (rm *RefManager) SetRef(refPath, hash string) error {
+	if err := CheckRefName(refPath); err != nil {
+		return err
+	}
 	fullPath := filepath.Join(rm.GitDir, refPath)
 
 	// Create directory if it doesn't exist
@@ -95,3 +106,109 @@ func (rm *RefManager) SetHEAD(refPath string) error {
 	headContent := fmt.Sprintf("ref: %s", refPath)
 	return os.WriteFile(headPath, []byte(headContent), 0644)
 }
+
+// CheckRefName applies the main rules of git-check-ref-format to a ref
+// name, full or short. Besides keeping names unambiguous in revisions,
+// they keep a ref inside the refs directory: "." and ".." components and
+// leading slashes are rejected.
+func CheckRefName(name string) error {
+	bad := name == "" || strings.HasPrefix(name, "-") || strings.HasPrefix(name, "/") ||
+		strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".") || strings.HasSuffix(name, ".lock") ||
+		strings.Contains(name, "..") || strings.Contains(name, "@{") || strings.Contains(name, "//") ||
+		strings.Contains(name, "/.") || strings.HasPrefix(name, ".")
+	for _, r := range name {
+		if r <= ' ' || r == 0x7f || strings.ContainsRune("~^:?*[\\", r) {
+			bad = true
+		}
+	}
+	if bad {
+		return fmt.Errorf("'%s' is not a valid ref name", name)
+	}
+	return nil
+}
+
+// ResolveRef looks a short ref name up the same way Git does, trying the
+// name as given and then under refs/, refs/tags/, refs/heads/ and refs/remotes/.
+// It returns the full ref path and the hash it points to.
+func (rm *RefManager) ResolveRef(name string) (string, string, error) {
+	if name == "HEAD" {
+		hash, err := rm.GetHEAD()
+		return "HEAD", hash, err
+	}
+
+	// Pseudo-refs such as ORIG_HEAD live directly in the git directory
+	if strings.HasSuffix(name, "_HEAD") && strings.ToUpper(name) == name {
+		hash, err := rm.GetRef(name)
+		return name, hash, err
+	}
+
+	candidates := []string{
+		name,
+		"refs/" + name,
+		"refs/tags/" + name,
+		"refs/heads/" + name,
+		"refs/remotes/" + name,
+	}
+	for _, candidate := range candidates {
+		if !strings.HasPrefix(candidate, "refs/") {
+			continue
+		}
+		hash, err := rm.GetRef(candidate)
+		if err != nil {
+			return "", "", err
+		}
+		if hash != "" {
+			return candidate, hash, nil
+		}
+	}
+
+	return "", "", nil
+}
+
+// DeleteRef removes a ref together with its reflog.
+func (rm *RefManager) DeleteRef(refPath string) error {
+	if err := CheckRefName(refPath); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(rm.GitDir, refPath)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete ref %s: %w", refPath, err)
+	}
+	if err := os.Remove(rm.reflogPath(refPath)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete reflog of %s: %w", refPath, err)
+	}
+	return nil
+}
+
+// ListRefs returns the refs under prefix (such as "refs/tags/"), sorted by
+// name. An empty prefix lists every ref under refs/.
+func (rm *RefManager) ListRefs(prefix string) ([]Ref, error) {
+	root := filepath.Join(rm.GitDir, "refs")
+	var list []Ref
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(rm.GitDir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		hash, err := rm.GetRef(name)
+		if err != nil {
+			return err
+		}
+		list = append(list, Ref{Name: name, Hash: hash})
+		return nil
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, err
+}
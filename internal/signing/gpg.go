@@ -0,0 +1,78 @@
+package signing
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func gpgProgram(opts Options) string {
+	if opts.GPGProgram != "" {
+		return opts.GPGProgram
+	}
+	return "gpg"
+}
+
+// gpgSign makes a detached, armored OpenPGP signature the way Git does,
+// with `gpg --status-fd=2 -bsau <key>`.
+func gpgSign(opts Options, payload []byte) (string, error) {
+	key := opts.SigningKey
+	if key == "" {
+		key = opts.Identity
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(gpgProgram(opts), "--status-fd=2", "-bsau", key)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil || !strings.Contains(stderr.String(), "[GNUPG:] SIG_CREATED ") {
+		return "", fmt.Errorf("gpg failed to sign the data:\n%s", strings.TrimSpace(stderr.String()))
+	}
+
+	// gpg may use CRLF line endings on some platforms
+	return strings.ReplaceAll(stdout.String(), "\r\n", "\n"), nil
+}
+
+// gpgVerify checks a detached OpenPGP signature against the keys in the
+// user's keyring.
+func gpgVerify(opts Options, payload []byte, signature string) (*Result, error) {
+	sigFile, err := os.CreateTemp("", "mygit-sig-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(sigFile.Name())
+	if _, err := sigFile.WriteString(signature); err != nil {
+		sigFile.Close()
+		return nil, err
+	}
+	sigFile.Close()
+
+	var status, report bytes.Buffer
+	cmd := exec.Command(gpgProgram(opts), "--keyid-format=long", "--status-fd=1", "--verify", sigFile.Name(), "-")
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = &status
+	cmd.Stderr = &report
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return nil, fmt.Errorf("could not run gpg: %w", err)
+		}
+	}
+
+	good := false
+	for _, line := range strings.Split(status.String(), "\n") {
+		switch {
+		case strings.HasPrefix(line, "[GNUPG:] GOODSIG "):
+			good = true
+		case strings.HasPrefix(line, "[GNUPG:] BADSIG "),
+			strings.HasPrefix(line, "[GNUPG:] ERRSIG "),
+			strings.HasPrefix(line, "[GNUPG:] EXPSIG "),
+			strings.HasPrefix(line, "[GNUPG:] REVKEYSIG "):
+			return &Result{Good: false, Output: strings.TrimSpace(report.String())}, nil
+		}
+	}
+	return &Result{Good: good, Output: strings.TrimSpace(report.String())}, nil
+}
@@ -0,0 +1,74 @@
+// Package signing creates and verifies the signatures carried by signed
+// commits and tags, in the formats Git uses: OpenPGP signatures made by
+// gpg and SSH signatures in the SSHSIG format.
+package signing
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Signature formats, as set by gpg.format.
+const (
+	FormatOpenPGP = "openpgp"
+	FormatSSH     = "ssh"
+)
+
+// Namespace is the SSHSIG namespace Git signs commits and tags in.
+const Namespace = "git"
+
+// Options configures signing and verification. Apart from SignedAt, the
+// fields mirror Git's configuration settings.
+type Options struct {
+	Format         string    // gpg.format: "openpgp" (default) or "ssh"
+	SigningKey     string    // user.signingKey: a gpg key id, or an ssh key file or "key::<public key>"
+	GPGProgram     string    // gpg.program; defaults to "gpg"
+	SSHProgram     string    // gpg.ssh.program; if empty, ed25519 keys are used in-process and others via ssh-keygen
+	AllowedSigners string    // gpg.ssh.allowedSignersFile
+	Identity       string    // "Name <email>" of the signer, the default gpg key
+	SignedAt       time.Time // when a signature being verified was made; zero means now
+}
+
+// Result is the outcome of verifying a signature.
+type Result struct {
+	Good   bool   // the signature is valid and made by a trusted key
+	Output string // a human-readable report, one or more lines
+}
+
+// Sign signs payload and returns the armored signature, ending in a newline.
+func Sign(opts Options, payload []byte) (string, error) {
+	switch strings.ToLower(opts.Format) {
+	case "", FormatOpenPGP:
+		return gpgSign(opts, payload)
+	case FormatSSH:
+		return sshSign(opts, payload)
+	default:
+		return "", fmt.Errorf("unsupported value for gpg.format: %s", opts.Format)
+	}
+}
+
+// Verify checks an armored signature over payload. The format is taken from
+// the signature itself, not from opts.Format.
+func Verify(opts Options, payload []byte, signature string) (*Result, error) {
+	switch DetectFormat(signature) {
+	case FormatSSH:
+		return sshVerify(opts, payload, signature)
+	case FormatOpenPGP:
+		return gpgVerify(opts, payload, signature)
+	default:
+		return nil, fmt.Errorf("unknown signature format")
+	}
+}
+
+// DetectFormat tells the format of an armored signature from its first line.
+func DetectFormat(signature string) string {
+	switch {
+	case strings.HasPrefix(signature, sshArmorBegin):
+		return FormatSSH
+	case strings.HasPrefix(signature, "-----BEGIN PGP SIGNATURE-----"),
+		strings.HasPrefix(signature, "-----BEGIN PGP MESSAGE-----"):
+		return FormatOpenPGP
+	}
+	return ""
+}
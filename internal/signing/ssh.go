@@ -0,0 +1,564 @@
+package signing
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SSHSIG is specified in OpenSSH's PROTOCOL.sshsig. A signature is an
+// armored blob holding the public key, the namespace, the hash algorithm
+// and an SSH signature over a wrapper around the hash of the message.
+const (
+	sshArmorBegin  = "-----BEGIN SSH SIGNATURE-----"
+	sshArmorEnd    = "-----END SSH SIGNATURE-----"
+	sshSigMagic    = "SSHSIG"
+	sshSigVersion  = 1
+	sshSigHashAlgo = "sha512"
+	sshArmorWidth  = 70
+)
+
+// sshSignature is a decoded SSHSIG blob.
+type sshSignature struct {
+	publicKey []byte // SSH wire-format public key
+	namespace string
+	hashAlgo  string
+	signature []byte // SSH wire-format signature
+}
+
+// sshSign signs payload with the key named by user.signingKey, either
+// in-process (unencrypted ed25519 keys) or with ssh-keygen.
+func sshSign(opts Options, payload []byte) (string, error) {
+	key := opts.SigningKey
+	if key == "" {
+		return "", fmt.Errorf("user.signingkey needs to be set for ssh signing")
+	}
+
+	if opts.SSHProgram == "" && !strings.HasPrefix(key, "key::") {
+		if priv, ok := loadEd25519Key(expandHome(key)); ok {
+			return signEd25519(priv, payload), nil
+		}
+	}
+	return sshKeygenSign(opts, key, payload)
+}
+
+// sshKeygenSign signs payload by running `ssh-keygen -Y sign`.
+func sshKeygenSign(opts Options, key string, payload []byte) (string, error) {
+	program := opts.SSHProgram
+	if program == "" {
+		program = "ssh-keygen"
+	}
+
+	dir, err := os.MkdirTemp("", "mygit-sign-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{"-Y", "sign", "-n", Namespace}
+	if literal, ok := strings.CutPrefix(key, "key::"); ok {
+		// A literal public key: the private key must be in the agent
+		keyFile := filepath.Join(dir, "key.pub")
+		if err := os.WriteFile(keyFile, []byte(literal+"\n"), 0600); err != nil {
+			return "", err
+		}
+		args = append(args, "-U", "-f", keyFile)
+	} else {
+		args = append(args, "-f", expandHome(key))
+	}
+
+	dataFile := filepath.Join(dir, "payload")
+	if err := os.WriteFile(dataFile, payload, 0600); err != nil {
+		return "", err
+	}
+	args = append(args, dataFile)
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(program, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("ssh-keygen failed to sign the data:\n%s", strings.TrimSpace(stderr.String()))
+	}
+
+	sig, err := os.ReadFile(dataFile + ".sig")
+	if err != nil {
+		return "", fmt.Errorf("ssh-keygen did not write a signature: %w", err)
+	}
+	return string(sig), nil
+}
+
+// signEd25519 makes an SSHSIG signature with an ed25519 private key.
+func signEd25519(priv ed25519.PrivateKey, payload []byte) string {
+	pub := priv.Public().(ed25519.PublicKey)
+	var pubBlob bytes.Buffer
+	writeString(&pubBlob, []byte("ssh-ed25519"))
+	writeString(&pubBlob, pub)
+
+	raw := ed25519.Sign(priv, signedData(Namespace, sshSigHashAlgo, payload))
+	var sigBlob bytes.Buffer
+	writeString(&sigBlob, []byte("ssh-ed25519"))
+	writeString(&sigBlob, raw)
+
+	var blob bytes.Buffer
+	blob.WriteString(sshSigMagic)
+	binary.Write(&blob, binary.BigEndian, uint32(sshSigVersion))
+	writeString(&blob, pubBlob.Bytes())
+	writeString(&blob, []byte(Namespace))
+	writeString(&blob, nil) // reserved
+	writeString(&blob, []byte(sshSigHashAlgo))
+	writeString(&blob, sigBlob.Bytes())
+
+	return armorSSH(blob.Bytes())
+}
+
+// signedData is the message an SSHSIG signature actually signs.
+func signedData(namespace, hashAlgo string, payload []byte) []byte {
+	var digest []byte
+	if hashAlgo == "sha256" {
+		sum := sha256.Sum256(payload)
+		digest = sum[:]
+	} else {
+		sum := sha512.Sum512(payload)
+		digest = sum[:]
+	}
+
+	var b bytes.Buffer
+	b.WriteString(sshSigMagic)
+	writeString(&b, []byte(namespace))
+	writeString(&b, nil) // reserved
+	writeString(&b, []byte(hashAlgo))
+	writeString(&b, digest)
+	return b.Bytes()
+}
+
+// sshVerify checks an SSHSIG signature and looks its key up in the
+// allowed signers file.
+func sshVerify(opts Options, payload []byte, armored string) (*Result, error) {
+	if opts.AllowedSigners == "" {
+		return nil, fmt.Errorf("gpg.ssh.allowedSignersFile needs to be configured and exist for ssh signature verification")
+	}
+
+	sig, err := parseSSHSignature(armored)
+	if err != nil {
+		return nil, err
+	}
+	keyType, fingerprint := describeKey(sig.publicKey)
+
+	if sig.namespace != Namespace {
+		return &Result{Output: fmt.Sprintf("Signature namespace %q does not match %q\nCould not verify signature.", sig.namespace, Namespace)}, nil
+	}
+	if err := verifySSHSignature(sig.publicKey, sig.signature, signedData(sig.namespace, sig.hashAlgo, payload)); err != nil {
+		return &Result{Output: fmt.Sprintf("BAD signature with %s key %s: %v\nCould not verify signature.", keyType, fingerprint, err)}, nil
+	}
+
+	when := opts.SignedAt
+	if when.IsZero() {
+		when = time.Now()
+	}
+	principal, err := findPrincipal(expandHome(opts.AllowedSigners), sig.publicKey, when)
+	if err != nil {
+		return nil, err
+	}
+	if principal == "" {
+		return &Result{Output: fmt.Sprintf("Good %q signature with %s key %s\nNo principal matched.", Namespace, keyType, fingerprint)}, nil
+	}
+	return &Result{
+		Good:   true,
+		Output: fmt.Sprintf("Good %q signature for %s with %s key %s", Namespace, principal, keyType, fingerprint),
+	}, nil
+}
+
+// parseSSHSignature decodes an armored SSHSIG signature.
+func parseSSHSignature(armored string) (*sshSignature, error) {
+	body := strings.TrimSpace(armored)
+	body, ok := strings.CutPrefix(body, sshArmorBegin)
+	if !ok {
+		return nil, fmt.Errorf("not an SSH signature")
+	}
+	body, ok = strings.CutSuffix(body, sshArmorEnd)
+	if !ok {
+		return nil, fmt.Errorf("unterminated SSH signature")
+	}
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH signature encoding: %w", err)
+	}
+
+	if !bytes.HasPrefix(blob, []byte(sshSigMagic)) {
+		return nil, fmt.Errorf("invalid SSH signature: missing magic")
+	}
+	r := &wireReader{buf: blob[len(sshSigMagic):]}
+	version := r.uint32()
+	sig := &sshSignature{
+		publicKey: r.string(),
+		namespace: string(r.string()),
+	}
+	r.string() // reserved
+	sig.hashAlgo = string(r.string())
+	sig.signature = r.string()
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid SSH signature: %w", r.err)
+	}
+	if version != sshSigVersion {
+		return nil, fmt.Errorf("unsupported SSH signature version %d", version)
+	}
+	if sig.hashAlgo != "sha256" && sig.hashAlgo != "sha512" {
+		return nil, fmt.Errorf("unsupported SSH signature hash algorithm %s", sig.hashAlgo)
+	}
+	return sig, nil
+}
+
+// verifySSHSignature checks an SSH wire-format signature made by an
+// ed25519, RSA or ECDSA public key.
+func verifySSHSignature(pubBlob, sigBlob, data []byte) error {
+	pr := &wireReader{buf: pubBlob}
+	keyType := string(pr.string())
+	sr := &wireReader{buf: sigBlob}
+	sigType := string(sr.string())
+	raw := sr.string()
+	if sr.err != nil {
+		return sr.err
+	}
+
+	switch keyType {
+	case "ssh-ed25519":
+		pub := pr.string()
+		if pr.err != nil || len(pub) != ed25519.PublicKeySize || sigType != keyType {
+			return fmt.Errorf("malformed ed25519 key or signature")
+		}
+		if !ed25519.Verify(pub, data, raw) {
+			return fmt.Errorf("incorrect signature")
+		}
+		return nil
+
+	case "ssh-rsa":
+		e := new(big.Int).SetBytes(pr.string())
+		n := new(big.Int).SetBytes(pr.string())
+		if pr.err != nil {
+			return pr.err
+		}
+		pub := &rsa.PublicKey{N: n, E: int(e.Int64())}
+		switch sigType {
+		case "rsa-sha2-256":
+			sum := sha256.Sum256(data)
+			return rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], raw)
+		case "rsa-sha2-512":
+			sum := sha512.Sum512(data)
+			return rsa.VerifyPKCS1v15(pub, crypto.SHA512, sum[:], raw)
+		}
+		return fmt.Errorf("unsupported RSA signature type %s", sigType)
+
+	case "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521":
+		pr.string() // curve name
+		point := pr.string()
+		if pr.err != nil {
+			return pr.err
+		}
+		var curve elliptic.Curve
+		var digest []byte
+		switch keyType {
+		case "ecdsa-sha2-nistp256":
+			curve = elliptic.P256()
+			sum := sha256.Sum256(data)
+			digest = sum[:]
+		case "ecdsa-sha2-nistp384":
+			curve = elliptic.P384()
+			sum := sha512.Sum384(data)
+			digest = sum[:]
+		default:
+			curve = elliptic.P521()
+			sum := sha512.Sum512(data)
+			digest = sum[:]
+		}
+		x, y := elliptic.Unmarshal(curve, point)
+		if x == nil {
+			return fmt.Errorf("malformed ECDSA key")
+		}
+		rr := &wireReader{buf: raw}
+		rInt := new(big.Int).SetBytes(rr.string())
+		sInt := new(big.Int).SetBytes(rr.string())
+		if rr.err != nil {
+			return rr.err
+		}
+		if !ecdsa.Verify(&ecdsa.PublicKey{Curve: curve, X: x, Y: y}, digest, rInt, sInt) {
+			return fmt.Errorf("incorrect signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported key type %s", keyType)
+}
+
+// describeKey returns the key type as ssh-keygen prints it (ED25519, RSA,
+// ECDSA) and the SHA256 fingerprint of a wire-format public key.
+func describeKey(pubBlob []byte) (string, string) {
+	r := &wireReader{buf: pubBlob}
+	keyType := string(r.string())
+	name := strings.ToUpper(keyType)
+	switch {
+	case keyType == "ssh-ed25519":
+		name = "ED25519"
+	case keyType == "ssh-rsa":
+		name = "RSA"
+	case strings.HasPrefix(keyType, "ecdsa-"):
+		name = "ECDSA"
+	}
+	sum := sha256.Sum256(pubBlob)
+	return name, "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// findPrincipal returns the first principal the allowed signers file
+// lists for the given public key at the time the signature was made, or ""
+// if it lists none. Entries restricted to other namespaces, or to a
+// validity window that does not contain when, are skipped, and so are
+// cert-authority entries: they trust certificates signed by the key, which
+// are not supported, not signatures made by the key itself.
+//
+// Each line of the file reads "<principals> [<options>] <keytype> <key>",
+// as described in ssh-keygen(1).
+func findPrincipal(allowedSigners string, pubBlob []byte, when time.Time) (string, error) {
+	file, err := os.Open(allowedSigners)
+	if err != nil {
+		return "", fmt.Errorf("could not read allowed signers file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := splitQuoted(line, " \t")
+		if len(fields) < 3 {
+			continue
+		}
+
+		principals, rest := fields[0], fields[1:]
+		options := ""
+		if !isKeyType(rest[0]) {
+			options, rest = rest[0], rest[1:]
+		}
+		if len(rest) < 2 || !isKeyType(rest[0]) {
+			continue
+		}
+		if !entryApplies(parseSignerOptions(options), when) {
+			continue
+		}
+
+		key, err := base64.StdEncoding.DecodeString(rest[1])
+		if err != nil || !bytes.Equal(key, pubBlob) {
+			continue
+		}
+		principal, _, _ := strings.Cut(principals, ",")
+		return principal, nil
+	}
+	return "", scanner.Err()
+}
+
+func isKeyType(s string) bool {
+	return strings.HasPrefix(s, "ssh-") || strings.HasPrefix(s, "ecdsa-") || strings.HasPrefix(s, "sk-")
+}
+
+// parseSignerOptions splits the options field of an allowed signers entry,
+// such as `cert-authority,namespaces="file,git"`, into lowercase option
+// names and their unquoted values. Commas inside quotes do not separate
+// options.
+func parseSignerOptions(options string) map[string]string {
+	parsed := make(map[string]string)
+	for _, opt := range splitQuoted(options, ",") {
+		name, value, _ := strings.Cut(opt, "=")
+		parsed[strings.ToLower(name)] = strings.Trim(value, `"`)
+	}
+	return parsed
+}
+
+// entryApplies reports whether an allowed signers entry with the given
+// options trusts its key for git signatures made at when.
+func entryApplies(options map[string]string, when time.Time) bool {
+	if _, ok := options["cert-authority"]; ok {
+		return false
+	}
+	if namespaces, ok := options["namespaces"]; ok {
+		allowed := false
+		for _, ns := range strings.Split(namespaces, ",") {
+			if ns == Namespace || ns == "*" {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	if value, ok := options["valid-after"]; ok {
+		after, err := parseSignerTime(value)
+		if err != nil || when.Before(after) {
+			return false
+		}
+	}
+	if value, ok := options["valid-before"]; ok {
+		before, err := parseSignerTime(value)
+		if err != nil || when.After(before) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSignerTime parses the timestamp of a valid-after or valid-before
+// option: YYYYMMDD or YYYYMMDDHHMM[SS], in local time unless it ends
+// in "Z".
+func parseSignerTime(value string) (time.Time, error) {
+	loc := time.Local
+	if v, ok := strings.CutSuffix(value, "Z"); ok {
+		value, loc = v, time.UTC
+	}
+	for _, layout := range []string{"20060102", "200601021504", "20060102150405"} {
+		if len(value) == len(layout) {
+			return time.ParseInLocation(layout, value, loc)
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+}
+
+// splitQuoted splits s at any of the separator characters outside double
+// quotes, dropping empty fields.
+func splitQuoted(s, separators string) []string {
+	var fields []string
+	var current strings.Builder
+	inQuotes := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			current.WriteRune(r)
+		case strings.ContainsRune(separators, r) && !inQuotes:
+			if current.Len() > 0 {
+				fields = append(fields, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		fields = append(fields, current.String())
+	}
+	return fields
+}
+
+// loadEd25519Key reads an unencrypted OpenSSH ed25519 private key. If path
+// names the public key (.pub), the private key next to it is used.
+func loadEd25519Key(path string) (ed25519.PrivateKey, bool) {
+	data, err := os.ReadFile(strings.TrimSuffix(path, ".pub"))
+	if err != nil {
+		return nil, false
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "OPENSSH PRIVATE KEY" {
+		return nil, false
+	}
+
+	const magic = "openssh-key-v1\x00"
+	if !bytes.HasPrefix(block.Bytes, []byte(magic)) {
+		return nil, false
+	}
+	r := &wireReader{buf: block.Bytes[len(magic):]}
+	cipher := string(r.string())
+	kdf := string(r.string())
+	r.string() // kdf options
+	count := r.uint32()
+	r.string() // public key
+	private := r.string()
+	if r.err != nil || cipher != "none" || kdf != "none" || count != 1 {
+		return nil, false
+	}
+
+	pr := &wireReader{buf: private}
+	check1, check2 := pr.uint32(), pr.uint32()
+	keyType := string(pr.string())
+	pr.string() // public key
+	priv := pr.string()
+	if pr.err != nil || check1 != check2 || keyType != "ssh-ed25519" || len(priv) != ed25519.PrivateKeySize {
+		return nil, false
+	}
+	return ed25519.PrivateKey(priv), true
+}
+
+// armorSSH wraps an SSHSIG blob in its armor, as ssh-keygen writes it.
+func armorSSH(blob []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(blob)
+	var b strings.Builder
+	b.WriteString(sshArmorBegin + "\n")
+	for len(encoded) > sshArmorWidth {
+		b.WriteString(encoded[:sshArmorWidth] + "\n")
+		encoded = encoded[sshArmorWidth:]
+	}
+	b.WriteString(encoded + "\n")
+	b.WriteString(sshArmorEnd + "\n")
+	return b.String()
+}
+
+// writeString appends an SSH wire-format string (length-prefixed bytes).
+func writeString(b *bytes.Buffer, s []byte) {
+	binary.Write(b, binary.BigEndian, uint32(len(s)))
+	b.Write(s)
+}
+
+// wireReader reads SSH wire-format values, remembering the first error.
+type wireReader struct {
+	buf []byte
+	err error
+}
+
+func (r *wireReader) uint32() uint32 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.buf) < 4 {
+		r.err = fmt.Errorf("unexpected end of data")
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.buf)
+	r.buf = r.buf[4:]
+	return v
+}
+
+func (r *wireReader) string() []byte {
+	n := r.uint32()
+	if r.err != nil {
+		return nil
+	}
+	if uint32(len(r.buf)) < n {
+		r.err = fmt.Errorf("unexpected end of data")
+		return nil
+	}
+	s := r.buf[:n]
+	r.buf = r.buf[n:]
+	return s
+}
+
+// expandHome replaces a leading "~/" with the user's home directory.
+func expandHome(p string) string {
+	if rest, ok := strings.CutPrefix(p, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return p
+}
@@ -0,0 +1,22 @@
+// Package trace prints debugging messages for mygit's internals.
+package trace
+
+import (
+	"fmt"
+	"os"
+)
+
+// enabled is read once: tracing is on when MYGIT_TRACE is set to anything
+// other than "", "0" or "false", like GIT_TRACE.
+var enabled = func() bool {
+	v := os.Getenv("MYGIT_TRACE")
+	return v != "" && v != "0" && v != "false"
+}()
+
+// Printf prints a debugging message when tracing is enabled. It goes to
+// standard error so that it never mixes with the output of a command.
+func Printf(format string, args ...any) {
+	if enabled {
+		fmt.Fprintf(os.Stderr, format, args...)
+	}
+}
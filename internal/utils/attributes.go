@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"mygit/internal/config"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// attrRule is a single line of an attributes file: a pattern and the
+// attributes it sets.
+type attrRule struct {
+	pattern *ignorePattern
+	attrs   []attrValue
+}
+
+// attrValue is one attribute of a rule. An empty value with unspecified
+// set takes back what less specific rules said ("!attr").
+type attrValue struct {
+	name        string
+	value       string // "true" when set, "false" when unset ("-attr")
+	unspecified bool
+}
+
+// Attributes represents the attributes of paths, following
+// gitattributes(5). Rules are read from, in increasing order of
+// precedence: the file named by core.attributesFile, the .gitattributes
+// file of every directory (deeper directories take precedence over their
+// parents), and .mygit/info/attributes. Per-directory files are added by
+// the caller, so that they can come from a tree as well as the working
+// directory.
+type Attributes struct {
+	global []*attrRule
+	info   []*attrRule
+	perDir map[string][]*attrRule // directory -> rules of its .gitattributes
+}
+
+// NewAttributes creates an Attributes instance for the repository with the
+// given .mygit directory, reading the global and info/attributes files.
+// Macros ("[attr]name ...") are not supported and are skipped.
+func NewAttributes(gitDir string) (*Attributes, error) {
+	a := &Attributes{perDir: make(map[string][]*attrRule)}
+
+	cfg := config.NewConfig(filepath.Join(gitDir, "config"))
+	if err := cfg.Load(); err != nil {
+		return nil, err
+	}
+	globalFile, ok := cfg.Get("core.attributesFile")
+	if ok {
+		globalFile = expandHome(globalFile)
+	} else {
+		globalFile = defaultAttributesFile()
+	}
+	if globalFile != "" {
+		if content, err := os.ReadFile(globalFile); err == nil {
+			a.global = parseAttributes(content, "")
+		}
+	}
+	if content, err := os.ReadFile(filepath.Join(gitDir, "info", "attributes")); err == nil {
+		a.info = parseAttributes(content, "")
+	}
+	return a, nil
+}
+
+// AddFile adds the rules of the .gitattributes file in dir ("" for the
+// top of the repository).
+func (a *Attributes) AddFile(dir string, content []byte) {
+	a.perDir[dir] = parseAttributes(content, dir)
+}
+
+// Get returns the value of an attribute for a path relative to the
+// repository root: "true" if it is set, "false" if it is unset, or the
+// value given to it. It reports false if the attribute is unspecified.
+func (a *Attributes) Get(p string, isDir bool, name string) (string, bool) {
+	if v, found := lookupAttr(a.info, p, isDir, name); found {
+		return v.value, !v.unspecified
+	}
+	dir := path.Dir(p)
+	for {
+		if dir == "." {
+			dir = ""
+		}
+		if v, found := lookupAttr(a.perDir[dir], p, isDir, name); found {
+			return v.value, !v.unspecified
+		}
+		if dir == "" {
+			break
+		}
+		dir = path.Dir(dir)
+	}
+	if v, found := lookupAttr(a.global, p, isDir, name); found {
+		return v.value, !v.unspecified
+	}
+	return "", false
+}
+
+// IsSet reports whether an attribute is set for a path.
+func (a *Attributes) IsSet(p string, isDir bool, name string) bool {
+	value, ok := a.Get(p, isDir, name)
+	return ok && value == "true"
+}
+
+// lookupAttr returns what the last rule matching the path says about an
+// attribute, and whether any rule does.
+func lookupAttr(rules []*attrRule, p string, isDir bool, name string) (attrValue, bool) {
+	for j := len(rules) - 1; j >= 0; j-- {
+		rule := rules[j]
+		if !rule.pattern.matches(p, isDir) {
+			continue
+		}
+		for k := len(rule.attrs) - 1; k >= 0; k-- {
+			if rule.attrs[k].name == name {
+				return rule.attrs[k], true
+			}
+		}
+	}
+	return attrValue{}, false
+}
+
+// parseAttributes parses the content of an attributes file whose patterns
+// are relative to base.
+func parseAttributes(content []byte, base string) []*attrRule {
+	var rules []*attrRule
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "[attr]") {
+			continue
+		}
+		// Negative patterns are not allowed in attributes files
+		if strings.HasPrefix(fields[0], "!") {
+			continue
+		}
+		pattern := parseIgnorePattern(fields[0])
+		if pattern == nil {
+			continue
+		}
+		pattern.base = base
+
+		rule := &attrRule{pattern: pattern}
+		for _, field := range fields[1:] {
+			switch {
+			case strings.HasPrefix(field, "-"):
+				rule.attrs = append(rule.attrs, attrValue{name: field[1:], value: "false"})
+			case strings.HasPrefix(field, "!"):
+				rule.attrs = append(rule.attrs, attrValue{name: field[1:], unspecified: true})
+			default:
+				name, value, ok := strings.Cut(field, "=")
+				if !ok {
+					value = "true"
+				}
+				rule.attrs = append(rule.attrs, attrValue{name: name, value: value})
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// defaultAttributesFile is where Git looks for a global attributes file
+// when core.attributesFile is not set.
+func defaultAttributesFile() string {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "git", "attributes")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "git", "attributes")
+	}
+	return ""
+}
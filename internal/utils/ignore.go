@@ -2,90 +2,374 @@ package utils
 
 import (
 	"bufio"
+	"mygit/internal/config"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 )
 
-// Ignore represents a set of .gitignore patterns.
+// ignorePattern is a single line of an ignore file.
+type ignorePattern struct {
+	text     string // the pattern as written, for check-ignore -v
+	source   string // file the pattern was read from
+	line     int    // 1-based line number in source
+	base     string // directory the pattern is relative to ("" for the root)
+	negate   bool   // "!pattern" re-includes what an earlier pattern excluded
+	dirOnly  bool   // "pattern/" only matches directories
+	anchored bool   // a slash in the pattern anchors it to base
+	re       *regexp.Regexp
+}
+
+// IgnoreMatch describes the pattern that decided whether a path is ignored.
+type IgnoreMatch struct {
+	Source  string
+	Line    int
+	Pattern string
+	Negated bool // the pattern re-included the path
+}
+
+// Ignore represents the ignore rules of a repository, following gitignore(5).
+// Patterns are read from, in increasing order of precedence: the file named
+// by core.excludesFile, .mygit/info/exclude, and the .gitignore file of every
+// directory (deeper directories take precedence over their parents).
+// Patterns given on the command line take precedence over all of them.
 type Ignore struct {
-	patterns []string
+	workDir string
+	cmdline []*ignorePattern
+	global  []*ignorePattern
+	exclude []*ignorePattern
+	perDir  map[string][]*ignorePattern // directory -> patterns of its .gitignore
+	noFiles bool                        // only the command line patterns apply
 }
 
-// NewIgnore creates a new Ignore instance by loading patterns from the .gitignore file
-// in the provided repository work directory.
+// NewIgnore creates a new Ignore instance for the repository rooted at workDir.
+// Per-directory .gitignore files are loaded lazily as paths are checked.
 func NewIgnore(workDir string) (*Ignore, error) {
-	gitignorePath := filepath.Join(workDir, ".gitignore")
+	ig := &Ignore{
+		workDir: workDir,
+		perDir:  make(map[string][]*ignorePattern),
+	}
+
+	gitDir := filepath.Join(workDir, ".mygit")
+	cfg := config.NewConfig(filepath.Join(gitDir, "config"))
+	if err := cfg.Load(); err != nil {
+		return nil, err
+	}
+
+	excludesFile, ok := cfg.Get("core.excludesFile")
+	if ok {
+		excludesFile = expandHome(excludesFile)
+	} else {
+		excludesFile = defaultExcludesFile()
+	}
+	if excludesFile != "" {
+		patterns, err := readIgnoreFile(excludesFile, excludesFile, "")
+		if err != nil {
+			return nil, err
+		}
+		ig.global = patterns
+	}
 
-	file, err := os.Open(gitignorePath)
+	patterns, err := readIgnoreFile(filepath.Join(gitDir, "info", "exclude"), ".mygit/info/exclude", "")
+	if err != nil {
+		return nil, err
+	}
+	ig.exclude = patterns
+
+	return ig, nil
+}
+
+// NewCommandLineIgnore creates an Ignore with only the given patterns and
+// none of the ignore files, as clean -x uses for its -e patterns.
+func NewCommandLineIgnore(workDir string, patterns []string) *Ignore {
+	ig := &Ignore{workDir: workDir, perDir: make(map[string][]*ignorePattern), noFiles: true}
+	ig.AddPatterns(patterns)
+	return ig
+}
+
+// AddPatterns adds patterns given on the command line, which take
+// precedence over the ignore files.
+func (i *Ignore) AddPatterns(patterns []string) {
+	for _, line := range patterns {
+		if pattern := parseIgnorePattern(line); pattern != nil {
+			pattern.source = "--exclude option"
+			i.cmdline = append(i.cmdline, pattern)
+		}
+	}
+}
+
+// IsIgnored checks if a given file path matches the ignore rules.
+// The path should be relative to the repository root.
+func (i *Ignore) IsIgnored(p string) bool {
+	isDir := false
+	if info, err := os.Lstat(filepath.Join(i.workDir, p)); err == nil {
+		isDir = info.IsDir()
+	}
+	return i.Matches(p, isDir)
+}
+
+// Matches is like IsIgnored for callers that already know whether the path
+// is a directory.
+func (i *Ignore) Matches(p string, isDir bool) bool {
+	match := i.Match(p, isDir)
+	return match != nil && !match.Negated
+}
+
+// Match returns the pattern that decides whether the path is ignored, or nil
+// if no pattern matches. A path inside an ignored directory is ignored by
+// that directory's pattern, since Git never looks inside excluded directories.
+func (i *Ignore) Match(p string, isDir bool) *IgnoreMatch {
+	p = strings.Trim(filepath.ToSlash(p), "/")
+
+	// Always ignore the .mygit directory itself.
+	if p == ".mygit" || strings.HasPrefix(p, ".mygit/") {
+		return &IgnoreMatch{Pattern: ".mygit"}
+	}
+
+	parts := strings.Split(p, "/")
+	for n := 1; n < len(parts); n++ {
+		parent := strings.Join(parts[:n], "/")
+		if match := i.matchPath(parent, true); match != nil && !match.Negated {
+			return match
+		}
+	}
+	return i.matchPath(p, isDir)
+}
+
+// matchPath checks a single path without looking at its parents.
+func (i *Ignore) matchPath(p string, isDir bool) *IgnoreMatch {
+	if match := matchPatterns(i.cmdline, p, isDir); match != nil {
+		return match
+	}
+
+	// Nearest .gitignore first, then up to the root
+	dir := path.Dir(p)
+	for {
+		if dir == "." {
+			dir = ""
+		}
+		if match := matchPatterns(i.dirPatterns(dir), p, isDir); match != nil {
+			return match
+		}
+		if dir == "" {
+			break
+		}
+		dir = path.Dir(dir)
+	}
+
+	if match := matchPatterns(i.exclude, p, isDir); match != nil {
+		return match
+	}
+	return matchPatterns(i.global, p, isDir)
+}
+
+// dirPatterns returns the patterns of the .gitignore file in dir, reading
+// it on first use.
+func (i *Ignore) dirPatterns(dir string) []*ignorePattern {
+	if i.noFiles {
+		return nil
+	}
+	if patterns, ok := i.perDir[dir]; ok {
+		return patterns
+	}
+
+	source := ".gitignore"
+	if dir != "" {
+		source = dir + "/.gitignore"
+	}
+	patterns, err := readIgnoreFile(filepath.Join(i.workDir, filepath.FromSlash(source)), source, dir)
+	if err != nil {
+		patterns = nil
+	}
+	i.perDir[dir] = patterns
+	return patterns
+}
+
+// matchPatterns returns the last pattern in the list that matches the path.
+func matchPatterns(patterns []*ignorePattern, p string, isDir bool) *IgnoreMatch {
+	for j := len(patterns) - 1; j >= 0; j-- {
+		pattern := patterns[j]
+		if pattern.matches(p, isDir) {
+			return &IgnoreMatch{
+				Source:  pattern.source,
+				Line:    pattern.line,
+				Pattern: pattern.text,
+				Negated: pattern.negate,
+			}
+		}
+	}
+	return nil
+}
+
+func (pt *ignorePattern) matches(p string, isDir bool) bool {
+	if pt.dirOnly && !isDir {
+		return false
+	}
+
+	rel := p
+	if pt.base != "" {
+		if !strings.HasPrefix(p, pt.base+"/") {
+			return false
+		}
+		rel = strings.TrimPrefix(p, pt.base+"/")
+	}
+
+	if !pt.anchored {
+		rel = path.Base(rel)
+	}
+	return pt.re.MatchString(rel)
+}
+
+// readIgnoreFile parses an ignore file. A missing file has no patterns.
+func readIgnoreFile(filename, source, base string) ([]*ignorePattern, error) {
+	file, err := os.Open(filename)
 	if err != nil {
 		if os.IsNotExist(err) {
-			// .gitignore not found, return an empty ignore list.
-			return &Ignore{patterns: []string{}}, nil
+			return nil, nil
 		}
 		return nil, err
 	}
 	defer file.Close()
 
-	var patterns []string
+	var patterns []*ignorePattern
+	lineNum := 0
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		// Ignore empty lines and comments.
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+		lineNum++
+		if pattern := parseIgnorePattern(scanner.Text()); pattern != nil {
+			pattern.source = source
+			pattern.line = lineNum
+			pattern.base = base
+			patterns = append(patterns, pattern)
 		}
-		patterns = append(patterns, line)
 	}
+	return patterns, scanner.Err()
+}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+// parseIgnorePattern parses one line of an ignore file, returning nil for
+// blank lines and comments.
+func parseIgnorePattern(line string) *ignorePattern {
+	line = strings.TrimSuffix(line, "\r")
+
+	// Trailing spaces are ignored unless escaped with a backslash
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
 	}
 
-	return &Ignore{patterns: patterns}, nil
-}
+	pattern := &ignorePattern{text: line}
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
 
-// IsIgnored checks if a given file path matches any of the loaded .gitignore patterns.
-// The path should be relative to the repository root.
-func (i *Ignore) IsIgnored(path string) bool {
-	// Always ignore the .mygit directory itself.
-	if strings.HasPrefix(path, ".mygit") {
-		return true
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		pattern.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return nil
 	}
 
-	path = filepath.ToSlash(path) // Normalize path to use forward slashes.
+	re, err := regexp.Compile("^" + globToRegexp(line) + "$")
+	if err != nil {
+		return nil
+	}
+	pattern.re = re
+	return pattern
+}
 
-	for _, pattern := range i.patterns {
-		// Handle directory patterns (e.g., "/logs/" or "node_modules/").
-		if strings.HasSuffix(pattern, "/") {
-			pattern = strings.TrimSuffix(pattern, "/") // Remove trailing slash.
-			// If the pattern starts with a slash, it should match from the root.
-			if strings.HasPrefix(pattern, "/") {
-				pattern = strings.TrimPrefix(pattern, "/")
-				if path == pattern || strings.HasPrefix(path, pattern+"/") {
-					return true
+// globToRegexp translates a gitignore glob into a regular expression.
+// "*" and "?" do not match "/", "**" matches across directories, and
+// bracket expressions support ranges and "!" or "^" negation.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				atStart := i == 0 || glob[i-1] == '/'
+				atEnd := i+2 == len(glob)
+				if atStart && atEnd {
+					b.WriteString(".*")
+					i++
+					continue
 				}
-			} else {
-				// Otherwise, it can match any directory with that name.
-				if path == pattern || strings.HasPrefix(path, pattern+"/") || strings.Contains(path, "/"+pattern+"/") {
-					return true
+				if atStart && glob[i+2] == '/' {
+					// "**/" matches zero or more leading directories
+					b.WriteString("(?:.*/)?")
+					i += 2
+					continue
 				}
 			}
-			continue // Skip other checks for this pattern.
-		}
-
-		// Use filepath.Match for glob pattern matching on the base name.
-		matched, err := filepath.Match(pattern, filepath.Base(path))
-		if err == nil && matched {
-			return true
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := i + 1
+			if end < len(glob) && (glob[end] == '!' || glob[end] == '^') {
+				end++
+			}
+			if end < len(glob) && glob[end] == ']' {
+				end++
+			}
+			for end < len(glob) && glob[end] != ']' {
+				end++
+			}
+			if end >= len(glob) {
+				b.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := glob[i+1 : end]
+			b.WriteByte('[')
+			if strings.HasPrefix(class, "!") || strings.HasPrefix(class, "^") {
+				b.WriteByte('^')
+				class = class[1:]
+			}
+			b.WriteString(strings.ReplaceAll(class, "\\", "\\\\"))
+			b.WriteByte(']')
+			i = end
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
 		}
+	}
+	return b.String()
+}
 
-		// Also check against the full path for patterns like `build/*`.
-		matched, err = filepath.Match(pattern, path)
-		if err == nil && matched {
-			return true
+// expandHome expands a leading "~/" to the user's home directory.
+func expandHome(p string) string {
+	if strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, p[2:])
 		}
 	}
+	return p
+}
 
-	return false
+// defaultExcludesFile is where Git looks for a global ignore file when
+// core.excludesFile is not set.
+func defaultExcludesFile() string {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "git", "ignore")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "git", "ignore")
+	}
+	return ""
 }
@@ -57,7 +57,7 @@ func GetTreeEntriesRecursive(objStore *objects.ObjectStore, treeHash, prefix str
 				Hash:        entry.Hash,
 				Size:        0,
 				ModTime:     time.Time{},
-				Permissions: 0644,
+				Permissions: objects.PermissionsFromMode(entry.Mode),
 			}
 		}
 	}
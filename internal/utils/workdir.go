@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"mygit/internal/config"
 	"mygit/internal/index"
 	"mygit/internal/objects"
 	"mygit/internal/repository"
@@ -9,27 +10,92 @@ import (
 	"path/filepath"
 )
 
+// WorktreeOptions controls how file modes are carried between the working
+// directory and the repository.
+type WorktreeOptions struct {
+	// FileMode (core.fileMode) makes the executable bit significant. When
+	// false, the mode recorded in the index is kept regardless of the file's
+	// permissions.
+	FileMode bool
+	// Symlinks (core.symlinks) makes checkout create symbolic links. When
+	// false, links are checked out as plain files containing the link target.
+	Symlinks bool
+}
+
+// LoadWorktreeOptions reads the core.fileMode and core.symlinks settings
+// of the repository. Both default to true.
+func LoadWorktreeOptions(repo *repository.GitRepository) WorktreeOptions {
+	cfg := config.NewConfig(filepath.Join(repo.GitDir, "config"))
+	if err := cfg.Load(); err != nil {
+		return WorktreeOptions{FileMode: true, Symlinks: true}
+	}
+	return WorktreeOptions{
+		FileMode: cfg.GetBool("core.fileMode", true),
+		Symlinks: cfg.GetBool("core.symlinks", true),
+	}
+}
+
+// ReadWorktreeFile returns the content Git would store for a file in the
+// working directory: the link target for a symbolic link, the file content
+// otherwise. It does not follow symbolic links.
+func ReadWorktreeFile(fullPath string) ([]byte, os.FileInfo, error) {
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(fullPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []byte(target), info, nil
+	}
+
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, info, nil
+}
+
+// WorktreePermissions returns the mode to record in the index for a file in
+// the working directory, given the entry currently in the index (if any).
+func WorktreePermissions(info os.FileInfo, existing *index.IndexEntry, opts WorktreeOptions) os.FileMode {
+	perm := info.Mode()
+
+	// Without symlink support a link is checked out as a plain file, so a
+	// plain file that the index knows as a link stays a link.
+	if !opts.Symlinks && existing != nil && existing.Permissions&os.ModeSymlink != 0 && perm.IsRegular() {
+		return existing.Permissions
+	}
+
+	if !opts.FileMode && perm&os.ModeSymlink == 0 {
+		perm &^= 0111
+		if existing != nil && existing.Permissions&os.ModeSymlink == 0 {
+			perm |= existing.Permissions & 0111
+		}
+	}
+	return perm
+}
+
 // GetUnstagedChanges compares the index with the working directory and returns a list of
 // file paths that have been modified or deleted in the working dir but not staged.
 func GetUnstagedChanges(repo *repository.GitRepository, idx *index.Index, objStore *objects.ObjectStore) ([]string, error) {
 	var modifiedFiles []string
+	opts := LoadWorktreeOptions(repo)
 
 	for path, entry := range idx.GetAll() {
 		fullPath := filepath.Join(repo.WorkDir, path)
 
-		_, err := os.Stat(fullPath)
+		// This is the most reliable check. We read the file's current content and hash it.
+		content, info, err := ReadWorktreeFile(fullPath)
 		if err != nil {
 			if os.IsNotExist(err) {
 				// File is in the index but not in the working directory -> deleted.
 				modifiedFiles = append(modifiedFiles, path)
+				continue
 			}
-			// For other errors, we might want to report them, but for now, we skip.
-			continue
-		}
-
-		// This is the most reliable check. We read the file's current content and hash it.
-		content, err := os.ReadFile(fullPath)
-		if err != nil {
 			return nil, fmt.Errorf("failed to read file %s for status check: %w", fullPath, err)
 		}
 
@@ -38,6 +104,13 @@ func GetUnstagedChanges(repo *repository.GitRepository, idx *index.Index, objSto
 		// If the hash is different, the file is modified.
 		if currentHash != entry.Hash {
 			modifiedFiles = append(modifiedFiles, path)
+			continue
+		}
+
+		// A changed file type or executable bit is a modification too.
+		perm := WorktreePermissions(info, entry, opts)
+		if objects.ModeFromPermissions(perm) != objects.ModeFromPermissions(entry.Permissions) {
+			modifiedFiles = append(modifiedFiles, path)
 		}
 	}
 